@@ -0,0 +1,70 @@
+package api
+
+import (
+	"authorization/pkg/storage"
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+const maxDisplayName = 64 // Наибольшая длина отображаемого имени в символах
+
+// displayNamePolicy Проверяет отображаемое имя и возвращает сообщения о нарушениях.
+// Пустое имя допустимо: тогда вместо него показывается логин.
+func displayNamePolicy(name string) []string {
+	var errorMessages []string
+	if utf8.RuneCountInString(name) > maxDisplayName {
+		errorMessages = append(errorMessages, "Имя не должно быть длиннее 64 символов")
+	}
+	if strings.IndexFunc(name, unicode.IsControl) >= 0 {
+		errorMessages = append(errorMessages, "Имя не должно содержать управляющих символов")
+	}
+	return errorMessages
+}
+
+// loginRefusal Причина, по которой пользователю с верными данными нельзя войти, или пустая строка.
+// Отключённый и заблокированный аккаунты не входят никогда, неподтверждённый адрес мешает входу,
+// только если включено WithEmailVerification.
+func (api *API) loginRefusal(ctx context.Context, username string) (string, error) {
+	c, err := api.db.GetAccount(ctx, username)
+	if errors.Is(err, storage.ErrNotFound) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	switch {
+	case c.Status == storage.StatusDisabled:
+		return "Аккаунт отключён администратором", nil
+	case c.Status == storage.StatusLocked:
+		return "Аккаунт заблокирован, обратитесь в поддержку", nil
+	case api.requireVerified && !c.EmailVerified:
+		return "Подтвердите адрес электронной почты по ссылке из письма", nil
+	}
+	return "", nil
+}
+
+// refuseLogin Ответ на вход, которому мешает состояние аккаунта.
+func refuseLogin(w http.ResponseWriter, message string) {
+	resp := storage.Response{
+		Success: false,
+		Message: message,
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusForbidden)
+	json.NewEncoder(w).Encode(resp)
+}
+
+// recordLogin Запоминает время входа. Ошибка не мешает входу.
+func (api *API) recordLogin(ctx context.Context, username string) {
+	if _, err := api.db.SetLastLogin(ctx, username, time.Now().UTC()); err != nil {
+		log.Println(err)
+	}
+}
@@ -2,8 +2,14 @@ package api
 
 import (
 	"authorization/pkg/check"
+	"authorization/pkg/jwt"
 	"authorization/pkg/storage"
+	"authorization/pkg/throttle"
+	"context"
+	"crypto/rand"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"github.com/gorilla/mux"
 	"io/ioutil"
 	"log"
@@ -11,6 +17,7 @@ import (
 	"path/filepath"
 	"strings"
 	"sync"
+	"time"
 )
 
 // API приложения.
@@ -18,14 +25,67 @@ type API struct {
 	r       *mux.Router       // Маршрутизатор запросов
 	db      storage.Interface // база данных
 	webRoot string            // Корневая директория для веб-приложения
+	issuer  string            // Издатель токенов, внешний адрес сервиса
+	keys    jwt.KeySet        // Ключи подписи токенов
+
+	adminToken string // Токен администратора для управления клиентами OAuth
+
+	mailer          Mailer // Отправка писем пользователям
+	requireVerified bool   // Вход только с подтверждённым адресом почты
+
+	throttle *throttle.Limiter // Защита входа от перебора паролей
+
+	deletionGrace time.Duration // Сколько удалённый аккаунт можно восстановить
+
+	credentialSecret []byte // Секрет подставных ключей доступа для неизвестных логинов
+}
+
+// Option Необязательная настройка API.
+type Option func(*API)
+
+// WithIssuer Задаёт издателя токенов (внешний адрес сервиса).
+func WithIssuer(issuer string) Option {
+	return func(api *API) {
+		api.issuer = strings.TrimSuffix(issuer, "/")
+	}
+}
+
+// WithKeys Задаёт ключи подписи токенов.
+func WithKeys(keys jwt.KeySet) Option {
+	return func(api *API) {
+		api.keys = keys
+	}
 }
 
 // New Конструктор API.
-func New(db storage.Interface, webRoot string) *API {
+func New(db storage.Interface, webRoot string, opts ...Option) *API {
 	api := API{
-		r:       mux.NewRouter(),
-		db:      db,
-		webRoot: webRoot,
+		r:        mux.NewRouter(),
+		db:       db,
+		webRoot:  webRoot,
+		issuer:   "http://127.0.0.1:5000",
+		mailer:   logMailer{},
+		throttle: throttle.New(throttle.NewMemoryStore()),
+
+		deletionGrace: defaultDeletionGrace,
+	}
+	for _, opt := range opts {
+		opt(&api)
+	}
+	if api.keys == nil {
+		// Без заданных ключей токены действуют только до перезапуска процесса
+		key, err := jwt.GenerateKey(jwt.ES256, "ephemeral")
+		if err != nil {
+			panic(err)
+		}
+		api.keys = jwt.StaticKeySet{key}
+	}
+	if len(api.credentialSecret) == 0 {
+		// Без заданного секрета подставные ключи доступа меняются при перезапуске процесса
+		api.credentialSecret = make([]byte, 32)
+		if _, err := rand.Read(api.credentialSecret); err != nil {
+			panic(err)
+		}
 	}
 	//	api.r = mux.NewRouter()
 	api.endpoints()
@@ -42,15 +102,60 @@ func (api *API) endpoints() {
 	api.r.HandleFunc("/", api.home).Methods(http.MethodGet)
 	api.r.HandleFunc("/api/login", api.handleLogin).Methods(http.MethodGet)
 	api.r.HandleFunc("/login", api.loginHandler).Methods(http.MethodPost)
+	api.r.HandleFunc("/login/2fa", api.loginSecondFactorHandler).Methods(http.MethodPost)
+	api.r.HandleFunc("/login/restore", api.restoreHandler).Methods(http.MethodPost)
+	api.r.HandleFunc("/login/webauthn/begin", api.loginWebAuthnBeginHandler).Methods(http.MethodPost)
+	api.r.HandleFunc("/login/webauthn/finish", api.loginWebAuthnFinishHandler).Methods(http.MethodPost)
 	api.r.HandleFunc("/dashboard", api.dashboardHandler).Methods(http.MethodGet)
 	api.r.HandleFunc("/registration", api.registrationHandler).Methods(http.MethodPost)
+	api.r.HandleFunc("/verify-email", api.verifyEmailHandler).Methods(http.MethodGet)
+	api.r.HandleFunc("/verify-email/resend", api.resendVerificationHandler).Methods(http.MethodPost)
+	api.r.HandleFunc("/password/forgot", api.forgotPasswordHandler).Methods(http.MethodPost)
+	api.r.HandleFunc("/password/reset", api.resetPageHandler).Methods(http.MethodGet)
+	api.r.HandleFunc("/password/reset", api.resetPasswordHandler).Methods(http.MethodPost)
 	api.r.HandleFunc("/delaccount", api.delAccountHandler).Methods(http.MethodPost)
+	api.r.HandleFunc("/logout", api.logoutHandler).Methods(http.MethodPost)
+	api.r.HandleFunc("/logout/all", api.logoutAllHandler).Methods(http.MethodPost)
+	api.r.HandleFunc("/api/sessions", api.sessionsHandler).Methods(http.MethodGet)
+	api.r.HandleFunc("/api/sessions/{id}", api.delSessionHandler).Methods(http.MethodDelete)
+	api.r.HandleFunc("/api/password", api.changePasswordHandler).Methods(http.MethodPost)
+	api.r.HandleFunc("/api/2fa/totp", api.setupTOTPHandler).Methods(http.MethodPost)
+	api.r.HandleFunc("/api/2fa/totp", api.disableTOTPHandler).Methods(http.MethodDelete)
+	api.r.HandleFunc("/api/2fa/totp/qr", api.totpQRHandler).Methods(http.MethodGet)
+	api.r.HandleFunc("/api/2fa/totp/confirm", api.confirmTOTPHandler).Methods(http.MethodPost)
+	api.r.HandleFunc("/api/webauthn/register/begin", api.registerBeginHandler).Methods(http.MethodPost)
+	api.r.HandleFunc("/api/webauthn/register/finish", api.registerFinishHandler).Methods(http.MethodPost)
+	api.r.HandleFunc("/api/webauthn/credentials", api.credentialsHandler).Methods(http.MethodGet)
+	api.r.HandleFunc("/api/webauthn/credentials/{id}", api.delCredentialHandler).Methods(http.MethodDelete)
+	api.r.HandleFunc("/api/token", api.tokenHandler).Methods(http.MethodPost)
+	api.r.HandleFunc("/.well-known/jwks.json", api.jwksHandler).Methods(http.MethodGet)
+	api.r.HandleFunc("/oauth2/authorize", api.authorizeHandler).Methods(http.MethodGet)
+	api.r.HandleFunc("/oauth2/token", api.oauthTokenHandler).Methods(http.MethodPost)
+	api.r.HandleFunc("/oauth2/introspect", api.introspectHandler).Methods(http.MethodPost)
+	api.r.HandleFunc("/oauth2/revoke", api.revokeHandler).Methods(http.MethodPost)
+	api.r.HandleFunc("/oauth2/device_authorization", api.deviceAuthorizationHandler).Methods(http.MethodPost)
+	api.r.HandleFunc("/device", api.devicePageHandler).Methods(http.MethodGet)
+	api.r.HandleFunc("/device", api.deviceApproveHandler).Methods(http.MethodPost)
+	api.r.HandleFunc("/userinfo", api.userinfoHandler).Methods(http.MethodGet, http.MethodPost)
+	api.r.HandleFunc("/.well-known/openid-configuration", api.discoveryHandler).Methods(http.MethodGet)
+	api.r.HandleFunc("/admin/clients", api.adminOnly(api.createClientHandler)).Methods(http.MethodPost)
+	api.r.HandleFunc("/admin/clients/{id}", api.adminOnly(api.clientHandler)).Methods(http.MethodGet)
+	api.r.HandleFunc("/admin/clients/{id}", api.adminOnly(api.delClientHandler)).Methods(http.MethodDelete)
+	api.r.HandleFunc("/admin/clients/{id}/secret", api.adminOnly(api.rotateClientSecretHandler)).Methods(http.MethodPost)
 
 	// веб-приложение
 	api.r.PathPrefix("/web/").Handler(http.StripPrefix("/web/", http.FileServer(http.Dir("./web/"))))
 
 }
 
+// errorStatus Код ответа на ошибку: 503, если база данных недоступна и запрос можно повторить, иначе 500.
+func errorStatus(err error) int {
+	if errors.Is(err, storage.ErrUnavailable) {
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusInternalServerError
+}
+
 // Обработчик для статических файлов веб-приложения.
 func (api *API) serveWebFiles(w http.ResponseWriter, r *http.Request) {
 	filePath := r.URL.Path
@@ -120,6 +225,7 @@ func (api *API) home(w http.ResponseWriter, r *http.Request) {
 
 // Функция-обработчик для страницы с регистрацией
 func (api *API) registrationHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
 	if r.URL.Path != "/registration" {
 		http.NotFound(w, r)
 		return
@@ -136,8 +242,90 @@ func (api *API) registrationHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	var errorMessages []string
+	if !check.CheckEmail(f.Username) {
+		errorMessages = append(errorMessages, "Адрес электронной почты не корректный")
+	}
+	errorMessages = append(errorMessages, passwordPolicy(f.Password)...)
+	f.DisplayName = strings.TrimSpace(f.DisplayName)
+	errorMessages = append(errorMessages, displayNamePolicy(f.DisplayName)...)
+
+	// Вывод ошибок, если они есть
+	if len(errorMessages) > 0 {
+		resp := storage.Response{
+			Success:       false,
+			ErrorMessages: errorMessages,
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+
+		return
+	}
+
+	// Адрес электронной почты и пароль валидны
+	hash, err := check.HashPass(f.Password)
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Ошибка при добавлении пользователя", errorStatus(err))
+		return
+	}
+	// Аккаунт ждёт подтверждения адреса, ссылка уходит на него письмом
+	c := storage.Account{
+		Username:    f.Username,
+		Password:    hash,
+		DisplayName: f.DisplayName,
+		Status:      storage.StatusPending,
+	}
+	if err = c.SetDefaults(); err != nil {
+		log.Println(err)
+		http.Error(w, "Ошибка при добавлении пользователя", errorStatus(err))
+		return
+	}
+
+	// Аккаунт создаётся, только если логин свободен: проверка и запись атомарны в базе данных
+	err = api.db.CreateAccount(ctx, c)
+	if errors.Is(err, storage.ErrAlreadyExists) {
+		resp := storage.Response{
+			Success: false,
+			Message: "Такой пользователь уже существует",
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+
+		return
+	}
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Ошибка при добавлении пользователя", errorStatus(err))
+		return
+	}
+
+	v := storage.EmailVerification{
+		Username:  c.Username,
+		CreatedAt: c.CreatedAt,
+	}
+	if err = api.db.SetEmailVerification(ctx, v); err != nil {
+		log.Println(err)
+		http.Error(w, "Ошибка при добавлении пользователя", errorStatus(err))
+		return
+	}
+	if err = api.sendVerification(ctx, v); err != nil {
+		// Ссылку можно запросить повторно через /verify-email/resend
+		log.Println(err)
+	}
+
+	resp := storage.Response{
+		Success: true,
+		Message: "Ваш аккаунт успешно создан. Мы отправили письмо со ссылкой для подтверждения адреса.",
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// passwordPolicy Проверяет пароль всеми проверками пакета check и возвращает сообщения о нарушениях.
+// Одни и те же правила действуют при регистрации, сбросе и смене пароля.
+func passwordPolicy(password string) []string {
 	// Каналы для синхронизации и передачи результатов проверок
-	emailResultCh := make(chan bool, 1)
 	letterCh := make(chan bool, 1)
 	specCharCh := make(chan bool, 1)
 	lenRegexCh := make(chan bool, 1)
@@ -146,45 +334,36 @@ func (api *API) registrationHandler(w http.ResponseWriter, r *http.Request) {
 	weakCh := make(chan bool, 1)
 
 	var wg sync.WaitGroup
-	wg.Add(7) // Устанавливаем количество ожидаемых горутин
+	wg.Add(6) // Устанавливаем количество ожидаемых горутин
 
-	// Горутина для проверки адреса электронной почты
-	go func() {
-		defer wg.Done()
-		emailResultCh <- check.CheckEmail(f.Username)
-	}()
-	// Горутины для проверки пароля
 	go func() {
 		defer wg.Done()
-		letterCh <- check.LowercaseLetter(f.Password)
+		letterCh <- check.LowercaseLetter(password)
 	}()
 	go func() {
 		defer wg.Done()
-		specCharCh <- check.SpecCharRegex(f.Password)
+		specCharCh <- check.SpecCharRegex(password)
 	}()
 	go func() {
 		defer wg.Done()
-		lenRegexCh <- check.LenPass(f.Password)
+		lenRegexCh <- check.LenPass(password)
 	}()
 	go func() {
 		defer wg.Done()
-		numbersCh <- check.NumbersPass(f.Password)
+		numbersCh <- check.NumbersPass(password)
 	}()
 	go func() {
 		defer wg.Done()
-		containLetterCh <- check.ContainPass(f.Password)
+		containLetterCh <- check.ContainPass(password)
 	}()
 	go func() {
 		defer wg.Done()
-		weakCh <- check.WeakPass(f.Password)
+		weakCh <- check.WeakPass(password)
 	}()
 	wg.Wait()
 
 	var errorMessages []string
 
-	if !<-emailResultCh {
-		errorMessages = append(errorMessages, "Адрес электронной почты не корректный")
-	}
 	if !<-letterCh {
 		errorMessages = append(errorMessages, "Ошибка! Пароль должен содержать строчные буквы")
 	}
@@ -203,109 +382,177 @@ func (api *API) registrationHandler(w http.ResponseWriter, r *http.Request) {
 	if !<-weakCh {
 		errorMessages = append(errorMessages, "Предупреждение! Очень слабый пароль, придумайте другой")
 	}
+	return errorMessages
+}
 
-	// Вывод ошибок, если они есть
-	if len(errorMessages) > 0 {
-		resp := storage.Response{
-			Success:       false,
-			ErrorMessages: errorMessages,
-		}
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(resp)
-
-		return
+// Функция-обработчик для страницы с авторизацией
+func (api *API) loginHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if r.URL.Path != "/login" {
+		http.NotFound(w, r)
 	}
-
-	// Адрес электронной почты и пароль валидны
-	hash := check.HashPass(f.Password)
-	c := storage.Account{
-		Username: f.Username,
-		Password: hash,
+	// Получаем данные из формы авторизации
+	var f storage.FormAccount
+	if err := json.NewDecoder(r.Body).Decode(&f); err != nil {
+		http.Error(w, "Ошибка при декодировании JSON", http.StatusBadRequest)
+		return
 	}
 
-	// Проверяем есть ли такой пользователь в базе данных
-	keys, err := api.db.KeysAccount(c)
-	if err != nil {
-		log.Println(err)
-		http.Error(w, "Ошибка при проверке пользователя", http.StatusInternalServerError)
+	// Попытка учитывается до проверки пароля, пока идёт пауза, пароль не проверяется, даже верный
+	attempt, wait := api.reserveLogin(r, f.Username)
+	if wait > 0 {
+		tooManyAttempts(w, wait)
 		return
 	}
 
-	if keys == true {
-		resp := storage.Response{
-			Success: false,
-			Message: "Такой пользователь уже существует",
+	// Проверяем логин и пароль
+	valid := api.checkPassword(ctx, f.Username, f.Password)
+
+	if valid {
+		// Второй фактор учитывается отдельной попыткой
+		api.cancelAttempt(ctx, attempt)
+		refusal, err := api.loginRefusal(ctx, f.Username)
+		if err != nil {
+			log.Println(err)
+			http.Error(w, "Ошибка при проверке аккаунта", errorStatus(err))
+			return
+		}
+		if refusal != "" {
+			refuseLogin(w, refusal)
+			return
 		}
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(resp)
 
-		return
-	} else {
-		err = api.db.AddAccount(c)
+		// С включённым вторым фактором сессию создаёт только /login/2fa
+		t, err := api.totpEnabled(ctx, f.Username)
 		if err != nil {
 			log.Println(err)
-			http.Error(w, "Ошибка при добавлении пользователя", http.StatusInternalServerError)
+			http.Error(w, "Ошибка при проверке второго фактора", errorStatus(err))
+			return
+		}
+		if t != nil {
+			token, err := api.issueStateToken("/login/2fa", f.Username, mfaTTL, "")
+			if err != nil {
+				log.Println(err)
+				http.Error(w, "Ошибка при создании сессии", errorStatus(err))
+				return
+			}
+			resp := mfaResponse{
+				Response: storage.Response{
+					Success: false,
+					Message: "Требуется второй фактор: введите код из приложения-аутентификатора",
+				},
+				MFARequired: true,
+				MFAToken:    token,
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("Cache-Control", "no-store")
+			json.NewEncoder(w).Encode(resp)
 			return
 		}
+
+		api.finishLogin(w, r, f.Username)
+	} else {
+		// Если авторизация не удалась, отображаем сообщение об ошибке
 		resp := storage.Response{
-			Success: true,
-			Message: "Ваш аккаунт успешно создан.",
+			Success: false,
+			Message: "Нет такой записи, проверти логин или пароль",
 		}
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(resp)
-		return
 	}
 }
 
-// Функция-обработчик для страницы с авторизацией
-func (api *API) loginHandler(w http.ResponseWriter, r *http.Request) {
-	if r.URL.Path != "/login" {
-		http.NotFound(w, r)
-	}
-	// Получаем данные из формы авторизации
-	var f storage.FormAccount
-	if err := json.NewDecoder(r.Body).Decode(&f); err != nil {
-		http.Error(w, "Ошибка при декодировании JSON", http.StatusBadRequest)
+// finishLogin Создаёт сессию после проверки всех факторов и перенаправляет на защищённую страницу.
+func (api *API) finishLogin(w http.ResponseWriter, r *http.Request, username string) {
+	ctx := r.Context()
+	// Счётчик сбрасывается только после всех факторов, иначе верный пароль обнулял бы перебор кода
+	api.loginSucceeded(ctx, username)
+
+	// Аккаунт, ожидающий удаления, сначала нужно восстановить
+	d, err := api.db.SearchDeletion(ctx, username)
+	switch {
+	case err == nil:
+		api.restoreOffer(w, d)
+		return
+	case !errors.Is(err, storage.ErrNotFound):
+		log.Println(err)
+		http.Error(w, "Ошибка при создании сессии", errorStatus(err))
 		return
 	}
 
-	hash := check.HashPass(f.Password)
-	c := storage.Account{
-		Username: f.Username,
-		Password: hash,
+	// Прежнюю сессию браузера отзываем, чтобы её токен нельзя было навязать заранее
+	if err := api.endSession(w, r); err != nil {
+		log.Println(err)
+	}
+	// Если авторизация успешна, создаём новую сессию на сервере
+	if err := api.startSession(w, r, username); err != nil {
+		log.Println(err)
+		http.Error(w, "Ошибка при создании сессии", errorStatus(err))
+		return
 	}
+	api.recordLogin(ctx, username)
 
-	// Получаем пароль из базы данных
-	result, err := api.db.SearchAccount(c)
+	// Перенаправляем пользователя на защищенную страницу
+	http.Redirect(w, r, "/dashboard", http.StatusFound)
+}
+
+// checkPassword Проверяет логин и пароль по хешу из базы данных.
+// Для несуществующего аккаунта тратится столько же времени, устаревший хеш пересчитывается.
+func (api *API) checkPassword(ctx context.Context, username, password string) bool {
+	result, valid, err := api.verifyPassword(ctx, username, password)
 	if err != nil {
 		log.Println(err)
 	}
 
-	// Проверяем, соответствуют ли переданные данные ожидаемым значениям
-	if c.Password == result {
-		// Если авторизация успешна, сохраняем информацию о входе в сессии
-		session, err := r.Cookie("session")
-		if err != nil {
-			session = &http.Cookie{
-				Name:   "session",
-				Value:  "authenticated",
-				Secure: true,
-				MaxAge: 3600, // 3600 Устанавливает время жизни cookie на 1 час
+	if valid && check.NeedsRehash(result) {
+		api.rehash(ctx, username, password, result)
+	}
+	return valid
+}
 
-			}
-		}
-		http.SetCookie(w, session)
+// verifyPassword Проверяет пароль по хешу из базы данных и возвращает этот хеш.
+// Для несуществующего аккаунта тратится столько же времени. Ошибка — только сбой базы, пароль тогда неверен.
+func (api *API) verifyPassword(ctx context.Context, username, password string) (string, bool, error) {
+	c := storage.Account{
+		Username: username,
+	}
 
-		// Перенаправляем пользователя на защищенную страницу
-		http.Redirect(w, r, "/dashboard", http.StatusFound)
-	} else {
-		// Если авторизация не удалась, отображаем сообщение об ошибке
-		resp := storage.Response{
-			Success: false,
-			Message: "Нет такой записи, проверти логин или пароль",
-		}
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(resp)
+	// Получаем хеш пароля из базы данных
+	result, err := api.db.SearchAccount(ctx, c)
+	if err != nil && !errors.Is(err, storage.ErrNotFound) {
+		return "", false, err
+	}
+
+	// Проверяем пароль по хешу, для несуществующего аккаунта тратим столько же времени
+	if result == "" {
+		check.FakeVerify(password)
+		return "", false, nil
+	}
+	valid, err := check.VerifyPass(password, result)
+	if err != nil {
+		log.Println(err)
+	}
+	return result, valid, nil
+}
+
+// rehash Пересчитывает хеш пароля текущим алгоритмом после успешного входа.
+// Ошибка не мешает входу: хеш будет пересчитан при следующей попытке.
+func (api *API) rehash(ctx context.Context, username, password, old string) {
+	hash, err := check.HashPass(password)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	err = api.db.UpdatePassword(ctx, storage.Account{
+		Username: username,
+		Password: hash,
+	})
+	if err != nil {
+		log.Printf("Не удалось обновить хеш пароля пользователя %s: %v", username, err)
+		return
+	}
+	if check.IsLegacyHash(old) {
+		log.Printf("Пароль пользователя %s переведён с SHA-256 на %s", username, check.CurrentHasher().Name())
 	}
 }
 
@@ -316,8 +563,11 @@ func (api *API) dashboardHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	// Проверяем, авторизован ли пользователь
-	session, err := r.Cookie("session")
-	if err != nil || session.Value != "authenticated" {
+	session, err := api.currentSession(r)
+	if err != nil {
+		log.Println(err)
+	}
+	if session == nil {
 		// Если пользователь не авторизован, перенаправляем на страницу входа
 		http.Redirect(w, r, "/login", http.StatusFound)
 		return
@@ -334,8 +584,18 @@ func (api *API) dashboardHandler(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(resp)
 }
 
-// Функция-обработчик для страницы с удалением аккаунта
+// deleteRequest Подтверждение удаления аккаунта паролем или свежим кодом второго фактора.
+type deleteRequest struct {
+	Username string `json:"username"` // Необязательно, но если указан, должен совпадать с аккаунтом сессии
+	Password string `json:"password"`
+	Code     string `json:"code"` // Код из приложения-аутентификатора или код восстановления вместо пароля
+}
+
+// Функция-обработчик для страницы с удалением аккаунта.
+// Удалить можно только свой аккаунт: нужна сессия и повторный ввод пароля или кода второго фактора,
+// чтобы одной украденной сессии не хватило.
 func (api *API) delAccountHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
 	if r.URL.Path != "/delaccount" {
 		http.NotFound(w, r)
 	}
@@ -344,56 +604,145 @@ func (api *API) delAccountHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	session, err := api.currentSession(r)
+	if err != nil {
+		log.Println(err)
+	}
+	if session == nil {
+		http.Error(w, "Требуется авторизация", http.StatusUnauthorized)
+		return
+	}
+
 	// Получаем данные из формы удаления
-	var f storage.FormAccount
-	if err := json.NewDecoder(r.Body).Decode(&f); err != nil {
+	var f deleteRequest
+	if err = json.NewDecoder(r.Body).Decode(&f); err != nil {
 		http.Error(w, "Ошибка при декодировании JSON", http.StatusBadRequest)
 		return
 	}
-	c := storage.Account{
-		Username: f.Username,
+
+	forbidden := func(message string) {
+		resp := storage.Response{
+			Success: false,
+			Message: message,
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(resp)
+	}
+	if f.Username != "" && f.Username != session.Username {
+		forbidden("Можно удалить только свой аккаунт")
+		return
 	}
 
-	// Проверяем есть ли такой пользователь в базе redis
-	keys, err := api.db.KeysAccount(c)
+	// Подбор пароля через чужую сессию ограничен так же, как вход
+	attempt, wait := api.reserveLogin(r, session.Username)
+	if wait > 0 {
+		tooManyAttempts(w, wait)
+		return
+	}
+	confirmed, err := api.confirmIdentity(ctx, session.Username, f.Password, f.Code)
 	if err != nil {
 		log.Println(err)
-		http.Error(w, "Ошибка при проверке пользователя", http.StatusInternalServerError)
+		http.Error(w, "Ошибка при проверке пользователя", errorStatus(err))
+		return
+	}
+	if !confirmed {
+		forbidden("Подтвердите удаление паролем или кодом второго фактора")
 		return
 	}
+	api.cancelAttempt(ctx, attempt)
 
-	// Удаляем аккаунт, если он существует
-	if keys == true {
-		a, err := api.db.DelAccount(c)
-		if err != nil {
+	// Со сроком восстановления аккаунт только отмечается, удаляет его PurgeAccounts
+	if api.deletionGrace > 0 {
+		d, err := api.scheduleDeletion(ctx, session.Username)
+		if d == nil {
 			log.Println(err)
-			http.Error(w, "Ошибка при удалении пользователя", http.StatusInternalServerError)
+			http.Error(w, "Ошибка при удалении пользователя", errorStatus(err))
 			return
 		}
-		if a == true {
-			// Удаляем Cookie
-			sessionCookie := &http.Cookie{
-				Name:   "session",
-				Value:  "",
-				MaxAge: -1, // или 0
-				Path:   "/",
-			}
-			http.SetCookie(w, sessionCookie)
+		if err != nil {
+			log.Printf("Не все сессии пользователя %s завершены: %v", session.Username, err)
+		}
+		clearSessionCookie(w)
+		log.Printf("Пользователь %s удалил аккаунт, окончательное удаление %s", session.Username, d.PurgeAt.Format(time.RFC3339))
 
-			resp := storage.Response{
-				Success: true,
-				Message: "Ваш аккаунт успешно удален.",
-			}
-			w.Header().Set("Content-Type", "application/json")
-			json.NewEncoder(w).Encode(resp)
-			return
+		resp := storage.Response{
+			Success: true,
+			Message: fmt.Sprintf("Ваш аккаунт будет удалён %s. До этого срока его можно восстановить, войдя в аккаунт.", d.PurgeAt.Format("02.01.2006 15:04 MST")),
 		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+		return
+	}
+
+	deleted, err := api.deleteAccount(ctx, session.Username)
+	if err != nil && !deleted {
+		log.Println(err)
+		http.Error(w, "Ошибка при удалении пользователя", errorStatus(err))
+		return
+	}
+	if err != nil {
+		log.Println(err)
+	}
+	clearSessionCookie(w)
+
+	if !deleted {
+		resp := storage.Response{
+			Success: false,
+			Message: "Такой пользователь не существует, проверьте логин.",
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+		return
 	}
-	// Если аккаунт не существует
+	log.Printf("Пользователь %s удалил аккаунт", session.Username)
+
 	resp := storage.Response{
-		Success: false,
-		Message: "Такой пользователь не существует, проверьте логин.",
+		Success: true,
+		Message: "Ваш аккаунт успешно удален.",
 	}
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(resp)
 }
+
+// confirmIdentity Проверяет пароль пользователя или, если пароль не указан, код второго фактора.
+// Код принимается один раз, как при входе.
+func (api *API) confirmIdentity(ctx context.Context, username, password, code string) (bool, error) {
+	if password != "" {
+		return api.checkPassword(ctx, username, password), nil
+	}
+	if code == "" {
+		return false, nil
+	}
+	t, err := api.totpEnabled(ctx, username)
+	if err != nil || t == nil {
+		return false, err
+	}
+	return api.verifySecondFactor(ctx, t, code)
+}
+
+// purgeUser Удаляет всё, что связано с пользователем: сессии, токены обновления, второй фактор,
+// ключи доступа, подтверждение адреса и ссылки сброса пароля.
+// Ничто из этого не должно достаться тому, кто зарегистрируется под тем же логином.
+func (api *API) purgeUser(ctx context.Context, username string) error {
+	var errs []error
+	if _, err := api.db.DelUserSessions(ctx, username); err != nil {
+		errs = append(errs, err)
+	}
+	if _, err := api.db.DelUserRefreshTokens(ctx, username); err != nil {
+		errs = append(errs, err)
+	}
+	if _, err := api.db.DelTOTP(ctx, username); err != nil {
+		errs = append(errs, err)
+	}
+	if _, err := api.db.DelUserCredentials(ctx, username); err != nil {
+		errs = append(errs, err)
+	}
+	if _, err := api.db.DelEmailVerification(ctx, username); err != nil {
+		errs = append(errs, err)
+	}
+	if _, err := api.db.DelUserPasswordResets(ctx, username); err != nil {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
@@ -2,23 +2,38 @@ package api_test
 
 import (
 	"authorization/pkg/api"
+	"authorization/pkg/check"
 	"authorization/pkg/storage"
 	"authorization/pkg/storage/redisDB"
+	"authorization/pkg/throttle"
+	"authorization/pkg/totp"
+	"authorization/pkg/webauthn"
+	"authorization/pkg/webauthn/webauthntest"
 	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
 func TestRegistrationHandler(t *testing.T) {
+	ctx := context.Background()
 	constr := "redis://localhost:6379"
 	// Создаём тестовую базу данных
 	db, _ := redisDB.New(constr)
 
 	// Создаём экземпляр API с тестовой базой данных
-	a := api.New(db)
+	a := api.New(db, "../../web")
 
 	// Создаём данные регистрации
 	formData := storage.FormAccount{
@@ -49,7 +64,7 @@ func TestRegistrationHandler(t *testing.T) {
 	}
 
 	// Проверяем ожидаемый JSON-ответ
-	expectedJSON := `{"success":true,"message":"Ваш аккаунт успешно создан.","errorMessages":null}`
+	expectedJSON := `{"success":true,"message":"Ваш аккаунт успешно создан. Мы отправили письмо со ссылкой для подтверждения адреса.","errorMessages":null}`
 	actualJSON := strings.TrimSpace(resRecorder.Body.String())
 	if actualJSON != expectedJSON {
 		t.Errorf("Неверный JSON-ответ: получено\n%s\nожидается\n%s", actualJSON, expectedJSON)
@@ -60,7 +75,7 @@ func TestRegistrationHandler(t *testing.T) {
 		Username: "ups@mail.ru",
 		Password: "Test123!",
 	}
-	keys, err := db.KeysAccount(account)
+	keys, err := db.KeysAccount(ctx, account)
 	if err != nil {
 		t.Fatalf("Ошибка при поиске ключей: %v", err)
 	}
@@ -75,7 +90,7 @@ func TestAPI_loginHandler(t *testing.T) {
 	db, _ := redisDB.New(constr)
 
 	// Создаём экземпляр API с тестовой базой данных
-	a := api.New(db)
+	a := api.New(db, "../../web")
 
 	// Создаём данные регистрации
 	formData := storage.FormAccount{
@@ -107,13 +122,55 @@ func TestAPI_loginHandler(t *testing.T) {
 
 }
 
+// login Выполняет вход тестового пользователя и возвращает cookie сессии.
+func login(t *testing.T, a *api.API, username, password string) *http.Cookie {
+	t.Helper()
+
+	jsonData, err := json.Marshal(storage.FormAccount{Username: username, Password: password})
+	if err != nil {
+		t.Fatalf("Ошибка при преобразовании данных в JSON: %v", err)
+	}
+	req, err := http.NewRequest(http.MethodPost, "/login", bytes.NewBuffer(jsonData))
+	if err != nil {
+		t.Fatalf("Ошибка при создании запроса: %v", err)
+	}
+	resRecorder := httptest.NewRecorder()
+	a.Router().ServeHTTP(resRecorder, req)
+
+	for _, c := range resRecorder.Result().Cookies() {
+		if c.Name == "session" && c.Value != "" {
+			return c
+		}
+	}
+	t.Fatalf("Сервер не установил cookie сессии, статус %v", resRecorder.Code)
+	return nil
+}
+
+// createUser Создаёт аккаунт с паролем password вместо прежнего и удаляет его после теста.
+func createUser(t *testing.T, db storage.Interface, username, password string) {
+	t.Helper()
+	ctx := context.Background()
+
+	hash, err := check.HashPass(password)
+	if err != nil {
+		t.Fatalf("Ошибка при хешировании пароля: %v", err)
+	}
+	db.DelAccount(ctx, storage.Account{Username: username})
+	if err = db.CreateAccount(ctx, storage.Account{Username: username, Password: hash}); err != nil {
+		t.Fatalf("Ошибка при создании пользователя: %v", err)
+	}
+	t.Cleanup(func() {
+		db.DelAccount(ctx, storage.Account{Username: username})
+	})
+}
+
 func TestDashboardHandler(t *testing.T) {
 	constr := "redis://localhost:6379"
 	// Создаём тестовую базу данных
 	db, _ := redisDB.New(constr)
 
 	// Создаём экземпляр API с тестовой базой данных
-	a := api.New(db)
+	a := api.New(db, "../../web")
 
 	// Создаём запрос GET для защищённой страницы
 	req, err := http.NewRequest(http.MethodGet, "/dashboard", nil)
@@ -122,11 +179,7 @@ func TestDashboardHandler(t *testing.T) {
 	}
 
 	// Устанавливаем cookie авторизованного пользователя
-	cookie := &http.Cookie{
-		Name:  "session",
-		Value: "authenticated",
-	}
-	req.AddCookie(cookie)
+	req.AddCookie(login(t, a, "ups@mail.ru", "Test123!"))
 
 	// Создаём ResponseWriter для записи ответа
 	resRecorder := httptest.NewRecorder()
@@ -147,59 +200,1780 @@ func TestDashboardHandler(t *testing.T) {
 	}
 }
 
-func TestAPI_delAccountHandler(t *testing.T) {
+func TestDashboardHandler_ForgedCookie(t *testing.T) {
 	constr := "redis://localhost:6379"
 	// Создаём тестовую базу данных
 	db, _ := redisDB.New(constr)
 
 	// Создаём экземпляр API с тестовой базой данных
-	a := api.New(db)
+	a := api.New(db, "../../web")
 
-	// Создаём аккаунт для удаления
-	formData := storage.FormAccount{
-		Username: "ups@mail.ru",
+	req, err := http.NewRequest(http.MethodGet, "/dashboard", nil)
+	if err != nil {
+		t.Fatalf("Ошибка при создании запроса: %v", err)
 	}
-	jsonData, err := json.Marshal(formData)
+
+	// Cookie, которую сервер не выдавал, не должна давать доступ
+	req.AddCookie(&http.Cookie{
+		Name:  "session",
+		Value: "authenticated",
+	})
+
+	resRecorder := httptest.NewRecorder()
+	a.Router().ServeHTTP(resRecorder, req)
+
+	if resRecorder.Code != http.StatusFound {
+		t.Errorf("Неверный статус код: получено %v, ожидается %v", resRecorder.Code, http.StatusFound)
+	}
+}
+
+// dashboardStatus Возвращает статус ответа защищённой страницы для cookie.
+func dashboardStatus(t *testing.T, a *api.API, cookie *http.Cookie) int {
+	t.Helper()
+
+	req, err := http.NewRequest(http.MethodGet, "/dashboard", nil)
 	if err != nil {
-		t.Fatalf("Ошибка при преобразовании данных в JSON: %v", err)
+		t.Fatalf("Ошибка при создании запроса: %v", err)
 	}
+	req.AddCookie(cookie)
+	resRecorder := httptest.NewRecorder()
+	a.Router().ServeHTTP(resRecorder, req)
+
+	return resRecorder.Code
+}
+
+func TestAPI_logoutHandler(t *testing.T) {
+	constr := "redis://localhost:6379"
+	// Создаём тестовую базу данных
+	db, _ := redisDB.New(constr)
+
+	// Создаём экземпляр API с тестовой базой данных
+	a := api.New(db, "../../web")
+
+	cookie := login(t, a, "ups@mail.ru", "Test123!")
 
-	// Создаём запрос POST с данными удаления
-	req, err := http.NewRequest(http.MethodPost, "/delaccount", bytes.NewBuffer(jsonData))
+	req, err := http.NewRequest(http.MethodPost, "/logout", nil)
 	if err != nil {
 		t.Fatalf("Ошибка при создании запроса: %v", err)
 	}
-	req.Header.Set("Content-Type", "application/json")
+	req.AddCookie(cookie)
+	resRecorder := httptest.NewRecorder()
+	a.Router().ServeHTTP(resRecorder, req)
 
-	// Создаём ResponseWriter для записи ответа
+	if resRecorder.Code != http.StatusOK {
+		t.Errorf("Неверный статус код: получено %v, ожидается %v", resRecorder.Code, http.StatusOK)
+	}
+
+	// Сессия отозвана на сервере, старая cookie больше не действует
+	if code := dashboardStatus(t, a, cookie); code != http.StatusFound {
+		t.Errorf("Неверный статус код: получено %v, ожидается %v", code, http.StatusFound)
+	}
+}
+
+func TestAPI_logoutAllHandler(t *testing.T) {
+	constr := "redis://localhost:6379"
+	// Создаём тестовую базу данных
+	db, _ := redisDB.New(constr)
+
+	// Создаём экземпляр API с тестовой базой данных
+	a := api.New(db, "../../web")
+
+	// Вход с двух устройств
+	first := login(t, a, "ups@mail.ru", "Test123!")
+	second := login(t, a, "ups@mail.ru", "Test123!")
+
+	req, err := http.NewRequest(http.MethodPost, "/logout/all", nil)
+	if err != nil {
+		t.Fatalf("Ошибка при создании запроса: %v", err)
+	}
+	req.AddCookie(first)
 	resRecorder := httptest.NewRecorder()
+	a.Router().ServeHTTP(resRecorder, req)
 
-	// Выполняем запрос
+	if resRecorder.Code != http.StatusOK {
+		t.Errorf("Неверный статус код: получено %v, ожидается %v", resRecorder.Code, http.StatusOK)
+	}
+
+	// Обе сессии отозваны
+	for _, c := range []*http.Cookie{first, second} {
+		if code := dashboardStatus(t, a, c); code != http.StatusFound {
+			t.Errorf("Неверный статус код: получено %v, ожидается %v", code, http.StatusFound)
+		}
+	}
+}
+
+func TestAPI_sessionsHandler(t *testing.T) {
+	constr := "redis://localhost:6379"
+	// Создаём тестовую базу данных
+	db, _ := redisDB.New(constr)
+
+	// Создаём экземпляр API с тестовой базой данных
+	a := api.New(db, "../../web")
+
+	// Вход с двух устройств
+	first := login(t, a, "ups@mail.ru", "Test123!")
+	second := login(t, a, "ups@mail.ru", "Test123!")
+
+	// Получаем список сессий с первого устройства
+	req, err := http.NewRequest(http.MethodGet, "/api/sessions", nil)
+	if err != nil {
+		t.Fatalf("Ошибка при создании запроса: %v", err)
+	}
+	req.AddCookie(first)
+	resRecorder := httptest.NewRecorder()
+	a.Router().ServeHTTP(resRecorder, req)
+
+	if resRecorder.Code != http.StatusOK {
+		t.Fatalf("Неверный статус код: получено %v, ожидается %v", resRecorder.Code, http.StatusOK)
+	}
+
+	var resp struct {
+		Success  bool `json:"success"`
+		Sessions []struct {
+			ID      string `json:"id"`
+			IP      string `json:"ip"`
+			Current bool   `json:"current"`
+		} `json:"sessions"`
+	}
+	if err = json.NewDecoder(resRecorder.Body).Decode(&resp); err != nil {
+		t.Fatalf("Ошибка при декодировании JSON: %v", err)
+	}
+
+	// Находим сессию второго устройства
+	var other string
+	for _, c := range resp.Sessions {
+		if !c.Current {
+			other = c.ID
+		}
+	}
+	if other == "" {
+		t.Fatalf("Сессия второго устройства не найдена в списке: %+v", resp.Sessions)
+	}
+
+	// Завершаем сессию второго устройства
+	req, err = http.NewRequest(http.MethodDelete, "/api/sessions/"+other, nil)
+	if err != nil {
+		t.Fatalf("Ошибка при создании запроса: %v", err)
+	}
+	req.AddCookie(first)
+	resRecorder = httptest.NewRecorder()
 	a.Router().ServeHTTP(resRecorder, req)
 
-	// Проверяем статус код
 	if resRecorder.Code != http.StatusOK {
 		t.Errorf("Неверный статус код: получено %v, ожидается %v", resRecorder.Code, http.StatusOK)
 	}
+	if code := dashboardStatus(t, a, second); code != http.StatusFound {
+		t.Errorf("Неверный статус код: получено %v, ожидается %v", code, http.StatusFound)
+	}
+	if code := dashboardStatus(t, a, first); code != http.StatusOK {
+		t.Errorf("Неверный статус код: получено %v, ожидается %v", code, http.StatusOK)
+	}
+}
 
-	// Проверяем ожидаемый JSON-ответ при успешном удалении
-	expectedResponse := `{"success":true,"message":"Ваш аккаунт успешно удален.","errorMessages":null}`
-	actualResponse := strings.TrimSpace(resRecorder.Body.String())
-	if actualResponse != expectedResponse {
-		t.Errorf("Неверный JSON-ответ: получено %v, ожидается %v", actualResponse, expectedResponse)
+// requestToken Выполняет запрос к /api/token и возвращает статус и ответ.
+func requestToken(t *testing.T, a *api.API, body map[string]string) (int, map[string]interface{}) {
+	t.Helper()
+
+	jsonData, err := json.Marshal(body)
+	if err != nil {
+		t.Fatalf("Ошибка при преобразовании данных в JSON: %v", err)
+	}
+	req, err := http.NewRequest(http.MethodPost, "/api/token", bytes.NewBuffer(jsonData))
+	if err != nil {
+		t.Fatalf("Ошибка при создании запроса: %v", err)
 	}
+	resRecorder := httptest.NewRecorder()
+	a.Router().ServeHTTP(resRecorder, req)
 
-	// Создаём аккаунт для проверки удаления из базы данных
-	c := storage.Account{
-		Username: "testuser",
+	var resp map[string]interface{}
+	if err = json.NewDecoder(resRecorder.Body).Decode(&resp); err != nil {
+		t.Fatalf("Ошибка при декодировании JSON: %v", err)
 	}
+	return resRecorder.Code, resp
+}
 
-	// Проверяем, что аккаунт был удалён из базы данных
-	keys, err := db.KeysAccount(c)
+// tokenClaims Возвращает утверждения подписанного токена без проверки подписи.
+func tokenClaims(t *testing.T, token string) map[string]interface{} {
+	t.Helper()
+
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		t.Fatalf("Неверный формат токена: %v", token)
+	}
+	payload, _ := base64.RawURLEncoding.DecodeString(parts[1])
+	var claims map[string]interface{}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		t.Fatalf("Ошибка при декодировании токена: %v", err)
+	}
+	return claims
+}
+
+func TestAPI_tokenHandler(t *testing.T) {
+	constr := "redis://localhost:6379"
+	// Создаём тестовую базу данных
+	db, _ := redisDB.New(constr)
+
+	// Создаём экземпляр API с тестовой базой данных
+	a := api.New(db, "../../web")
+
+	// Обмениваем логин и пароль на токены
+	code, resp := requestToken(t, a, map[string]string{
+		"grant_type": "password",
+		"username":   "ups@mail.ru",
+		"password":   "Test123!",
+	})
+	if code != http.StatusOK {
+		t.Fatalf("Неверный статус код: получено %v, ожидается %v, ответ %v", code, http.StatusOK, resp)
+	}
+	if resp["access_token"] == nil || resp["refresh_token"] == nil {
+		t.Fatalf("В ответе нет токенов: %v", resp)
+	}
+	first := resp["refresh_token"].(string)
+
+	// Ротация: старый токен обновления меняется на новый
+	code, resp = requestToken(t, a, map[string]string{
+		"grant_type":    "refresh_token",
+		"refresh_token": first,
+	})
+	if code != http.StatusOK {
+		t.Fatalf("Неверный статус код: получено %v, ожидается %v, ответ %v", code, http.StatusOK, resp)
+	}
+	second := resp["refresh_token"].(string)
+	if second == first {
+		t.Fatal("Токен обновления не был заменён")
+	}
+
+	// Повторное использование старого токена отзывает всё семейство
+	code, resp = requestToken(t, a, map[string]string{
+		"grant_type":    "refresh_token",
+		"refresh_token": first,
+	})
+	if code != http.StatusBadRequest || resp["error"] != "invalid_grant" {
+		t.Errorf("Повторное использование токена не отклонено: %v %v", code, resp)
+	}
+	code, resp = requestToken(t, a, map[string]string{
+		"grant_type":    "refresh_token",
+		"refresh_token": second,
+	})
+	if code != http.StatusBadRequest || resp["error"] != "invalid_grant" {
+		t.Errorf("Семейство токенов не отозвано: %v %v", code, resp)
+	}
+
+	// Неверный пароль
+	code, resp = requestToken(t, a, map[string]string{
+		"grant_type": "password",
+		"username":   "ups@mail.ru",
+		"password":   "Wrong123!",
+	})
+	if code != http.StatusBadRequest || resp["error"] != "invalid_grant" {
+		t.Errorf("Неверный пароль не отклонён: %v %v", code, resp)
+	}
+}
+
+func TestAPI_jwksHandler(t *testing.T) {
+	constr := "redis://localhost:6379"
+	// Создаём тестовую базу данных
+	db, _ := redisDB.New(constr)
+
+	// Создаём экземпляр API с тестовой базой данных
+	a := api.New(db, "../../web")
+
+	req := httptest.NewRequest(http.MethodGet, "/.well-known/jwks.json", nil)
+	resRecorder := httptest.NewRecorder()
+	a.Router().ServeHTTP(resRecorder, req)
+
+	if resRecorder.Code != http.StatusOK {
+		t.Fatalf("Неверный статус код: получено %v, ожидается %v", resRecorder.Code, http.StatusOK)
+	}
+
+	// Опубликованы только открытые части ключей
+	var set struct {
+		Keys []map[string]interface{} `json:"keys"`
+	}
+	if err := json.NewDecoder(resRecorder.Body).Decode(&set); err != nil {
+		t.Fatalf("Ошибка при декодировании JSON: %v", err)
+	}
+	if len(set.Keys) == 0 {
+		t.Fatal("В JWKS нет ключей")
+	}
+	for _, k := range set.Keys {
+		if k["kid"] == "" || k["kty"] == nil {
+			t.Errorf("Неполный ключ: %v", k)
+		}
+		if _, ok := k["d"]; ok {
+			t.Errorf("В JWKS опубликован закрытый ключ: %v", k)
+		}
+	}
+}
+
+// oauthToken Выполняет запрос к /oauth2/token с формой и возвращает статус и ответ.
+func oauthToken(t *testing.T, a *api.API, form url.Values) (int, map[string]interface{}) {
+	t.Helper()
+
+	req, err := http.NewRequest(http.MethodPost, "/oauth2/token", strings.NewReader(form.Encode()))
 	if err != nil {
-		t.Fatalf("Ошибка при поиске ключей: %v", err)
+		t.Fatalf("Ошибка при создании запроса: %v", err)
 	}
-	if keys {
-		t.Errorf("Аккаунт не должен быть найден в базе данных после удаления")
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resRecorder := httptest.NewRecorder()
+	a.Router().ServeHTTP(resRecorder, req)
+
+	var resp map[string]interface{}
+	if err = json.NewDecoder(resRecorder.Body).Decode(&resp); err != nil {
+		t.Fatalf("Ошибка при декодировании JSON: %v", err)
+	}
+	return resRecorder.Code, resp
+}
+
+func TestAPI_oauthAuthorizationCode(t *testing.T) {
+	ctx := context.Background()
+	constr := "redis://localhost:6379"
+	// Создаём тестовую базу данных
+	db, _ := redisDB.New(constr)
+
+	// Создаём экземпляр API с тестовой базой данных
+	a := api.New(db, "../../web")
+
+	const redirectURI = "http://localhost:3000/callback"
+	err := db.AddClient(ctx, storage.Client{
+		ID:           "test-spa",
+		RedirectURIs: []string{redirectURI},
+		Scopes:       []string{"openid", "profile"},
+	})
+	if err != nil {
+		t.Fatalf("Ошибка при добавлении клиента: %v", err)
+	}
+
+	// Секрет PKCE и его преобразование S256
+	verifier := strings.Repeat("v", 43)
+	sum := sha256.Sum256([]byte(verifier))
+	challenge := base64.RawURLEncoding.EncodeToString(sum[:])
+
+	authorize := "/oauth2/authorize?" + url.Values{
+		"response_type":         {"code"},
+		"client_id":             {"test-spa"},
+		"redirect_uri":          {redirectURI},
+		"scope":                 {"openid"},
+		"state":                 {"xyz"},
+		"code_challenge":        {challenge},
+		"code_challenge_method": {"S256"},
+	}.Encode()
+
+	// Без сессии пользователь отправляется на страницу входа
+	req := httptest.NewRequest(http.MethodGet, authorize, nil)
+	resRecorder := httptest.NewRecorder()
+	a.Router().ServeHTTP(resRecorder, req)
+	if loc := resRecorder.Header().Get("Location"); !strings.HasPrefix(loc, "/?next=") {
+		t.Fatalf("Ожидается перенаправление на вход, получено %q", loc)
+	}
+
+	// После входа код отправляется на адрес клиента вместе со state
+	cookie := login(t, a, "ups@mail.ru", "Test123!")
+	req = httptest.NewRequest(http.MethodGet, authorize, nil)
+	req.AddCookie(cookie)
+	resRecorder = httptest.NewRecorder()
+	a.Router().ServeHTTP(resRecorder, req)
+	loc, err := url.Parse(resRecorder.Header().Get("Location"))
+	if err != nil || !strings.HasPrefix(loc.String(), redirectURI) {
+		t.Fatalf("Неверное перенаправление %v", resRecorder.Header().Get("Location"))
+	}
+	code := loc.Query().Get("code")
+	if code == "" || loc.Query().Get("state") != "xyz" {
+		t.Fatalf("Нет кода или state в перенаправлении %v", loc)
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {redirectURI},
+		"client_id":     {"test-spa"},
+		"code_verifier": {verifier},
+	}
+	status, resp := oauthToken(t, a, form)
+	if status != http.StatusOK || resp["access_token"] == nil {
+		t.Fatalf("Неверный ответ: статус %v, %v", status, resp)
+	}
+
+	refresh, _ := resp["refresh_token"].(string)
+
+	// Код одноразовый
+	status, resp = oauthToken(t, a, form)
+	if status != http.StatusBadRequest || resp["error"] != "invalid_grant" {
+		t.Errorf("Повторный обмен кода не отклонён: статус %v, %v", status, resp)
+	}
+
+	// Токен обновления клиента не принимается /api/token и при этом не сгорает
+	if code, resp := requestToken(t, a, map[string]string{"grant_type": "refresh_token", "refresh_token": refresh}); code != http.StatusBadRequest {
+		t.Errorf("Токен клиента принят /api/token: статус %v, %v", code, resp)
+	}
+	status, resp = oauthToken(t, a, url.Values{
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {refresh},
+		"client_id":     {"test-spa"},
+	})
+	if status != http.StatusOK || resp["refresh_token"] == nil {
+		t.Errorf("Токен обновления клиента не обменивается: статус %v, %v", status, resp)
+	}
+
+	// Незарегистрированный адрес перенаправления не принимается
+	req = httptest.NewRequest(http.MethodGet, strings.Replace(authorize, "3000", "4000", 1), nil)
+	req.AddCookie(cookie)
+	resRecorder = httptest.NewRecorder()
+	a.Router().ServeHTTP(resRecorder, req)
+	if resRecorder.Code != http.StatusBadRequest {
+		t.Errorf("Неверный статус код: получено %v, ожидается %v", resRecorder.Code, http.StatusBadRequest)
+	}
+}
+
+func TestAPI_oauthPKCERequired(t *testing.T) {
+	ctx := context.Background()
+	constr := "redis://localhost:6379"
+	// Создаём тестовую базу данных
+	db, _ := redisDB.New(constr)
+
+	// Создаём экземпляр API с тестовой базой данных
+	a := api.New(db, "../../web")
+
+	const redirectURI = "http://localhost:3000/callback"
+	err := db.AddClient(ctx, storage.Client{
+		ID:           "test-spa",
+		RedirectURIs: []string{redirectURI},
+		Scopes:       []string{"openid"},
+	})
+	if err != nil {
+		t.Fatalf("Ошибка при добавлении клиента: %v", err)
+	}
+
+	// Без code_challenge клиент получает ошибку на свой адрес
+	authorize := "/oauth2/authorize?" + url.Values{
+		"response_type": {"code"},
+		"client_id":     {"test-spa"},
+		"redirect_uri":  {redirectURI},
+	}.Encode()
+	req := httptest.NewRequest(http.MethodGet, authorize, nil)
+	resRecorder := httptest.NewRecorder()
+	a.Router().ServeHTTP(resRecorder, req)
+	loc, _ := url.Parse(resRecorder.Header().Get("Location"))
+	if loc == nil || loc.Query().Get("error") != "invalid_request" {
+		t.Errorf("Ожидается ошибка invalid_request, получено %v", resRecorder.Header().Get("Location"))
+	}
+}
+
+func TestAPI_discoveryHandler(t *testing.T) {
+	constr := "redis://localhost:6379"
+	// Создаём тестовую базу данных
+	db, _ := redisDB.New(constr)
+
+	// Создаём экземпляр API с тестовой базой данных
+	a := api.New(db, "../../web", api.WithIssuer("https://auth.example.com"))
+
+	req := httptest.NewRequest(http.MethodGet, "/.well-known/openid-configuration", nil)
+	resRecorder := httptest.NewRecorder()
+	a.Router().ServeHTTP(resRecorder, req)
+
+	var doc map[string]interface{}
+	if err := json.NewDecoder(resRecorder.Body).Decode(&doc); err != nil {
+		t.Fatalf("Ошибка при декодировании JSON: %v", err)
+	}
+	if doc["issuer"] != "https://auth.example.com" || doc["jwks_uri"] != "https://auth.example.com/.well-known/jwks.json" {
+		t.Errorf("Неверный документ обнаружения: %v", doc)
+	}
+}
+
+func TestAPI_openIDConnect(t *testing.T) {
+	ctx := context.Background()
+	constr := "redis://localhost:6379"
+	// Создаём тестовую базу данных
+	db, _ := redisDB.New(constr)
+
+	// Создаём экземпляр API с тестовой базой данных
+	a := api.New(db, "../../web")
+
+	const redirectURI = "http://localhost:3000/callback"
+	err := db.AddClient(ctx, storage.Client{
+		ID:           "test-oidc",
+		RedirectURIs: []string{redirectURI},
+		Scopes:       []string{"openid", "email"},
+	})
+	if err != nil {
+		t.Fatalf("Ошибка при добавлении клиента: %v", err)
+	}
+
+	verifier := strings.Repeat("v", 43)
+	sum := sha256.Sum256([]byte(verifier))
+	req := httptest.NewRequest(http.MethodGet, "/oauth2/authorize?"+url.Values{
+		"response_type":         {"code"},
+		"client_id":             {"test-oidc"},
+		"redirect_uri":          {redirectURI},
+		"scope":                 {"openid email"},
+		"nonce":                 {"n-0S6_WzA2Mj"},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(sum[:])},
+		"code_challenge_method": {"S256"},
+	}.Encode(), nil)
+	req.AddCookie(login(t, a, "ups@mail.ru", "Test123!"))
+	resRecorder := httptest.NewRecorder()
+	a.Router().ServeHTTP(resRecorder, req)
+	loc, _ := url.Parse(resRecorder.Header().Get("Location"))
+
+	status, resp := oauthToken(t, a, url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {loc.Query().Get("code")},
+		"redirect_uri":  {redirectURI},
+		"client_id":     {"test-oidc"},
+		"code_verifier": {verifier},
+	})
+	if status != http.StatusOK {
+		t.Fatalf("Неверный ответ: статус %v, %v", status, resp)
+	}
+
+	// Утверждения id_token
+	idToken, _ := resp["id_token"].(string)
+	parts := strings.Split(idToken, ".")
+	if len(parts) != 3 {
+		t.Fatalf("В ответе нет id_token: %v", resp)
+	}
+	payload, _ := base64.RawURLEncoding.DecodeString(parts[1])
+	var claims map[string]interface{}
+	if err = json.Unmarshal(payload, &claims); err != nil {
+		t.Fatalf("Ошибка при декодировании id_token: %v", err)
+	}
+	account, err := db.GetAccount(ctx, "ups@mail.ru")
+	if err != nil {
+		t.Fatalf("Аккаунт не найден: %v", err)
+	}
+	// sub — идентификатор пользователя, а не логин
+	if claims["sub"] != account.ID || claims["aud"] != "test-oidc" || claims["nonce"] != "n-0S6_WzA2Mj" ||
+		claims["email"] != "ups@mail.ru" || claims["auth_time"] == nil {
+		t.Errorf("Неверные утверждения id_token: %v", claims)
+	}
+	// Тот же субъект и в токене доступа
+	if sub := tokenClaims(t, resp["access_token"].(string))["sub"]; sub != account.ID {
+		t.Errorf("Неверный субъект токена доступа: получено %v, ожидается %v", sub, account.ID)
+	}
+
+	// Сведения о пользователе по токену доступа
+	req = httptest.NewRequest(http.MethodGet, "/userinfo", nil)
+	req.Header.Set("Authorization", "Bearer "+resp["access_token"].(string))
+	resRecorder = httptest.NewRecorder()
+	a.Router().ServeHTTP(resRecorder, req)
+	if resRecorder.Code != http.StatusOK {
+		t.Fatalf("Неверный статус код: получено %v, ожидается %v", resRecorder.Code, http.StatusOK)
+	}
+	var info map[string]interface{}
+	if err = json.NewDecoder(resRecorder.Body).Decode(&info); err != nil {
+		t.Fatalf("Ошибка при декодировании JSON: %v", err)
+	}
+	if info["sub"] != account.ID || info["email"] != "ups@mail.ru" {
+		t.Errorf("Неверные сведения о пользователе: %v", info)
+	}
+
+	// Без токена доступ запрещён
+	req = httptest.NewRequest(http.MethodGet, "/userinfo", nil)
+	resRecorder = httptest.NewRecorder()
+	a.Router().ServeHTTP(resRecorder, req)
+	if resRecorder.Code != http.StatusUnauthorized {
+		t.Errorf("Неверный статус код: получено %v, ожидается %v", resRecorder.Code, http.StatusUnauthorized)
+	}
+}
+
+// adminRequest Выполняет запрос администратора и возвращает статус и ответ.
+func adminRequest(t *testing.T, a *api.API, method, target, token string, body interface{}) (int, map[string]interface{}) {
+	t.Helper()
+
+	jsonData, err := json.Marshal(body)
+	if err != nil {
+		t.Fatalf("Ошибка при преобразовании данных в JSON: %v", err)
+	}
+	req := httptest.NewRequest(method, target, bytes.NewBuffer(jsonData))
+	req.Header.Set("Authorization", "Bearer "+token)
+	resRecorder := httptest.NewRecorder()
+	a.Router().ServeHTTP(resRecorder, req)
+
+	var resp map[string]interface{}
+	json.NewDecoder(resRecorder.Body).Decode(&resp)
+	return resRecorder.Code, resp
+}
+
+// clientCredentials Запрашивает токен сервиса с секретом в заголовке Basic.
+func clientCredentials(t *testing.T, a *api.API, id, secret string) int {
+	t.Helper()
+
+	form := url.Values{"grant_type": {"client_credentials"}, "scope": {"invoices:read"}}
+	req := httptest.NewRequest(http.MethodPost, "/oauth2/token", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(id, secret)
+	resRecorder := httptest.NewRecorder()
+	a.Router().ServeHTTP(resRecorder, req)
+	return resRecorder.Code
+}
+
+func TestAPI_adminClients_Unauthorized(t *testing.T) {
+	constr := "redis://localhost:6379"
+	// Создаём тестовую базу данных
+	db, _ := redisDB.New(constr)
+
+	// Без заданного токена администратора управление клиентами закрыто для всех
+	a := api.New(db, "../../web")
+	if code, _ := adminRequest(t, a, http.MethodPost, "/admin/clients", "", nil); code != http.StatusUnauthorized {
+		t.Errorf("Неверный статус код: получено %v, ожидается %v", code, http.StatusUnauthorized)
+	}
+
+	a = api.New(db, "../../web", api.WithAdminToken("admin-secret"))
+	if code, _ := adminRequest(t, a, http.MethodPost, "/admin/clients", "wrong", nil); code != http.StatusUnauthorized {
+		t.Errorf("Неверный статус код: получено %v, ожидается %v", code, http.StatusUnauthorized)
+	}
+}
+
+func TestAPI_clientCredentials(t *testing.T) {
+	constr := "redis://localhost:6379"
+	// Создаём тестовую базу данных
+	db, _ := redisDB.New(constr)
+
+	// Создаём экземпляр API с тестовой базой данных
+	a := api.New(db, "../../web", api.WithAdminToken("admin-secret"))
+
+	code, resp := adminRequest(t, a, http.MethodPost, "/admin/clients", "admin-secret", map[string]interface{}{
+		"name":       "billing",
+		"grantTypes": []string{"client_credentials"},
+		"scopes":     []string{"invoices:read", "openid"},
+	})
+	if code != http.StatusCreated || resp["secret"] == nil {
+		t.Fatalf("Клиент не создан: статус %v, %v", code, resp)
+	}
+	id, secret := resp["id"].(string), resp["secret"].(string)
+
+	if code = clientCredentials(t, a, id, secret); code != http.StatusOK {
+		t.Errorf("Неверный статус код: получено %v, ожидается %v", code, http.StatusOK)
+	}
+	if code = clientCredentials(t, a, id, "wrong"); code != http.StatusUnauthorized {
+		t.Errorf("Неверный статус код: получено %v, ожидается %v", code, http.StatusUnauthorized)
+	}
+
+	// Токен сервиса отмечен явно, сведений о пользователе по нему не получить даже с областью openid
+	code, resp = oauthToken(t, a, url.Values{
+		"grant_type":    {"client_credentials"},
+		"scope":         {"openid"},
+		"client_id":     {id},
+		"client_secret": {secret},
+	})
+	if code != http.StatusOK {
+		t.Fatalf("Токен не выдан: статус %v, %v", code, resp)
+	}
+	if claims := tokenClaims(t, resp["access_token"].(string)); claims["service"] != true || claims["sub"] != id {
+		t.Errorf("Токен сервиса не отмечен: %v", claims)
+	}
+	req := httptest.NewRequest(http.MethodGet, "/userinfo", nil)
+	req.Header.Set("Authorization", "Bearer "+resp["access_token"].(string))
+	resRecorder := httptest.NewRecorder()
+	a.Router().ServeHTTP(resRecorder, req)
+	if resRecorder.Code != http.StatusUnauthorized {
+		t.Errorf("Сведения о пользователе выданы по токену сервиса: статус %v", resRecorder.Code)
+	}
+
+	// После смены секрета прежний не действует
+	code, resp = adminRequest(t, a, http.MethodPost, "/admin/clients/"+id+"/secret", "admin-secret", nil)
+	if code != http.StatusOK || resp["secret"] == secret {
+		t.Fatalf("Секрет не сменён: статус %v, %v", code, resp)
+	}
+	if code = clientCredentials(t, a, id, secret); code != http.StatusUnauthorized {
+		t.Errorf("Неверный статус код: получено %v, ожидается %v", code, http.StatusUnauthorized)
+	}
+	newSecret := resp["secret"].(string)
+
+	// Отозванный клиент не получает токенов
+	if code, _ = adminRequest(t, a, http.MethodDelete, "/admin/clients/"+id, "admin-secret", nil); code != http.StatusOK {
+		t.Fatalf("Клиент не отозван: статус %v", code)
+	}
+	if code = clientCredentials(t, a, id, newSecret); code != http.StatusUnauthorized {
+		t.Errorf("Неверный статус код: получено %v, ожидается %v", code, http.StatusUnauthorized)
+	}
+}
+
+// deviceRequest Выполняет запрос к обработчику кода устройства с формой.
+func deviceRequest(t *testing.T, a *api.API, target string, form url.Values) (int, map[string]interface{}) {
+	t.Helper()
+
+	req := httptest.NewRequest(http.MethodPost, target, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resRecorder := httptest.NewRecorder()
+	a.Router().ServeHTTP(resRecorder, req)
+
+	var resp map[string]interface{}
+	if err := json.NewDecoder(resRecorder.Body).Decode(&resp); err != nil {
+		t.Fatalf("Ошибка при декодировании JSON: %v", err)
+	}
+	return resRecorder.Code, resp
+}
+
+func TestAPI_deviceAuthorization(t *testing.T) {
+	ctx := context.Background()
+	constr := "redis://localhost:6379"
+	// Создаём тестовую базу данных
+	db, _ := redisDB.New(constr)
+
+	// Создаём экземпляр API с тестовой базой данных
+	a := api.New(db, "../../web")
+
+	err := db.AddClient(ctx, storage.Client{
+		ID:         "test-cli",
+		Scopes:     []string{"openid"},
+		GrantTypes: []string{"urn:ietf:params:oauth:grant-type:device_code"},
+	})
+	if err != nil {
+		t.Fatalf("Ошибка при добавлении клиента: %v", err)
+	}
+
+	status, resp := deviceRequest(t, a, "/oauth2/device_authorization", url.Values{"client_id": {"test-cli"}})
+	if status != http.StatusOK || resp["device_code"] == nil || resp["user_code"] == nil {
+		t.Fatalf("Неверный ответ: статус %v, %v", status, resp)
+	}
+	poll := url.Values{
+		"grant_type":  {"urn:ietf:params:oauth:grant-type:device_code"},
+		"device_code": {resp["device_code"].(string)},
+		"client_id":   {"test-cli"},
+	}
+
+	// Пока пользователь не подтвердил вход, устройство ждёт, а частый опрос замедляется
+	if _, resp := deviceRequest(t, a, "/oauth2/token", poll); resp["error"] != "authorization_pending" {
+		t.Errorf("Ожидается authorization_pending, получено %v", resp)
+	}
+	if _, resp := deviceRequest(t, a, "/oauth2/token", poll); resp["error"] != "slow_down" {
+		t.Errorf("Ожидается slow_down, получено %v", resp)
+	}
+
+	// Пользователь вводит код на странице /device
+	jsonData, _ := json.Marshal(map[string]interface{}{"user_code": resp["user_code"], "approve": true})
+	req := httptest.NewRequest(http.MethodPost, "/device", bytes.NewBuffer(jsonData))
+	req.AddCookie(login(t, a, "ups@mail.ru", "Test123!"))
+	resRecorder := httptest.NewRecorder()
+	a.Router().ServeHTTP(resRecorder, req)
+	if !strings.Contains(resRecorder.Body.String(), `"success":true`) {
+		t.Fatalf("Код не подтверждён: %v", resRecorder.Body.String())
+	}
+
+	// После подтверждения и паузы устройство получает токены
+	time.Sleep(5 * time.Second)
+	status, resp = deviceRequest(t, a, "/oauth2/token", poll)
+	if status != http.StatusOK || resp["access_token"] == nil {
+		t.Errorf("Неверный ответ: статус %v, %v", status, resp)
+	}
+}
+
+func TestAPI_introspectAndRevoke(t *testing.T) {
+	ctx := context.Background()
+	constr := "redis://localhost:6379"
+	// Создаём тестовую базу данных
+	db, _ := redisDB.New(constr)
+
+	// Создаём экземпляр API с тестовой базой данных
+	a := api.New(db, "../../web")
+
+	sum := sha256.Sum256([]byte("test-secret"))
+	for _, c := range []storage.Client{
+		{ID: "test-resource", GrantTypes: []string{"client_credentials"}, SecretHash: hex.EncodeToString(sum[:])},
+		{ID: "test-public", GrantTypes: []string{"client_credentials"}},
+	} {
+		if err := db.AddClient(ctx, c); err != nil {
+			t.Fatalf("Ошибка при создании клиента: %v", err)
+		}
+	}
+	auth := url.Values{"client_id": {"test-resource"}, "client_secret": {"test-secret"}}
+
+	code, resp := oauthToken(t, a, url.Values{
+		"grant_type":    {"client_credentials"},
+		"client_id":     {"test-resource"},
+		"client_secret": {"test-secret"},
+	})
+	if code != http.StatusOK {
+		t.Fatalf("Токен не выдан: статус %v, %v", code, resp)
+	}
+	token := resp["access_token"].(string)
+
+	form := url.Values{"token": {token}}
+	for k, v := range auth {
+		form[k] = v
+	}
+	code, resp = deviceRequest(t, a, "/oauth2/introspect", form)
+	if code != http.StatusOK || resp["active"] != true || resp["client_id"] != "test-resource" {
+		t.Fatalf("Действующий токен не распознан: статус %v, %v", code, resp)
+	}
+	if resp["username"] != nil {
+		t.Errorf("У токена сервиса указан пользователь: %v", resp)
+	}
+
+	// Для токена пользователя субъект — ID аккаунта, логин возвращается отдельно
+	account, err := db.GetAccount(ctx, "ups@mail.ru")
+	if err != nil {
+		t.Fatalf("Аккаунт не найден: %v", err)
+	}
+	code, resp = requestToken(t, a, map[string]string{
+		"grant_type": "password",
+		"username":   "ups@mail.ru",
+		"password":   "Test123!",
+	})
+	if code != http.StatusOK {
+		t.Fatalf("Токен не выдан: статус %v, %v", code, resp)
+	}
+	for _, hint := range []string{"access_token", "refresh_token"} {
+		userForm := url.Values{"token": {resp[hint].(string)}, "token_type_hint": {hint}}
+		for k, v := range auth {
+			userForm[k] = v
+		}
+		code, info := deviceRequest(t, a, "/oauth2/introspect", userForm)
+		if code != http.StatusOK || info["active"] != true || info["sub"] != account.ID || info["username"] != "ups@mail.ru" {
+			t.Errorf("Неверные сведения о токене %s: статус %v, %v", hint, code, info)
+		}
+	}
+
+	// Публичный клиент не проверяет токены
+	code, _ = deviceRequest(t, a, "/oauth2/introspect", url.Values{"token": {token}, "client_id": {"test-public"}})
+	if code != http.StatusUnauthorized {
+		t.Errorf("Неверный статус код: получено %v, ожидается %v", code, http.StatusUnauthorized)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/oauth2/revoke", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resRecorder := httptest.NewRecorder()
+	a.Router().ServeHTTP(resRecorder, req)
+	if resRecorder.Code != http.StatusOK {
+		t.Fatalf("Неверный статус код: получено %v, ожидается %v", resRecorder.Code, http.StatusOK)
+	}
+
+	// Отозванный токен больше не действует
+	code, resp = deviceRequest(t, a, "/oauth2/introspect", form)
+	if code != http.StatusOK || resp["active"] != false {
+		t.Errorf("Отозванный токен действует: статус %v, %v", code, resp)
+	}
+}
+
+// jsonRequest Выполняет запрос с JSON и cookie сессии.
+func jsonRequest(t *testing.T, a *api.API, method, target string, cookie *http.Cookie, body interface{}) *httptest.ResponseRecorder {
+	t.Helper()
+
+	jsonData, err := json.Marshal(body)
+	if err != nil {
+		t.Fatalf("Ошибка при преобразовании данных в JSON: %v", err)
+	}
+	req := httptest.NewRequest(method, target, bytes.NewBuffer(jsonData))
+	req.Header.Set("Content-Type", "application/json")
+	if cookie != nil {
+		req.AddCookie(cookie)
+	}
+	resRecorder := httptest.NewRecorder()
+	a.Router().ServeHTTP(resRecorder, req)
+	return resRecorder
+}
+
+func TestAPI_totpLogin(t *testing.T) {
+	ctx := context.Background()
+	constr := "redis://localhost:6379"
+	// Создаём тестовую базу данных
+	db, _ := redisDB.New(constr)
+
+	// Создаём экземпляр API с тестовой базой данных
+	a := api.New(db, "../../web")
+
+	// Отдельный пользователь, чтобы второй фактор не мешал остальным тестам
+	const username, password = "totp@mail.ru", "Test123!"
+	db.DelTOTP(ctx, username)
+	createUser(t, db, username, password)
+	defer db.DelTOTP(ctx, username)
+
+	cookie := login(t, a, username, password)
+
+	res := jsonRequest(t, a, http.MethodPost, "/api/2fa/totp", cookie, nil)
+	var setup map[string]interface{}
+	if err := json.NewDecoder(res.Body).Decode(&setup); err != nil || res.Code != http.StatusOK {
+		t.Fatalf("Аутентификатор не создан: статус %v, %v", res.Code, err)
+	}
+	secret := setup["secret"].(string)
+	if !strings.HasPrefix(setup["uri"].(string), "otpauth://totp/") {
+		t.Errorf("Неверный адрес otpauth: %v", setup["uri"])
+	}
+
+	res = jsonRequest(t, a, http.MethodGet, "/api/2fa/totp/qr", cookie, nil)
+	if res.Code != http.StatusOK || res.Header().Get("Content-Type") != "image/png" {
+		t.Errorf("QR-код не получен: статус %v", res.Code)
+	}
+
+	// До подтверждения вход по паролю не требует кода
+	login(t, a, username, password)
+
+	code, _ := totp.Code(secret, time.Now())
+	res = jsonRequest(t, a, http.MethodPost, "/api/2fa/totp/confirm", cookie, map[string]string{"code": code})
+	var confirm struct {
+		Success       bool     `json:"success"`
+		RecoveryCodes []string `json:"recoveryCodes"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&confirm); err != nil || !confirm.Success || len(confirm.RecoveryCodes) == 0 {
+		t.Fatalf("Аутентификатор не подтверждён: статус %v, %v", res.Code, confirm)
+	}
+
+	// Верный пароль больше не создаёт сессию
+	res = jsonRequest(t, a, http.MethodPost, "/login", nil, storage.FormAccount{Username: username, Password: password})
+	var pending struct {
+		MFARequired bool   `json:"mfaRequired"`
+		MFAToken    string `json:"mfaToken"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&pending); err != nil || !pending.MFARequired || pending.MFAToken == "" {
+		t.Fatalf("Второй фактор не запрошен: статус %v, %v", res.Code, pending)
+	}
+	if len(res.Result().Cookies()) != 0 {
+		t.Error("Сессия создана без второго фактора")
+	}
+
+	// Код подтверждения уже использован, повторно он не принимается
+	res = jsonRequest(t, a, http.MethodPost, "/login/2fa", nil, map[string]string{"mfaToken": pending.MFAToken, "code": code})
+	if res.Code != http.StatusOK || len(res.Result().Cookies()) != 0 {
+		t.Errorf("Повторный код принят: статус %v", res.Code)
+	}
+
+	// Код восстановления действует один раз
+	recovery := map[string]string{"mfaToken": pending.MFAToken, "code": confirm.RecoveryCodes[0]}
+	res = jsonRequest(t, a, http.MethodPost, "/login/2fa", nil, recovery)
+	if res.Code != http.StatusFound {
+		t.Fatalf("Неверный статус код: получено %v, ожидается %v", res.Code, http.StatusFound)
+	}
+	res = jsonRequest(t, a, http.MethodPost, "/login/2fa", nil, recovery)
+	if res.Code == http.StatusFound {
+		t.Error("Токен ожидания второго фактора использован повторно")
+	}
+
+	// Аккаунт, отключённый между паролем и кодом, не входит
+	res = jsonRequest(t, a, http.MethodPost, "/login", nil, storage.FormAccount{Username: username, Password: password})
+	if err := json.NewDecoder(res.Body).Decode(&pending); err != nil || !pending.MFARequired {
+		t.Fatalf("Второй фактор не запрошен: статус %v, %v", res.Code, pending)
+	}
+	if _, err := db.SetAccountStatus(ctx, username, storage.StatusDisabled); err != nil {
+		t.Fatalf("Ошибка при изменении статуса: %v", err)
+	}
+	res = jsonRequest(t, a, http.MethodPost, "/login/2fa", nil, map[string]string{"mfaToken": pending.MFAToken, "code": confirm.RecoveryCodes[1]})
+	if res.Code != http.StatusForbidden || len(res.Result().Cookies()) != 0 {
+		t.Errorf("Вход в отключённый аккаунт после второго фактора: статус %v", res.Code)
+	}
+}
+
+// ceremony Ответ begin церемонии WebAuthn.
+type ceremony struct {
+	Options struct {
+		Challenge webauthn.Bytes `json:"challenge"`
+	} `json:"options"`
+	Ceremony string `json:"ceremony"`
+}
+
+func TestAPI_webauthn(t *testing.T) {
+	ctx := context.Background()
+	constr := "redis://localhost:6379"
+	// Создаём тестовую базу данных
+	db, _ := redisDB.New(constr)
+
+	// Создаём экземпляр API с тестовой базой данных
+	a := api.New(db, "../../web")
+
+	const username, password = "passkey@mail.ru", "Test123!"
+	db.DelUserCredentials(ctx, username)
+	createUser(t, db, username, password)
+	defer db.DelUserCredentials(ctx, username)
+
+	// Программный аутентификатор для адреса сервиса по умолчанию
+	authenticator := webauthntest.New("127.0.0.1", "http://127.0.0.1:5000")
+	cookie := login(t, a, username, password)
+
+	var begin ceremony
+	res := jsonRequest(t, a, http.MethodPost, "/api/webauthn/register/begin", cookie, nil)
+	if err := json.NewDecoder(res.Body).Decode(&begin); err != nil || res.Code != http.StatusOK {
+		t.Fatalf("Регистрация не начата: статус %v, %v", res.Code, err)
+	}
+	created, err := authenticator.Create(begin.Options.Challenge, webauthntest.FormatPacked)
+	if err != nil {
+		t.Fatalf("Ошибка аутентификатора: %v", err)
+	}
+	finish := map[string]interface{}{"ceremony": begin.Ceremony, "name": "Тест", "credential": created}
+	res = jsonRequest(t, a, http.MethodPost, "/api/webauthn/register/finish", cookie, finish)
+	if res.Code != http.StatusOK {
+		t.Fatalf("Ключ доступа не зарегистрирован: статус %v, %s", res.Code, res.Body)
+	}
+
+	// Токен церемонии одноразовый
+	res = jsonRequest(t, a, http.MethodPost, "/api/webauthn/register/finish", cookie, finish)
+	if res.Code == http.StatusOK {
+		t.Error("Регистрация повторена тем же токеном")
+	}
+
+	res = jsonRequest(t, a, http.MethodGet, "/api/webauthn/credentials", cookie, nil)
+	var list struct {
+		Credentials []struct {
+			ID   string `json:"id"`
+			Name string `json:"name"`
+		} `json:"credentials"`
+	}
+	if err = json.NewDecoder(res.Body).Decode(&list); err != nil || len(list.Credentials) != 1 || list.Credentials[0].Name != "Тест" {
+		t.Fatalf("Неверный список ключей доступа: статус %v, %v", res.Code, list)
+	}
+
+	// allowed Возвращает ключи, которые сервис предлагает для входа по логину
+	allowed := func(username string) string {
+		t.Helper()
+
+		var begin struct {
+			Options webauthn.RequestOptions `json:"options"`
+		}
+		res := jsonRequest(t, a, http.MethodPost, "/login/webauthn/begin", nil, map[string]string{"username": username})
+		if err := json.NewDecoder(res.Body).Decode(&begin); err != nil || res.Code != http.StatusOK {
+			t.Fatalf("Вход не начат: статус %v, %v", res.Code, err)
+		}
+		if len(begin.Options.AllowCredentials) != 1 {
+			t.Fatalf("Предложено ключей %d, ожидается 1", len(begin.Options.AllowCredentials))
+		}
+		return base64.RawURLEncoding.EncodeToString(begin.Options.AllowCredentials[0].ID)
+	}
+
+	// Неизвестному логину предлагается подставной ключ, всегда один и тот же
+	if allowed("nobody@mail.ru") != allowed("nobody@mail.ru") || allowed("nobody@mail.ru") == allowed("other@mail.ru") {
+		t.Error("Подставной ключ меняется от запроса к запросу или одинаков для разных логинов")
+	}
+	if allowed(username) != list.Credentials[0].ID {
+		t.Error("Пользователю предложен не его ключ")
+	}
+
+	// Вход ключом доступа без пароля
+	assertion := func(username string) map[string]interface{} {
+		t.Helper()
+
+		var begin ceremony
+		res := jsonRequest(t, a, http.MethodPost, "/login/webauthn/begin", nil, map[string]string{"username": username})
+		if err := json.NewDecoder(res.Body).Decode(&begin); err != nil || res.Code != http.StatusOK {
+			t.Fatalf("Вход не начат: статус %v, %v", res.Code, err)
+		}
+		got, err := authenticator.Get(created.ID, begin.Options.Challenge)
+		if err != nil {
+			t.Fatalf("Ошибка аутентификатора: %v", err)
+		}
+		return map[string]interface{}{"ceremony": begin.Ceremony, "credential": got}
+	}
+	finish = assertion(username)
+	res = jsonRequest(t, a, http.MethodPost, "/login/webauthn/finish", nil, finish)
+	if res.Code != http.StatusFound || len(res.Result().Cookies()) == 0 {
+		t.Fatalf("Вход ключом доступа не выполнен: статус %v, %s", res.Code, res.Body)
+	}
+	res = jsonRequest(t, a, http.MethodPost, "/login/webauthn/finish", nil, finish)
+	if res.Code == http.StatusFound {
+		t.Error("Ответ аутентификатора принят повторно")
+	}
+
+	// Вход без логина: пользователь определяется по ключу
+	res = jsonRequest(t, a, http.MethodPost, "/login/webauthn/finish", nil, assertion(""))
+	if res.Code != http.StatusFound {
+		t.Errorf("Вход без логина не выполнен: статус %v", res.Code)
+	}
+
+	// Ключ не подходит к чужому логину
+	res = jsonRequest(t, a, http.MethodPost, "/login/webauthn/finish", nil, assertion("other@mail.ru"))
+	if res.Code == http.StatusFound {
+		t.Error("Вход выполнен ключом другого пользователя")
+	}
+
+	// Скопированный ключ с отставшим счётчиком отклоняется
+	authenticator.Counter = 0
+	res = jsonRequest(t, a, http.MethodPost, "/login/webauthn/finish", nil, assertion(username))
+	if res.Code == http.StatusFound {
+		t.Error("Принят ключ с отставшим счётчиком")
+	}
+
+	res = jsonRequest(t, a, http.MethodDelete, "/api/webauthn/credentials/"+list.Credentials[0].ID, cookie, nil)
+	if res.Code != http.StatusOK {
+		t.Errorf("Ключ доступа не удалён: статус %v", res.Code)
+	}
+}
+
+// mailbox Почта для тестов: запоминает отправленные письма.
+type mailbox struct {
+	mu   sync.Mutex
+	sent []map[string]string
+}
+
+func (m *mailbox) Send(_ context.Context, to, template string, data map[string]string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sent = append(m.sent, data)
+	return nil
+}
+
+// wait Ждёт, пока не будет отправлено n писем, и возвращает отправленные письма.
+func (m *mailbox) wait(t *testing.T, n int) []map[string]string {
+	t.Helper()
+
+	for deadline := time.Now().Add(2 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		m.mu.Lock()
+		sent := append([]map[string]string(nil), m.sent...)
+		m.mu.Unlock()
+		if len(sent) >= n {
+			return sent
+		}
+	}
+	t.Fatalf("Письмо не отправлено, ожидается писем: %d", n)
+	return nil
+}
+
+func TestAPI_emailVerification(t *testing.T) {
+	ctx := context.Background()
+	constr := "redis://localhost:6379"
+	// Создаём тестовую базу данных
+	db, _ := redisDB.New(constr)
+
+	// Вход только с подтверждённым адресом
+	mail := &mailbox{}
+	a := api.New(db, "../../web", api.WithMailer(mail), api.WithEmailVerification(true))
+
+	const username, password = "verify@mail.ru", "Test123!"
+	db.DelAccount(ctx, storage.Account{Username: username})
+	db.DelEmailVerification(ctx, username)
+	defer db.DelEmailVerification(ctx, username)
+	defer db.DelAccount(ctx, storage.Account{Username: username})
+
+	res := jsonRequest(t, a, http.MethodPost, "/registration", nil, storage.FormAccount{Username: username, Password: password})
+	if res.Code != http.StatusOK || len(mail.sent) != 1 {
+		t.Fatalf("Письмо не отправлено: статус %v, писем %d", res.Code, len(mail.sent))
+	}
+
+	// До подтверждения сессия не создаётся
+	res = jsonRequest(t, a, http.MethodPost, "/login", nil, storage.FormAccount{Username: username, Password: password})
+	if res.Code != http.StatusForbidden || len(res.Result().Cookies()) != 0 {
+		t.Errorf("Вход с неподтверждённым адресом: статус %v", res.Code)
+	}
+	if code, _ := requestToken(t, a, map[string]string{"grant_type": "password", "username": username, "password": password}); code != http.StatusBadRequest {
+		t.Errorf("Токен выдан для неподтверждённого адреса: статус %v", code)
+	}
+
+	// Испорченная ссылка не подтверждает адрес
+	link, err := url.Parse(mail.sent[0]["Link"])
+	if err != nil || link.Path != "/verify-email" {
+		t.Fatalf("Неверная ссылка подтверждения: %v", mail.sent[0]["Link"])
+	}
+	res = jsonRequest(t, a, http.MethodGet, "/verify-email?token="+link.Query().Get("token")+"x", nil, nil)
+	if res.Code != http.StatusBadRequest {
+		t.Errorf("Неверный статус код: получено %v, ожидается %v", res.Code, http.StatusBadRequest)
+	}
+
+	// Повторная отправка отвечает одинаково для любого адреса
+	res = jsonRequest(t, a, http.MethodPost, "/verify-email/resend", nil, map[string]string{"username": username})
+	other := jsonRequest(t, a, http.MethodPost, "/verify-email/resend", nil, map[string]string{"username": "nobody@mail.ru"})
+	if res.Body.String() != other.Body.String() || len(mail.sent) != 2 {
+		t.Errorf("Ответы повторной отправки различаются или письмо не отправлено: писем %d", len(mail.sent))
+	}
+
+	// Сбой после записи о подтверждении: запись отмечена, аккаунт нет.
+	// Подтверждён ли адрес, решает аккаунт, поэтому ссылки отправляются и действуют
+	v, err := db.SearchEmailVerification(ctx, username)
+	if err != nil {
+		t.Fatalf("Запись подтверждения не найдена: %v", err)
+	}
+	v.Verified, v.VerifiedAt = true, time.Now().UTC()
+	if err = db.SetEmailVerification(ctx, *v); err != nil {
+		t.Fatalf("Ошибка при изменении записи подтверждения: %v", err)
+	}
+	jsonRequest(t, a, http.MethodPost, "/verify-email/resend", nil, map[string]string{"username": username})
+	if len(mail.sent) != 3 {
+		t.Errorf("Ссылка не отправлена неподтверждённому аккаунту: писем %d", len(mail.sent))
+	}
+
+	res = jsonRequest(t, a, http.MethodGet, link.RequestURI(), nil, nil)
+	if res.Code != http.StatusOK {
+		t.Fatalf("Адрес не подтверждён: статус %v, %s", res.Code, res.Body)
+	}
+	login(t, a, username, password)
+
+	// Подтверждённому адресу новые ссылки не отправляются
+	jsonRequest(t, a, http.MethodPost, "/verify-email/resend", nil, map[string]string{"username": username})
+	if len(mail.sent) != 3 {
+		t.Errorf("Отправлено лишнее письмо: писем %d", len(mail.sent))
+	}
+}
+
+func TestAPI_passwordReset(t *testing.T) {
+	ctx := context.Background()
+	constr := "redis://localhost:6379"
+	// Создаём тестовую базу данных
+	db, _ := redisDB.New(constr)
+
+	mail := &mailbox{}
+	a := api.New(db, "../../web", api.WithMailer(mail))
+
+	const username, password, newPassword = "reset@mail.ru", "Test123!", "Brand9new#Pass"
+	db.DelUserPasswordResets(ctx, username)
+	createUser(t, db, username, password)
+	defer db.DelUserPasswordResets(ctx, username)
+
+	cookie := login(t, a, username, password)
+	code, tokens := requestToken(t, a, map[string]string{"grant_type": "password", "username": username, "password": password})
+	if code != http.StatusOK {
+		t.Fatalf("Токены не выданы: %v %v", code, tokens)
+	}
+
+	// Ответ не выдаёт, существует ли аккаунт; письмо уходит в фоне и только на существующий адрес
+	other := jsonRequest(t, a, http.MethodPost, "/password/forgot", nil, map[string]string{"username": "nobody@mail.ru"})
+	res := jsonRequest(t, a, http.MethodPost, "/password/forgot", nil, map[string]string{"username": username})
+	if res.Code != http.StatusOK || res.Body.String() != other.Body.String() {
+		t.Errorf("Ответы различаются: %s и %s", res.Body, other.Body)
+	}
+	sent := mail.wait(t, 1)
+	if len(sent) != 1 {
+		t.Fatalf("Отправлено писем %d, ожидается 1", len(sent))
+	}
+	link, err := url.Parse(sent[0]["Link"])
+	if err != nil || link.Path != "/password/reset" {
+		t.Fatalf("Неверная ссылка сброса: %v", sent[0]["Link"])
+	}
+	token := link.Query().Get("token")
+
+	// Слабый пароль отклоняется и не расходует токен
+	res = jsonRequest(t, a, http.MethodPost, "/password/reset", nil, map[string]string{"token": token, "password": "weak"})
+	var weak storage.Response
+	if err = json.NewDecoder(res.Body).Decode(&weak); err != nil || weak.Success || len(weak.ErrorMessages) == 0 {
+		t.Errorf("Слабый пароль принят: %v", weak)
+	}
+
+	res = jsonRequest(t, a, http.MethodPost, "/password/reset", nil, map[string]string{"token": token, "password": newPassword})
+	if res.Code != http.StatusOK {
+		t.Fatalf("Пароль не сброшен: статус %v, %s", res.Code, res.Body)
+	}
+
+	// Токен одноразовый
+	res = jsonRequest(t, a, http.MethodPost, "/password/reset", nil, map[string]string{"token": token, "password": newPassword + "1"})
+	if res.Code != http.StatusBadRequest {
+		t.Errorf("Токен сброса использован повторно: статус %v", res.Code)
+	}
+
+	// Сессии и токены, полученные со старым паролем, больше не действуют
+	if code := dashboardStatus(t, a, cookie); code != http.StatusFound {
+		t.Errorf("Сессия не завершена: статус %v", code)
+	}
+	if code, resp := requestToken(t, a, map[string]string{"grant_type": "refresh_token", "refresh_token": tokens["refresh_token"].(string)}); code != http.StatusBadRequest {
+		t.Errorf("Токен обновления действует после сброса пароля: %v %v", code, resp)
+	}
+	if revoked, err := db.AccessTokenRevoked(ctx, tokenClaims(t, tokens["access_token"].(string))["jti"].(string)); err != nil || !revoked {
+		t.Errorf("Токен доступа не отозван после сброса пароля: %v", err)
+	}
+	login(t, a, username, newPassword)
+	res = jsonRequest(t, a, http.MethodPost, "/login", nil, storage.FormAccount{Username: username, Password: password})
+	if len(res.Result().Cookies()) != 0 {
+		t.Error("Вход со старым паролем")
+	}
+}
+
+func TestAPI_changePassword(t *testing.T) {
+	ctx := context.Background()
+	constr := "redis://localhost:6379"
+	// Создаём тестовую базу данных
+	db, _ := redisDB.New(constr)
+
+	a := api.New(db, "../../web")
+
+	const username, password, newPassword = "change@mail.ru", "Test123!", "Brand9new#Pass"
+	db.DelUserSessions(ctx, username)
+	createUser(t, db, username, password)
+	defer db.DelUserSessions(ctx, username)
+
+	other := login(t, a, username, password)
+	cookie := login(t, a, username, password)
+	code, tokens := requestToken(t, a, map[string]string{"grant_type": "password", "username": username, "password": password})
+	if code != http.StatusOK {
+		t.Fatalf("Токены не выданы: %v %v", code, tokens)
+	}
+
+	// Без сессии пароль не меняется
+	res := jsonRequest(t, a, http.MethodPost, "/api/password", nil, map[string]interface{}{"currentPassword": password, "newPassword": newPassword})
+	if res.Code != http.StatusUnauthorized {
+		t.Errorf("Неверный статус код: получено %v, ожидается %v", res.Code, http.StatusUnauthorized)
+	}
+
+	// Подбор текущего пароля через сессию ограничен так же, как вход
+	for i := 0; i < throttle.AccountPolicy.Free+1; i++ {
+		res = jsonRequest(t, a, http.MethodPost, "/api/password", cookie, map[string]interface{}{"currentPassword": "Wrong123!", "newPassword": newPassword})
+		if res.Code != http.StatusForbidden {
+			t.Fatalf("Попытка %d: принят неверный текущий пароль, статус %v", i+1, res.Code)
+		}
+	}
+	res = jsonRequest(t, a, http.MethodPost, "/api/password", cookie, map[string]interface{}{"currentPassword": password, "newPassword": newPassword})
+	if res.Code != http.StatusTooManyRequests {
+		t.Fatalf("Неверный статус код: получено %v, ожидается %v", res.Code, http.StatusTooManyRequests)
+	}
+	time.Sleep(throttle.AccountPolicy.Delay + 100*time.Millisecond)
+
+	res = jsonRequest(t, a, http.MethodPost, "/api/password", cookie, map[string]interface{}{"currentPassword": password, "newPassword": "weak"})
+	var weak storage.Response
+	if err := json.NewDecoder(res.Body).Decode(&weak); err != nil || weak.Success || len(weak.ErrorMessages) == 0 {
+		t.Errorf("Слабый пароль принят: %v", weak)
+	}
+
+	res = jsonRequest(t, a, http.MethodPost, "/api/password", cookie, map[string]interface{}{
+		"currentPassword": password,
+		"newPassword":     newPassword,
+		"logoutOthers":    true,
+	})
+	var changed storage.Response
+	if err := json.NewDecoder(res.Body).Decode(&changed); err != nil || !changed.Success {
+		t.Fatalf("Пароль не изменён: статус %v, %v", res.Code, changed)
+	}
+
+	// Текущая сессия остаётся, остальные завершены
+	if code := dashboardStatus(t, a, cookie); code != http.StatusOK {
+		t.Errorf("Текущая сессия завершена: статус %v", code)
+	}
+	if code := dashboardStatus(t, a, other); code != http.StatusFound {
+		t.Errorf("Другая сессия не завершена: статус %v", code)
+	}
+	if code, resp := requestToken(t, a, map[string]string{"grant_type": "refresh_token", "refresh_token": tokens["refresh_token"].(string)}); code != http.StatusBadRequest {
+		t.Errorf("Токен обновления действует после смены пароля: %v %v", code, resp)
+	}
+	login(t, a, username, newPassword)
+}
+
+func TestAPI_loginThrottle(t *testing.T) {
+	ctx := context.Background()
+	constr := "redis://localhost:6379"
+	// Создаём тестовую базу данных
+	db, _ := redisDB.New(constr)
+
+	// Счётчики попыток в памяти этого экземпляра, чтобы не мешать остальным тестам
+	a := api.New(db, "../../web")
+
+	const username, password = "throttle@mail.ru", "Test123!"
+	createUser(t, db, username, password)
+	defer db.DelUserSessions(ctx, username)
+
+	form := func(password string) storage.FormAccount {
+		return storage.FormAccount{Username: username, Password: password}
+	}
+
+	// Первые неудачные попытки проходят без паузы
+	for i := 0; i < throttle.AccountPolicy.Free+1; i++ {
+		res := jsonRequest(t, a, http.MethodPost, "/login", nil, form("Wrong123!"))
+		if res.Code != http.StatusOK {
+			t.Fatalf("Попытка %d: статус %v, ожидается %v", i+1, res.Code, http.StatusOK)
+		}
+	}
+
+	// Во время паузы отклоняется даже верный пароль
+	res := jsonRequest(t, a, http.MethodPost, "/login", nil, form(password))
+	if res.Code != http.StatusTooManyRequests {
+		t.Fatalf("Неверный статус код: получено %v, ожидается %v", res.Code, http.StatusTooManyRequests)
+	}
+	if res.Header().Get("Retry-After") != "1" {
+		t.Errorf("Retry-After = %q", res.Header().Get("Retry-After"))
+	}
+	code, resp := requestToken(t, a, map[string]string{"grant_type": "password", "username": username, "password": password})
+	if code != http.StatusTooManyRequests || resp["error"] != "invalid_grant" {
+		t.Errorf("Токен выдан во время паузы: %v %v", code, resp)
+	}
+
+	time.Sleep(throttle.AccountPolicy.Delay + 100*time.Millisecond)
+	res = jsonRequest(t, a, http.MethodPost, "/login", nil, form(password))
+	if res.Code != http.StatusFound {
+		t.Fatalf("Вход после паузы: статус %v, ожидается %v", res.Code, http.StatusFound)
+	}
+
+	// Успешный вход сбросил счётчик аккаунта
+	res = jsonRequest(t, a, http.MethodPost, "/login", nil, form("Wrong123!"))
+	if res.Code != http.StatusOK {
+		t.Errorf("Счётчик не сброшен после входа: статус %v", res.Code)
+	}
+
+	// Перебор разных аккаунтов с одного адреса
+	for i := 0; i < throttle.AddressPolicy.Free+1; i++ {
+		req := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(fmt.Sprintf(`{"username":"nobody%d@mail.ru","password":"x"}`, i)))
+		req.RemoteAddr = "198.51.100.7:4000"
+		a.Router().ServeHTTP(httptest.NewRecorder(), req)
+	}
+	req := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(`{"username":"nobody@mail.ru","password":"x"}`))
+	req.RemoteAddr = "198.51.100.7:4001"
+	resRecorder := httptest.NewRecorder()
+	a.Router().ServeHTTP(resRecorder, req)
+	if resRecorder.Code != http.StatusTooManyRequests {
+		t.Errorf("Перебор с одного адреса не остановлен: статус %v", resRecorder.Code)
+	}
+}
+
+func TestAPI_loginThrottleConcurrent(t *testing.T) {
+	constr := "redis://localhost:6379"
+	// Создаём тестовую базу данных
+	db, _ := redisDB.New(constr)
+
+	// Счётчики попыток в памяти этого экземпляра, чтобы не мешать остальным тестам
+	a := api.New(db, "../../web")
+
+	const username, password = "throttle-race@mail.ru", "Test123!"
+	createUser(t, db, username, password)
+
+	// Параллельный перебор проверяет пароль не больше раз, чем последовательный
+	const n = 30
+	responses := make([]*httptest.ResponseRecorder, n)
+	var wg sync.WaitGroup
+	for i := range responses {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			responses[i] = jsonRequest(t, a, http.MethodPost, "/login", nil, storage.FormAccount{Username: username, Password: fmt.Sprintf("Wrong%d!", i)})
+		}(i)
+	}
+	wg.Wait()
+
+	checked := 0
+	for _, res := range responses {
+		switch res.Code {
+		case http.StatusOK:
+			checked++
+		case http.StatusTooManyRequests:
+		default:
+			t.Fatalf("Неверный статус код: %v", res.Code)
+		}
+	}
+	if checked != throttle.AccountPolicy.Free+1 {
+		t.Errorf("Проверено паролей: %d, ожидается %d", checked, throttle.AccountPolicy.Free+1)
+	}
+}
+
+func TestAPI_delAccountHandler(t *testing.T) {
+	ctx := context.Background()
+	constr := "redis://localhost:6379"
+	// Создаём тестовую базу данных
+	db, _ := redisDB.New(constr)
+
+	// Создаём экземпляр API с тестовой базой данных, аккаунт удаляется сразу
+	a := api.New(db, "../../web", api.WithDeletionGrace(0))
+
+	// Создаём аккаунт для удаления
+	const username, password = "delete@mail.ru", "Test123!"
+	createUser(t, db, username, password)
+
+	_, tokens := requestToken(t, a, map[string]string{"grant_type": "password", "username": username, "password": password})
+	other := login(t, a, username, password)
+	cookie := login(t, a, username, password)
+
+	// Без сессии аккаунт не удаляется, даже с верным паролем
+	res := jsonRequest(t, a, http.MethodPost, "/delaccount", nil, map[string]string{"username": username, "password": password})
+	if res.Code != http.StatusUnauthorized {
+		t.Errorf("Неверный статус код: получено %v, ожидается %v", res.Code, http.StatusUnauthorized)
+	}
+
+	// Сессии недостаточно без пароля
+	res = jsonRequest(t, a, http.MethodPost, "/delaccount", cookie, map[string]string{"password": "Wrong123!"})
+	if res.Code != http.StatusForbidden {
+		t.Errorf("Принят неверный пароль: статус %v", res.Code)
+	}
+
+	// Чужой аккаунт удалить нельзя
+	res = jsonRequest(t, a, http.MethodPost, "/delaccount", cookie, map[string]string{"username": "ups@mail.ru", "password": password})
+	if res.Code != http.StatusForbidden {
+		t.Errorf("Принято удаление чужого аккаунта: статус %v", res.Code)
+	}
+
+	res = jsonRequest(t, a, http.MethodPost, "/delaccount", cookie, map[string]string{"username": username, "password": password})
+	if res.Code != http.StatusOK {
+		t.Errorf("Неверный статус код: получено %v, ожидается %v", res.Code, http.StatusOK)
+	}
+
+	// Проверяем ожидаемый JSON-ответ при успешном удалении
+	expectedResponse := `{"success":true,"message":"Ваш аккаунт успешно удален.","errorMessages":null}`
+	actualResponse := strings.TrimSpace(res.Body.String())
+	if actualResponse != expectedResponse {
+		t.Errorf("Неверный JSON-ответ: получено %v, ожидается %v", actualResponse, expectedResponse)
+	}
+
+	// Проверяем, что аккаунт был удалён из базы данных
+	keys, err := db.KeysAccount(ctx, storage.Account{Username: username})
+	if err != nil {
+		t.Fatalf("Ошибка при поиске ключей: %v", err)
+	}
+	if keys {
+		t.Errorf("Аккаунт не должен быть найден в базе данных после удаления")
+	}
+
+	// Сессии на всех устройствах и токены обновления удалены вместе с аккаунтом
+	if code := dashboardStatus(t, a, other); code != http.StatusFound {
+		t.Errorf("Сессия удалённого аккаунта действует: статус %v", code)
+	}
+	code, resp := requestToken(t, a, map[string]string{"grant_type": "refresh_token", "refresh_token": tokens["refresh_token"].(string)})
+	if code != http.StatusBadRequest {
+		t.Errorf("Токен обновления удалённого аккаунта принят: %v %v", code, resp)
+	}
+}
+
+func TestAPI_delAccountSecondFactor(t *testing.T) {
+	ctx := context.Background()
+	constr := "redis://localhost:6379"
+	// Создаём тестовую базу данных
+	db, _ := redisDB.New(constr)
+
+	a := api.New(db, "../../web", api.WithDeletionGrace(0))
+
+	const username, password = "delete2fa@mail.ru", "Test123!"
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		t.Fatalf("Ошибка при создании секрета: %v", err)
+	}
+	createUser(t, db, username, password)
+	defer db.DelTOTP(ctx, username)
+
+	// Сессию создаём до включения второго фактора, чтобы не проходить вход с кодом
+	cookie := login(t, a, username, password)
+	if err = db.SetTOTP(ctx, storage.TOTP{Username: username, Secret: secret, Enabled: true, CreatedAt: time.Now().UTC()}); err != nil {
+		t.Fatalf("Ошибка при сохранении аутентификатора: %v", err)
+	}
+
+	res := jsonRequest(t, a, http.MethodPost, "/delaccount", cookie, map[string]string{"code": "000000"})
+	if res.Code != http.StatusForbidden {
+		t.Errorf("Принят неверный код: статус %v", res.Code)
+	}
+
+	code, _ := totp.Code(secret, time.Now())
+	res = jsonRequest(t, a, http.MethodPost, "/delaccount", cookie, map[string]string{"code": code})
+	if res.Code != http.StatusOK {
+		t.Fatalf("Неверный статус код: получено %v, ожидается %v", res.Code, http.StatusOK)
+	}
+
+	// Второй фактор удалён вместе с аккаунтом
+	found, err := db.SearchTOTP(ctx, username)
+	if found != nil || !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("Аутентификатор удалённого аккаунта найден: %v %v", found, err)
+	}
+}
+
+func TestAPI_softDelete(t *testing.T) {
+	ctx := context.Background()
+	constr := "redis://localhost:6379"
+	// Создаём тестовую базу данных
+	db, _ := redisDB.New(constr)
+
+	a := api.New(db, "../../web", api.WithDeletionGrace(time.Hour))
+
+	const username, password = "softdelete@mail.ru", "Test123!"
+	db.CancelDeletion(ctx, username)
+	createUser(t, db, username, password)
+	defer db.CancelDeletion(ctx, username)
+
+	other := login(t, a, username, password)
+	cookie := login(t, a, username, password)
+	res := jsonRequest(t, a, http.MethodPost, "/delaccount", cookie, map[string]string{"password": password})
+	if res.Code != http.StatusOK {
+		t.Fatalf("Неверный статус код: получено %v, ожидается %v", res.Code, http.StatusOK)
+	}
+
+	// Аккаунт только отмечен для удаления, но войти в него уже нельзя
+	keys, err := db.KeysAccount(ctx, storage.Account{Username: username})
+	if err != nil || !keys {
+		t.Fatalf("Аккаунт удалён до истечения срока восстановления: %v", err)
+	}
+	if code := dashboardStatus(t, a, other); code != http.StatusFound {
+		t.Errorf("Сессия удалённого аккаунта действует: статус %v", code)
+	}
+	code, _ := requestToken(t, a, map[string]string{"grant_type": "password", "username": username, "password": password})
+	if code != http.StatusBadRequest {
+		t.Errorf("Токен выдан для аккаунта, ожидающего удаления: статус %v", code)
+	}
+
+	// Вход вместо сессии предлагает восстановить аккаунт
+	res = jsonRequest(t, a, http.MethodPost, "/login", nil, storage.FormAccount{Username: username, Password: password})
+	var offer map[string]interface{}
+	if err = json.Unmarshal(res.Body.Bytes(), &offer); err != nil {
+		t.Fatalf("Ошибка при разборе ответа: %v", err)
+	}
+	if offer["restoreRequired"] != true || len(res.Result().Cookies()) != 0 {
+		t.Fatalf("Вход не предложил восстановить аккаунт: %v", offer)
+	}
+	restoreToken, _ := offer["restoreToken"].(string)
+
+	res = jsonRequest(t, a, http.MethodPost, "/login/restore", nil, map[string]string{"restoreToken": restoreToken})
+	restored := false
+	for _, c := range res.Result().Cookies() {
+		restored = restored || c.Name == "session" && c.Value != ""
+	}
+	if !restored {
+		t.Fatalf("Восстановление не создало сессию: статус %v %v", res.Code, res.Body.String())
+	}
+	if d, err := db.SearchDeletion(ctx, username); d != nil || !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("Отметка удаления осталась после восстановления: %v %v", d, err)
+	}
+
+	// Токен восстановления одноразовый
+	res = jsonRequest(t, a, http.MethodPost, "/login/restore", nil, map[string]string{"restoreToken": restoreToken})
+	if len(res.Result().Cookies()) != 0 {
+		t.Errorf("Токен восстановления принят повторно")
+	}
+
+	// До истечения срока аккаунт не удаляется, после — удаляется со всеми данными
+	cookie = login(t, a, username, password)
+	res = jsonRequest(t, a, http.MethodPost, "/delaccount", cookie, map[string]string{"password": password})
+	if res.Code != http.StatusOK {
+		t.Fatalf("Неверный статус код: получено %v, ожидается %v", res.Code, http.StatusOK)
+	}
+	purged, err := a.PurgeAccounts(ctx, time.Now().UTC())
+	if err != nil {
+		t.Fatalf("Ошибка при удалении аккаунтов: %v", err)
+	}
+	for _, p := range purged {
+		if p == username {
+			t.Errorf("Аккаунт удалён до истечения срока восстановления")
+		}
+	}
+	purged, err = a.PurgeAccounts(ctx, time.Now().UTC().Add(2*time.Hour))
+	if err != nil {
+		t.Fatalf("Ошибка при удалении аккаунтов: %v", err)
+	}
+	found := false
+	for _, p := range purged {
+		found = found || p == username
+	}
+	if !found {
+		t.Errorf("Аккаунт с истёкшим сроком восстановления не удалён: %v", purged)
+	}
+	keys, err = db.KeysAccount(ctx, storage.Account{Username: username})
+	if err != nil || keys {
+		t.Errorf("Аккаунт найден после окончательного удаления: %v", err)
+	}
+}
+
+func TestAPI_accountModel(t *testing.T) {
+	ctx := context.Background()
+	constr := "redis://localhost:6379"
+	// Создаём тестовую базу данных
+	db, _ := redisDB.New(constr)
+
+	mail := &mailbox{}
+	a := api.New(db, "../../web", api.WithMailer(mail))
+
+	const username, password = "profile@mail.ru", "Test123!"
+	db.DelAccount(ctx, storage.Account{Username: username})
+	db.DelEmailVerification(ctx, username)
+	defer db.DelEmailVerification(ctx, username)
+	defer db.DelAccount(ctx, storage.Account{Username: username})
+
+	res := jsonRequest(t, a, http.MethodPost, "/registration", nil, storage.FormAccount{Username: username, Password: password, DisplayName: " Иван "})
+	if res.Code != http.StatusOK {
+		t.Fatalf("Аккаунт не создан: статус %v", res.Code)
+	}
+	res = jsonRequest(t, a, http.MethodPost, "/registration", nil, storage.FormAccount{Username: "long@mail.ru", Password: password, DisplayName: strings.Repeat("я", 65)})
+	if !strings.Contains(res.Body.String(), `"success":false`) {
+		t.Errorf("Принято слишком длинное имя: %s", res.Body)
+	}
+
+	login(t, a, username, password)
+	c, err := db.GetAccount(ctx, username)
+	if err != nil {
+		t.Fatalf("Аккаунт не найден: %v", err)
+	}
+	if c.ID == "" || c.DisplayName != "Иван" || c.Status != storage.StatusPending ||
+		c.EmailVerified || c.CreatedAt.IsZero() || c.LastLoginAt.IsZero() {
+		t.Errorf("Неверный новый аккаунт: %+v", c)
+	}
+
+	// После подтверждения адреса аккаунт становится активным, идентификатор не меняется
+	link, err := url.Parse(mail.sent[0]["Link"])
+	if err != nil {
+		t.Fatalf("Неверная ссылка подтверждения: %v", mail.sent[0]["Link"])
+	}
+	jsonRequest(t, a, http.MethodGet, link.RequestURI(), nil, nil)
+	verified, err := db.GetAccount(ctx, username)
+	if err != nil {
+		t.Fatalf("Аккаунт не найден: %v", err)
+	}
+	if verified.Status != storage.StatusActive || !verified.EmailVerified || verified.ID != c.ID {
+		t.Errorf("Неверный аккаунт после подтверждения адреса: %+v", verified)
+	}
+
+	code, tokens := requestToken(t, a, map[string]string{"grant_type": "password", "username": username, "password": password})
+	if code != http.StatusOK {
+		t.Fatalf("Токены не выданы: %v %v", code, tokens)
+	}
+
+	// В отключённый аккаунт нельзя войти ни паролем, ни за токеном
+	if _, err = db.SetAccountStatus(ctx, username, storage.StatusDisabled); err != nil {
+		t.Fatalf("Ошибка при изменении статуса: %v", err)
+	}
+	res = jsonRequest(t, a, http.MethodPost, "/login", nil, storage.FormAccount{Username: username, Password: password})
+	if res.Code != http.StatusForbidden || len(res.Result().Cookies()) != 0 {
+		t.Errorf("Вход в отключённый аккаунт: статус %v", res.Code)
+	}
+	if code, _ := requestToken(t, a, map[string]string{"grant_type": "password", "username": username, "password": password}); code != http.StatusBadRequest {
+		t.Errorf("Токен выдан для отключённого аккаунта: статус %v", code)
+	}
+	refresh := map[string]string{"grant_type": "refresh_token", "refresh_token": tokens["refresh_token"].(string)}
+	if code, resp := requestToken(t, a, refresh); code != http.StatusBadRequest {
+		t.Errorf("Токен обновлён для отключённого аккаунта: %v %v", code, resp)
+	}
+	if _, err = db.SetAccountStatus(ctx, username, storage.StatusActive); err != nil {
+		t.Fatalf("Ошибка при изменении статуса: %v", err)
+	}
+	login(t, a, username, password)
+
+	// Семейство токенов отозвано и после включения аккаунта не действует
+	if code, resp := requestToken(t, a, refresh); code != http.StatusBadRequest {
+		t.Errorf("Токен обновлён после отзыва семейства: %v %v", code, resp)
+	}
+}
+
+// unavailableDB База, которая не отвечает на поиск сессий.
+type unavailableDB struct {
+	storage.Interface
+}
+
+func (unavailableDB) SearchSession(context.Context, string) (*storage.Session, error) {
+	return nil, storage.Unavailable(errors.New("connection refused"))
+}
+
+func TestAPI_storageUnavailable(t *testing.T) {
+	db, _ := redisDB.New("redis://localhost:6379")
+	a := api.New(unavailableDB{db}, "../../web")
+
+	// Недоступная база — повод повторить запрос позже, а не внутренняя ошибка
+	res := jsonRequest(t, a, http.MethodGet, "/api/sessions", &http.Cookie{Name: "session", Value: "token"}, nil)
+	if res.Code != http.StatusServiceUnavailable {
+		t.Errorf("Неверный статус код: получено %v, ожидается %v", res.Code, http.StatusServiceUnavailable)
+	}
+}
+
+func TestAPI_registrationConcurrent(t *testing.T) {
+	ctx := context.Background()
+	constr := "redis://localhost:6379"
+	// Создаём тестовую базу данных
+	db, _ := redisDB.New(constr)
+
+	mail := &mailbox{}
+	a := api.New(db, "../../web", api.WithMailer(mail))
+
+	const username, password = "race@mail.ru", "Test123!"
+	db.DelAccount(ctx, storage.Account{Username: username})
+	db.DelEmailVerification(ctx, username)
+	defer db.DelEmailVerification(ctx, username)
+	defer db.DelAccount(ctx, storage.Account{Username: username})
+
+	// Одновременные регистрации одного адреса создают ровно один аккаунт
+	const n = 8
+	responses := make([]*httptest.ResponseRecorder, n)
+	var wg sync.WaitGroup
+	for i := range responses {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			responses[i] = jsonRequest(t, a, http.MethodPost, "/registration", nil, storage.FormAccount{Username: username, Password: password})
+		}(i)
+	}
+	wg.Wait()
+
+	created := 0
+	for _, res := range responses {
+		var resp storage.Response
+		if res.Code != http.StatusOK || json.Unmarshal(res.Body.Bytes(), &resp) != nil {
+			t.Fatalf("Неверный ответ на регистрацию: статус %v, %s", res.Code, res.Body)
+		}
+		if resp.Success {
+			created++
+		} else if resp.Message != "Такой пользователь уже существует" {
+			t.Errorf("Неверное сообщение: %s", resp.Message)
+		}
+	}
+	if created != 1 || len(mail.sent) != 1 {
+		t.Errorf("Создано аккаунтов %d, отправлено писем %d, ожидается по одному", created, len(mail.sent))
 	}
+	login(t, a, username, password)
 }
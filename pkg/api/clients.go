@@ -0,0 +1,289 @@
+package api
+
+import (
+	"authorization/pkg/storage"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"github.com/gofrs/uuid"
+	"github.com/gorilla/mux"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Виды разрешений OAuth 2.0, которые выдаёт сервис.
+const (
+	grantAuthorizationCode = "authorization_code"
+	grantRefreshToken      = "refresh_token"
+	grantClientCredentials = "client_credentials"
+)
+
+// clientRequest Запрос администратора на создание клиента OAuth.
+type clientRequest struct {
+	Name         string   `json:"name"`
+	RedirectURIs []string `json:"redirectUris"`
+	Scopes       []string `json:"scopes"`
+	GrantTypes   []string `json:"grantTypes"`
+	Confidential bool     `json:"confidential"` // Выдать секрет; для client_credentials обязателен
+}
+
+// clientResponse Клиент OAuth в ответе администратору.
+// Секрет возвращается только при создании и смене, в базе хранится лишь его хеш.
+type clientResponse struct {
+	ID           string    `json:"id"`
+	Name         string    `json:"name"`
+	RedirectURIs []string  `json:"redirectUris"`
+	Scopes       []string  `json:"scopes"`
+	GrantTypes   []string  `json:"grantTypes"`
+	Confidential bool      `json:"confidential"`
+	Secret       string    `json:"secret,omitempty"`
+	CreatedAt    time.Time `json:"createdAt"`
+}
+
+// WithAdminToken Задаёт токен администратора для управления клиентами OAuth.
+// Без токена административные обработчики недоступны.
+func WithAdminToken(token string) Option {
+	return func(api *API) {
+		api.adminToken = token
+	}
+}
+
+// clientGrants Разрешения клиента, по умолчанию — вход пользователя через код авторизации.
+func clientGrants(c *storage.Client) []string {
+	if len(c.GrantTypes) == 0 {
+		return []string{grantAuthorizationCode, grantRefreshToken}
+	}
+	return c.GrantTypes
+}
+
+// clientAllows Проверяет, разрешён ли клиенту вид разрешения.
+func clientAllows(c *storage.Client, grant string) bool {
+	for _, g := range clientGrants(c) {
+		if g == grant {
+			return true
+		}
+	}
+	return false
+}
+
+// unescapeBasic Раскодирует идентификатор или секрет из Basic,
+// RFC 6749 требует кодировать их как поля формы.
+func unescapeBasic(v string) string {
+	if u, err := url.QueryUnescape(v); err == nil {
+		return u
+	}
+	return v
+}
+
+// authenticateClient Находит клиента запроса за токенами и проверяет его секрет.
+// Секрет принимается в заголовке Authorization: Basic или в полях формы.
+// Публичный клиент без секрета предъявляет только client_id.
+func (api *API) authenticateClient(r *http.Request) (*storage.Client, error) {
+	ctx := r.Context()
+	clientID := r.PostForm.Get("client_id")
+	secret := r.PostForm.Get("client_secret")
+	if id, pass, ok := r.BasicAuth(); ok {
+		clientID, secret = unescapeBasic(id), unescapeBasic(pass)
+	}
+	if clientID == "" {
+		return nil, nil
+	}
+
+	c, err := api.db.SearchClient(ctx, clientID)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if c.SecretHash == "" {
+		return c, nil
+	}
+	if secret == "" || subtle.ConstantTimeCompare([]byte(hashToken(secret)), []byte(c.SecretHash)) != 1 {
+		return nil, nil
+	}
+	return c, nil
+}
+
+// isAdmin Проверяет токен администратора в заголовке Authorization: Bearer.
+func (api *API) isAdmin(r *http.Request) bool {
+	if api.adminToken == "" {
+		return false
+	}
+	header := r.Header.Get("Authorization")
+	const prefix = "Bearer "
+	if len(header) <= len(prefix) || !strings.EqualFold(header[:len(prefix)], prefix) {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(header[len(prefix):]), []byte(api.adminToken)) == 1
+}
+
+// adminOnly Пропускает к обработчику только администратора.
+func (api *API) adminOnly(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !api.isAdmin(r) {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "Требуется токен администратора", http.StatusUnauthorized)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// writeClient Отправляет клиента OAuth администратору.
+func writeClient(w http.ResponseWriter, status int, c *storage.Client, secret string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(clientResponse{
+		ID:           c.ID,
+		Name:         c.Name,
+		RedirectURIs: c.RedirectURIs,
+		Scopes:       c.Scopes,
+		GrantTypes:   clientGrants(c),
+		Confidential: c.SecretHash != "",
+		Secret:       secret,
+		CreatedAt:    c.CreatedAt,
+	})
+}
+
+// Функция-обработчик для регистрации клиента OAuth администратором.
+func (api *API) createClientHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	var f clientRequest
+	if err := json.NewDecoder(r.Body).Decode(&f); err != nil {
+		http.Error(w, "Ошибка при декодировании JSON", http.StatusBadRequest)
+		return
+	}
+
+	c := storage.Client{
+		Name:         f.Name,
+		RedirectURIs: f.RedirectURIs,
+		Scopes:       f.Scopes,
+		GrantTypes:   f.GrantTypes,
+	}
+	for _, g := range clientGrants(&c) {
+		switch g {
+		case grantAuthorizationCode, grantRefreshToken, grantDeviceCode:
+		case grantClientCredentials:
+			// Сервис получает токены без пользователя, поэтому обязан подтверждать себя секретом
+			f.Confidential = true
+		default:
+			http.Error(w, "Неподдерживаемый вид разрешения "+g, http.StatusBadRequest)
+			return
+		}
+	}
+	if clientAllows(&c, grantAuthorizationCode) && len(c.RedirectURIs) == 0 {
+		http.Error(w, "Для authorization_code нужен хотя бы один адрес перенаправления", http.StatusBadRequest)
+		return
+	}
+
+	id, err := uuid.NewV4()
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Ошибка при создании клиента", errorStatus(err))
+		return
+	}
+	c.ID = id.String()
+	c.CreatedAt = time.Now().UTC()
+
+	var secret string
+	if f.Confidential {
+		if secret, err = randomToken(); err != nil {
+			log.Println(err)
+			http.Error(w, "Ошибка при создании клиента", errorStatus(err))
+			return
+		}
+		c.SecretHash = hashToken(secret)
+	}
+
+	if err = api.db.AddClient(ctx, c); err != nil {
+		log.Println(err)
+		http.Error(w, "Ошибка при создании клиента", errorStatus(err))
+		return
+	}
+	log.Printf("Создан клиент OAuth %s (%s)", c.ID, c.Name)
+
+	writeClient(w, http.StatusCreated, &c, secret)
+}
+
+// Функция-обработчик для просмотра клиента OAuth администратором.
+func (api *API) clientHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	c, err := api.db.SearchClient(ctx, mux.Vars(r)["id"])
+	if errors.Is(err, storage.ErrNotFound) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Ошибка при поиске клиента", errorStatus(err))
+		return
+	}
+
+	writeClient(w, http.StatusOK, c, "")
+}
+
+// Функция-обработчик для смены секрета клиента OAuth администратором.
+// Прежний секрет перестаёт действовать сразу.
+func (api *API) rotateClientSecretHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	c, err := api.db.SearchClient(ctx, mux.Vars(r)["id"])
+	if errors.Is(err, storage.ErrNotFound) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Ошибка при поиске клиента", errorStatus(err))
+		return
+	}
+	if c.SecretHash == "" {
+		http.Error(w, "У публичного клиента нет секрета", http.StatusConflict)
+		return
+	}
+
+	secret, err := randomToken()
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Ошибка при смене секрета", errorStatus(err))
+		return
+	}
+	c.SecretHash = hashToken(secret)
+	if err = api.db.AddClient(ctx, *c); err != nil {
+		log.Println(err)
+		http.Error(w, "Ошибка при смене секрета", errorStatus(err))
+		return
+	}
+	log.Printf("Сменён секрет клиента OAuth %s", c.ID)
+
+	writeClient(w, http.StatusOK, c, secret)
+}
+
+// Функция-обработчик для отзыва клиента OAuth администратором.
+// Выданные клиенту токены обновления больше не обмениваются, токены доступа доживают свой срок.
+func (api *API) delClientHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	id := mux.Vars(r)["id"]
+	deleted, err := api.db.DelClient(ctx, id)
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Ошибка при удалении клиента", errorStatus(err))
+		return
+	}
+	if !deleted {
+		http.NotFound(w, r)
+		return
+	}
+	log.Printf("Отозван клиент OAuth %s", id)
+
+	resp := storage.Response{
+		Success: true,
+		Message: "Клиент отозван.",
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
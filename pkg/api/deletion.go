@@ -0,0 +1,189 @@
+package api
+
+import (
+	"authorization/pkg/storage"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+)
+
+const (
+	defaultDeletionGrace = 30 * 24 * time.Hour // Сколько удалённый аккаунт можно восстановить
+	restoreTTL           = 5 * time.Minute     // Сколько ждём согласия на восстановление после входа
+	purgeBatch           = 100                 // Сколько аккаунтов удаляется за один проход
+)
+
+// WithDeletionGrace Задаёт срок, в течение которого удалённый аккаунт можно восстановить, войдя в него.
+// С нулевым сроком аккаунт удаляется сразу.
+func WithDeletionGrace(grace time.Duration) Option {
+	return func(api *API) {
+		api.deletionGrace = grace
+	}
+}
+
+// restoreResponse Ответ на вход в аккаунт, ожидающий удаления.
+type restoreResponse struct {
+	storage.Response
+	RestoreRequired bool      `json:"restoreRequired"`
+	RestoreToken    string    `json:"restoreToken"`
+	PurgeAt         time.Time `json:"purgeAt"` // Когда аккаунт будет удалён окончательно
+}
+
+// restoreRequest Согласие восстановить аккаунт.
+type restoreRequest struct {
+	RestoreToken string `json:"restoreToken"`
+}
+
+// scheduleDeletion Отмечает аккаунт для удаления по истечении срока восстановления.
+// Пользователь выходит на всех устройствах, остальные данные хранятся до окончательного удаления.
+func (api *API) scheduleDeletion(ctx context.Context, username string) (*storage.AccountDeletion, error) {
+	now := time.Now().UTC()
+	d := storage.AccountDeletion{
+		Username:    username,
+		RequestedAt: now,
+		PurgeAt:     now.Add(api.deletionGrace),
+	}
+	if err := api.db.ScheduleDeletion(ctx, d); err != nil {
+		return nil, err
+	}
+
+	if _, err := api.db.DelUserSessions(ctx, username); err != nil {
+		return &d, err
+	}
+	if _, err := api.db.DelUserRefreshTokens(ctx, username); err != nil {
+		return &d, err
+	}
+	return &d, nil
+}
+
+// deleteAccount Окончательно удаляет аккаунт и все данные пользователя.
+func (api *API) deleteAccount(ctx context.Context, username string) (bool, error) {
+	deleted, err := api.db.DelAccount(ctx, storage.Account{Username: username})
+	if err != nil {
+		return false, err
+	}
+	// Остальные данные удаляются, даже если аккаунт уже удалён параллельным запросом
+	if err = api.purgeUser(ctx, username); err != nil {
+		return deleted, fmt.Errorf("не все данные пользователя %s удалены: %w", username, err)
+	}
+	return deleted, nil
+}
+
+// restoreOffer Вместо сессии предлагает восстановить аккаунт, ожидающий удаления.
+func (api *API) restoreOffer(w http.ResponseWriter, d *storage.AccountDeletion) {
+	token, err := api.issueStateToken("/login/restore", d.Username, restoreTTL, "")
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Ошибка при создании сессии", errorStatus(err))
+		return
+	}
+
+	resp := restoreResponse{
+		Response: storage.Response{
+			Success: false,
+			Message: fmt.Sprintf("Аккаунт будет удалён %s. Восстановить его?", d.PurgeAt.Format("02.01.2006 15:04 MST")),
+		},
+		RestoreRequired: true,
+		RestoreToken:    token,
+		PurgeAt:         d.PurgeAt,
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// Функция-обработчик для восстановления аккаунта, ожидающего удаления.
+// Токен выдаётся только после всех факторов входа, поэтому после восстановления сразу создаётся сессия.
+func (api *API) restoreHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	var f restoreRequest
+	if err := json.NewDecoder(r.Body).Decode(&f); err != nil {
+		http.Error(w, "Ошибка при декодировании JSON", http.StatusBadRequest)
+		return
+	}
+
+	claims, err := api.parseStateToken(ctx, f.RestoreToken, "/login/restore")
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Ошибка при проверке входа", errorStatus(err))
+		return
+	}
+	if claims == nil {
+		resp := storage.Response{
+			Success: false,
+			Message: "Время на восстановление истекло, войдите заново",
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+		return
+	}
+	if err = api.useStateToken(ctx, claims); err != nil {
+		log.Println(err)
+		http.Error(w, "Ошибка при восстановлении аккаунта", errorStatus(err))
+		return
+	}
+
+	restored, err := api.db.CancelDeletion(ctx, claims.Subject)
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Ошибка при восстановлении аккаунта", errorStatus(err))
+		return
+	}
+	if restored {
+		log.Printf("Пользователь %s восстановил аккаунт", claims.Subject)
+	} else {
+		// Отметку могла снять окончательная очистка
+		exists, err := api.db.KeysAccount(ctx, storage.Account{Username: claims.Subject})
+		if err != nil {
+			log.Println(err)
+			http.Error(w, "Ошибка при восстановлении аккаунта", errorStatus(err))
+			return
+		}
+		if !exists {
+			resp := storage.Response{
+				Success: false,
+				Message: "Аккаунт уже удалён",
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusGone)
+			json.NewEncoder(w).Encode(resp)
+			return
+		}
+	}
+
+	api.finishLogin(w, r, claims.Subject)
+}
+
+// PurgeAccounts Окончательно удаляет аккаунты, срок восстановления которых истёк к now,
+// и возвращает их логины.
+func (api *API) PurgeAccounts(ctx context.Context, now time.Time) ([]string, error) {
+	var purged []string
+	for {
+		due, err := api.db.DueDeletions(ctx, now, purgeBatch)
+		if err != nil {
+			return purged, err
+		}
+
+		for _, d := range due {
+			// Аккаунт удаляет только тот, кто снял отметку: восстановление или другая копия сервиса успели раньше
+			claimed, err := api.db.ClaimDeletion(ctx, d.Username, now)
+			if err != nil {
+				return purged, err
+			}
+			if !claimed {
+				continue
+			}
+			if _, err = api.deleteAccount(ctx, d.Username); err != nil {
+				return purged, err
+			}
+			purged = append(purged, d.Username)
+		}
+
+		if len(due) < purgeBatch {
+			return purged, nil
+		}
+	}
+}
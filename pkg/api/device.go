@@ -0,0 +1,306 @@
+package api
+
+import (
+	"authorization/pkg/storage"
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"log"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	// grantDeviceCode Вид разрешения авторизации устройства по RFC 8628.
+	grantDeviceCode = "urn:ietf:params:oauth:grant-type:device_code"
+
+	deviceCodeTTL  = 10 * time.Minute // Сколько пользователь может вводить код
+	devicePollWait = 5 * time.Second  // Наименьший интервал опроса устройством
+	userCodeLen    = 8                // Длина кода пользователя без дефиса
+)
+
+// userCodeAlphabet Согласные без гласных и похожих символов: код легко ввести с телевизора
+// и из него не складываются слова.
+const userCodeAlphabet = "BCDFGHJKLMNPQRSTVWXZ"
+
+// deviceAuthorizationResponse Ответ устройству на запрос авторизации по RFC 8628.
+type deviceAuthorizationResponse struct {
+	DeviceCode              string `json:"device_code"`
+	UserCode                string `json:"user_code"`
+	VerificationURI         string `json:"verification_uri"`
+	VerificationURIComplete string `json:"verification_uri_complete"`
+	ExpiresIn               int64  `json:"expires_in"`
+	Interval                int64  `json:"interval"`
+}
+
+// deviceApproval Решение пользователя на странице /device.
+type deviceApproval struct {
+	UserCode string `json:"user_code"`
+	Approve  bool   `json:"approve"`
+}
+
+// randomCode Случайная строка длины n из символов alphabet.
+func randomCode(alphabet string, n int) (string, error) {
+	b := make([]byte, n)
+	max := big.NewInt(int64(len(alphabet)))
+	for i := range b {
+		v, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		b[i] = alphabet[v.Int64()]
+	}
+	return string(b), nil
+}
+
+// newUserCode Случайный код пользователя.
+func newUserCode() (string, error) {
+	return randomCode(userCodeAlphabet, userCodeLen)
+}
+
+// formatUserCode Код пользователя с дефисом посередине, как его показывает устройство.
+func formatUserCode(code string) string {
+	return code[:userCodeLen/2] + "-" + code[userCodeLen/2:]
+}
+
+// normalizeUserCode Приводит введённый код к виду в базе: без дефисов и пробелов, заглавными буквами.
+func normalizeUserCode(code string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '-' || r == ' ' {
+			return -1
+		}
+		return r
+	}, strings.ToUpper(code))
+}
+
+// Функция-обработчик для запроса авторизации устройства (RFC 8628).
+// Устройство получает код для пользователя и опрашивает /oauth2/token, пока тот не подтвердит вход.
+func (api *API) deviceAuthorizationHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if err := r.ParseForm(); err != nil {
+		writeTokenError(w, http.StatusBadRequest, "invalid_request", "Ошибка при разборе формы")
+		return
+	}
+
+	client, err := api.authenticateClient(r)
+	if err != nil {
+		log.Println(err)
+		writeTokenError(w, errorStatus(err), "server_error", "")
+		return
+	}
+	if client == nil {
+		w.Header().Set("WWW-Authenticate", `Basic realm="oauth2"`)
+		writeTokenError(w, http.StatusUnauthorized, "invalid_client", "")
+		return
+	}
+	if !clientAllows(client, grantDeviceCode) {
+		writeTokenError(w, http.StatusBadRequest, "unauthorized_client", "")
+		return
+	}
+	scope, ok := allowedScope(client, r.PostForm.Get("scope"))
+	if !ok {
+		writeTokenError(w, http.StatusBadRequest, "invalid_scope", "")
+		return
+	}
+
+	deviceCode, err := randomToken()
+	if err != nil {
+		log.Println(err)
+		writeTokenError(w, errorStatus(err), "server_error", "")
+		return
+	}
+
+	// Короткий код может совпасть с действующим, тогда пробуем другой
+	var userCode string
+	now := time.Now().UTC()
+	for attempt := 0; attempt < 5; attempt++ {
+		if userCode, err = newUserCode(); err != nil {
+			break
+		}
+		err = api.db.AddDeviceCode(ctx, storage.DeviceCode{
+			ID:        hashToken(deviceCode),
+			UserCode:  userCode,
+			ClientID:  client.ID,
+			Scope:     scope,
+			Status:    storage.DevicePending,
+			CreatedAt: now,
+			ExpiresAt: now.Add(deviceCodeTTL),
+		})
+		if !errors.Is(err, storage.ErrUserCodeTaken) {
+			break
+		}
+	}
+	if err != nil {
+		log.Println(err)
+		writeTokenError(w, errorStatus(err), "server_error", "")
+		return
+	}
+
+	verification := api.endpoint("/device")
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(deviceAuthorizationResponse{
+		DeviceCode:              deviceCode,
+		UserCode:                formatUserCode(userCode),
+		VerificationURI:         verification,
+		VerificationURIComplete: verification + "?user_code=" + url.QueryEscape(formatUserCode(userCode)),
+		ExpiresIn:               int64(deviceCodeTTL.Seconds()),
+		Interval:                int64(devicePollWait.Seconds()),
+	})
+}
+
+// deviceToken Обменивает подтверждённый код устройства на токены.
+// Пока пользователь не решил, устройство получает authorization_pending,
+// а при слишком частом опросе — slow_down.
+func (api *API) deviceToken(ctx context.Context, w http.ResponseWriter, client *storage.Client, deviceCode string) {
+	id := hashToken(deviceCode)
+	d, err := api.db.SearchDeviceCode(ctx, id)
+	if errors.Is(err, storage.ErrNotFound) {
+		writeTokenError(w, http.StatusBadRequest, "expired_token", "")
+		return
+	}
+	if err != nil {
+		log.Println(err)
+		writeTokenError(w, errorStatus(err), "server_error", "")
+		return
+	}
+	if d.ClientID != client.ID {
+		writeTokenError(w, http.StatusBadRequest, "invalid_grant", "")
+		return
+	}
+
+	now := time.Now().UTC()
+	prev, err := api.db.PollDeviceCode(ctx, id, now)
+	if err != nil {
+		log.Println(err)
+		writeTokenError(w, errorStatus(err), "server_error", "")
+		return
+	}
+	if !prev.IsZero() && now.Sub(prev) < devicePollWait {
+		writeTokenError(w, http.StatusBadRequest, "slow_down", "")
+		return
+	}
+
+	switch d.Status {
+	case storage.DevicePending:
+		writeTokenError(w, http.StatusBadRequest, "authorization_pending", "")
+		return
+	case storage.DeviceDenied:
+		if _, err = api.db.DelDeviceCode(ctx, id); err != nil {
+			log.Println(err)
+		}
+		writeTokenError(w, http.StatusBadRequest, "access_denied", "")
+		return
+	}
+
+	// Код обменивается один раз: токены получает только тот, кто удалил запрос
+	deleted, err := api.db.DelDeviceCode(ctx, id)
+	if err != nil {
+		log.Println(err)
+		writeTokenError(w, errorStatus(err), "server_error", "")
+		return
+	}
+	if !deleted {
+		writeTokenError(w, http.StatusBadRequest, "invalid_grant", "")
+		return
+	}
+
+	familyID, err := randomToken()
+	if err != nil {
+		log.Println(err)
+		writeTokenError(w, errorStatus(err), "server_error", "")
+		return
+	}
+	resp, err := api.issueTokens(ctx, d.Username, client.ID, d.Scope, familyID)
+	if err != nil {
+		log.Println(err)
+		writeTokenError(w, errorStatus(err), "server_error", "")
+		return
+	}
+	writeToken(w, resp)
+}
+
+// Функция-обработчик для страницы ввода кода устройства.
+// Без сессии пользователь сначала входит через login.html.
+func (api *API) devicePageHandler(w http.ResponseWriter, r *http.Request) {
+	session, err := api.currentSession(r)
+	if err != nil {
+		log.Println(err)
+	}
+	if session == nil {
+		http.Redirect(w, r, "/?next="+url.QueryEscape(r.URL.RequestURI()), http.StatusFound)
+		return
+	}
+
+	// Чтение содержимого файла device.html
+	content, err := ioutil.ReadFile("web/device.html")
+	if err != nil {
+		http.Error(w, "Ошибка чтения файла", http.StatusInternalServerError)
+		return
+	}
+
+	// Отправка содержимого файла как ответ
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(content)
+}
+
+// Функция-обработчик для подтверждения или отказа во входе на устройстве.
+func (api *API) deviceApproveHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	session, err := api.currentSession(r)
+	if err != nil {
+		log.Println(err)
+	}
+	if session == nil {
+		http.Error(w, "Требуется авторизация", http.StatusUnauthorized)
+		return
+	}
+
+	var f deviceApproval
+	if err = json.NewDecoder(r.Body).Decode(&f); err != nil {
+		http.Error(w, "Ошибка при декодировании JSON", http.StatusBadRequest)
+		return
+	}
+
+	userCode := normalizeUserCode(f.UserCode)
+	d, err := api.db.SearchUserCode(ctx, userCode)
+	if err != nil && !errors.Is(err, storage.ErrNotFound) {
+		log.Println(err)
+		http.Error(w, "Ошибка при поиске кода", errorStatus(err))
+		return
+	}
+	ok := d != nil
+	if ok {
+		ok, err = api.db.ApproveDeviceCode(ctx, userCode, session.Username, f.Approve)
+		if err != nil {
+			log.Println(err)
+			http.Error(w, "Ошибка при подтверждении кода", errorStatus(err))
+			return
+		}
+	}
+	if !ok {
+		resp := storage.Response{
+			Success: false,
+			Message: "Код не найден или уже использован",
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+		return
+	}
+
+	resp := storage.Response{
+		Success: true,
+		Message: "Вход на устройстве отклонён.",
+	}
+	if f.Approve {
+		resp.Message = "Устройство подключено, вернитесь к нему."
+		log.Printf("Пользователь %s подтвердил вход на устройстве клиента %s", session.Username, d.ClientID)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,203 @@
+package api
+
+import (
+	"authorization/pkg/storage"
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+)
+
+// introspection Сведения о токене по RFC 7662.
+// Для недействительного токена возвращается только active=false.
+type introspection struct {
+	Active    bool   `json:"active"`
+	Scope     string `json:"scope,omitempty"`
+	ClientID  string `json:"client_id,omitempty"`
+	Username  string `json:"username,omitempty"`
+	TokenType string `json:"token_type,omitempty"`
+	ExpiresAt int64  `json:"exp,omitempty"`
+	IssuedAt  int64  `json:"iat,omitempty"`
+	Subject   string `json:"sub,omitempty"`
+	Issuer    string `json:"iss,omitempty"`
+	ID        string `json:"jti,omitempty"`
+}
+
+// introspectAccess Сведения о токене доступа или nil, если он недействителен.
+func (api *API) introspectAccess(ctx context.Context, token string) (*introspection, error) {
+	claims, err := api.parseAccessToken(ctx, token)
+	if err != nil || claims == nil {
+		return nil, err
+	}
+
+	info := &introspection{
+		Active:    true,
+		Scope:     claims.Scope,
+		ClientID:  claims.ClientID,
+		TokenType: "Bearer",
+		ExpiresAt: claims.ExpiresAt,
+		IssuedAt:  claims.IssuedAt,
+		Subject:   claims.Subject,
+		Issuer:    claims.Issuer,
+		ID:        claims.ID,
+	}
+	// Токен сервиса (client_credentials) выдан клиенту, а не пользователю
+	if claims.Service {
+		return info, nil
+	}
+	// Токен удалённого аккаунта недействителен
+	account, err := api.db.GetAccountByID(ctx, claims.Subject)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	info.Username = account.Username
+	return info, nil
+}
+
+// introspectRefresh Сведения о токене обновления или nil, если он недействителен.
+func (api *API) introspectRefresh(ctx context.Context, token string) (*introspection, error) {
+	t, err := api.db.SearchRefreshToken(ctx, hashToken(token))
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil || t.Used {
+		return nil, err
+	}
+	account, err := api.db.GetAccount(ctx, t.Username)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &introspection{
+		Active:    true,
+		Scope:     t.Scope,
+		ClientID:  t.ClientID,
+		Username:  t.Username,
+		TokenType: "refresh_token",
+		ExpiresAt: t.ExpiresAt.Unix(),
+		IssuedAt:  t.CreatedAt.Unix(),
+		Subject:   account.ID,
+		Issuer:    api.issuer,
+	}, nil
+}
+
+// confidentialClient Проверяет клиента запроса к защищённым обработчикам OAuth.
+// Публичному клиенту без секрета в доступе отказывается.
+func (api *API) confidentialClient(w http.ResponseWriter, r *http.Request) *storage.Client {
+	if err := r.ParseForm(); err != nil {
+		writeTokenError(w, http.StatusBadRequest, "invalid_request", "Ошибка при разборе формы")
+		return nil
+	}
+
+	client, err := api.authenticateClient(r)
+	if err != nil {
+		log.Println(err)
+		writeTokenError(w, errorStatus(err), "server_error", "")
+		return nil
+	}
+	if client == nil || client.SecretHash == "" {
+		w.Header().Set("WWW-Authenticate", `Basic realm="oauth2"`)
+		writeTokenError(w, http.StatusUnauthorized, "invalid_client", "")
+		return nil
+	}
+	return client
+}
+
+// Функция-обработчик для проверки токенов серверами ресурсов (RFC 7662).
+// Принимает токен доступа и токен обновления, подсказка token_type_hint задаёт порядок поиска.
+func (api *API) introspectHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if api.confidentialClient(w, r) == nil {
+		return
+	}
+
+	token := r.PostForm.Get("token")
+	lookups := []func(context.Context, string) (*introspection, error){api.introspectAccess, api.introspectRefresh}
+	if r.PostForm.Get("token_type_hint") == "refresh_token" {
+		lookups[0], lookups[1] = lookups[1], lookups[0]
+	}
+
+	info := &introspection{}
+	for _, lookup := range lookups {
+		found, err := lookup(ctx, token)
+		if err != nil {
+			log.Println(err)
+			writeTokenError(w, errorStatus(err), "server_error", "")
+			return
+		}
+		if found != nil {
+			info = found
+			break
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(info)
+}
+
+// Функция-обработчик для отзыва токенов клиентом (RFC 7009).
+// Клиент отзывает только собственные токены; отзыв токена обновления отзывает всё его семейство.
+// На неизвестный или чужой токен отвечаем так же, как на отозванный.
+func (api *API) revokeHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if err := r.ParseForm(); err != nil {
+		writeTokenError(w, http.StatusBadRequest, "invalid_request", "Ошибка при разборе формы")
+		return
+	}
+	client, err := api.authenticateClient(r)
+	if err != nil {
+		log.Println(err)
+		writeTokenError(w, errorStatus(err), "server_error", "")
+		return
+	}
+	if client == nil {
+		w.Header().Set("WWW-Authenticate", `Basic realm="oauth2"`)
+		writeTokenError(w, http.StatusUnauthorized, "invalid_client", "")
+		return
+	}
+
+	token := r.PostForm.Get("token")
+	t, err := api.db.SearchRefreshToken(ctx, hashToken(token))
+	if err != nil && !errors.Is(err, storage.ErrNotFound) {
+		log.Println(err)
+		writeTokenError(w, errorStatus(err), "server_error", "")
+		return
+	}
+	if t != nil && t.ClientID == client.ID {
+		if _, err = api.db.DelRefreshFamily(ctx, t.FamilyID); err != nil {
+			log.Println(err)
+			writeTokenError(w, errorStatus(err), "server_error", "")
+			return
+		}
+		log.Printf("Клиент %s отозвал токены обновления пользователя %s", client.ID, t.Username)
+	}
+
+	if t == nil {
+		claims, err := api.parseAccessToken(ctx, token)
+		if err != nil {
+			log.Println(err)
+			writeTokenError(w, errorStatus(err), "server_error", "")
+			return
+		}
+		if claims != nil && claims.ClientID == client.ID && claims.ID != "" {
+			err = api.db.RevokeAccessToken(ctx, claims.ID, time.Unix(claims.ExpiresAt, 0))
+			if err != nil {
+				log.Println(err)
+				writeTokenError(w, errorStatus(err), "server_error", "")
+				return
+			}
+		}
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+}
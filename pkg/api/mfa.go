@@ -0,0 +1,465 @@
+package api
+
+import (
+	"authorization/pkg/jwt"
+	"authorization/pkg/storage"
+	"authorization/pkg/totp"
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/skip2/go-qrcode"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	totpIssuer     = "Authorization" // Название сервиса в приложении-аутентификаторе
+	mfaTTL         = 5 * time.Minute // Сколько ждём второй фактор после верного пароля
+	recoveryCodes  = 10              // Число кодов восстановления
+	recoveryLen    = 10              // Длина кода восстановления без дефиса
+	qrCodeSize     = 256             // Размер QR-кода в пикселях
+	recoveryLetter = "abcdefghjkmnpqrstuvwxyz23456789"
+)
+
+// mfaRequest Второй фактор при входе: токен ожидания из ответа /login и код.
+// Вместо кода из приложения можно ввести код восстановления.
+type mfaRequest struct {
+	MFAToken string `json:"mfaToken"`
+	Code     string `json:"code"`
+}
+
+// mfaResponse Ответ на верный пароль, когда включена двухфакторная аутентификация.
+type mfaResponse struct {
+	storage.Response
+	MFARequired bool   `json:"mfaRequired"`
+	MFAToken    string `json:"mfaToken"`
+}
+
+// totpCodeRequest Код из приложения-аутентификатора или код восстановления.
+type totpCodeRequest struct {
+	Code string `json:"code"`
+}
+
+// totpSetupResponse Новый секрет для приложения-аутентификатора.
+type totpSetupResponse struct {
+	Success bool   `json:"success"`
+	Secret  string `json:"secret"`
+	URI     string `json:"uri"`    // otpauth:// для ручного ввода или своего QR-кода
+	QRCode  string `json:"qrCode"` // Адрес изображения QR-кода в PNG
+}
+
+// recoveryResponse Коды восстановления, показываются пользователю один раз.
+type recoveryResponse struct {
+	Success       bool     `json:"success"`
+	Message       string   `json:"message"`
+	RecoveryCodes []string `json:"recoveryCodes"`
+}
+
+// newRecoveryCodes Создаёт коды восстановления и их хеши для базы.
+func newRecoveryCodes() ([]string, []string, error) {
+	codes := make([]string, recoveryCodes)
+	hashes := make([]string, recoveryCodes)
+	for i := range codes {
+		code, err := randomCode(recoveryLetter, recoveryLen)
+		if err != nil {
+			return nil, nil, err
+		}
+		codes[i] = code[:recoveryLen/2] + "-" + code[recoveryLen/2:]
+		hashes[i] = hashToken(code)
+	}
+	return codes, hashes, nil
+}
+
+// normalizeRecoveryCode Приводит введённый код восстановления к виду, от которого считался хеш.
+func normalizeRecoveryCode(code string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '-' || r == ' ' {
+			return -1
+		}
+		return r
+	}, strings.ToLower(code))
+}
+
+// isTOTPCode Похож ли введённый код на код из приложения, а не на код восстановления.
+func isTOTPCode(code string) bool {
+	if len(code) != totp.Digits {
+		return false
+	}
+	for _, r := range code {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// totpEnabled Возвращает подтверждённый аутентификатор пользователя или nil, если второй фактор выключен.
+func (api *API) totpEnabled(ctx context.Context, username string) (*storage.TOTP, error) {
+	t, err := api.db.SearchTOTP(ctx, username)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil || !t.Enabled {
+		return nil, err
+	}
+	return t, nil
+}
+
+// verifySecondFactor Проверяет код из приложения или код восстановления.
+// Каждый код принимается один раз: повторно предъявленный код отклоняется.
+func (api *API) verifySecondFactor(ctx context.Context, t *storage.TOTP, code string) (bool, error) {
+	code = strings.ReplaceAll(code, " ", "")
+	if isTOTPCode(code) {
+		step, ok := totp.Validate(t.Secret, code, time.Now())
+		if !ok {
+			return false, nil
+		}
+		return api.db.UseTOTPStep(ctx, t.Username, step)
+	}
+
+	ok, err := api.db.UseRecoveryCode(ctx, t.Username, hashToken(normalizeRecoveryCode(code)))
+	if ok {
+		log.Printf("Пользователь %s вошёл по коду восстановления", t.Username)
+	}
+	return ok, err
+}
+
+// stateClaims Утверждения токена состояния незавершённого входа или церемонии WebAuthn.
+// Аудитория отличает такие токены от токенов доступа и друг от друга.
+type stateClaims struct {
+	jwt.Claims
+	Challenge string `json:"challenge,omitempty"` // Вызов WebAuthn в base64url
+}
+
+// issueStateToken Выпускает короткоживущий подписанный токен состояния для аудитории path.
+// Состояние хранится у клиента, сервер проверяет подпись и отмечает токен использованным.
+func (api *API) issueStateToken(path, username string, ttl time.Duration, challenge string) (string, error) {
+	signer, err := api.keys.Signer()
+	if err != nil {
+		return "", err
+	}
+	jti, err := randomToken()
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now().UTC()
+	return jwt.Sign(signer, stateClaims{
+		Claims: jwt.Claims{
+			Issuer:    api.issuer,
+			Subject:   username,
+			Audience:  api.endpoint(path),
+			IssuedAt:  now.Unix(),
+			ExpiresAt: now.Add(ttl).Unix(),
+			ID:        jti,
+		},
+		Challenge: challenge,
+	})
+}
+
+// parseStateToken Проверяет токен состояния для аудитории path, nil — если он недействителен или уже использован.
+func (api *API) parseStateToken(ctx context.Context, token, path string) (*stateClaims, error) {
+	var claims stateClaims
+	err := jwt.Parse(ctx, token, api.keys, &claims)
+	if err != nil || claims.Issuer != api.issuer || claims.Audience != api.endpoint(path) {
+		return nil, nil
+	}
+	used, err := api.db.AccessTokenRevoked(ctx, claims.ID)
+	if err != nil || used {
+		return nil, err
+	}
+	return &claims, nil
+}
+
+// useStateToken Отмечает токен состояния использованным до истечения его срока.
+func (api *API) useStateToken(ctx context.Context, claims *stateClaims) error {
+	return api.db.RevokeAccessToken(ctx, claims.ID, time.Unix(claims.ExpiresAt, 0))
+}
+
+// Функция-обработчик для второго шага входа с кодом из приложения-аутентификатора.
+func (api *API) loginSecondFactorHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	var f mfaRequest
+	if err := json.NewDecoder(r.Body).Decode(&f); err != nil {
+		http.Error(w, "Ошибка при декодировании JSON", http.StatusBadRequest)
+		return
+	}
+
+	claims, err := api.parseStateToken(ctx, f.MFAToken, "/login/2fa")
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Ошибка при проверке входа", errorStatus(err))
+		return
+	}
+	if claims == nil {
+		resp := storage.Response{
+			Success: false,
+			Message: "Время на ввод кода истекло, войдите заново",
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+		return
+	}
+	attempt, wait := api.reserveLogin(r, claims.Subject)
+	if wait > 0 {
+		tooManyAttempts(w, wait)
+		return
+	}
+
+	t, err := api.totpEnabled(ctx, claims.Subject)
+	ok := err == nil && t != nil
+	if ok {
+		ok, err = api.verifySecondFactor(ctx, t, f.Code)
+	}
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Ошибка при проверке кода", errorStatus(err))
+		return
+	}
+	if !ok {
+		resp := storage.Response{
+			Success: false,
+			Message: "Неверный код",
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+		return
+	}
+
+	api.cancelAttempt(ctx, attempt)
+
+	// Токен ожидания одноразовый, как и код
+	if err = api.useStateToken(ctx, claims); err != nil {
+		log.Println(err)
+		http.Error(w, "Ошибка при создании сессии", errorStatus(err))
+		return
+	}
+
+	// Пока вводили код, аккаунт могли отключить
+	refusal, err := api.loginRefusal(ctx, claims.Subject)
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Ошибка при проверке аккаунта", errorStatus(err))
+		return
+	}
+	if refusal != "" {
+		refuseLogin(w, refusal)
+		return
+	}
+	api.finishLogin(w, r, claims.Subject)
+}
+
+// Функция-обработчик для начала подключения приложения-аутентификатора.
+// Новый секрет действует только после подтверждения первым кодом.
+func (api *API) setupTOTPHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	session, err := api.currentSession(r)
+	if err != nil {
+		log.Println(err)
+	}
+	if session == nil {
+		http.Error(w, "Требуется авторизация", http.StatusUnauthorized)
+		return
+	}
+
+	t, err := api.totpEnabled(ctx, session.Username)
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Ошибка при поиске аутентификатора", errorStatus(err))
+		return
+	}
+	if t != nil {
+		http.Error(w, "Двухфакторная аутентификация уже включена, сначала отключите её", http.StatusConflict)
+		return
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Ошибка при создании секрета", errorStatus(err))
+		return
+	}
+	err = api.db.SetTOTP(ctx, storage.TOTP{
+		Username:  session.Username,
+		Secret:    secret,
+		CreatedAt: time.Now().UTC(),
+	})
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Ошибка при сохранении секрета", errorStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(totpSetupResponse{
+		Success: true,
+		Secret:  secret,
+		URI:     totp.URI(totpIssuer, session.Username, secret),
+		QRCode:  "/api/2fa/totp/qr",
+	})
+}
+
+// Функция-обработчик для QR-кода неподтверждённого аутентификатора.
+// После подтверждения секрет больше не показывается.
+func (api *API) totpQRHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	session, err := api.currentSession(r)
+	if err != nil {
+		log.Println(err)
+	}
+	if session == nil {
+		http.Error(w, "Требуется авторизация", http.StatusUnauthorized)
+		return
+	}
+
+	t, err := api.db.SearchTOTP(ctx, session.Username)
+	if err != nil && !errors.Is(err, storage.ErrNotFound) {
+		log.Println(err)
+		http.Error(w, "Ошибка при поиске аутентификатора", errorStatus(err))
+		return
+	}
+	if t == nil || t.Enabled {
+		http.NotFound(w, r)
+		return
+	}
+
+	png, err := qrcode.Encode(totp.URI(totpIssuer, session.Username, t.Secret), qrcode.Medium, qrCodeSize)
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Ошибка при создании QR-кода", errorStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Write(png)
+}
+
+// Функция-обработчик для подтверждения аутентификатора первым кодом.
+// Включает второй фактор и возвращает коды восстановления.
+func (api *API) confirmTOTPHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	session, err := api.currentSession(r)
+	if err != nil {
+		log.Println(err)
+	}
+	if session == nil {
+		http.Error(w, "Требуется авторизация", http.StatusUnauthorized)
+		return
+	}
+
+	var f totpCodeRequest
+	if err = json.NewDecoder(r.Body).Decode(&f); err != nil {
+		http.Error(w, "Ошибка при декодировании JSON", http.StatusBadRequest)
+		return
+	}
+
+	t, err := api.db.SearchTOTP(ctx, session.Username)
+	if err != nil && !errors.Is(err, storage.ErrNotFound) {
+		log.Println(err)
+		http.Error(w, "Ошибка при поиске аутентификатора", errorStatus(err))
+		return
+	}
+	if t == nil || t.Enabled {
+		http.Error(w, "Нет аутентификатора, ожидающего подтверждения", http.StatusConflict)
+		return
+	}
+
+	step, ok := totp.Validate(t.Secret, strings.ReplaceAll(f.Code, " ", ""), time.Now())
+	if !ok {
+		resp := storage.Response{
+			Success: false,
+			Message: "Неверный код, проверьте время на устройстве",
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+		return
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Ошибка при создании кодов восстановления", errorStatus(err))
+		return
+	}
+	t.Enabled = true
+	t.RecoveryCodes = hashes
+	t.LastStep = step
+	if err = api.db.SetTOTP(ctx, *t); err != nil {
+		log.Println(err)
+		http.Error(w, "Ошибка при включении аутентификатора", errorStatus(err))
+		return
+	}
+	log.Printf("Пользователь %s включил двухфакторную аутентификацию", session.Username)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(recoveryResponse{
+		Success:       true,
+		Message:       "Двухфакторная аутентификация включена. Сохраните коды восстановления, они показываются один раз.",
+		RecoveryCodes: codes,
+	})
+}
+
+// Функция-обработчик для отключения второго фактора.
+// Требует действующий код, чтобы второй фактор не снял тот, кто завладел одной сессией.
+func (api *API) disableTOTPHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	session, err := api.currentSession(r)
+	if err != nil {
+		log.Println(err)
+	}
+	if session == nil {
+		http.Error(w, "Требуется авторизация", http.StatusUnauthorized)
+		return
+	}
+
+	var f totpCodeRequest
+	if err = json.NewDecoder(r.Body).Decode(&f); err != nil {
+		http.Error(w, "Ошибка при декодировании JSON", http.StatusBadRequest)
+		return
+	}
+
+	t, err := api.db.SearchTOTP(ctx, session.Username)
+	if err != nil && !errors.Is(err, storage.ErrNotFound) {
+		log.Println(err)
+		http.Error(w, "Ошибка при поиске аутентификатора", errorStatus(err))
+		return
+	}
+	// Неподтверждённый аутентификатор удаляется без кода
+	ok := t != nil && !t.Enabled
+	if t != nil && t.Enabled {
+		ok, err = api.verifySecondFactor(ctx, t, f.Code)
+		if err != nil {
+			log.Println(err)
+			http.Error(w, "Ошибка при проверке кода", errorStatus(err))
+			return
+		}
+	}
+	if !ok {
+		resp := storage.Response{
+			Success: false,
+			Message: "Неверный код",
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+		return
+	}
+
+	if _, err = api.db.DelTOTP(ctx, session.Username); err != nil {
+		log.Println(err)
+		http.Error(w, "Ошибка при отключении аутентификатора", errorStatus(err))
+		return
+	}
+	log.Printf("Пользователь %s отключил двухфакторную аутентификацию", session.Username)
+
+	resp := storage.Response{
+		Success: true,
+		Message: "Двухфакторная аутентификация отключена.",
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
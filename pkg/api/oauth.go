@@ -0,0 +1,296 @@
+package api
+
+import (
+	"authorization/pkg/storage"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// codeTTL Время жизни кода авторизации, клиент обменивает его сразу после перенаправления.
+const codeTTL = time.Minute
+
+// pkceVerifier Допустимый code_verifier по RFC 7636: 43–128 символов без резервированных.
+var pkceVerifier = regexp.MustCompile(`^[A-Za-z0-9\-._~]{43,128}$`)
+
+// pkceChallenge Преобразование code_verifier методом S256.
+func pkceChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// redirectAllowed Проверяет, что адрес перенаправления зарегистрирован за клиентом.
+// Сравнение точное, без нормализации, иначе открывается подмена адреса.
+func redirectAllowed(c *storage.Client, redirectURI string) bool {
+	for _, u := range c.RedirectURIs {
+		if u == redirectURI {
+			return true
+		}
+	}
+	return false
+}
+
+// allowedScope Проверяет запрошенные области доступа по списку разрешённых клиенту.
+// Если области не запрошены, выдаются все разрешённые.
+func allowedScope(c *storage.Client, requested string) (string, bool) {
+	if strings.TrimSpace(requested) == "" {
+		return strings.Join(c.Scopes, " "), true
+	}
+
+	allowed := make(map[string]bool, len(c.Scopes))
+	for _, s := range c.Scopes {
+		allowed[s] = true
+	}
+	scopes := strings.Fields(requested)
+	for _, s := range scopes {
+		if !allowed[s] {
+			return "", false
+		}
+	}
+	return strings.Join(scopes, " "), true
+}
+
+// redirectWithParams Перенаправляет на адрес клиента, добавляя параметры к его запросу.
+func redirectWithParams(w http.ResponseWriter, r *http.Request, redirectURI string, params url.Values) {
+	u, err := url.Parse(redirectURI)
+	if err != nil {
+		http.Error(w, "Некорректный адрес перенаправления", http.StatusBadRequest)
+		return
+	}
+	q := u.Query()
+	for k, v := range params {
+		q[k] = v
+	}
+	u.RawQuery = q.Encode()
+	http.Redirect(w, r, u.String(), http.StatusFound)
+}
+
+// authorizeError Сообщает клиенту об ошибке авторизации перенаправлением по RFC 6749.
+func authorizeError(w http.ResponseWriter, r *http.Request, redirectURI, state, code, description string) {
+	params := url.Values{"error": {code}}
+	if description != "" {
+		params.Set("error_description", description)
+	}
+	if state != "" {
+		params.Set("state", state)
+	}
+	redirectWithParams(w, r, redirectURI, params)
+}
+
+// Функция-обработчик для авторизации клиента OAuth 2.0 (response_type=code).
+// Без сессии пользователь отправляется на страницу входа и возвращается сюда после него.
+func (api *API) authorizeHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	q := r.URL.Query()
+	clientID := q.Get("client_id")
+	redirectURI := q.Get("redirect_uri")
+	state := q.Get("state")
+
+	// Пока клиент и адрес не проверены, перенаправлять нельзя: ошибка показывается пользователю
+	client, err := api.db.SearchClient(ctx, clientID)
+	if errors.Is(err, storage.ErrNotFound) {
+		http.Error(w, "Неизвестный клиент", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Ошибка при поиске клиента", errorStatus(err))
+		return
+	}
+	if !redirectAllowed(client, redirectURI) {
+		http.Error(w, "Адрес перенаправления не зарегистрирован", http.StatusBadRequest)
+		return
+	}
+
+	if q.Get("response_type") != "code" {
+		authorizeError(w, r, redirectURI, state, "unsupported_response_type", "")
+		return
+	}
+	// PKCE обязателен для всех клиентов, метод plain не принимается
+	challenge := q.Get("code_challenge")
+	if challenge == "" || q.Get("code_challenge_method") != "S256" {
+		authorizeError(w, r, redirectURI, state, "invalid_request", "Требуется PKCE с методом S256")
+		return
+	}
+	scope, ok := allowedScope(client, q.Get("scope"))
+	if !ok {
+		authorizeError(w, r, redirectURI, state, "invalid_scope", "")
+		return
+	}
+
+	session, err := api.currentSession(r)
+	if err != nil {
+		log.Println(err)
+	}
+	if session == nil && q.Get("prompt") == "none" {
+		// Клиент проверяет вход без показа страницы, например в скрытом фрейме
+		authorizeError(w, r, redirectURI, state, "login_required", "")
+		return
+	}
+	if session == nil {
+		// Вход через обычную страницу login.html, после него браузер вернётся по next
+		http.Redirect(w, r, "/?next="+url.QueryEscape(r.URL.RequestURI()), http.StatusFound)
+		return
+	}
+
+	code, err := randomToken()
+	if err != nil {
+		log.Println(err)
+		authorizeError(w, r, redirectURI, state, "server_error", "")
+		return
+	}
+	now := time.Now().UTC()
+	err = api.db.AddAuthCode(ctx, storage.AuthCode{
+		ID:                  hashToken(code),
+		ClientID:            client.ID,
+		Username:            session.Username,
+		RedirectURI:         redirectURI,
+		Scope:               scope,
+		CodeChallenge:       challenge,
+		CodeChallengeMethod: "S256",
+		Nonce:               q.Get("nonce"),
+		AuthTime:            session.CreatedAt,
+		CreatedAt:           now,
+		ExpiresAt:           now.Add(codeTTL),
+	})
+	if err != nil {
+		log.Println(err)
+		authorizeError(w, r, redirectURI, state, "server_error", "")
+		return
+	}
+
+	params := url.Values{"code": {code}}
+	if state != "" {
+		params.Set("state", state)
+	}
+	redirectWithParams(w, r, redirectURI, params)
+}
+
+// Функция-обработчик для выдачи токенов клиентам OAuth 2.0.
+// Принимает форму application/x-www-form-urlencoded с grant_type=authorization_code, refresh_token,
+// client_credentials или кодом устройства. Конфиденциальный клиент подтверждает себя секретом.
+func (api *API) oauthTokenHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if err := r.ParseForm(); err != nil {
+		writeTokenError(w, http.StatusBadRequest, "invalid_request", "Ошибка при разборе формы")
+		return
+	}
+
+	client, err := api.authenticateClient(r)
+	if err != nil {
+		log.Println(err)
+		writeTokenError(w, errorStatus(err), "server_error", "")
+		return
+	}
+	if client == nil {
+		w.Header().Set("WWW-Authenticate", `Basic realm="oauth2"`)
+		writeTokenError(w, http.StatusUnauthorized, "invalid_client", "")
+		return
+	}
+
+	grant := r.PostForm.Get("grant_type")
+	switch grant {
+	case grantAuthorizationCode, grantRefreshToken, grantClientCredentials, grantDeviceCode:
+		if !clientAllows(client, grant) {
+			writeTokenError(w, http.StatusBadRequest, "unauthorized_client", "")
+			return
+		}
+	}
+
+	switch grant {
+	case grantAuthorizationCode:
+		// Код забирается из базы до проверок: предъявленный однажды, он больше не действует
+		code, err := api.db.UseAuthCode(ctx, hashToken(r.PostForm.Get("code")))
+		if err != nil && !errors.Is(err, storage.ErrNotFound) {
+			log.Println(err)
+			writeTokenError(w, errorStatus(err), "server_error", "")
+			return
+		}
+		if code == nil || code.ClientID != client.ID || code.RedirectURI != r.PostForm.Get("redirect_uri") {
+			writeTokenError(w, http.StatusBadRequest, "invalid_grant", "Код авторизации недействителен")
+			return
+		}
+		verifier := r.PostForm.Get("code_verifier")
+		if !pkceVerifier.MatchString(verifier) ||
+			subtle.ConstantTimeCompare([]byte(pkceChallenge(verifier)), []byte(code.CodeChallenge)) != 1 {
+			writeTokenError(w, http.StatusBadRequest, "invalid_grant", "Неверный code_verifier")
+			return
+		}
+
+		familyID, err := randomToken()
+		if err != nil {
+			log.Println(err)
+			writeTokenError(w, errorStatus(err), "server_error", "")
+			return
+		}
+		resp, err := api.issueTokens(ctx, code.Username, client.ID, code.Scope, familyID)
+		if err != nil {
+			log.Println(err)
+			writeTokenError(w, errorStatus(err), "server_error", "")
+			return
+		}
+		// Область openid означает вход по OpenID Connect, клиенту нужен id_token
+		if hasScope(code.Scope, "openid") {
+			resp.IDToken, err = api.issueIDToken(ctx, code)
+			if errors.Is(err, storage.ErrNotFound) {
+				writeTokenError(w, http.StatusBadRequest, "invalid_grant", "Аккаунт удалён")
+				return
+			}
+			if err != nil {
+				log.Println(err)
+				writeTokenError(w, errorStatus(err), "server_error", "")
+				return
+			}
+		}
+		writeToken(w, resp)
+
+	case grantRefreshToken:
+		// Токен обновления действует только у клиента, которому выдан
+		t, ok, err := api.rotateRefreshToken(ctx, r.PostForm.Get("refresh_token"), client.ID)
+		if err != nil {
+			log.Println(err)
+			writeTokenError(w, errorStatus(err), "server_error", "")
+			return
+		}
+		if !ok {
+			writeTokenError(w, http.StatusBadRequest, "invalid_grant", "Токен обновления недействителен")
+			return
+		}
+
+		resp, err := api.issueTokens(ctx, t.Username, t.ClientID, t.Scope, t.FamilyID)
+		if err != nil {
+			log.Println(err)
+			writeTokenError(w, errorStatus(err), "server_error", "")
+			return
+		}
+		writeToken(w, resp)
+
+	case grantDeviceCode:
+		api.deviceToken(ctx, w, client, r.PostForm.Get("device_code"))
+
+	case grantClientCredentials:
+		// Токен выдаётся самому сервису: субъект — клиент, токена обновления нет
+		scope, ok := allowedScope(client, r.PostForm.Get("scope"))
+		if !ok {
+			writeTokenError(w, http.StatusBadRequest, "invalid_scope", "")
+			return
+		}
+		resp, err := api.issueServiceToken(client, scope)
+		if err != nil {
+			log.Println(err)
+			writeTokenError(w, errorStatus(err), "server_error", "")
+			return
+		}
+		writeToken(w, resp)
+
+	default:
+		writeTokenError(w, http.StatusBadRequest, "unsupported_grant_type", "")
+	}
+}
@@ -0,0 +1,176 @@
+package api
+
+import (
+	"authorization/pkg/jwt"
+	"authorization/pkg/storage"
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// idTokenTTL Время жизни id_token, клиент проверяет его сразу после входа.
+const idTokenTTL = 5 * time.Minute
+
+// idClaims Утверждения id_token OpenID Connect.
+type idClaims struct {
+	jwt.Claims
+	Email         string `json:"email,omitempty"`
+	EmailVerified *bool  `json:"email_verified,omitempty"`
+	AuthTime      int64  `json:"auth_time,omitempty"`
+	Nonce         string `json:"nonce,omitempty"`
+}
+
+// userinfoResponse Сведения о пользователе по токену доступа.
+type userinfoResponse struct {
+	Subject       string `json:"sub"`
+	Email         string `json:"email,omitempty"`
+	EmailVerified *bool  `json:"email_verified,omitempty"`
+}
+
+// discoveryDocument Метаданные провайдера OpenID Connect.
+type discoveryDocument struct {
+	Issuer                            string   `json:"issuer"`
+	AuthorizationEndpoint             string   `json:"authorization_endpoint"`
+	TokenEndpoint                     string   `json:"token_endpoint"`
+	UserinfoEndpoint                  string   `json:"userinfo_endpoint"`
+	JWKSURI                           string   `json:"jwks_uri"`
+	DeviceAuthorizationEndpoint       string   `json:"device_authorization_endpoint"`
+	IntrospectionEndpoint             string   `json:"introspection_endpoint"`
+	RevocationEndpoint                string   `json:"revocation_endpoint"`
+	ResponseTypesSupported            []string `json:"response_types_supported"`
+	GrantTypesSupported               []string `json:"grant_types_supported"`
+	SubjectTypesSupported             []string `json:"subject_types_supported"`
+	IDTokenSigningAlgValuesSupported  []string `json:"id_token_signing_alg_values_supported"`
+	ScopesSupported                   []string `json:"scopes_supported"`
+	ClaimsSupported                   []string `json:"claims_supported"`
+	TokenEndpointAuthMethodsSupported []string `json:"token_endpoint_auth_methods_supported"`
+	CodeChallengeMethodsSupported     []string `json:"code_challenge_methods_supported"`
+}
+
+// hasScope Проверяет, входит ли область доступа в список через пробел.
+func hasScope(scope, s string) bool {
+	for _, v := range strings.Fields(scope) {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// emailClaims Адрес электронной почты пользователя, если клиенту выдана область email.
+// Логином служит адрес почты, поэтому он же и возвращается.
+func emailClaims(c *storage.Account, scope string) (string, *bool) {
+	if !hasScope(scope, "email") {
+		return "", nil
+	}
+	verified := c.EmailVerified
+	return c.Username, &verified
+}
+
+// issueIDToken Выпускает id_token для клиента по обменянному коду авторизации.
+// Если аккаунт удалён после входа, возвращает storage.ErrNotFound.
+func (api *API) issueIDToken(ctx context.Context, code *storage.AuthCode) (string, error) {
+	signer, err := api.keys.Signer()
+	if err != nil {
+		return "", err
+	}
+
+	// sub — неизменный идентификатор пользователя: логин можно сменить, а клиенты связывают по sub свои записи
+	account, err := api.db.GetAccount(ctx, code.Username)
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now().UTC()
+	claims := idClaims{
+		Claims: jwt.Claims{
+			Issuer:    api.issuer,
+			Subject:   account.ID,
+			Audience:  code.ClientID,
+			IssuedAt:  now.Unix(),
+			ExpiresAt: now.Add(idTokenTTL).Unix(),
+		},
+		AuthTime: code.AuthTime.Unix(),
+		Nonce:    code.Nonce,
+	}
+	claims.Email, claims.EmailVerified = emailClaims(account, code.Scope)
+
+	return jwt.Sign(signer, claims)
+}
+
+// endpoint Полный адрес обработчика сервиса.
+func (api *API) endpoint(path string) string {
+	return strings.TrimSuffix(api.issuer, "/") + path
+}
+
+// Функция-обработчик для сведений о пользователе по токену доступа OpenID Connect.
+func (api *API) userinfoHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	claims, err := api.verifyAccessToken(r)
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Ошибка при проверке токена", errorStatus(err))
+		return
+	}
+	if claims == nil || !hasScope(claims.Scope, "openid") {
+		w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+		http.Error(w, "Токен доступа недействителен", http.StatusUnauthorized)
+		return
+	}
+
+	// Аккаунт мог быть удалён после выдачи токена
+	account, err := api.db.GetAccountByID(ctx, claims.Subject)
+	if errors.Is(err, storage.ErrNotFound) {
+		w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+		http.Error(w, "Токен доступа недействителен", http.StatusUnauthorized)
+		return
+	}
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Ошибка при поиске пользователя", errorStatus(err))
+		return
+	}
+
+	resp := userinfoResponse{Subject: account.ID}
+	resp.Email, resp.EmailVerified = emailClaims(account, claims.Scope)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// Функция-обработчик для документа обнаружения OpenID Connect.
+// По нему стандартные клиенты находят все адреса и возможности сервиса.
+func (api *API) discoveryHandler(w http.ResponseWriter, r *http.Request) {
+	var algs []string
+	if signer, err := api.keys.Signer(); err == nil {
+		algs = append(algs, signer.Alg())
+	}
+
+	doc := discoveryDocument{
+		Issuer:                            api.issuer,
+		AuthorizationEndpoint:             api.endpoint("/oauth2/authorize"),
+		TokenEndpoint:                     api.endpoint("/oauth2/token"),
+		UserinfoEndpoint:                  api.endpoint("/userinfo"),
+		JWKSURI:                           api.endpoint("/.well-known/jwks.json"),
+		DeviceAuthorizationEndpoint:       api.endpoint("/oauth2/device_authorization"),
+		IntrospectionEndpoint:             api.endpoint("/oauth2/introspect"),
+		RevocationEndpoint:                api.endpoint("/oauth2/revoke"),
+		ResponseTypesSupported:            []string{"code"},
+		GrantTypesSupported:               []string{grantAuthorizationCode, grantRefreshToken, grantClientCredentials, grantDeviceCode},
+		SubjectTypesSupported:             []string{"public"},
+		IDTokenSigningAlgValuesSupported:  algs,
+		ScopesSupported:                   []string{"openid", "email"},
+		ClaimsSupported:                   []string{"iss", "sub", "aud", "exp", "iat", "auth_time", "nonce", "email", "email_verified"},
+		TokenEndpointAuthMethodsSupported: []string{"none", "client_secret_basic", "client_secret_post"},
+		CodeChallengeMethodsSupported:     []string{"S256"},
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	json.NewEncoder(w).Encode(doc)
+}
@@ -0,0 +1,335 @@
+package api
+
+import (
+	"authorization/pkg/check"
+	"authorization/pkg/storage"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+const (
+	resetTTL          = time.Hour        // Время жизни ссылки сброса пароля
+	forgotWorkTimeout = 10 * time.Second // Сколько ждём базу, готовя ссылку сброса после ответа на запрос
+)
+
+// forgotRequest Запрос ссылки для сброса забытого пароля.
+type forgotRequest struct {
+	Username string `json:"username"`
+}
+
+// resetRequest Новый пароль и токен из ссылки сброса.
+type resetRequest struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+// changeRequest Смена пароля пользователем, который вошёл в аккаунт.
+type changeRequest struct {
+	CurrentPassword string `json:"currentPassword"`
+	NewPassword     string `json:"newPassword"`
+	LogoutOthers    bool   `json:"logoutOthers"` // Завершить остальные сессии пользователя
+}
+
+// sendPasswordReset Создаёт одноразовый токен сброса пароля и отправляет ссылку с ним.
+func (api *API) sendPasswordReset(ctx context.Context, username string) error {
+	token, err := randomToken()
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	err = api.db.AddPasswordReset(ctx, storage.PasswordReset{
+		ID:        hashToken(token),
+		Username:  username,
+		CreatedAt: now,
+		ExpiresAt: now.Add(resetTTL),
+	})
+	if err != nil {
+		return err
+	}
+
+	link := api.endpoint("/password/reset") + "?" + url.Values{"token": {token}}.Encode()
+	return api.mailer.Send(ctx, username, "password_reset", map[string]string{"Link": link})
+}
+
+// requestPasswordReset Отправляет ссылку сброса пароля, если аккаунт username есть.
+// Выполняется после ответа на запрос, поэтому работает со своим контекстом, а не с контекстом запроса.
+func (api *API) requestPasswordReset(username string) {
+	ctx, cancel := context.WithTimeout(context.Background(), forgotWorkTimeout)
+	defer cancel()
+
+	keys, err := api.db.KeysAccount(ctx, storage.Account{Username: username})
+	if err != nil {
+		log.Println(err)
+	}
+	if keys {
+		if err = api.sendPasswordReset(ctx, username); err != nil {
+			log.Println(err)
+		}
+	}
+}
+
+// Функция-обработчик для запроса ссылки сброса пароля.
+// Ответ одинаковый для любого адреса, чтобы по нему нельзя было узнать, есть ли аккаунт.
+func (api *API) forgotPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	var f forgotRequest
+	if err := json.NewDecoder(r.Body).Decode(&f); err != nil {
+		http.Error(w, "Ошибка при декодировании JSON", http.StatusBadRequest)
+		return
+	}
+
+	// Аккаунт ищется и ссылка создаётся в фоне: иначе по времени ответа было бы видно, есть ли аккаунт
+	go api.requestPasswordReset(f.Username)
+
+	resp := storage.Response{
+		Success: true,
+		Message: "Если такой аккаунт есть, мы отправили на его адрес ссылку для сброса пароля.",
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// Функция-обработчик для страницы ввода нового пароля по ссылке из письма
+func (api *API) resetPageHandler(w http.ResponseWriter, r *http.Request) {
+	// Чтение содержимого файла reset.html
+	content, err := ioutil.ReadFile("web/reset.html")
+	if err != nil {
+		http.Error(w, "Ошибка чтения файла", http.StatusInternalServerError)
+		return
+	}
+
+	// Токен в адресе страницы не должен уходить на другие сайты
+	w.Header().Set("Referrer-Policy", "no-referrer")
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(content)
+}
+
+// Функция-обработчик для установки нового пароля по токену сброса.
+// После сброса все сессии пользователя завершаются, токены обновления и доступа отзываются.
+func (api *API) resetPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	var f resetRequest
+	if err := json.NewDecoder(r.Body).Decode(&f); err != nil {
+		http.Error(w, "Ошибка при декодировании JSON", http.StatusBadRequest)
+		return
+	}
+
+	// Пароль проверяется до использования токена, чтобы со слабым паролем можно было попробовать снова
+	if errorMessages := passwordPolicy(f.Password); len(errorMessages) > 0 {
+		resp := storage.Response{
+			Success:       false,
+			ErrorMessages: errorMessages,
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+		return
+	}
+
+	reset, err := api.db.UsePasswordReset(ctx, hashToken(f.Token))
+	if errors.Is(err, storage.ErrNotFound) {
+		resp := storage.Response{
+			Success: false,
+			Message: "Ссылка недействительна или устарела, запросите новую",
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(resp)
+		return
+	}
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Ошибка при проверке ссылки", errorStatus(err))
+		return
+	}
+
+	hash, err := check.HashPass(f.Password)
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Ошибка при смене пароля", errorStatus(err))
+		return
+	}
+	if err = api.db.UpdatePassword(ctx, storage.Account{Username: reset.Username, Password: hash}); err != nil {
+		log.Println(err)
+		http.Error(w, "Ошибка при смене пароля", errorStatus(err))
+		return
+	}
+	log.Printf("Пользователь %s сбросил пароль", reset.Username)
+
+	// Тот, кто знал старый пароль, не должен остаться в аккаунте
+	if _, err = api.db.DelUserSessions(ctx, reset.Username); err != nil {
+		log.Println(err)
+		http.Error(w, "Пароль изменён, но не удалось завершить сессии", errorStatus(err))
+		return
+	}
+	if err = api.revokeUserTokens(ctx, reset.Username); err != nil {
+		log.Println(err)
+		http.Error(w, "Пароль изменён, но не удалось отозвать токены", errorStatus(err))
+		return
+	}
+	if _, err = api.db.DelUserPasswordResets(ctx, reset.Username); err != nil {
+		log.Println(err)
+	}
+	// Ссылка пришла на почту, значит адрес принадлежит пользователю. Сначала отмечается аккаунт:
+	// подтверждён ли адрес, решает он
+	if _, err = api.db.SetEmailVerified(ctx, reset.Username); err != nil {
+		log.Println(err)
+	}
+	if v, err := api.db.SearchEmailVerification(ctx, reset.Username); err == nil && !v.Verified {
+		v.Verified, v.VerifiedAt = true, time.Now().UTC()
+		if err = api.db.SetEmailVerification(ctx, *v); err != nil {
+			log.Println(err)
+		}
+	}
+	clearSessionCookie(w)
+
+	resp := storage.Response{
+		Success: true,
+		Message: "Пароль изменён, войдите с новым паролем.",
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// Функция-обработчик для смены пароля пользователем, который вошёл в аккаунт.
+// Требует текущий пароль: одной украденной сессии недостаточно, чтобы забрать аккаунт.
+func (api *API) changePasswordHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	session, err := api.currentSession(r)
+	if err != nil {
+		log.Println(err)
+	}
+	if session == nil {
+		http.Error(w, "Требуется авторизация", http.StatusUnauthorized)
+		return
+	}
+
+	var f changeRequest
+	if err = json.NewDecoder(r.Body).Decode(&f); err != nil {
+		http.Error(w, "Ошибка при декодировании JSON", http.StatusBadRequest)
+		return
+	}
+
+	// Подбор пароля через чужую сессию ограничен так же, как вход
+	attempt, wait := api.reserveLogin(r, session.Username)
+	if wait > 0 {
+		tooManyAttempts(w, wait)
+		return
+	}
+	old, valid, err := api.verifyPassword(ctx, session.Username, f.CurrentPassword)
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Ошибка при проверке пароля", errorStatus(err))
+		return
+	}
+	if !valid {
+		resp := storage.Response{
+			Success: false,
+			Message: "Неверный текущий пароль",
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(resp)
+		return
+	}
+	api.cancelAttempt(ctx, attempt)
+
+	errorMessages := passwordPolicy(f.NewPassword)
+	if f.NewPassword == f.CurrentPassword {
+		errorMessages = append(errorMessages, "Новый пароль должен отличаться от текущего")
+	}
+	if len(errorMessages) > 0 {
+		resp := storage.Response{
+			Success:       false,
+			ErrorMessages: errorMessages,
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+		return
+	}
+
+	hash, err := check.HashPass(f.NewPassword)
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Ошибка при смене пароля", errorStatus(err))
+		return
+	}
+	// Хеш заменяется, только если пароль не сменили параллельно после нашей проверки
+	ok, err := api.db.ChangePassword(ctx, session.Username, old, hash)
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Ошибка при смене пароля", errorStatus(err))
+		return
+	}
+	if !ok {
+		http.Error(w, "Пароль был изменён другим запросом, повторите попытку", http.StatusConflict)
+		return
+	}
+	log.Printf("Пользователь %s сменил пароль", session.Username)
+
+	// Ссылки сброса, выданные для старого пароля, больше не нужны
+	if _, err = api.db.DelUserPasswordResets(ctx, session.Username); err != nil {
+		log.Println(err)
+	}
+
+	message := "Пароль изменён."
+	if f.LogoutOthers {
+		n, err := api.endOtherSessions(ctx, session)
+		if err != nil {
+			log.Println(err)
+			http.Error(w, "Пароль изменён, но не удалось завершить другие сессии", errorStatus(err))
+			return
+		}
+		if err = api.revokeUserTokens(ctx, session.Username); err != nil {
+			log.Println(err)
+			http.Error(w, "Пароль изменён, но не удалось отозвать токены", errorStatus(err))
+			return
+		}
+		message = fmt.Sprintf("Пароль изменён. Завершено других сессий: %d.", n)
+	}
+
+	resp := storage.Response{
+		Success: true,
+		Message: message,
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// revokeUserTokens Удаляет токены обновления пользователя и отзывает его действующие токены доступа.
+func (api *API) revokeUserTokens(ctx context.Context, username string) error {
+	if _, err := api.db.DelUserRefreshTokens(ctx, username); err != nil {
+		return err
+	}
+	_, err := api.db.RevokeUserAccessTokens(ctx, username)
+	return err
+}
+
+// endOtherSessions Завершает все сессии пользователя, кроме текущей.
+func (api *API) endOtherSessions(ctx context.Context, current *storage.Session) (int, error) {
+	sessions, err := api.db.ListSessions(ctx, current.Username)
+	if err != nil {
+		return 0, err
+	}
+
+	n := 0
+	for _, c := range sessions {
+		if c.ID == current.ID {
+			continue
+		}
+		ok, err := api.db.DelSession(ctx, c.ID)
+		if err != nil {
+			return n, err
+		}
+		if ok {
+			n++
+		}
+	}
+	return n, nil
+}
@@ -0,0 +1,286 @@
+package api
+
+import (
+	"authorization/pkg/storage"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gorilla/mux"
+	"log"
+	"net"
+	"net/http"
+	"time"
+)
+
+const (
+	sessionCookie = "session"   // Имя cookie с токеном сессии
+	sessionTTL    = time.Hour   // Время жизни сессии
+	touchInterval = time.Minute // Как часто обновлять время последней активности
+	tokenBytes    = 32          // Длина случайных токенов в байтах
+)
+
+// sessionInfo Сессия в ответе списка сессий пользователя.
+type sessionInfo struct {
+	ID        string    `json:"id"`
+	CreatedAt time.Time `json:"createdAt"`
+	LastSeen  time.Time `json:"lastSeen"`
+	ExpiresAt time.Time `json:"expiresAt"`
+	IP        string    `json:"ip"`
+	UserAgent string    `json:"userAgent"`
+	RequestID string    `json:"requestId"`
+	Current   bool      `json:"current"` // Сессия, с которой выполнен запрос
+}
+
+// sessionsResponse Ответ со списком сессий пользователя.
+type sessionsResponse struct {
+	Success  bool          `json:"success"`
+	Sessions []sessionInfo `json:"sessions"`
+}
+
+// randomToken Генерирует случайный непрозрачный токен.
+func randomToken() (string, error) {
+	b := make([]byte, tokenBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// hashToken Идентификатор для хранения токена в базе.
+// В базе хранится только SHA-256 токена, утечка базы не даёт действующих токенов.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// startSession Создает сессию пользователя и устанавливает cookie с её токеном.
+// Вместе с сессией сохраняются адрес клиента и идентификатор запроса из middl.Middle.
+func (api *API) startSession(w http.ResponseWriter, r *http.Request, username string) error {
+	ctx := r.Context()
+	token, err := randomToken()
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	err = api.db.AddSession(ctx, storage.Session{
+		ID:        hashToken(token),
+		Username:  username,
+		CreatedAt: now,
+		LastSeen:  now,
+		ExpiresAt: now.Add(sessionTTL),
+		IP:        clientIP(r),
+		UserAgent: r.UserAgent(),
+		RequestID: r.Header.Get("X-Request-ID"),
+	})
+	if err != nil {
+		return err
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookie,
+		Value:    token,
+		Path:     "/",
+		MaxAge:   int(sessionTTL.Seconds()),
+		Secure:   true,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	return nil
+}
+
+// currentSession Возвращает действующую сессию запроса или nil, если её нет.
+func (api *API) currentSession(r *http.Request) (*storage.Session, error) {
+	ctx := r.Context()
+	cookie, err := r.Cookie(sessionCookie)
+	if err != nil || cookie.Value == "" {
+		return nil, nil
+	}
+	session, err := api.db.SearchSession(ctx, hashToken(cookie.Value))
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Время активности обновляем не чаще раза в минуту, чтобы не писать в базу на каждый запрос
+	now := time.Now().UTC()
+	if now.Sub(session.LastSeen) > touchInterval {
+		if err := api.db.TouchSession(ctx, session.ID, now); err != nil {
+			log.Println(err)
+		}
+		session.LastSeen = now
+	}
+	return session, nil
+}
+
+// clientIP Адрес клиента без порта.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// endSession Отзывает сессию запроса на сервере и удаляет cookie.
+func (api *API) endSession(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+	clearSessionCookie(w)
+
+	cookie, err := r.Cookie(sessionCookie)
+	if err != nil || cookie.Value == "" {
+		return nil
+	}
+	_, err = api.db.DelSession(ctx, hashToken(cookie.Value))
+	return err
+}
+
+// clearSessionCookie Удаляет cookie сессии в браузере.
+func clearSessionCookie(w http.ResponseWriter) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookie,
+		Value:    "",
+		Path:     "/",
+		MaxAge:   -1,
+		Secure:   true,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// Функция-обработчик для выхода из аккаунта на текущем устройстве
+func (api *API) logoutHandler(w http.ResponseWriter, r *http.Request) {
+	if err := api.endSession(w, r); err != nil {
+		log.Println(err)
+		http.Error(w, "Ошибка при завершении сессии", errorStatus(err))
+		return
+	}
+
+	resp := storage.Response{
+		Success: true,
+		Message: "Вы вышли из аккаунта.",
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// Функция-обработчик для выхода из аккаунта на всех устройствах
+func (api *API) logoutAllHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	session, err := api.currentSession(r)
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Ошибка при проверке сессии", errorStatus(err))
+		return
+	}
+	if session == nil {
+		http.Error(w, "Необходимо авторизоваться", http.StatusUnauthorized)
+		return
+	}
+
+	n, err := api.db.DelUserSessions(ctx, session.Username)
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Ошибка при завершении сессий", errorStatus(err))
+		return
+	}
+	clearSessionCookie(w)
+
+	resp := storage.Response{
+		Success: true,
+		Message: fmt.Sprintf("Вы вышли из аккаунта на всех устройствах. Завершено сессий: %d.", n),
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// Функция-обработчик для списка активных сессий пользователя
+func (api *API) sessionsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	session, err := api.currentSession(r)
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Ошибка при проверке сессии", errorStatus(err))
+		return
+	}
+	if session == nil {
+		http.Error(w, "Необходимо авторизоваться", http.StatusUnauthorized)
+		return
+	}
+
+	sessions, err := api.db.ListSessions(ctx, session.Username)
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Ошибка при получении сессий", errorStatus(err))
+		return
+	}
+
+	resp := sessionsResponse{
+		Success:  true,
+		Sessions: []sessionInfo{},
+	}
+	for _, c := range sessions {
+		resp.Sessions = append(resp.Sessions, sessionInfo{
+			ID:        c.ID,
+			CreatedAt: c.CreatedAt,
+			LastSeen:  c.LastSeen,
+			ExpiresAt: c.ExpiresAt,
+			IP:        c.IP,
+			UserAgent: c.UserAgent,
+			RequestID: c.RequestID,
+			Current:   c.ID == session.ID,
+		})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// Функция-обработчик для завершения одной сессии пользователя
+func (api *API) delSessionHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	session, err := api.currentSession(r)
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Ошибка при проверке сессии", errorStatus(err))
+		return
+	}
+	if session == nil {
+		http.Error(w, "Необходимо авторизоваться", http.StatusUnauthorized)
+		return
+	}
+
+	// Завершить можно только свою сессию, чужие выглядят как несуществующие
+	id := mux.Vars(r)["id"]
+	target, err := api.db.SearchSession(ctx, id)
+	if err != nil && !errors.Is(err, storage.ErrNotFound) {
+		log.Println(err)
+		http.Error(w, "Ошибка при поиске сессии", errorStatus(err))
+		return
+	}
+	if target == nil || target.Username != session.Username {
+		http.Error(w, "Сессия не найдена", http.StatusNotFound)
+		return
+	}
+
+	if _, err = api.db.DelSession(ctx, id); err != nil {
+		log.Println(err)
+		http.Error(w, "Ошибка при завершении сессии", errorStatus(err))
+		return
+	}
+	if id == session.ID {
+		clearSessionCookie(w)
+	}
+
+	resp := storage.Response{
+		Success: true,
+		Message: "Сессия завершена.",
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
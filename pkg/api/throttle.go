@@ -0,0 +1,67 @@
+package api
+
+import (
+	"authorization/pkg/storage"
+	"authorization/pkg/throttle"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// WithAttemptStore Задаёт хранилище счётчиков неудачных попыток входа.
+// Без этой настройки счётчики хранятся в памяти процесса.
+func WithAttemptStore(store storage.AttemptStore) Option {
+	return func(api *API) {
+		api.throttle = throttle.New(store)
+	}
+}
+
+// reserveLogin Учитывает попытку входа в аккаунт username до проверки пароля или кода
+// и возвращает, сколько ещё ждать, если попытка не разрешена. Учтённая попытка считается неудачной,
+// пока её не отменит cancelAttempt. При сбое хранилища счётчиков вход не блокируется.
+func (api *API) reserveLogin(r *http.Request, username string) (*throttle.Attempt, time.Duration) {
+	ctx := r.Context()
+	a, wait, err := api.throttle.Reserve(ctx, username, clientIP(r))
+	if err != nil {
+		log.Printf("Не удалось учесть попытку входа %v", err)
+	}
+	return a, wait
+}
+
+// cancelAttempt Отменяет учёт попытки, которая не оказалась неудачной.
+func (api *API) cancelAttempt(ctx context.Context, a *throttle.Attempt) {
+	if err := api.throttle.Cancel(ctx, a); err != nil {
+		log.Printf("Не удалось отменить учёт попытки входа %v", err)
+	}
+}
+
+// loginSucceeded Сбрасывает счётчик неудачных попыток после входа в аккаунт username.
+func (api *API) loginSucceeded(ctx context.Context, username string) {
+	if err := api.throttle.Success(ctx, username); err != nil {
+		log.Printf("Не удалось сбросить счётчик попыток входа %v", err)
+	}
+}
+
+// setRetryAfter Задаёт заголовок Retry-After в целых секундах с округлением вверх.
+func setRetryAfter(w http.ResponseWriter, wait time.Duration) int {
+	seconds := int(math.Ceil(wait.Seconds()))
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	return seconds
+}
+
+// tooManyAttempts Ответ на попытку входа до истечения паузы.
+func tooManyAttempts(w http.ResponseWriter, wait time.Duration) {
+	seconds := setRetryAfter(w, wait)
+	resp := storage.Response{
+		Success: false,
+		Message: fmt.Sprintf("Слишком много неудачных попыток входа, повторите через %d с", seconds),
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusTooManyRequests)
+	json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,372 @@
+package api
+
+import (
+	"authorization/pkg/jwt"
+	"authorization/pkg/keys"
+	"authorization/pkg/storage"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	AccessTTL  = 15 * time.Minute    // Время жизни токена доступа, ключ подписи публикуется не меньше
+	refreshTTL = 30 * 24 * time.Hour // Время жизни токена обновления
+)
+
+// tokenRequest Запрос на выдачу токенов.
+type tokenRequest struct {
+	GrantType    string `json:"grant_type"`
+	Username     string `json:"username"`
+	Password     string `json:"password"`
+	RefreshToken string `json:"refresh_token"`
+	OTP          string `json:"otp"` // Код второго фактора, если он включён
+}
+
+// tokenResponse Выданные токены в формате RFC 6749.
+type tokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	Scope        string `json:"scope,omitempty"`
+	IDToken      string `json:"id_token,omitempty"`
+}
+
+// tokenError Ошибка выдачи токенов в формате RFC 6749.
+type tokenError struct {
+	Error       string `json:"error"`
+	Description string `json:"error_description,omitempty"`
+}
+
+// accessClaims Утверждения токена доступа.
+type accessClaims struct {
+	jwt.Claims
+	Scope    string `json:"scope,omitempty"`
+	ClientID string `json:"client_id,omitempty"`
+	Service  bool   `json:"service,omitempty"` // Токен выдан самому клиенту (client_credentials), субъект — клиент, а не пользователь
+}
+
+// writeToken Отправляет выданные токены, ответ не должен кешироваться.
+func writeToken(w http.ResponseWriter, resp *tokenResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Pragma", "no-cache")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// writeTokenError Отправляет ошибку выдачи токенов.
+func writeTokenError(w http.ResponseWriter, status int, code, description string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(tokenError{Error: code, Description: description})
+}
+
+// signAccessToken Подписывает токен доступа, дополняя claims издателем, сроком и jti.
+func (api *API) signAccessToken(claims *accessClaims) (string, error) {
+	signer, err := api.keys.Signer()
+	if err != nil {
+		return "", err
+	}
+	jti, err := randomToken()
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now().UTC()
+	claims.Issuer = api.issuer
+	claims.IssuedAt = now.Unix()
+	claims.ExpiresAt = now.Add(AccessTTL).Unix()
+	claims.ID = jti
+	return jwt.Sign(signer, claims)
+}
+
+// issueServiceToken Выдаёт токен доступа самому клиенту (client_credentials), без токена обновления.
+func (api *API) issueServiceToken(client *storage.Client, scope string) (*tokenResponse, error) {
+	access, err := api.signAccessToken(&accessClaims{
+		Claims:   jwt.Claims{Subject: client.ID},
+		Scope:    scope,
+		ClientID: client.ID,
+		Service:  true,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &tokenResponse{
+		AccessToken: access,
+		TokenType:   "Bearer",
+		ExpiresIn:   int64(AccessTTL.Seconds()),
+		Scope:       scope,
+	}, nil
+}
+
+// issueTokens Выдаёт пользователю токен доступа и новый токен обновления в семействе familyID.
+// Субъект токена доступа — ID аккаунта, как в id_token и ответе userinfo.
+func (api *API) issueTokens(ctx context.Context, username, clientID, scope, familyID string) (*tokenResponse, error) {
+	account, err := api.db.GetAccount(ctx, username)
+	if err != nil {
+		return nil, err
+	}
+	claims := accessClaims{
+		Claims:   jwt.Claims{Subject: account.ID},
+		Scope:    scope,
+		ClientID: clientID,
+	}
+	access, err := api.signAccessToken(&claims)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &tokenResponse{
+		AccessToken: access,
+		TokenType:   "Bearer",
+		ExpiresIn:   int64(AccessTTL.Seconds()),
+		Scope:       scope,
+	}
+
+	// Токен пользователя запоминается, чтобы отозвать его при сбросе пароля
+	if err = api.db.AddAccessToken(ctx, username, claims.ID, time.Unix(claims.ExpiresAt, 0)); err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	refresh, err := randomToken()
+	if err != nil {
+		return nil, err
+	}
+	err = api.db.AddRefreshToken(ctx, storage.RefreshToken{
+		ID:        hashToken(refresh),
+		FamilyID:  familyID,
+		Username:  username,
+		ClientID:  clientID,
+		Scope:     scope,
+		CreatedAt: now,
+		ExpiresAt: now.Add(refreshTTL),
+	})
+	if err != nil {
+		return nil, err
+	}
+	resp.RefreshToken = refresh
+
+	return resp, nil
+}
+
+// verifyAccessToken Проверяет пользовательский токен доступа из заголовка Authorization: Bearer.
+// Возвращает nil без ошибки, если заголовка нет, токен недействителен или выдан сервису:
+// у токена client_credentials нет пользователя, от имени которого он действует.
+func (api *API) verifyAccessToken(r *http.Request) (*accessClaims, error) {
+	ctx := r.Context()
+	header := r.Header.Get("Authorization")
+	const prefix = "Bearer "
+	if len(header) <= len(prefix) || !strings.EqualFold(header[:len(prefix)], prefix) {
+		return nil, nil
+	}
+	claims, err := api.parseAccessToken(ctx, header[len(prefix):])
+	if err != nil || claims == nil || claims.Service {
+		return nil, err
+	}
+	return claims, nil
+}
+
+// parseAccessToken Проверяет подпись, срок и издателя токена доступа.
+// Отозванный через /oauth2/revoke токен не принимается до истечения его срока.
+// Возвращает nil без ошибки, если токен недействителен, ошибку — только при сбое базы.
+func (api *API) parseAccessToken(ctx context.Context, token string) (*accessClaims, error) {
+	var claims accessClaims
+	err := jwt.Parse(ctx, token, api.keys, &claims)
+	// У id_token и токена ожидания второго фактора есть аудитория, за токен доступа они не принимаются
+	if err != nil || claims.Issuer != api.issuer || claims.Audience != "" {
+		return nil, nil
+	}
+	revoked, err := api.db.AccessTokenRevoked(ctx, claims.ID)
+	if err != nil || revoked {
+		return nil, err
+	}
+	return &claims, nil
+}
+
+// canRefresh Проверяет, что аккаунт username может получать токены так же, как входить:
+// он существует, не отключён и не заблокирован, адрес подтверждён, если это требуется, и аккаунт не ожидает удаления.
+func (api *API) canRefresh(ctx context.Context, username string) (bool, error) {
+	exists, err := api.db.KeysAccount(ctx, storage.Account{Username: username})
+	if err != nil || !exists {
+		return false, err
+	}
+	refusal, err := api.loginRefusal(ctx, username)
+	if err != nil || refusal != "" {
+		return false, err
+	}
+	_, err = api.db.SearchDeletion(ctx, username)
+	if errors.Is(err, storage.ErrNotFound) {
+		return true, nil
+	}
+	return false, err
+}
+
+// rotateRefreshToken Обменивает токен обновления клиента clientID на новый в том же семействе.
+// Токен другого клиента отклоняется до обмена, чтобы чужой запрос не сжёг его у владельца.
+// Повторное использование уже обменянного токена означает его кражу:
+// всё семейство отзывается, и ни вор, ни владелец больше не могут им пользоваться.
+func (api *API) rotateRefreshToken(ctx context.Context, token, clientID string) (*storage.RefreshToken, bool, error) {
+	t, err := api.db.SearchRefreshToken(ctx, hashToken(token))
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	if t.ClientID != clientID {
+		return nil, false, nil
+	}
+
+	// Токены удалённого, отключённого или ожидающего удаления аккаунта больше не обновляются
+	allowed, err := api.canRefresh(ctx, t.Username)
+	if err != nil {
+		return nil, false, err
+	}
+	if !allowed {
+		if _, err = api.db.DelRefreshFamily(ctx, t.FamilyID); err != nil {
+			return nil, false, err
+		}
+		return nil, false, nil
+	}
+
+	ok := !t.Used
+	if ok {
+		ok, err = api.db.UseRefreshToken(ctx, t.ID)
+		if err != nil {
+			return nil, false, err
+		}
+	}
+	if !ok {
+		log.Printf("Повторное использование токена обновления пользователя %s, семейство %s отозвано", t.Username, t.FamilyID)
+		if _, err = api.db.DelRefreshFamily(ctx, t.FamilyID); err != nil {
+			return nil, false, err
+		}
+		return nil, false, nil
+	}
+
+	return t, true, nil
+}
+
+// Функция-обработчик для выдачи токенов доступа сервисам.
+// Принимает логин и пароль (grant_type=password) или токен обновления (grant_type=refresh_token).
+func (api *API) tokenHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	var f tokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&f); err != nil {
+		writeTokenError(w, http.StatusBadRequest, "invalid_request", "Ошибка при декодировании JSON")
+		return
+	}
+
+	switch f.GrantType {
+	case "password", "":
+		// Логин и пароль проверяются так же, как при входе через форму, с теми же счётчиками попыток
+		attempt, wait := api.reserveLogin(r, f.Username)
+		if wait > 0 {
+			setRetryAfter(w, wait)
+			writeTokenError(w, http.StatusTooManyRequests, "invalid_grant", "Слишком много неудачных попыток входа")
+			return
+		}
+		if !api.checkPassword(ctx, f.Username, f.Password) {
+			writeTokenError(w, http.StatusBadRequest, "invalid_grant", "Нет такой записи, проверти логин или пароль")
+			return
+		}
+		refusal, err := api.loginRefusal(ctx, f.Username)
+		if err != nil {
+			log.Println(err)
+			writeTokenError(w, errorStatus(err), "server_error", "")
+			return
+		}
+		if refusal != "" {
+			api.cancelAttempt(ctx, attempt)
+			writeTokenError(w, http.StatusBadRequest, "invalid_grant", refusal)
+			return
+		}
+		t, err := api.totpEnabled(ctx, f.Username)
+		ok := err == nil && t == nil
+		if err == nil && t != nil {
+			ok, err = api.verifySecondFactor(ctx, t, f.OTP)
+		}
+		if err != nil {
+			log.Println(err)
+			writeTokenError(w, errorStatus(err), "server_error", "")
+			return
+		}
+		// Пустой код — это запрос второго фактора, а не попытка перебора
+		if ok || f.OTP == "" {
+			api.cancelAttempt(ctx, attempt)
+		}
+		if !ok {
+			writeTokenError(w, http.StatusBadRequest, "invalid_grant", "Требуется верный код второго фактора в поле otp")
+			return
+		}
+		api.loginSucceeded(ctx, f.Username)
+
+		// Восстановить аккаунт можно только через форму входа
+		d, err := api.db.SearchDeletion(ctx, f.Username)
+		if err != nil && !errors.Is(err, storage.ErrNotFound) {
+			log.Println(err)
+			writeTokenError(w, errorStatus(err), "server_error", "")
+			return
+		}
+		if d != nil {
+			writeTokenError(w, http.StatusBadRequest, "invalid_grant", "Аккаунт ожидает удаления, восстановите его через форму входа")
+			return
+		}
+		api.recordLogin(ctx, f.Username)
+
+		familyID, err := randomToken()
+		if err != nil {
+			log.Println(err)
+			writeTokenError(w, errorStatus(err), "server_error", "")
+			return
+		}
+		resp, err := api.issueTokens(ctx, f.Username, "", "", familyID)
+		if err != nil {
+			log.Println(err)
+			writeTokenError(w, errorStatus(err), "server_error", "")
+			return
+		}
+		writeToken(w, resp)
+
+	case "refresh_token":
+		// Токены клиентов OAuth обновляются только через /oauth2/token
+		t, ok, err := api.rotateRefreshToken(ctx, f.RefreshToken, "")
+		if err != nil {
+			log.Println(err)
+			writeTokenError(w, errorStatus(err), "server_error", "")
+			return
+		}
+		if !ok {
+			writeTokenError(w, http.StatusBadRequest, "invalid_grant", "Токен обновления недействителен")
+			return
+		}
+
+		resp, err := api.issueTokens(ctx, t.Username, t.ClientID, t.Scope, t.FamilyID)
+		if err != nil {
+			log.Println(err)
+			writeTokenError(w, errorStatus(err), "server_error", "")
+			return
+		}
+		writeToken(w, resp)
+
+	default:
+		writeTokenError(w, http.StatusBadRequest, "unsupported_grant_type", "")
+	}
+}
+
+// Функция-обработчик для публикации открытых ключей подписи (JWKS).
+// Сервисы кешируют ответ и проверяют токены доступа без обращения к нам.
+func (api *API) jwksHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(keys.JWKSMaxAge.Seconds())))
+	json.NewEncoder(w).Encode(api.keys.JWKS())
+}
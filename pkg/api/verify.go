@@ -0,0 +1,149 @@
+package api
+
+import (
+	"authorization/pkg/storage"
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+const verifyTTL = 24 * time.Hour // Время жизни ссылки подтверждения адреса
+
+// Mailer Отправка писем пользователям.
+// template — имя шаблона письма, data — подставляемые в него значения.
+type Mailer interface {
+	Send(ctx context.Context, to, template string, data map[string]string) error
+}
+
+// logMailer Вместо отправки пишет в журнал шаблон и адресата письма. Используется при разработке.
+// Ссылка из письма в журнал не попадает: по ней можно сменить пароль чужого аккаунта.
+type logMailer struct{}
+
+func (logMailer) Send(_ context.Context, to, template string, _ map[string]string) error {
+	log.Printf("Письмо %s для %s не отправлено: доставка писем не настроена", template, to)
+	return nil
+}
+
+// WithMailer Задаёт отправку писем пользователям.
+func WithMailer(m Mailer) Option {
+	return func(api *API) {
+		api.mailer = m
+	}
+}
+
+// WithEmailVerification Запрещает вход, пока адрес электронной почты не подтверждён.
+// Без этой настройки письмо со ссылкой отправляется, но вход разрешён сразу.
+func WithEmailVerification(required bool) Option {
+	return func(api *API) {
+		api.requireVerified = required
+	}
+}
+
+// resendRequest Повторная отправка ссылки подтверждения.
+type resendRequest struct {
+	Username string `json:"username"`
+}
+
+// sendVerification Отправляет ссылку подтверждения адреса из записи v.
+func (api *API) sendVerification(ctx context.Context, v storage.EmailVerification) error {
+	token, err := api.issueStateToken("/verify-email", v.Username, verifyTTL, "")
+	if err != nil {
+		return err
+	}
+	link := api.endpoint("/verify-email") + "?" + url.Values{"token": {token}}.Encode()
+	return api.mailer.Send(ctx, v.Username, "verify_email", map[string]string{"Link": link})
+}
+
+// Функция-обработчик для перехода по ссылке подтверждения адреса
+func (api *API) verifyEmailHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	claims, err := api.parseStateToken(ctx, r.URL.Query().Get("token"), "/verify-email")
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Ошибка при проверке ссылки", errorStatus(err))
+		return
+	}
+
+	var v *storage.EmailVerification
+	if claims != nil {
+		v, err = api.db.SearchEmailVerification(ctx, claims.Subject)
+		if err != nil && !errors.Is(err, storage.ErrNotFound) {
+			log.Println(err)
+			http.Error(w, "Ошибка при проверке ссылки", errorStatus(err))
+			return
+		}
+	}
+	// Ссылка, выданная до повторной регистрации того же адреса, недействительна
+	if v == nil || claims.IssuedAt < v.CreatedAt.Unix() {
+		resp := storage.Response{
+			Success: false,
+			Message: "Ссылка недействительна или устарела, запросите новую",
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(resp)
+		return
+	}
+
+	// Подтверждён ли адрес, решает аккаунт. Он отмечается при каждом переходе по ссылке,
+	// чтобы повтор исправил аккаунт, не отмеченный из-за сбоя в прошлый раз
+	if _, err = api.db.SetEmailVerified(ctx, v.Username); err != nil {
+		log.Println(err)
+		http.Error(w, "Ошибка при подтверждении адреса", errorStatus(err))
+		return
+	}
+	if !v.Verified {
+		v.Verified = true
+		v.VerifiedAt = time.Now().UTC()
+		if err = api.db.SetEmailVerification(ctx, *v); err != nil {
+			log.Println(err)
+		}
+		log.Printf("Пользователь %s подтвердил адрес электронной почты", v.Username)
+	}
+
+	resp := storage.Response{
+		Success: true,
+		Message: "Адрес электронной почты подтверждён, теперь можно войти.",
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// Функция-обработчик для повторной отправки ссылки подтверждения.
+// Ответ одинаковый для любого адреса, чтобы по нему нельзя было узнать, есть ли аккаунт.
+func (api *API) resendVerificationHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	var f resendRequest
+	if err := json.NewDecoder(r.Body).Decode(&f); err != nil {
+		http.Error(w, "Ошибка при декодировании JSON", http.StatusBadRequest)
+		return
+	}
+
+	// Подтверждён ли адрес, решает аккаунт, запись нужна для даты регистрации
+	c, err := api.db.GetAccount(ctx, f.Username)
+	if err != nil && !errors.Is(err, storage.ErrNotFound) {
+		log.Println(err)
+	}
+	if c != nil && !c.EmailVerified {
+		v, err := api.db.SearchEmailVerification(ctx, f.Username)
+		if err != nil && !errors.Is(err, storage.ErrNotFound) {
+			log.Println(err)
+		}
+		if v != nil {
+			if err = api.sendVerification(ctx, *v); err != nil {
+				log.Println(err)
+			}
+		}
+	}
+
+	resp := storage.Response{
+		Success: true,
+		Message: "Если адрес зарегистрирован и не подтверждён, мы отправили на него новую ссылку.",
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,481 @@
+package api
+
+import (
+	"authorization/pkg/storage"
+	"authorization/pkg/webauthn"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"github.com/gorilla/mux"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+const webauthnTTL = webauthn.Timeout + time.Minute // Сколько ждём ответ аутентификатора
+
+// credentialJSON Ответ аутентификатора из navigator.credentials, поля в base64url.
+type credentialJSON struct {
+	ID                webauthn.Bytes `json:"id"`
+	ClientDataJSON    webauthn.Bytes `json:"clientDataJSON"`
+	AttestationObject webauthn.Bytes `json:"attestationObject"`
+	AuthenticatorData webauthn.Bytes `json:"authenticatorData"`
+	Signature         webauthn.Bytes `json:"signature"`
+}
+
+// webauthnBeginRequest Начало входа ключом доступа.
+// Без логина браузер предложит любой ключ доступа, сохранённый для сайта.
+type webauthnBeginRequest struct {
+	Username string `json:"username"`
+}
+
+// webauthnFinishRequest Завершение церемонии: токен из ответа begin и ответ аутентификатора.
+type webauthnFinishRequest struct {
+	Ceremony   string         `json:"ceremony"`
+	Name       string         `json:"name"` // Название ключа при регистрации
+	Credential credentialJSON `json:"credential"`
+}
+
+// creationResponse Параметры для navigator.credentials.create.
+type creationResponse struct {
+	Success  bool                     `json:"success"`
+	Options  webauthn.CreationOptions `json:"options"`
+	Ceremony string                   `json:"ceremony"`
+}
+
+// requestResponse Параметры для navigator.credentials.get.
+type requestResponse struct {
+	Success  bool                    `json:"success"`
+	Options  webauthn.RequestOptions `json:"options"`
+	Ceremony string                  `json:"ceremony"`
+}
+
+// credentialInfo Ключ доступа в ответе списка ключей пользователя.
+type credentialInfo struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	AAGUID    string    `json:"aaguid"`
+	Format    string    `json:"format"`
+	CreatedAt time.Time `json:"createdAt"`
+	LastUsed  time.Time `json:"lastUsed"`
+}
+
+// credentialsResponse Ответ со списком ключей доступа пользователя.
+type credentialsResponse struct {
+	Success     bool             `json:"success"`
+	Credentials []credentialInfo `json:"credentials"`
+}
+
+// relyingParty Сайт для ключей доступа, выводится из внешнего адреса сервиса.
+func (api *API) relyingParty() webauthn.RelyingParty {
+	u, err := url.Parse(api.issuer)
+	if err != nil {
+		return webauthn.RelyingParty{Name: totpIssuer, Origin: api.issuer}
+	}
+	return webauthn.RelyingParty{
+		ID:     u.Hostname(),
+		Name:   totpIssuer,
+		Origin: u.Scheme + "://" + u.Host,
+	}
+}
+
+// userHandle Идентификатор пользователя для аутентификатора, не раскрывающий логин.
+func userHandle(username string) []byte {
+	sum := sha256.Sum256([]byte(username))
+	return sum[:16]
+}
+
+// credentialID Идентификатор ключа доступа для хранения в базе.
+func credentialID(id []byte) string {
+	return base64.RawURLEncoding.EncodeToString(id)
+}
+
+// WithCredentialSecret Задаёт секрет, из которого выводятся подставные ключи доступа для неизвестных логинов.
+// Секрет должен быть одинаковым у всех копий сервиса и не меняться при перезапуске,
+// иначе подставные ключи можно отличить от настоящих по смене ответа.
+func WithCredentialSecret(secret string) Option {
+	return func(api *API) {
+		api.credentialSecret = []byte(secret)
+	}
+}
+
+// fakeCredentialIDs Подставной ключ доступа для логина без ключей. Для одного логина он всегда один и тот же
+// и по виду не отличается от настоящего, поэтому по ответу нельзя узнать, есть ли аккаунт и ключи.
+func (api *API) fakeCredentialIDs(username string) [][]byte {
+	mac := hmac.New(sha256.New, api.credentialSecret)
+	mac.Write([]byte(username))
+	return [][]byte{mac.Sum(nil)}
+}
+
+// credentialIDs Идентификаторы ключей доступа пользователя для параметров церемонии.
+func (api *API) credentialIDs(ctx context.Context, username string) ([][]byte, error) {
+	list, err := api.db.ListCredentials(ctx, username)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([][]byte, 0, len(list))
+	for _, c := range list {
+		id, err := base64.RawURLEncoding.DecodeString(c.ID)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// Функция-обработчик для начала регистрации ключа доступа.
+func (api *API) registerBeginHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	session, err := api.currentSession(r)
+	if err != nil {
+		log.Println(err)
+	}
+	if session == nil {
+		http.Error(w, "Требуется авторизация", http.StatusUnauthorized)
+		return
+	}
+
+	// Уже зарегистрированные ключи аутентификатор не станет создавать повторно
+	exclude, err := api.credentialIDs(ctx, session.Username)
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Ошибка при поиске ключей доступа", errorStatus(err))
+		return
+	}
+	challenge, err := webauthn.NewChallenge()
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Ошибка при создании вызова", errorStatus(err))
+		return
+	}
+	ceremony, err := api.issueStateToken("/api/webauthn/register", session.Username, webauthnTTL,
+		base64.RawURLEncoding.EncodeToString(challenge))
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Ошибка при создании вызова", errorStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(creationResponse{
+		Success:  true,
+		Options:  api.relyingParty().CreationOptions(challenge, userHandle(session.Username), session.Username, exclude),
+		Ceremony: ceremony,
+	})
+}
+
+// Функция-обработчик для завершения регистрации ключа доступа.
+func (api *API) registerFinishHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	session, err := api.currentSession(r)
+	if err != nil {
+		log.Println(err)
+	}
+	if session == nil {
+		http.Error(w, "Требуется авторизация", http.StatusUnauthorized)
+		return
+	}
+
+	var f webauthnFinishRequest
+	if err = json.NewDecoder(r.Body).Decode(&f); err != nil {
+		http.Error(w, "Ошибка при декодировании JSON", http.StatusBadRequest)
+		return
+	}
+
+	claims, err := api.parseStateToken(ctx, f.Ceremony, "/api/webauthn/register")
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Ошибка при проверке регистрации", errorStatus(err))
+		return
+	}
+	if claims == nil || claims.Subject != session.Username {
+		http.Error(w, "Время на регистрацию ключа истекло, начните заново", http.StatusBadRequest)
+		return
+	}
+	challenge, err := base64.RawURLEncoding.DecodeString(claims.Challenge)
+	if err != nil {
+		http.Error(w, "Время на регистрацию ключа истекло, начните заново", http.StatusBadRequest)
+		return
+	}
+
+	cred, err := api.relyingParty().VerifyRegistration(challenge, f.Credential.ClientDataJSON, f.Credential.AttestationObject, true)
+	if err != nil {
+		log.Printf("Ключ доступа пользователя %s не принят: %v", session.Username, err)
+		http.Error(w, "Ключ доступа не прошёл проверку", http.StatusBadRequest)
+		return
+	}
+	if err = api.useStateToken(ctx, claims); err != nil {
+		log.Println(err)
+		http.Error(w, "Ошибка при сохранении ключа доступа", errorStatus(err))
+		return
+	}
+
+	id := credentialID(cred.ID)
+	existing, err := api.db.SearchCredential(ctx, id)
+	if err != nil && !errors.Is(err, storage.ErrNotFound) {
+		log.Println(err)
+		http.Error(w, "Ошибка при поиске ключа доступа", errorStatus(err))
+		return
+	}
+	if existing != nil {
+		http.Error(w, "Этот ключ доступа уже зарегистрирован", http.StatusConflict)
+		return
+	}
+
+	name := f.Name
+	if name == "" {
+		name = "Ключ доступа"
+	}
+	now := time.Now().UTC()
+	err = api.db.AddCredential(ctx, storage.WebAuthnCredential{
+		ID:        id,
+		Username:  session.Username,
+		Name:      name,
+		PublicKey: cred.PublicKey,
+		Alg:       cred.Alg,
+		SignCount: int64(cred.SignCount),
+		AAGUID:    hex.EncodeToString(cred.AAGUID),
+		Format:    cred.Format,
+		CreatedAt: now,
+		LastUsed:  now,
+	})
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Ошибка при сохранении ключа доступа", errorStatus(err))
+		return
+	}
+	log.Printf("Пользователь %s добавил ключ доступа %s", session.Username, cred.Format)
+
+	resp := storage.Response{
+		Success: true,
+		Message: "Ключ доступа добавлен.",
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// Функция-обработчик для списка ключей доступа пользователя
+func (api *API) credentialsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	session, err := api.currentSession(r)
+	if err != nil {
+		log.Println(err)
+	}
+	if session == nil {
+		http.Error(w, "Требуется авторизация", http.StatusUnauthorized)
+		return
+	}
+
+	list, err := api.db.ListCredentials(ctx, session.Username)
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Ошибка при получении ключей доступа", errorStatus(err))
+		return
+	}
+
+	resp := credentialsResponse{
+		Success:     true,
+		Credentials: []credentialInfo{},
+	}
+	for _, c := range list {
+		resp.Credentials = append(resp.Credentials, credentialInfo{
+			ID:        c.ID,
+			Name:      c.Name,
+			AAGUID:    c.AAGUID,
+			Format:    c.Format,
+			CreatedAt: c.CreatedAt,
+			LastUsed:  c.LastUsed,
+		})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// Функция-обработчик для удаления ключа доступа пользователя
+func (api *API) delCredentialHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	session, err := api.currentSession(r)
+	if err != nil {
+		log.Println(err)
+	}
+	if session == nil {
+		http.Error(w, "Требуется авторизация", http.StatusUnauthorized)
+		return
+	}
+
+	// Чужие ключи выглядят как несуществующие
+	ok, err := api.db.DelCredential(ctx, session.Username, mux.Vars(r)["id"])
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Ошибка при удалении ключа доступа", errorStatus(err))
+		return
+	}
+	if !ok {
+		http.Error(w, "Ключ доступа не найден", http.StatusNotFound)
+		return
+	}
+
+	resp := storage.Response{
+		Success: true,
+		Message: "Ключ доступа удалён.",
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// Функция-обработчик для начала входа ключом доступа.
+// Неизвестному логину и пользователю без ключей отдаётся подставной ключ, неотличимый от настоящего.
+func (api *API) loginWebAuthnBeginHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	var f webauthnBeginRequest
+	if err := json.NewDecoder(r.Body).Decode(&f); err != nil {
+		http.Error(w, "Ошибка при декодировании JSON", http.StatusBadRequest)
+		return
+	}
+
+	var allow [][]byte
+	if f.Username != "" {
+		var err error
+		allow, err = api.credentialIDs(ctx, f.Username)
+		if err != nil {
+			log.Println(err)
+			http.Error(w, "Ошибка при поиске ключей доступа", errorStatus(err))
+			return
+		}
+		if len(allow) == 0 {
+			allow = api.fakeCredentialIDs(f.Username)
+		}
+	}
+	challenge, err := webauthn.NewChallenge()
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Ошибка при создании вызова", errorStatus(err))
+		return
+	}
+	ceremony, err := api.issueStateToken("/login/webauthn", f.Username, webauthnTTL,
+		base64.RawURLEncoding.EncodeToString(challenge))
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Ошибка при создании вызова", errorStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(requestResponse{
+		Success:  true,
+		Options:  api.relyingParty().RequestOptions(challenge, allow),
+		Ceremony: ceremony,
+	})
+}
+
+// Функция-обработчик для завершения входа ключом доступа.
+// Ключ с проверкой пользователя заменяет и пароль, и второй фактор.
+func (api *API) loginWebAuthnFinishHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	var f webauthnFinishRequest
+	if err := json.NewDecoder(r.Body).Decode(&f); err != nil {
+		http.Error(w, "Ошибка при декодировании JSON", http.StatusBadRequest)
+		return
+	}
+
+	fail := func() {
+		resp := storage.Response{
+			Success: false,
+			Message: "Не удалось войти с ключом доступа",
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+	}
+
+	claims, err := api.parseStateToken(ctx, f.Ceremony, "/login/webauthn")
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Ошибка при проверке входа", errorStatus(err))
+		return
+	}
+	// Попытка засчитывается пользователю, для которого начат вход, и адресу клиента
+	var username string
+	if claims != nil {
+		username = claims.Subject
+	}
+	attempt, wait := api.reserveLogin(r, username)
+	if wait > 0 {
+		tooManyAttempts(w, wait)
+		return
+	}
+	if claims == nil {
+		fail()
+		return
+	}
+	challenge, err := base64.RawURLEncoding.DecodeString(claims.Challenge)
+	if err != nil {
+		fail()
+		return
+	}
+
+	c, err := api.db.SearchCredential(ctx, credentialID(f.Credential.ID))
+	if err != nil && !errors.Is(err, storage.ErrNotFound) {
+		log.Println(err)
+		http.Error(w, "Ошибка при поиске ключа доступа", errorStatus(err))
+		return
+	}
+	// Если вход начат с логином, ключ должен принадлежать этому пользователю
+	if c == nil || (claims.Subject != "" && claims.Subject != c.Username) {
+		fail()
+		return
+	}
+
+	cred := webauthn.Credential{
+		ID:        f.Credential.ID,
+		PublicKey: c.PublicKey,
+		Alg:       c.Alg,
+		SignCount: uint32(c.SignCount),
+		Format:    c.Format,
+	}
+	count, err := api.relyingParty().VerifyAssertion(cred, challenge, f.Credential.ClientDataJSON,
+		f.Credential.AuthenticatorData, f.Credential.Signature, true)
+	if errors.Is(err, webauthn.ErrSignCount) {
+		log.Printf("Счётчик ключа доступа %s пользователя %s не вырос, возможно ключ скопирован", c.ID, c.Username)
+	}
+	if err != nil {
+		fail()
+		return
+	}
+
+	// Одновременный вход тем же ответом проиграет сравнение счётчика
+	ok, err := api.db.UseCredential(ctx, c.ID, c.SignCount, int64(count), time.Now().UTC())
+	if err == nil && ok {
+		err = api.useStateToken(ctx, claims)
+	}
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Ошибка при создании сессии", errorStatus(err))
+		return
+	}
+	if !ok {
+		fail()
+		return
+	}
+	api.cancelAttempt(ctx, attempt)
+
+	refusal, err := api.loginRefusal(ctx, c.Username)
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Ошибка при проверке аккаунта", errorStatus(err))
+		return
+	}
+	if refusal != "" {
+		refuseLogin(w, refusal)
+		return
+	}
+	api.finishLogin(w, r, c.Username)
+}
@@ -0,0 +1,399 @@
+package check
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/crypto/scrypt"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// Имена поддерживаемых алгоритмов хеширования паролей.
+const (
+	Argon2id = "argon2id"
+	Bcrypt   = "bcrypt"
+	Scrypt   = "scrypt"
+	// LegacySHA256 Устаревший формат: несолёный SHA-256 в шестнадцатеричном виде.
+	LegacySHA256 = "sha256"
+)
+
+var (
+	// ErrUnknownHash Хеш создан неизвестным алгоритмом.
+	ErrUnknownHash = errors.New("неизвестный формат хеша пароля")
+	// ErrInvalidHash Хеш повреждён или содержит недопустимые параметры.
+	ErrInvalidHash = errors.New("некорректный хеш пароля")
+)
+
+// Hasher Алгоритм хеширования паролей.
+// Хеш кодируется в формате PHC и сам хранит соль и параметры,
+// поэтому проверка не зависит от текущих настроек хешера.
+type Hasher interface {
+	// Name Имя алгоритма.
+	Name() string
+	// Hash Возвращает закодированный хеш пароля со случайной солью.
+	Hash(password string) (string, error)
+	// Verify Сравнивает пароль с закодированным хешем за постоянное время.
+	Verify(password, encoded string) (bool, error)
+}
+
+var (
+	hasherMu sync.RWMutex
+	hasher   Hasher = NewArgon2id()
+)
+
+// NewHasher Возвращает хешер с параметрами по умолчанию по имени алгоритма.
+func NewHasher(name string) (Hasher, error) {
+	switch strings.ToLower(name) {
+	case Argon2id, "":
+		return NewArgon2id(), nil
+	case Bcrypt:
+		return NewBcrypt(), nil
+	case Scrypt:
+		return NewScrypt(), nil
+	}
+	return nil, fmt.Errorf("неизвестный алгоритм хеширования %q", name)
+}
+
+// SetHasher Устанавливает алгоритм, которым хешируются новые пароли.
+func SetHasher(h Hasher) {
+	hasherMu.Lock()
+	defer hasherMu.Unlock()
+	hasher = h
+}
+
+// CurrentHasher Возвращает алгоритм, которым хешируются новые пароли.
+func CurrentHasher() Hasher {
+	hasherMu.RLock()
+	defer hasherMu.RUnlock()
+	return hasher
+}
+
+// HashPass Хеширование пароля текущим алгоритмом.
+func HashPass(password string) (string, error) {
+	return CurrentHasher().Hash(password)
+}
+
+// VerifyPass Проверяет пароль по хешу любого поддерживаемого алгоритма,
+// включая устаревший несолёный SHA-256.
+func VerifyPass(password, encoded string) (bool, error) {
+	h, err := hasherFor(encoded)
+	if err != nil {
+		return false, err
+	}
+	return h.Verify(password, encoded)
+}
+
+// NeedsRehash Сообщает, что хеш создан не текущим алгоритмом или с другими параметрами
+// и после успешного входа его следует пересчитать.
+func NeedsRehash(encoded string) bool {
+	current := CurrentHasher()
+	switch h := current.(type) {
+	case *Argon2idHasher:
+		p, salt, key, err := decodeArgon2id(encoded)
+		if err != nil {
+			return true
+		}
+		return p.Memory != h.Memory || p.Iterations != h.Iterations || p.Parallelism != h.Parallelism ||
+			uint32(len(salt)) != h.SaltLen || uint32(len(key)) != h.KeyLen
+	case *BcryptHasher:
+		if !strings.HasPrefix(encoded, "$2") {
+			return true
+		}
+		cost, err := bcrypt.Cost([]byte(encoded))
+		return err != nil || cost != h.Cost
+	case *ScryptHasher:
+		p, salt, key, err := decodeScrypt(encoded)
+		if err != nil {
+			return true
+		}
+		return p.LogN != h.LogN || p.R != h.R || p.P != h.P ||
+			uint32(len(salt)) != h.SaltLen || uint32(len(key)) != h.KeyLen
+	}
+	// Для сторонних реализаций сравниваем только алгоритм
+	h, err := hasherFor(encoded)
+	return err != nil || h.Name() != current.Name()
+}
+
+// IsLegacyHash Сообщает, что хеш сохранён в устаревшем формате SHA-256.
+func IsLegacyHash(encoded string) bool {
+	return legacyRegex.MatchString(encoded)
+}
+
+// legacyRegex Формат хешей, которые создавала прежняя версия HashPass.
+var legacyRegex = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// hasherFor Определяет алгоритм по префиксу закодированного хеша.
+func hasherFor(encoded string) (Hasher, error) {
+	switch {
+	case IsLegacyHash(encoded):
+		return legacyHasher{}, nil
+	case strings.HasPrefix(encoded, "$argon2id$"):
+		return NewArgon2id(), nil
+	case strings.HasPrefix(encoded, "$scrypt$"):
+		return NewScrypt(), nil
+	case strings.HasPrefix(encoded, "$2a$"), strings.HasPrefix(encoded, "$2b$"), strings.HasPrefix(encoded, "$2y$"):
+		return NewBcrypt(), nil
+	}
+	return nil, ErrUnknownHash
+}
+
+// randomSalt Генерирует криптографически стойкую соль.
+func randomSalt(n uint32) ([]byte, error) {
+	salt := make([]byte, n)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	return salt, nil
+}
+
+// b64 Кодировка соли и хеша в формате PHC (base64 без дополнения).
+var b64 = base64.RawStdEncoding
+
+// Argon2idHasher Хеширование argon2id (RFC 9106).
+type Argon2idHasher struct {
+	Memory      uint32 // Память в КиБ
+	Iterations  uint32 // Число проходов
+	Parallelism uint8  // Число потоков
+	SaltLen     uint32 // Длина соли в байтах
+	KeyLen      uint32 // Длина хеша в байтах
+}
+
+// NewArgon2id Конструктор с рекомендуемыми параметрами RFC 9106.
+func NewArgon2id() *Argon2idHasher {
+	return &Argon2idHasher{
+		Memory:      64 * 1024,
+		Iterations:  3,
+		Parallelism: 4,
+		SaltLen:     16,
+		KeyLen:      32,
+	}
+}
+
+// Name Имя алгоритма.
+func (h *Argon2idHasher) Name() string {
+	return Argon2id
+}
+
+// Hash Хеш вида $argon2id$v=19$m=65536,t=3,p=4$<соль>$<хеш>.
+func (h *Argon2idHasher) Hash(password string) (string, error) {
+	salt, err := randomSalt(h.SaltLen)
+	if err != nil {
+		return "", err
+	}
+	key := argon2.IDKey([]byte(password), salt, h.Iterations, h.Memory, h.Parallelism, h.KeyLen)
+
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, h.Memory, h.Iterations, h.Parallelism, b64.EncodeToString(salt), b64.EncodeToString(key)), nil
+}
+
+// Verify Проверяет пароль с параметрами, записанными в хеше.
+func (h *Argon2idHasher) Verify(password, encoded string) (bool, error) {
+	p, salt, key, err := decodeArgon2id(encoded)
+	if err != nil {
+		return false, err
+	}
+	other := argon2.IDKey([]byte(password), salt, p.Iterations, p.Memory, p.Parallelism, uint32(len(key)))
+
+	return subtle.ConstantTimeCompare(key, other) == 1, nil
+}
+
+// decodeArgon2id Разбирает хеш argon2id на параметры, соль и ключ.
+func decodeArgon2id(encoded string) (*Argon2idHasher, []byte, []byte, error) {
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 || parts[1] != Argon2id {
+		return nil, nil, nil, ErrInvalidHash
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return nil, nil, nil, ErrInvalidHash
+	}
+
+	p := &Argon2idHasher{}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.Memory, &p.Iterations, &p.Parallelism); err != nil {
+		return nil, nil, nil, ErrInvalidHash
+	}
+	if p.Iterations == 0 || p.Parallelism == 0 {
+		return nil, nil, nil, ErrInvalidHash
+	}
+
+	salt, err := b64.DecodeString(parts[4])
+	if err != nil {
+		return nil, nil, nil, ErrInvalidHash
+	}
+	key, err := b64.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return nil, nil, nil, ErrInvalidHash
+	}
+	p.SaltLen = uint32(len(salt))
+	p.KeyLen = uint32(len(key))
+
+	return p, salt, key, nil
+}
+
+// BcryptHasher Хеширование bcrypt.
+type BcryptHasher struct {
+	Cost int // Стоимость (логарифм числа раундов)
+}
+
+// NewBcrypt Конструктор со стоимостью 12.
+func NewBcrypt() *BcryptHasher {
+	return &BcryptHasher{Cost: 12}
+}
+
+// Name Имя алгоритма.
+func (h *BcryptHasher) Name() string {
+	return Bcrypt
+}
+
+// Hash Хеш в собственном формате bcrypt $2a$<стоимость>$<соль><хеш>.
+func (h *BcryptHasher) Hash(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), h.Cost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+// Verify Проверяет пароль, bcrypt сравнивает хеши за постоянное время.
+func (h *BcryptHasher) Verify(password, encoded string) (bool, error) {
+	err := bcrypt.CompareHashAndPassword([]byte(encoded), []byte(password))
+	if err == nil {
+		return true, nil
+	}
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		return false, nil
+	}
+	return false, ErrInvalidHash
+}
+
+// ScryptHasher Хеширование scrypt.
+type ScryptHasher struct {
+	LogN    uint8  // Логарифм параметра стоимости N
+	R       int    // Размер блока
+	P       int    // Параллелизм
+	SaltLen uint32 // Длина соли в байтах
+	KeyLen  uint32 // Длина хеша в байтах
+}
+
+// NewScrypt Конструктор с параметрами N=2^15, r=8, p=1.
+func NewScrypt() *ScryptHasher {
+	return &ScryptHasher{
+		LogN:    15,
+		R:       8,
+		P:       1,
+		SaltLen: 16,
+		KeyLen:  32,
+	}
+}
+
+// Name Имя алгоритма.
+func (h *ScryptHasher) Name() string {
+	return Scrypt
+}
+
+// Hash Хеш вида $scrypt$ln=15,r=8,p=1$<соль>$<хеш>.
+func (h *ScryptHasher) Hash(password string) (string, error) {
+	salt, err := randomSalt(h.SaltLen)
+	if err != nil {
+		return "", err
+	}
+	key, err := scrypt.Key([]byte(password), salt, 1<<h.LogN, h.R, h.P, int(h.KeyLen))
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("$scrypt$ln=%d,r=%d,p=%d$%s$%s",
+		h.LogN, h.R, h.P, b64.EncodeToString(salt), b64.EncodeToString(key)), nil
+}
+
+// Verify Проверяет пароль с параметрами, записанными в хеше.
+func (h *ScryptHasher) Verify(password, encoded string) (bool, error) {
+	p, salt, key, err := decodeScrypt(encoded)
+	if err != nil {
+		return false, err
+	}
+	other, err := scrypt.Key([]byte(password), salt, 1<<p.LogN, p.R, p.P, len(key))
+	if err != nil {
+		return false, ErrInvalidHash
+	}
+
+	return subtle.ConstantTimeCompare(key, other) == 1, nil
+}
+
+// decodeScrypt Разбирает хеш scrypt на параметры, соль и ключ.
+func decodeScrypt(encoded string) (*ScryptHasher, []byte, []byte, error) {
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 5 || parts[1] != Scrypt {
+		return nil, nil, nil, ErrInvalidHash
+	}
+
+	p := &ScryptHasher{}
+	if _, err := fmt.Sscanf(parts[2], "ln=%d,r=%d,p=%d", &p.LogN, &p.R, &p.P); err != nil {
+		return nil, nil, nil, ErrInvalidHash
+	}
+	if p.LogN == 0 || p.LogN > 30 || p.R <= 0 || p.P <= 0 {
+		return nil, nil, nil, ErrInvalidHash
+	}
+
+	salt, err := b64.DecodeString(parts[3])
+	if err != nil {
+		return nil, nil, nil, ErrInvalidHash
+	}
+	key, err := b64.DecodeString(parts[4])
+	if err != nil || len(key) == 0 {
+		return nil, nil, nil, ErrInvalidHash
+	}
+	p.SaltLen = uint32(len(salt))
+	p.KeyLen = uint32(len(key))
+
+	return p, salt, key, nil
+}
+
+// legacyHasher Проверка паролей, захешированных несолёным SHA-256.
+// Новые хеши в этом формате не создаются, он нужен только для миграции.
+type legacyHasher struct{}
+
+// Name Имя алгоритма.
+func (legacyHasher) Name() string {
+	return LegacySHA256
+}
+
+// Hash Устаревший формат не используется для новых паролей.
+func (legacyHasher) Hash(string) (string, error) {
+	return "", errors.New("хеширование SHA-256 без соли запрещено")
+}
+
+// Verify Сравнивает SHA-256 пароля с сохранённым значением за постоянное время.
+func (legacyHasher) Verify(password, encoded string) (bool, error) {
+	sum := sha256.Sum256([]byte(password))
+	other := hex.EncodeToString(sum[:])
+
+	return subtle.ConstantTimeCompare([]byte(encoded), []byte(other)) == 1, nil
+}
+
+// dummyHashes Фиктивные хеши для FakeVerify по имени алгоритма.
+var dummyHashes sync.Map
+
+// FakeVerify Выполняет проверку пароля по фиктивному хешу текущего алгоритма,
+// чтобы время ответа для несуществующего пользователя не выдавало его отсутствие.
+func FakeVerify(password string) {
+	h := CurrentHasher()
+	encoded, ok := dummyHashes.Load(h.Name())
+	if !ok {
+		hash, err := h.Hash("dummy-password")
+		if err != nil {
+			return
+		}
+		encoded, _ = dummyHashes.LoadOrStore(h.Name(), hash)
+	}
+	_, _ = h.Verify(password, encoded.(string))
+}
@@ -0,0 +1,159 @@
+package check
+
+import (
+	"strings"
+	"testing"
+)
+
+// testHashers Хешеры с облегчёнными параметрами, чтобы тесты проходили быстро.
+func testHashers() []Hasher {
+	return []Hasher{
+		&Argon2idHasher{Memory: 1024, Iterations: 1, Parallelism: 1, SaltLen: 16, KeyLen: 32},
+		&BcryptHasher{Cost: 4},
+		&ScryptHasher{LogN: 4, R: 8, P: 1, SaltLen: 16, KeyLen: 32},
+	}
+}
+
+func TestHasher_HashVerify(t *testing.T) {
+	for _, h := range testHashers() {
+		t.Run(h.Name(), func(t *testing.T) {
+			encoded, err := h.Hash("Test123!")
+			if err != nil {
+				t.Fatalf("ошибка хеширования: %v", err)
+			}
+
+			ok, err := h.Verify("Test123!", encoded)
+			if err != nil {
+				t.Fatalf("ошибка проверки: %v", err)
+			}
+			if !ok {
+				t.Error("верный пароль не прошёл проверку")
+			}
+
+			ok, err = h.Verify("Test123?", encoded)
+			if err != nil {
+				t.Fatalf("ошибка проверки: %v", err)
+			}
+			if ok {
+				t.Error("неверный пароль прошёл проверку")
+			}
+		})
+	}
+}
+
+func TestHasher_Salt(t *testing.T) {
+	for _, h := range testHashers() {
+		first, err := h.Hash("Test123!")
+		if err != nil {
+			t.Fatal(err)
+		}
+		second, err := h.Hash("Test123!")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if first == second {
+			t.Errorf("%s: одинаковые хеши для одного пароля, соль не используется", h.Name())
+		}
+	}
+}
+
+func TestVerifyPass(t *testing.T) {
+	// Хеши, созданные с любыми параметрами, проверяются независимо от текущего хешера
+	for _, h := range testHashers() {
+		encoded, err := h.Hash("Test123!")
+		if err != nil {
+			t.Fatal(err)
+		}
+		ok, err := VerifyPass("Test123!", encoded)
+		if err != nil {
+			t.Fatalf("%s: ошибка проверки: %v", h.Name(), err)
+		}
+		if !ok {
+			t.Errorf("%s: верный пароль не прошёл проверку", h.Name())
+		}
+	}
+
+	if _, err := VerifyPass("Test123!", "plain"); err != ErrUnknownHash {
+		t.Errorf("ожидается ErrUnknownHash, получено %v", err)
+	}
+	if _, err := VerifyPass("Test123!", "$argon2id$v=19$m=x$y"); err != ErrInvalidHash {
+		t.Errorf("ожидается ErrInvalidHash, получено %v", err)
+	}
+}
+
+func TestArgon2id_Format(t *testing.T) {
+	h := &Argon2idHasher{Memory: 1024, Iterations: 2, Parallelism: 1, SaltLen: 16, KeyLen: 32}
+	encoded, err := h.Hash("Test123!")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(encoded, "$argon2id$v=19$m=1024,t=2,p=1$") {
+		t.Errorf("неверный формат PHC: %s", encoded)
+	}
+}
+
+func TestNewHasher(t *testing.T) {
+	for _, name := range []string{Argon2id, Bcrypt, Scrypt} {
+		h, err := NewHasher(name)
+		if err != nil {
+			t.Fatalf("ошибка создания хешера %s: %v", name, err)
+		}
+		if h.Name() != name {
+			t.Errorf("получен хешер %s, ожидается %s", h.Name(), name)
+		}
+	}
+	if _, err := NewHasher("md5"); err == nil {
+		t.Error("ожидается ошибка для неизвестного алгоритма")
+	}
+}
+
+func TestVerifyPass_Legacy(t *testing.T) {
+	// SHA-256 от "Test123!", как его сохраняла прежняя версия HashPass
+	legacy := "54de7f606f2523cba8efac173fab42fb7f59d56ceff974c8fdb7342cf2cfe345"
+	if !IsLegacyHash(legacy) {
+		t.Fatal("хеш не распознан как устаревший")
+	}
+
+	ok, err := VerifyPass("Test123!", legacy)
+	if err != nil {
+		t.Fatalf("ошибка проверки: %v", err)
+	}
+	if !ok {
+		t.Error("верный пароль не прошёл проверку по устаревшему хешу")
+	}
+	ok, _ = VerifyPass("Test123?", legacy)
+	if ok {
+		t.Error("неверный пароль прошёл проверку по устаревшему хешу")
+	}
+
+	if !NeedsRehash(legacy) {
+		t.Error("устаревший хеш должен требовать перехеширования")
+	}
+}
+
+func TestNeedsRehash(t *testing.T) {
+	old := CurrentHasher()
+	defer SetHasher(old)
+
+	weak := &Argon2idHasher{Memory: 1024, Iterations: 1, Parallelism: 1, SaltLen: 16, KeyLen: 32}
+	SetHasher(weak)
+	encoded, err := HashPass("Test123!")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if NeedsRehash(encoded) {
+		t.Error("хеш с текущими параметрами не должен требовать перехеширования")
+	}
+
+	// Изменились параметры
+	SetHasher(&Argon2idHasher{Memory: 2048, Iterations: 1, Parallelism: 1, SaltLen: 16, KeyLen: 32})
+	if !NeedsRehash(encoded) {
+		t.Error("хеш со старыми параметрами должен требовать перехеширования")
+	}
+
+	// Изменился алгоритм
+	SetHasher(&BcryptHasher{Cost: 4})
+	if !NeedsRehash(encoded) {
+		t.Error("хеш другого алгоритма должен требовать перехеширования")
+	}
+}
@@ -0,0 +1,143 @@
+// Package jwt Выпуск и проверка JSON Web Token (RFC 7519) в компактной форме JWS.
+package jwt
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrMalformed Токен не разбирается как JWS.
+	ErrMalformed = errors.New("jwt: некорректный формат токена")
+	// ErrSignature Подпись токена не прошла проверку.
+	ErrSignature = errors.New("jwt: неверная подпись")
+	// ErrUnknownKey Ключ с указанным kid или алгоритмом не найден.
+	ErrUnknownKey = errors.New("jwt: неизвестный ключ")
+	// ErrExpired Срок действия токена истёк.
+	ErrExpired = errors.New("jwt: срок действия токена истёк")
+	// ErrNotYetValid Токен ещё не действует.
+	ErrNotYetValid = errors.New("jwt: токен ещё не действует")
+)
+
+// leeway Допустимое расхождение часов между серверами.
+const leeway = 30 * time.Second
+
+// Signer Ключ, которым подписываются токены.
+type Signer interface {
+	Alg() string
+	KeyID() string
+	Sign(input []byte) ([]byte, error)
+}
+
+// Verifier Ключ, которым проверяется подпись.
+type Verifier interface {
+	Verify(input, signature []byte) error
+}
+
+// KeySet Набор ключей: текущий ключ для подписи, все действующие ключи для проверки
+// и их открытые части для публикации. Verifier может подгружать неизвестный ключ в рамках ctx запроса.
+type KeySet interface {
+	Signer() (Signer, error)
+	Verifier(ctx context.Context, alg, kid string) (Verifier, error)
+	JWKS() JWKSet
+}
+
+// Header Заголовок JWS.
+type Header struct {
+	Alg string `json:"alg"`
+	Typ string `json:"typ,omitempty"`
+	Kid string `json:"kid,omitempty"`
+}
+
+// Claims Зарегистрированные утверждения RFC 7519.
+// Встраивается в структуры с дополнительными утверждениями.
+type Claims struct {
+	Issuer    string `json:"iss,omitempty"`
+	Subject   string `json:"sub,omitempty"`
+	Audience  string `json:"aud,omitempty"`
+	ExpiresAt int64  `json:"exp,omitempty"`
+	NotBefore int64  `json:"nbf,omitempty"`
+	IssuedAt  int64  `json:"iat,omitempty"`
+	ID        string `json:"jti,omitempty"`
+}
+
+// enc Кодировка частей токена.
+var enc = base64.RawURLEncoding
+
+// Sign Подписывает утверждения ключом и возвращает токен.
+func Sign(s Signer, claims interface{}) (string, error) {
+	header, err := json.Marshal(Header{Alg: s.Alg(), Typ: "JWT", Kid: s.KeyID()})
+	if err != nil {
+		return "", err
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	input := enc.EncodeToString(header) + "." + enc.EncodeToString(payload)
+	sig, err := s.Sign([]byte(input))
+	if err != nil {
+		return "", err
+	}
+	return input + "." + enc.EncodeToString(sig), nil
+}
+
+// Parse Проверяет подпись и сроки действия токена и раскладывает утверждения в claims.
+// Издателя и аудиторию проверяет вызывающий код.
+func Parse(ctx context.Context, token string, keys KeySet, claims interface{}) error {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return ErrMalformed
+	}
+
+	headerJSON, err := enc.DecodeString(parts[0])
+	if err != nil {
+		return ErrMalformed
+	}
+	var h Header
+	if err = json.Unmarshal(headerJSON, &h); err != nil {
+		return ErrMalformed
+	}
+	// Алгоритм "none" не допускается ни при каких условиях
+	if h.Alg == "" || strings.EqualFold(h.Alg, "none") {
+		return ErrSignature
+	}
+
+	sig, err := enc.DecodeString(parts[2])
+	if err != nil {
+		return ErrMalformed
+	}
+	v, err := keys.Verifier(ctx, h.Alg, h.Kid)
+	if err != nil {
+		return err
+	}
+	if err = v.Verify([]byte(parts[0]+"."+parts[1]), sig); err != nil {
+		return ErrSignature
+	}
+
+	payload, err := enc.DecodeString(parts[1])
+	if err != nil {
+		return ErrMalformed
+	}
+	var registered Claims
+	if err = json.Unmarshal(payload, &registered); err != nil {
+		return ErrMalformed
+	}
+	now := time.Now()
+	if registered.ExpiresAt != 0 && now.After(time.Unix(registered.ExpiresAt, 0).Add(leeway)) {
+		return ErrExpired
+	}
+	if registered.NotBefore != 0 && now.Add(leeway).Before(time.Unix(registered.NotBefore, 0)) {
+		return ErrNotYetValid
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(payload))
+	dec.UseNumber()
+	return dec.Decode(claims)
+}
@@ -0,0 +1,124 @@
+package jwt
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testClaims struct {
+	Claims
+	Scope string `json:"scope,omitempty"`
+}
+
+func TestSignParse(t *testing.T) {
+	ctx := context.Background()
+	for _, alg := range []string{RS256, ES256, EdDSA} {
+		t.Run(alg, func(t *testing.T) {
+			key, err := GenerateKey(alg, "test-"+alg)
+			if err != nil {
+				t.Fatalf("ошибка создания ключа: %v", err)
+			}
+			keys := StaticKeySet{key}
+
+			claims := testClaims{
+				Claims: Claims{
+					Subject:   "ups@mail.ru",
+					ExpiresAt: time.Now().Add(time.Minute).Unix(),
+				},
+				Scope: "openid",
+			}
+			token, err := Sign(key, claims)
+			if err != nil {
+				t.Fatalf("ошибка подписи: %v", err)
+			}
+
+			var got testClaims
+			if err = Parse(ctx, token, keys, &got); err != nil {
+				t.Fatalf("ошибка проверки: %v", err)
+			}
+			if got.Subject != claims.Subject || got.Scope != claims.Scope {
+				t.Errorf("неправильные утверждения. Получено: %+v, Ожидается: %+v", got, claims)
+			}
+		})
+	}
+}
+
+func TestParse_Invalid(t *testing.T) {
+	ctx := context.Background()
+	key, _ := GenerateKey(ES256, "test")
+	keys := StaticKeySet{key}
+
+	expired, _ := Sign(key, Claims{ExpiresAt: time.Now().Add(-time.Hour).Unix()})
+	if err := Parse(ctx, expired, keys, &Claims{}); err != ErrExpired {
+		t.Errorf("ожидается ErrExpired, получено %v", err)
+	}
+
+	// Токен, подписанный другим ключом с тем же kid
+	otherKey, _ := GenerateKey(ES256, "test")
+	other, _ := Sign(otherKey, Claims{Subject: "ups@mail.ru"})
+	if err := Parse(ctx, other, keys, &Claims{}); err != ErrSignature {
+		t.Errorf("ожидается ErrSignature, получено %v", err)
+	}
+
+	// Токен с подменённым содержимым
+	valid, _ := Sign(key, Claims{Subject: "ups@mail.ru"})
+	parts := strings.Split(valid, ".")
+	forged, _ := Sign(key, Claims{Subject: "admin@mail.ru"})
+	tampered := parts[0] + "." + strings.Split(forged, ".")[1] + "." + parts[2]
+	if err := Parse(ctx, tampered, keys, &Claims{}); err != ErrSignature {
+		t.Errorf("ожидается ErrSignature, получено %v", err)
+	}
+
+	// Неизвестный kid
+	unknown, _ := GenerateKey(ES256, "unknown")
+	token, _ := Sign(unknown, Claims{Subject: "ups@mail.ru"})
+	if err := Parse(ctx, token, keys, &Claims{}); err != ErrUnknownKey {
+		t.Errorf("ожидается ErrUnknownKey, получено %v", err)
+	}
+
+	// Алгоритм none
+	none := "eyJhbGciOiJub25lIn0.eyJzdWIiOiJ1cHNAbWFpbC5ydSJ9."
+	if err := Parse(ctx, none, keys, &Claims{}); err == nil {
+		t.Error("токен без подписи прошёл проверку")
+	}
+
+	if err := Parse(ctx, "abc", keys, &Claims{}); err != ErrMalformed {
+		t.Errorf("ожидается ErrMalformed, получено %v", err)
+	}
+}
+
+func TestParseKey(t *testing.T) {
+	ctx := context.Background()
+	for _, alg := range []string{RS256, ES256, EdDSA} {
+		key, err := GenerateKey(alg, "test")
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := key.MarshalPEM()
+		if err != nil {
+			t.Fatalf("%s: ошибка сериализации ключа: %v", alg, err)
+		}
+		restored, err := ParseKey(alg, "test", data)
+		if err != nil {
+			t.Fatalf("%s: ошибка восстановления ключа: %v", alg, err)
+		}
+
+		// Токен, подписанный восстановленным ключом, проверяется исходным
+		token, _ := Sign(restored, Claims{Subject: "ups@mail.ru"})
+		if err = Parse(ctx, token, StaticKeySet{key}, &Claims{}); err != nil {
+			t.Errorf("%s: ошибка проверки: %v", alg, err)
+		}
+		if jwk := key.JWK(); jwk.Kid != "test" || jwk.Alg != alg || jwk.Kty == "" {
+			t.Errorf("%s: неправильный JWK: %+v", alg, jwk)
+		}
+	}
+
+	// Тип ключа должен соответствовать алгоритму
+	key, _ := GenerateKey(ES256, "test")
+	data, _ := key.MarshalPEM()
+	if _, err := ParseKey(RS256, "test", data); err == nil {
+		t.Error("ключ ES256 восстановлен как RS256")
+	}
+}
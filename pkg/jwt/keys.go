@@ -0,0 +1,230 @@
+package jwt
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// Поддерживаемые асимметричные алгоритмы подписи.
+const (
+	RS256 = "RS256"
+	ES256 = "ES256"
+	EdDSA = "EdDSA"
+)
+
+// Key Асимметричный ключ подписи с идентификатором kid.
+// Открытая часть публикуется в JWKS, чтобы другие сервисы проверяли токены без обращения к нам.
+type Key struct {
+	kid     string
+	alg     string
+	private crypto.Signer
+}
+
+// GenerateKey Создает новый ключ для алгоритма RS256, ES256 или EdDSA.
+func GenerateKey(alg, kid string) (*Key, error) {
+	var (
+		private crypto.Signer
+		err     error
+	)
+	switch alg {
+	case RS256:
+		private, err = rsa.GenerateKey(rand.Reader, 2048)
+	case ES256:
+		private, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case EdDSA:
+		_, private, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		return nil, fmt.Errorf("jwt: неподдерживаемый алгоритм %q", alg)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &Key{kid: kid, alg: alg, private: private}, nil
+}
+
+// ParseKey Восстанавливает ключ из закрытого ключа PKCS #8 в формате PEM.
+func ParseKey(alg, kid, privatePEM string) (*Key, error) {
+	block, _ := pem.Decode([]byte(privatePEM))
+	if block == nil {
+		return nil, errors.New("jwt: закрытый ключ не в формате PEM")
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	var private crypto.Signer
+	switch k := parsed.(type) {
+	case *rsa.PrivateKey:
+		if alg == RS256 {
+			private = k
+		}
+	case *ecdsa.PrivateKey:
+		if alg == ES256 && k.Curve == elliptic.P256() {
+			private = k
+		}
+	case ed25519.PrivateKey:
+		if alg == EdDSA {
+			private = k
+		}
+	}
+	if private == nil {
+		return nil, fmt.Errorf("jwt: тип ключа не соответствует алгоритму %q", alg)
+	}
+	return &Key{kid: kid, alg: alg, private: private}, nil
+}
+
+// MarshalPEM Закрытый ключ PKCS #8 в формате PEM для хранения в базе.
+func (k *Key) MarshalPEM() (string, error) {
+	der, err := x509.MarshalPKCS8PrivateKey(k.private)
+	if err != nil {
+		return "", err
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})), nil
+}
+
+// Alg Алгоритм подписи.
+func (k *Key) Alg() string {
+	return k.alg
+}
+
+// KeyID Идентификатор ключа.
+func (k *Key) KeyID() string {
+	return k.kid
+}
+
+// Sign Подписывает данные.
+// Подпись ES256 кодируется как R || S по 32 байта, как требует RFC 7518.
+func (k *Key) Sign(input []byte) ([]byte, error) {
+	switch private := k.private.(type) {
+	case *rsa.PrivateKey:
+		sum := sha256.Sum256(input)
+		return rsa.SignPKCS1v15(rand.Reader, private, crypto.SHA256, sum[:])
+	case *ecdsa.PrivateKey:
+		sum := sha256.Sum256(input)
+		r, s, err := ecdsa.Sign(rand.Reader, private, sum[:])
+		if err != nil {
+			return nil, err
+		}
+		sig := make([]byte, 64)
+		r.FillBytes(sig[:32])
+		s.FillBytes(sig[32:])
+		return sig, nil
+	case ed25519.PrivateKey:
+		return ed25519.Sign(private, input), nil
+	}
+	return nil, ErrUnknownKey
+}
+
+// Verify Проверяет подпись открытым ключом.
+func (k *Key) Verify(input, signature []byte) error {
+	switch public := k.private.Public().(type) {
+	case *rsa.PublicKey:
+		sum := sha256.Sum256(input)
+		if rsa.VerifyPKCS1v15(public, crypto.SHA256, sum[:], signature) != nil {
+			return ErrSignature
+		}
+		return nil
+	case *ecdsa.PublicKey:
+		if len(signature) != 64 {
+			return ErrSignature
+		}
+		sum := sha256.Sum256(input)
+		r := new(big.Int).SetBytes(signature[:32])
+		s := new(big.Int).SetBytes(signature[32:])
+		if !ecdsa.Verify(public, sum[:], r, s) {
+			return ErrSignature
+		}
+		return nil
+	case ed25519.PublicKey:
+		if !ed25519.Verify(public, input, signature) {
+			return ErrSignature
+		}
+		return nil
+	}
+	return ErrUnknownKey
+}
+
+// JWK Открытая часть ключа в формате RFC 7517.
+func (k *Key) JWK() JWK {
+	jwk := JWK{Kid: k.kid, Alg: k.alg, Use: "sig"}
+	switch public := k.private.Public().(type) {
+	case *rsa.PublicKey:
+		jwk.Kty = "RSA"
+		jwk.N = enc.EncodeToString(public.N.Bytes())
+		jwk.E = enc.EncodeToString(big.NewInt(int64(public.E)).Bytes())
+	case *ecdsa.PublicKey:
+		jwk.Kty = "EC"
+		jwk.Crv = "P-256"
+		x := make([]byte, 32)
+		y := make([]byte, 32)
+		public.X.FillBytes(x)
+		public.Y.FillBytes(y)
+		jwk.X = enc.EncodeToString(x)
+		jwk.Y = enc.EncodeToString(y)
+	case ed25519.PublicKey:
+		jwk.Kty = "OKP"
+		jwk.Crv = "Ed25519"
+		jwk.X = enc.EncodeToString(public)
+	}
+	return jwk
+}
+
+// JWK Открытый ключ в формате RFC 7517.
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use,omitempty"`
+	Alg string `json:"alg,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+// JWKSet Набор открытых ключей, публикуемый по адресу /.well-known/jwks.json.
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// StaticKeySet Неизменяемый набор ключей, подписывает первым из них.
+type StaticKeySet []*Key
+
+// Signer Ключ для подписи.
+func (s StaticKeySet) Signer() (Signer, error) {
+	if len(s) == 0 {
+		return nil, ErrUnknownKey
+	}
+	return s[0], nil
+}
+
+// Verifier Ключ для проверки по алгоритму и kid.
+func (s StaticKeySet) Verifier(_ context.Context, alg, kid string) (Verifier, error) {
+	for _, k := range s {
+		if k.kid == kid && k.alg == alg {
+			return k, nil
+		}
+	}
+	return nil, ErrUnknownKey
+}
+
+// JWKS Открытые ключи набора.
+func (s StaticKeySet) JWKS() JWKSet {
+	set := JWKSet{Keys: []JWK{}}
+	for _, k := range s {
+		set.Keys = append(set.Keys, k.JWK())
+	}
+	return set
+}
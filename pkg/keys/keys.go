@@ -0,0 +1,252 @@
+// Package keys Управление ключами подписи токенов: хранение в базе, ротация и публикация JWKS.
+package keys
+
+import (
+	"authorization/pkg/jwt"
+	"authorization/pkg/storage"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	reloadInterval = time.Minute // Как часто можно перечитывать ключи из базы, встретив неизвестный kid
+
+	// RefreshInterval Как часто копии сервиса перечитывают ключи из базы в Run.
+	RefreshInterval = 10 * time.Minute
+	// JWKSMaxAge Сколько клиенты могут кешировать JWKS.
+	JWKSMaxAge = 5 * time.Minute
+	// publishAhead За сколько до начала подписи новый ключ появляется в JWKS: за это время
+	// его загружают все копии сервиса и видят клиенты, закешировавшие JWKS до его создания.
+	publishAhead = RefreshInterval + JWKSMaxAge
+)
+
+// Manager Набор ключей подписи, общий для всех копий сервиса через базу данных.
+// Новый ключ создаётся раз в rotation и публикуется в JWKS за publishAhead до того, как начнёт подписывать;
+// прежний ещё grace публикуется после смены, чтобы выпущенные им токены продолжали проверяться.
+type Manager struct {
+	db       storage.KeyStore
+	alg      string
+	rotation time.Duration
+	grace    time.Duration
+	tokenTTL time.Duration
+
+	refreshMu sync.Mutex // Обновления ключей выполняются по одному, иначе параллельные ротации создали бы лишние ключи
+
+	mu       sync.RWMutex
+	signer   *jwt.Key
+	keys     []*jwt.Key // Действующие ключи, новые первыми
+	loadedAt time.Time
+}
+
+// New Конструктор, загружает ключи из базы и при необходимости создаёт первый ключ.
+// tokenTTL — время жизни подписанных токенов: льготный период не может быть короче,
+// иначе ключ удалялся бы, пока выпущенные им токены ещё действуют.
+func New(ctx context.Context, db storage.KeyStore, alg string, rotation, grace, tokenTTL time.Duration) (*Manager, error) {
+	switch alg {
+	case jwt.RS256, jwt.ES256, jwt.EdDSA:
+	default:
+		return nil, fmt.Errorf("неподдерживаемый алгоритм подписи %q, допустимы RS256 , ES256 или EdDSA", alg)
+	}
+	if rotation <= publishAhead {
+		return nil, fmt.Errorf("период ротации ключей должен быть больше %v", publishAhead)
+	}
+	if grace < tokenTTL {
+		return nil, fmt.Errorf("льготный период ключей должен быть не короче времени жизни токенов %v", tokenTTL)
+	}
+
+	m := &Manager{
+		db:       db,
+		alg:      alg,
+		rotation: rotation,
+		grace:    grace,
+		tokenTTL: tokenTTL,
+	}
+	if err := m.Refresh(ctx); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Run Перечитывает ключи раз в RefreshInterval и ротирует их по расписанию, пока не отменён ctx.
+func (m *Manager) Run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(RefreshInterval):
+		}
+		if err := m.Refresh(ctx); err != nil {
+			log.Printf("Не удалось обновить ключи подписи %v", err)
+		}
+	}
+}
+
+// Refresh Удаляет истекшие ключи, заранее создаёт новый, если текущий скоро пора сменить,
+// и загружает действующие ключи из базы.
+func (m *Manager) Refresh(ctx context.Context) error {
+	m.refreshMu.Lock()
+	defer m.refreshMu.Unlock()
+	return m.refresh(ctx)
+}
+
+// refresh Обновляет ключи, вызывающий держит refreshMu.
+func (m *Manager) refresh(ctx context.Context) error {
+	stored, err := m.db.ListSigningKeys(ctx)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	var live []storage.SigningKey
+	for _, k := range stored {
+		if now.After(k.ExpiresAt) {
+			if _, err = m.db.DelSigningKey(ctx, k.ID); err != nil {
+				return err
+			}
+			log.Printf("Ключ подписи %s удалён по истечении льготного периода", k.ID)
+			continue
+		}
+		live = append(live, k)
+	}
+
+	// Новые ключи первыми; при одновременной ротации на нескольких копиях
+	// все выберут один и тот же ключ по времени создания и kid
+	sort.Slice(live, func(i, j int) bool {
+		if !live[i].CreatedAt.Equal(live[j].CreatedAt) {
+			return live[i].CreatedAt.After(live[j].CreatedAt)
+		}
+		return live[i].ID > live[j].ID
+	})
+
+	if len(live) == 0 || !now.Before(live[0].RetireAt.Add(-publishAhead)) || live[0].Alg != m.alg {
+		k, err := m.generate(ctx, now)
+		if err != nil {
+			return err
+		}
+		live = append([]storage.SigningKey{*k}, live...)
+	}
+
+	// Подписывает самый новый ключ, опубликованный не меньше publishAhead назад, если выпущенные
+	// им токены успеют истечь до его удаления. Если такого нет, например при первом запуске, — самый новый
+	signerID := live[0].ID
+	for _, k := range live {
+		if !now.Before(k.CreatedAt.Add(publishAhead)) && now.Add(m.tokenTTL).Before(k.ExpiresAt) {
+			signerID = k.ID
+			break
+		}
+	}
+
+	var signer *jwt.Key
+	var keys []*jwt.Key
+	for _, k := range live {
+		key, err := jwt.ParseKey(k.Alg, k.ID, k.PrivateKey)
+		if err != nil {
+			log.Printf("Ключ подписи %s не загружен: %v", k.ID, err)
+			continue
+		}
+		if k.ID == signerID {
+			signer = key
+		}
+		keys = append(keys, key)
+	}
+	if signer == nil {
+		return fmt.Errorf("не удалось загрузить текущий ключ подписи %s", signerID)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.signer = signer
+	m.keys = keys
+	m.loadedAt = now
+
+	return nil
+}
+
+// generate Создает и сохраняет в базе новый ключ подписи.
+func (m *Manager) generate(ctx context.Context, now time.Time) (*storage.SigningKey, error) {
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return nil, err
+	}
+	kid := now.Format("20060102") + "-" + hex.EncodeToString(suffix)
+
+	key, err := jwt.GenerateKey(m.alg, kid)
+	if err != nil {
+		return nil, err
+	}
+	private, err := key.MarshalPEM()
+	if err != nil {
+		return nil, err
+	}
+
+	k := storage.SigningKey{
+		ID:         kid,
+		Alg:        m.alg,
+		PrivateKey: private,
+		CreatedAt:  now,
+		RetireAt:   now.Add(publishAhead + m.rotation),
+		ExpiresAt:  now.Add(publishAhead + m.rotation + m.grace),
+	}
+	if err = m.db.AddSigningKey(ctx, k); err != nil {
+		return nil, err
+	}
+	log.Printf("Создан ключ подписи %s (%s)", kid, m.alg)
+
+	return &k, nil
+}
+
+// Signer Текущий ключ для подписи.
+func (m *Manager) Signer() (jwt.Signer, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if m.signer == nil {
+		return nil, jwt.ErrUnknownKey
+	}
+	return m.signer, nil
+}
+
+// Verifier Ключ для проверки по алгоритму и kid.
+// Неизвестный kid мог появиться на другой копии сервиса, поэтому ключи перечитываются из базы
+// в рамках ctx запроса. Одновременные запросы с неизвестным kid перечитывают ключи один раз.
+func (m *Manager) Verifier(ctx context.Context, alg, kid string) (jwt.Verifier, error) {
+	if v, err := m.find(ctx, alg, kid); err == nil {
+		return v, nil
+	}
+
+	m.refreshMu.Lock()
+	defer m.refreshMu.Unlock()
+	// Пока запрос ждал, ключи могли перечитать
+	if v, err := m.find(ctx, alg, kid); err == nil {
+		return v, nil
+	}
+	m.mu.RLock()
+	stale := time.Since(m.loadedAt) > reloadInterval
+	m.mu.RUnlock()
+	if !stale {
+		return nil, jwt.ErrUnknownKey
+	}
+	if err := m.refresh(ctx); err != nil {
+		log.Printf("Не удалось обновить ключи подписи %v", err)
+	}
+	return m.find(ctx, alg, kid)
+}
+
+// find Ищет среди загруженных ключей.
+func (m *Manager) find(ctx context.Context, alg, kid string) (jwt.Verifier, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return jwt.StaticKeySet(m.keys).Verifier(ctx, alg, kid)
+}
+
+// JWKS Открытые части действующих ключей.
+func (m *Manager) JWKS() jwt.JWKSet {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return jwt.StaticKeySet(m.keys).JWKS()
+}
@@ -0,0 +1,198 @@
+package keys
+
+import (
+	"authorization/pkg/jwt"
+	"authorization/pkg/storage"
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memStore Хранилище ключей в памяти для тестов.
+type memStore struct {
+	mu    sync.Mutex
+	keys  map[string]storage.SigningKey
+	delay time.Duration // Задержка ответа, имитирующая запрос к базе
+}
+
+func newMemStore() *memStore {
+	return &memStore{keys: map[string]storage.SigningKey{}}
+}
+
+func (s *memStore) AddSigningKey(_ context.Context, k storage.SigningKey) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys[k.ID] = k
+	return nil
+}
+
+func (s *memStore) ListSigningKeys(context.Context) ([]storage.SigningKey, error) {
+	s.mu.Lock()
+	var keys []storage.SigningKey
+	for _, k := range s.keys {
+		keys = append(keys, k)
+	}
+	s.mu.Unlock()
+	time.Sleep(s.delay)
+	return keys, nil
+}
+
+func (s *memStore) DelSigningKey(_ context.Context, id string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.keys[id]
+	delete(s.keys, id)
+	return ok, nil
+}
+
+// shift Сдвигает сроки всех ключей в прошлое, имитируя течение времени.
+func (s *memStore) shift(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id, k := range s.keys {
+		k.CreatedAt = k.CreatedAt.Add(-d)
+		k.RetireAt = k.RetireAt.Add(-d)
+		k.ExpiresAt = k.ExpiresAt.Add(-d)
+		s.keys[id] = k
+	}
+}
+
+func TestManager_Rotation(t *testing.T) {
+	ctx := context.Background()
+	db := newMemStore()
+	m, err := New(ctx, db, jwt.ES256, time.Hour, 30*time.Minute, 15*time.Minute)
+	if err != nil {
+		t.Fatalf("ошибка создания менеджера: %v", err)
+	}
+	first, _ := m.Signer()
+	token, err := jwt.Sign(first, jwt.Claims{Subject: "ups@mail.ru"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Вторая копия сервиса использует тот же ключ из базы
+	replica, err := New(ctx, db, jwt.ES256, time.Hour, 30*time.Minute, 15*time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s, _ := replica.Signer(); s.KeyID() != first.KeyID() {
+		t.Errorf("копии подписывают разными ключами: %s и %s", s.KeyID(), first.KeyID())
+	}
+
+	// Ключ скоро пора сменить: новый создаётся и публикуется, но ещё не подписывает
+	db.shift(time.Hour + time.Minute)
+	if err = m.Refresh(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if s, _ := m.Signer(); s.KeyID() != first.KeyID() {
+		t.Errorf("новый ключ %s подписывает до публикации", s.KeyID())
+	}
+	if n := len(m.JWKS().Keys); n != 2 {
+		t.Errorf("в JWKS %d ключей, ожидается 2", n)
+	}
+
+	// Кеш JWKS у клиентов обновился: подписывает новый ключ, старый ещё проверяет токены
+	db.shift(publishAhead)
+	if err = m.Refresh(ctx); err != nil {
+		t.Fatal(err)
+	}
+	second, _ := m.Signer()
+	if second.KeyID() == first.KeyID() {
+		t.Fatal("ключ не сменился по расписанию")
+	}
+	if err = jwt.Parse(ctx, token, m, &jwt.Claims{}); err != nil {
+		t.Errorf("токен старого ключа не проверяется в льготный период: %v", err)
+	}
+	if err = replica.Refresh(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if s, _ := replica.Signer(); s.KeyID() != second.KeyID() {
+		t.Errorf("копии подписывают разными ключами: %s и %s", s.KeyID(), second.KeyID())
+	}
+
+	// Льготный период прошёл: старый ключ удаляется
+	db.shift(31 * time.Minute)
+	if err = m.Refresh(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err = jwt.Parse(ctx, token, m, &jwt.Claims{}); err != jwt.ErrUnknownKey {
+		t.Errorf("ожидается ErrUnknownKey, получено %v", err)
+	}
+	if _, ok := db.keys[first.KeyID()]; ok {
+		t.Error("истекший ключ не удалён из базы")
+	}
+}
+
+func TestManager_AlgChange(t *testing.T) {
+	ctx := context.Background()
+	db := newMemStore()
+	if _, err := New(ctx, db, jwt.ES256, time.Hour, time.Hour, 15*time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	db.shift(publishAhead)
+
+	// Смена алгоритма в настройках сразу создаёт новый ключ, подписывать он начинает после публикации
+	m, err := New(ctx, db, jwt.EdDSA, time.Hour, time.Hour, 15*time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s, _ := m.Signer(); s.Alg() != jwt.ES256 || len(m.JWKS().Keys) != 2 {
+		t.Errorf("ключ %s подписывает до публикации, в JWKS %d ключей", s.Alg(), len(m.JWKS().Keys))
+	}
+	db.shift(publishAhead)
+	if err = m.Refresh(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if s, _ := m.Signer(); s.Alg() != jwt.EdDSA {
+		t.Errorf("подпись алгоритмом %s, ожидается %s", s.Alg(), jwt.EdDSA)
+	}
+
+	if _, err = New(ctx, db, "HS256", time.Hour, time.Hour, 15*time.Minute); err == nil {
+		t.Error("принят неподдерживаемый алгоритм")
+	}
+}
+
+func TestManager_ConcurrentRefresh(t *testing.T) {
+	ctx := context.Background()
+	db := newMemStore()
+	m, err := New(ctx, db, jwt.ES256, time.Hour, 30*time.Minute, 15*time.Minute)
+	if err != nil {
+		t.Fatalf("ошибка создания менеджера: %v", err)
+	}
+
+	// Ключ пора сменить: одновременные обновления создают один новый ключ
+	db.shift(time.Hour + time.Minute)
+	db.delay = 10 * time.Millisecond
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := m.Refresh(ctx); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if n := len(db.keys); n != 2 {
+		t.Errorf("в базе %d ключей, ожидается 2", n)
+	}
+}
+
+func TestNew_Periods(t *testing.T) {
+	ctx := context.Background()
+	db := newMemStore()
+
+	// Ключ не удаляется, пока выпущенные им токены действуют
+	if _, err := New(ctx, db, jwt.ES256, time.Hour, 10*time.Minute, 15*time.Minute); err == nil {
+		t.Error("принят льготный период короче времени жизни токенов")
+	}
+	// Ключ должен успеть опубликоваться до начала подписи
+	if _, err := New(ctx, db, jwt.ES256, publishAhead, time.Hour, 15*time.Minute); err == nil {
+		t.Error("принят период ротации не длиннее времени публикации")
+	}
+	if _, err := New(ctx, db, jwt.ES256, time.Hour, 15*time.Minute, 15*time.Minute); err != nil {
+		t.Errorf("отклонены допустимые периоды: %v", err)
+	}
+}
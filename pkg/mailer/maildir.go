@@ -0,0 +1,57 @@
+package mailer
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Maildir Складывает письма в каталог в формате maildir вместо отправки.
+// Используется при разработке и в тестах: письма можно открыть любым почтовым клиентом.
+type Maildir struct {
+	Dir string
+}
+
+// NewMaildir Конструктор, создаёт подкаталоги tmp, new и cur.
+func NewMaildir(dir string) (*Maildir, error) {
+	for _, sub := range []string{"tmp", "new", "cur"} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0o700); err != nil {
+			return nil, err
+		}
+	}
+	return &Maildir{Dir: dir}, nil
+}
+
+// Send Записывает письмо в tmp и переносит в new, чтобы читатель не увидел его недописанным.
+func (d *Maildir) Send(m Message) error {
+	data, err := m.Bytes()
+	if err != nil {
+		return err
+	}
+
+	b := make([]byte, 8)
+	if _, err = rand.Read(b); err != nil {
+		return err
+	}
+	host, err := os.Hostname()
+	if err != nil {
+		host = "localhost"
+	}
+	// Символы / и : в имени файла maildir запрещены
+	host = strings.NewReplacer("/", `\057`, ":", `\072`).Replace(host)
+	name := fmt.Sprintf("%d.%s.%s", time.Now().UnixNano(), hex.EncodeToString(b), host)
+
+	tmp := filepath.Join(d.Dir, "tmp", name)
+	if err = os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	if err = os.Rename(tmp, filepath.Join(d.Dir, "new", name)); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,171 @@
+// Package mailer Исходящая почта: шаблоны писем, очередь в базе данных с повторными попытками
+// и транспорты SMTP и maildir.
+package mailer
+
+import (
+	"authorization/pkg/storage"
+	"context"
+	"fmt"
+	"github.com/gofrs/uuid"
+	"log"
+	"time"
+)
+
+const (
+	batchSize   = 20               // Сколько писем забирается из очереди за раз
+	lease       = 5 * time.Minute  // Через сколько забранное письмо снова доступно, если копия сервиса упала
+	maxAttempts = 8                // После стольких неудачных попыток письмо удаляется из очереди
+	baseBackoff = time.Minute      // Пауза после первой неудачной попытки, дальше удваивается
+	maxBackoff  = 6 * time.Hour    // Самая долгая пауза между попытками
+	sendTimeout = 30 * time.Second // Время на отправку одного письма
+)
+
+// Message Готовое к отправке письмо.
+type Message struct {
+	From    string
+	To      string
+	Subject string
+	Text    string // Текстовая часть
+	HTML    string // Часть HTML, может быть пустой
+}
+
+// Transport Способ доставки письма: SMTP, каталог maildir и т.п.
+type Transport interface {
+	Send(m Message) error
+}
+
+// Mailer Отрисовывает письма по шаблонам и ставит их в очередь в базе данных,
+// откуда их доставляет Run. Письмо не теряется, если транспорт временно недоступен
+// или сервис перезапустился.
+type Mailer struct {
+	db        storage.OutboxStore
+	transport Transport
+	from      string
+	templates *Templates
+	wake      chan struct{}
+}
+
+// New Конструктор, загружает шаблоны писем из каталога dir.
+func New(db storage.OutboxStore, transport Transport, from, dir string) (*Mailer, error) {
+	if from == "" {
+		return nil, fmt.Errorf("не задан адрес отправителя писем")
+	}
+	templates, err := LoadTemplates(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Mailer{
+		db:        db,
+		transport: transport,
+		from:      from,
+		templates: templates,
+		wake:      make(chan struct{}, 1),
+	}, nil
+}
+
+// Send Отрисовывает письмо по шаблону name и ставит его в очередь.
+func (m *Mailer) Send(ctx context.Context, to, name string, data map[string]string) error {
+	subject, text, html, err := m.templates.Render(name, data)
+	if err != nil {
+		return err
+	}
+	id, err := uuid.NewV4()
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	err = m.db.AddOutboxMessage(ctx, storage.OutboxMessage{
+		ID:          id.String(),
+		To:          to,
+		Subject:     subject,
+		Text:        text,
+		HTML:        html,
+		NextAttempt: now,
+		CreatedAt:   now,
+	})
+	if err != nil {
+		return err
+	}
+
+	// Будим Run, чтобы письмо ушло сразу, а не по расписанию
+	select {
+	case m.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Run Доставляет письма из очереди сразу после Send и не реже раза в interval.
+func (m *Mailer) Run(interval time.Duration) {
+	for {
+		select {
+		case <-m.wake:
+		case <-time.After(interval):
+		}
+		if _, err := m.Flush(context.Background()); err != nil {
+			log.Printf("Не удалось разобрать очередь писем %v", err)
+		}
+	}
+}
+
+// Flush Отправляет все письма, время которых наступило, и возвращает число доставленных.
+// Неудачная попытка откладывается с растущей паузой.
+func (m *Mailer) Flush(ctx context.Context) (int, error) {
+	sent := 0
+	for {
+		batch, err := m.db.ClaimOutboxMessages(ctx, time.Now().UTC(), lease, batchSize)
+		if err != nil {
+			return sent, err
+		}
+		for _, msg := range batch {
+			ok, err := m.deliver(ctx, msg)
+			if err != nil {
+				return sent, err
+			}
+			if ok {
+				sent++
+			}
+		}
+		if len(batch) < batchSize {
+			return sent, nil
+		}
+	}
+}
+
+// deliver Отправляет одно письмо из очереди. Ошибка возвращается только при сбое базы данных.
+func (m *Mailer) deliver(ctx context.Context, msg storage.OutboxMessage) (bool, error) {
+	err := m.transport.Send(Message{
+		From:    m.from,
+		To:      msg.To,
+		Subject: msg.Subject,
+		Text:    msg.Text,
+		HTML:    msg.HTML,
+	})
+	if err == nil {
+		_, err = m.db.DelOutboxMessage(ctx, msg.ID)
+		return true, err
+	}
+
+	attempts := msg.Attempts + 1
+	if attempts >= maxAttempts {
+		log.Printf("Письмо %s для %s не доставлено после %d попыток и удалено из очереди: %v", msg.ID, msg.To, attempts, err)
+		_, err = m.db.DelOutboxMessage(ctx, msg.ID)
+		return false, err
+	}
+	log.Printf("Не удалось отправить письмо %s для %s, попытка %d: %v", msg.ID, msg.To, attempts, err)
+	return false, m.db.RetryOutboxMessage(ctx, msg.ID, attempts, time.Now().UTC().Add(backoff(attempts)), err.Error())
+}
+
+// backoff Пауза перед следующей попыткой после attempts неудачных.
+func backoff(attempts int) time.Duration {
+	d := baseBackoff
+	for i := 1; i < attempts && d < maxBackoff; i++ {
+		d *= 2
+	}
+	if d > maxBackoff {
+		d = maxBackoff
+	}
+	return d
+}
@@ -0,0 +1,389 @@
+package mailer
+
+import (
+	"authorization/pkg/storage"
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/mail"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const templatesDir = "../../web/templates/mail"
+
+// memOutbox Очередь писем в памяти для тестов.
+type memOutbox struct {
+	mu   sync.Mutex
+	msgs map[string]storage.OutboxMessage
+}
+
+func newMemOutbox() *memOutbox {
+	return &memOutbox{msgs: map[string]storage.OutboxMessage{}}
+}
+
+func (s *memOutbox) AddOutboxMessage(_ context.Context, m storage.OutboxMessage) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.msgs[m.ID] = m
+	return nil
+}
+
+func (s *memOutbox) ClaimOutboxMessages(_ context.Context, now time.Time, lease time.Duration, limit int) ([]storage.OutboxMessage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var list []storage.OutboxMessage
+	for id, m := range s.msgs {
+		if len(list) == limit {
+			break
+		}
+		if m.NextAttempt.After(now) {
+			continue
+		}
+		m.NextAttempt = now.Add(lease)
+		s.msgs[id] = m
+		list = append(list, m)
+	}
+	return list, nil
+}
+
+func (s *memOutbox) RetryOutboxMessage(_ context.Context, id string, attempts int, next time.Time, lastError string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if m, ok := s.msgs[id]; ok {
+		m.Attempts, m.NextAttempt, m.LastError = attempts, next, lastError
+		s.msgs[id] = m
+	}
+	return nil
+}
+
+func (s *memOutbox) DelOutboxMessage(_ context.Context, id string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.msgs[id]
+	delete(s.msgs, id)
+	return ok, nil
+}
+
+// list Письма в очереди.
+func (s *memOutbox) list() []storage.OutboxMessage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var list []storage.OutboxMessage
+	for _, m := range s.msgs {
+		list = append(list, m)
+	}
+	return list
+}
+
+// expire Делает все письма в очереди готовыми к отправке, имитируя течение времени.
+func (s *memOutbox) expire() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id, m := range s.msgs {
+		m.NextAttempt = time.Time{}
+		s.msgs[id] = m
+	}
+}
+
+// failingTransport Транспорт, который не может отправить письмо.
+type failingTransport struct{ calls int }
+
+func (f *failingTransport) Send(Message) error {
+	f.calls++
+	return errors.New("сервер недоступен")
+}
+
+// readParts Разбирает письмо и возвращает тему и части по типу содержимого.
+func readParts(t *testing.T, r io.Reader) (string, map[string]string) {
+	msg, err := mail.ReadMessage(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	subject, err := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/alternative" {
+		t.Fatalf("Content-Type = %q, %v", msg.Header.Get("Content-Type"), err)
+	}
+
+	parts := map[string]string{}
+	mr := multipart.NewReader(msg.Body, params["boundary"])
+	for {
+		p, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		// NextPart сам раскодирует quoted-printable
+		body, err := io.ReadAll(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		contentType, _, _ := mime.ParseMediaType(p.Header.Get("Content-Type"))
+		parts[contentType] = string(body)
+	}
+	return subject, parts
+}
+
+func TestTemplates_Render(t *testing.T) {
+	templates, err := LoadTemplates(templatesDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	link := "http://localhost:5000/verify-email?token=a&b=<c>"
+	subject, text, html, err := templates.Render("verify_email", map[string]string{"Link": link})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if subject == "" || strings.Contains(subject, "\n") {
+		t.Errorf("тема письма = %q", subject)
+	}
+	if !strings.Contains(text, link) {
+		t.Errorf("в текстовой части нет ссылки: %s", text)
+	}
+	// В HTML ссылка экранируется
+	if strings.Contains(html, link) || !strings.Contains(html, "&amp;b=%3cc%3e") {
+		t.Errorf("ссылка в HTML не экранирована: %s", html)
+	}
+
+	if _, _, _, err = templates.Render("unknown", nil); err == nil {
+		t.Error("неизвестный шаблон отрисован")
+	}
+	if _, _, _, err = templates.Render("password_reset", map[string]string{}); err == nil {
+		t.Error("шаблон отрисован без ссылки")
+	}
+}
+
+func TestMailer_Maildir(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	transport, err := NewMaildir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := newMemOutbox()
+	m, err := New(db, transport, "Authorization <noreply@example.com>", templatesDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	link := "http://localhost:5000/password/reset?token=abc"
+	if err = m.Send(ctx, "user@example.com", "password_reset", map[string]string{"Link": link}); err != nil {
+		t.Fatal(err)
+	}
+	if len(db.list()) != 1 {
+		t.Fatal("письмо не поставлено в очередь")
+	}
+	sent, err := m.Flush(ctx)
+	if err != nil || sent != 1 {
+		t.Fatalf("Flush() = %d, %v", sent, err)
+	}
+	if len(db.list()) != 0 {
+		t.Error("доставленное письмо осталось в очереди")
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "new", "*"))
+	if err != nil || len(files) != 1 {
+		t.Fatalf("в maildir %d писем, %v", len(files), err)
+	}
+	f, err := os.Open(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	subject, parts := readParts(t, f)
+	if subject != "Сброс пароля" {
+		t.Errorf("тема письма = %q", subject)
+	}
+	if !strings.Contains(parts["text/plain"], link) || !strings.Contains(parts["text/html"], link) {
+		t.Errorf("в частях письма нет ссылки: %v", parts)
+	}
+}
+
+func TestMailer_Retry(t *testing.T) {
+	ctx := context.Background()
+	db := newMemOutbox()
+	transport := &failingTransport{}
+	m, err := New(db, transport, "noreply@example.com", templatesDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = m.Send(ctx, "user@example.com", "verify_email", map[string]string{"Link": "http://localhost/"}); err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	if sent, err := m.Flush(ctx); err != nil || sent != 0 {
+		t.Fatalf("Flush() = %d, %v", sent, err)
+	}
+	list := db.list()
+	if len(list) != 1 || list[0].Attempts != 1 || list[0].LastError == "" {
+		t.Fatalf("неудачная попытка не сохранена: %+v", list)
+	}
+	if list[0].NextAttempt.Before(start.Add(baseBackoff)) {
+		t.Errorf("следующая попытка %v, ожидалась не раньше чем через %v", list[0].NextAttempt, baseBackoff)
+	}
+
+	// До наступления времени следующей попытки письмо не отправляется
+	m.Flush(ctx)
+	if transport.calls != 1 {
+		t.Errorf("письмо отправлялось %d раз до наступления времени попытки", transport.calls)
+	}
+
+	for i := 1; i < maxAttempts; i++ {
+		db.expire()
+		if _, err = m.Flush(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if transport.calls != maxAttempts {
+		t.Errorf("попыток отправки %d, ожидалось %d", transport.calls, maxAttempts)
+	}
+	if len(db.list()) != 0 {
+		t.Error("письмо осталось в очереди после последней попытки")
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	if backoff(1) != baseBackoff || backoff(2) != 2*baseBackoff {
+		t.Errorf("backoff(1) = %v, backoff(2) = %v", backoff(1), backoff(2))
+	}
+	if backoff(100) != maxBackoff {
+		t.Errorf("backoff(100) = %v, ожидалось %v", backoff(100), maxBackoff)
+	}
+}
+
+// smtpServer Простейший сервер SMTP без STARTTLS.
+type smtpServer struct {
+	addr string
+	auth string // Строка AUTH от клиента
+	from string
+	to   string
+	data chan string
+}
+
+func newSMTPServer(t *testing.T) *smtpServer {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+
+	s := &smtpServer{addr: l.Addr().String(), data: make(chan string, 1)}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+// serve Обслуживает одно соединение.
+func (s *smtpServer) serve(conn net.Conn) {
+	defer conn.Close()
+	tp := textproto.NewConn(conn)
+	tp.PrintfLine("220 localhost ESMTP")
+	for {
+		line, err := tp.ReadLine()
+		if err != nil {
+			return
+		}
+		cmd := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+		switch cmd {
+		case "EHLO":
+			tp.PrintfLine("250-localhost")
+			tp.PrintfLine("250 AUTH PLAIN")
+		case "AUTH":
+			s.auth = line
+			tp.PrintfLine("235 2.7.0 Authentication successful")
+		case "MAIL":
+			s.from = line
+			tp.PrintfLine("250 OK")
+		case "RCPT":
+			s.to = line
+			tp.PrintfLine("250 OK")
+		case "DATA":
+			tp.PrintfLine("354 End data with <CR><LF>.<CR><LF>")
+			body, err := io.ReadAll(tp.DotReader())
+			if err != nil {
+				return
+			}
+			s.data <- string(body)
+			tp.PrintfLine("250 OK")
+		case "QUIT":
+			tp.PrintfLine("221 Bye")
+			return
+		default:
+			tp.PrintfLine("502 Command not implemented")
+		}
+	}
+}
+
+func TestSMTP_Send(t *testing.T) {
+	server := newSMTPServer(t)
+	transport := &SMTP{Addr: server.addr, Username: "mailer", Password: "secret"}
+
+	err := transport.Send(Message{
+		From:    "Authorization <noreply@example.com>",
+		To:      "user@example.com",
+		Subject: "Проверка",
+		Text:    "Текст письма",
+		HTML:    "<p>Текст письма</p>",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var data string
+	select {
+	case data = <-server.data:
+	case <-time.After(5 * time.Second):
+		t.Fatal("сервер не получил письмо")
+	}
+	if !strings.HasPrefix(server.auth, "AUTH PLAIN ") {
+		t.Errorf("AUTH = %q", server.auth)
+	}
+	if server.from != "MAIL FROM:<noreply@example.com>" || !strings.HasPrefix(server.to, "RCPT TO:<user@example.com>") {
+		t.Errorf("конверт письма %q, %q", server.from, server.to)
+	}
+	subject, parts := readParts(t, bufio.NewReader(strings.NewReader(data)))
+	if subject != "Проверка" || parts["text/plain"] != "Текст письма" || parts["text/html"] != "<p>Текст письма</p>" {
+		t.Errorf("письмо %q, %v", subject, parts)
+	}
+
+	// Без STARTTLS письмо не отправляется, если шифрование обязательно
+	transport.RequireTLS = true
+	if err = transport.Send(Message{From: "noreply@example.com", To: "user@example.com", Text: "x"}); err == nil {
+		t.Error("письмо отправлено без STARTTLS")
+	}
+}
+
+func TestMessage_HeaderInjection(t *testing.T) {
+	_, err := Message{From: "noreply@example.com", To: "user@example.com", Subject: "a\r\nBcc: evil@example.com"}.Bytes()
+	if err == nil {
+		t.Error("перевод строки в теме принят")
+	}
+	_, err = Message{From: "noreply@example.com", To: "user@example.com\r\nBcc: evil@example.com"}.Bytes()
+	if err == nil {
+		t.Error("перевод строки в адресе принят")
+	}
+}
@@ -0,0 +1,91 @@
+package mailer
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"time"
+)
+
+// SMTP Доставка писем через сервер SMTP. Если сервер поддерживает STARTTLS,
+// соединение шифруется до передачи пароля и письма.
+type SMTP struct {
+	Addr       string      // Адрес сервера host:port
+	Username   string      // Имя для входа, без него письмо отправляется без авторизации
+	Password   string      // Пароль для входа
+	RequireTLS bool        // Не отправлять письмо, если сервер не поддерживает STARTTLS
+	TLSConfig  *tls.Config // Настройки TLS, по умолчанию проверяется сертификат сервера
+}
+
+// Send Отправляет письмо через сервер SMTP.
+func (s *SMTP) Send(m Message) error {
+	data, err := m.Bytes()
+	if err != nil {
+		return err
+	}
+	from, err := mail.ParseAddress(m.From)
+	if err != nil {
+		return err
+	}
+	to, err := mail.ParseAddress(m.To)
+	if err != nil {
+		return err
+	}
+	host, _, err := net.SplitHostPort(s.Addr)
+	if err != nil {
+		return err
+	}
+
+	conn, err := net.DialTimeout("tcp", s.Addr, sendTimeout)
+	if err != nil {
+		return err
+	}
+	// Зависший сервер не должен останавливать разбор очереди
+	if err = conn.SetDeadline(time.Now().Add(sendTimeout)); err != nil {
+		conn.Close()
+		return err
+	}
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		config := &tls.Config{ServerName: host}
+		if s.TLSConfig != nil {
+			config = s.TLSConfig.Clone()
+		}
+		if err = c.StartTLS(config); err != nil {
+			return err
+		}
+	} else if s.RequireTLS {
+		return fmt.Errorf("сервер SMTP %s не поддерживает STARTTLS", s.Addr)
+	}
+
+	if s.Username != "" {
+		if err = c.Auth(smtp.PlainAuth("", s.Username, s.Password, host)); err != nil {
+			return err
+		}
+	}
+	if err = c.Mail(from.Address); err != nil {
+		return err
+	}
+	if err = c.Rcpt(to.Address); err != nil {
+		return err
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err = w.Write(data); err != nil {
+		return err
+	}
+	if err = w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
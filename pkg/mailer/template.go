@@ -0,0 +1,90 @@
+package mailer
+
+import (
+	"bytes"
+	"fmt"
+	htmltemplate "html/template"
+	"os"
+	"path/filepath"
+	"strings"
+	texttemplate "text/template"
+)
+
+// Templates Шаблоны писем. Письмо name описывают два файла в каталоге шаблонов:
+// name.txt — текстовая часть с блоком {{define "subject"}} для темы письма,
+// name.html — необязательная часть HTML.
+type Templates struct {
+	text map[string]*texttemplate.Template
+	html map[string]*htmltemplate.Template
+}
+
+// LoadTemplates Загружает шаблоны писем из каталога dir.
+func LoadTemplates(dir string) (*Templates, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.txt"))
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("в каталоге %s нет шаблонов писем", dir)
+	}
+
+	t := &Templates{
+		text: make(map[string]*texttemplate.Template),
+		html: make(map[string]*htmltemplate.Template),
+	}
+	for _, file := range files {
+		name := strings.TrimSuffix(filepath.Base(file), ".txt")
+
+		text, err := texttemplate.New(name).Option("missingkey=error").ParseFiles(file)
+		if err != nil {
+			return nil, err
+		}
+		if text.Lookup("subject") == nil {
+			return nil, fmt.Errorf("в шаблоне письма %s нет блока subject", file)
+		}
+		t.text[name] = text.Lookup(filepath.Base(file))
+
+		htmlFile := filepath.Join(dir, name+".html")
+		if _, err = os.Stat(htmlFile); err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, err
+		}
+		html, err := htmltemplate.New(name).Option("missingkey=error").ParseFiles(htmlFile)
+		if err != nil {
+			return nil, err
+		}
+		t.html[name] = html.Lookup(filepath.Base(htmlFile))
+	}
+	return t, nil
+}
+
+// Render Отрисовывает тему, текстовую часть и часть HTML письма name.
+func (t *Templates) Render(name string, data map[string]string) (subject, text, html string, err error) {
+	tmpl, ok := t.text[name]
+	if !ok {
+		return "", "", "", fmt.Errorf("неизвестный шаблон письма %q", name)
+	}
+
+	var buf bytes.Buffer
+	if err = tmpl.ExecuteTemplate(&buf, "subject", data); err != nil {
+		return "", "", "", err
+	}
+	subject = strings.TrimSpace(buf.String())
+
+	buf.Reset()
+	if err = tmpl.Execute(&buf, data); err != nil {
+		return "", "", "", err
+	}
+	text = strings.TrimSpace(buf.String()) + "\n"
+
+	if h, ok := t.html[name]; ok {
+		buf.Reset()
+		if err = h.Execute(&buf, data); err != nil {
+			return "", "", "", err
+		}
+		html = buf.String()
+	}
+	return subject, text, html, nil
+}
@@ -0,0 +1,70 @@
+package middl
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// sweepEvery Через сколько запросов удаляются наполнившиеся корзины.
+const sweepEvery = 10000
+
+// bucket Корзина токенов.
+type bucket struct {
+	tokens  float64
+	updated time.Time
+	rate    float64
+	burst   int
+}
+
+// refill Пополняет корзину на момент now.
+func (b *bucket) refill(now time.Time) {
+	if elapsed := now.Sub(b.updated).Seconds(); elapsed > 0 {
+		b.tokens = math.Min(float64(b.burst), b.tokens+elapsed*b.rate)
+		b.updated = now
+	}
+}
+
+// MemoryBuckets Корзины токенов в памяти процесса: у каждой копии сервиса свои ограничения.
+type MemoryBuckets struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	calls   int
+}
+
+// NewMemoryBuckets Конструктор.
+func NewMemoryBuckets() *MemoryBuckets {
+	return &MemoryBuckets{buckets: make(map[string]*bucket)}
+}
+
+// TakeToken Забирает токен из корзины key.
+func (m *MemoryBuckets) TakeToken(_ context.Context, key string, rate float64, burst int, now time.Time) (bool, float64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	b, ok := m.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(burst), updated: now}
+		m.buckets[key] = b
+	}
+	b.rate, b.burst = rate, burst
+	b.refill(now)
+
+	allowed := b.tokens >= 1
+	if allowed {
+		b.tokens--
+	}
+
+	// Полная корзина ничем не отличается от отсутствующей
+	m.calls++
+	if m.calls%sweepEvery == 0 {
+		for k, b := range m.buckets {
+			b.refill(now)
+			if b.tokens >= float64(b.burst) {
+				delete(m.buckets, k)
+			}
+		}
+	}
+	return allowed, b.tokens, nil
+}
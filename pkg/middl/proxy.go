@@ -0,0 +1,95 @@
+package middl
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// TrustedProxies Адреса обратных прокси, которым можно верить в заголовке X-Forwarded-For.
+type TrustedProxies []*net.IPNet
+
+// ParseTrustedProxies Разбирает список адресов и подсетей через запятую, например "10.0.0.0/8,127.0.0.1".
+func ParseTrustedProxies(s string) (TrustedProxies, error) {
+	var proxies TrustedProxies
+	for _, v := range strings.Split(s, ",") {
+		v = strings.TrimSpace(v)
+		if v == "" {
+			continue
+		}
+		if !strings.Contains(v, "/") {
+			ip := net.ParseIP(v)
+			if ip == nil {
+				return nil, fmt.Errorf("неверный адрес прокси %q", v)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			proxies = append(proxies, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, network, err := net.ParseCIDR(v)
+		if err != nil {
+			return nil, fmt.Errorf("неверная подсеть прокси %q: %v", v, err)
+		}
+		proxies = append(proxies, network)
+	}
+	return proxies, nil
+}
+
+// trusted Является ли адрес доверенным прокси.
+func (t TrustedProxies) trusted(addr string) bool {
+	ip := net.ParseIP(strings.TrimSpace(addr))
+	if ip == nil {
+		return false
+	}
+	for _, network := range t {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// ClientIP Адрес клиента. Заголовок X-Forwarded-For учитывается, только если запрос пришёл
+// от доверенного прокси: адреса в нём перебираются справа налево, пропуская доверенные прокси,
+// так как левую часть заголовка клиент может подделать.
+func (t TrustedProxies) ClientIP(r *http.Request) string {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ip = r.RemoteAddr
+	}
+	if !t.trusted(ip) {
+		return ip
+	}
+
+	var hops []string
+	for _, h := range r.Header.Values("X-Forwarded-For") {
+		hops = append(hops, strings.Split(h, ",")...)
+	}
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if net.ParseIP(hop) == nil {
+			// Испорченный заголовок: дальше верить ему нельзя
+			return ip
+		}
+		ip = hop
+		if !t.trusted(hop) {
+			break
+		}
+	}
+	return ip
+}
+
+// RealIP Подставляет в RemoteAddr адрес клиента из X-Forwarded-For доверенного прокси,
+// чтобы журнал, ограничения частоты и защита входа видели настоящий адрес.
+func (t TrustedProxies) RealIP(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if len(t) > 0 {
+			req.RemoteAddr = net.JoinHostPort(t.ClientIP(req), "0")
+		}
+		next.ServeHTTP(w, req)
+	})
+}
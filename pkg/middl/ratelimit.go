@@ -0,0 +1,145 @@
+package middl
+
+import (
+	"authorization/pkg/storage"
+	"encoding/json"
+	"fmt"
+	"github.com/gorilla/mux"
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultRoute Маршрут для политики, которая действует на все маршруты без своей.
+const DefaultRoute = "*"
+
+// Limit Политика корзины токенов: Rate запросов в секунду в среднем и до Burst подряд.
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+// ParseLimits Разбирает политики через запятую вида маршрут=число/период[:burst],
+// например "/registration=5/m,*=20/s:50". Период s, m или h; burst по умолчанию равен числу.
+// Маршрут задаётся шаблоном, как при регистрации обработчика: "/api/sessions/{id}".
+func ParseLimits(s string) (map[string]Limit, error) {
+	limits := make(map[string]Limit)
+	for _, v := range strings.Split(s, ",") {
+		v = strings.TrimSpace(v)
+		if v == "" {
+			continue
+		}
+		route, spec, ok := strings.Cut(v, "=")
+		if !ok {
+			return nil, fmt.Errorf("неверная политика %q, ожидается маршрут=число/период[:burst]", v)
+		}
+		spec, burstText, hasBurst := strings.Cut(spec, ":")
+		countText, period, ok := strings.Cut(spec, "/")
+		if !ok {
+			return nil, fmt.Errorf("неверная политика %q, ожидается маршрут=число/период[:burst]", v)
+		}
+
+		count, err := strconv.Atoi(countText)
+		if err != nil || count <= 0 {
+			return nil, fmt.Errorf("неверное число запросов в политике %q", v)
+		}
+		var seconds float64
+		switch period {
+		case "s":
+			seconds = 1
+		case "m":
+			seconds = 60
+		case "h":
+			seconds = 3600
+		default:
+			return nil, fmt.Errorf("неверный период в политике %q, допустимы s , m или h", v)
+		}
+		burst := count
+		if hasBurst {
+			burst, err = strconv.Atoi(burstText)
+			if err != nil || burst <= 0 {
+				return nil, fmt.Errorf("неверный burst в политике %q", v)
+			}
+		}
+
+		limits[strings.TrimSpace(route)] = Limit{Rate: float64(count) / seconds, Burst: burst}
+	}
+	return limits, nil
+}
+
+// RateLimiter Ограничивает частоту запросов с одного адреса к каждому маршруту.
+type RateLimiter struct {
+	store  storage.BucketStore
+	limits map[string]Limit
+	now    func() time.Time
+}
+
+// NewRateLimiter Конструктор. Корзины хранятся в store: в памяти процесса или в Redis,
+// чтобы все копии сервиса делили одни ограничения.
+func NewRateLimiter(store storage.BucketStore, limits map[string]Limit) *RateLimiter {
+	return &RateLimiter{
+		store:  store,
+		limits: limits,
+		now:    time.Now,
+	}
+}
+
+// limit Политика маршрута запроса и ключ корзины.
+func (l *RateLimiter) limit(r *http.Request) (Limit, string, bool) {
+	route := r.URL.Path
+	if current := mux.CurrentRoute(r); current != nil {
+		if tpl, err := current.GetPathTemplate(); err == nil {
+			route = tpl
+		}
+	}
+	if limit, ok := l.limits[route]; ok {
+		return limit, route, true
+	}
+	limit, ok := l.limits[DefaultRoute]
+	return limit, DefaultRoute, ok
+}
+
+// Middleware Пропускает запрос, если в корзине адреса клиента для маршрута есть токен,
+// иначе отвечает 429. Ответ содержит заголовки RateLimit-Limit , RateLimit-Remaining и RateLimit-Reset.
+func (l *RateLimiter) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		limit, route, ok := l.limit(req)
+		if !ok {
+			next.ServeHTTP(w, req)
+			return
+		}
+
+		ip, _, err := net.SplitHostPort(req.RemoteAddr)
+		if err != nil {
+			ip = req.RemoteAddr
+		}
+		allowed, tokens, err := l.store.TakeToken(req.Context(), route+"|"+ip, limit.Rate, limit.Burst, l.now())
+		if err != nil {
+			// Недоступное хранилище не должно останавливать сервис
+			log.Printf("Не удалось проверить ограничение частоты запросов %v", err)
+			next.ServeHTTP(w, req)
+			return
+		}
+
+		h := w.Header()
+		h.Set("RateLimit-Limit", strconv.Itoa(limit.Burst))
+		h.Set("RateLimit-Remaining", strconv.Itoa(int(tokens)))
+		h.Set("RateLimit-Reset", strconv.Itoa(int(math.Ceil((float64(limit.Burst)-tokens)/limit.Rate))))
+		if !allowed {
+			h.Set("Retry-After", strconv.Itoa(int(math.Ceil((1-tokens)/limit.Rate))))
+			resp := storage.Response{
+				Success: false,
+				Message: "Слишком много запросов, повторите позже",
+			}
+			h.Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusTooManyRequests)
+			json.NewEncoder(w).Encode(resp)
+			return
+		}
+		next.ServeHTTP(w, req)
+	})
+}
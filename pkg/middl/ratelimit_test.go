@@ -0,0 +1,183 @@
+package middl
+
+import (
+	"context"
+	"github.com/gorilla/mux"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestParseLimits(t *testing.T) {
+	limits, err := ParseLimits("/registration=5/m, *=20/s:50,/api/sessions/{id}=1/h")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]Limit{
+		"/registration":      {Rate: 5.0 / 60, Burst: 5},
+		"*":                  {Rate: 20, Burst: 50},
+		"/api/sessions/{id}": {Rate: 1.0 / 3600, Burst: 1},
+	}
+	if len(limits) != len(want) {
+		t.Fatalf("ParseLimits() = %v", limits)
+	}
+	for route, l := range want {
+		if limits[route] != l {
+			t.Errorf("политика %s = %v, want %v", route, limits[route], l)
+		}
+	}
+
+	for _, bad := range []string{"/login", "/login=5", "/login=0/m", "/login=5/d", "/login=5/m:x"} {
+		if _, err = ParseLimits(bad); err == nil {
+			t.Errorf("ParseLimits(%q) без ошибки", bad)
+		}
+	}
+}
+
+func TestMemoryBuckets(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemoryBuckets()
+	now := time.Now()
+
+	for i := 0; i < 3; i++ {
+		if ok, _, _ := m.TakeToken(ctx, "k", 1, 3, now); !ok {
+			t.Fatalf("запрос %d отклонён", i+1)
+		}
+	}
+	ok, tokens, _ := m.TakeToken(ctx, "k", 1, 3, now)
+	if ok || tokens != 0 {
+		t.Errorf("TakeToken() = %v, %v, корзина должна быть пуста", ok, tokens)
+	}
+	if ok, _, _ = m.TakeToken(ctx, "other", 1, 3, now); !ok {
+		t.Error("запрос с другим ключом отклонён")
+	}
+
+	// Через секунду появляется один токен
+	if ok, tokens, _ = m.TakeToken(ctx, "k", 1, 3, now.Add(time.Second)); !ok || tokens != 0 {
+		t.Errorf("TakeToken() = %v, %v после пополнения", ok, tokens)
+	}
+}
+
+// newLimitedRouter Маршрутизатор с двумя маршрутами и ограничением частоты.
+func newLimitedRouter(limits map[string]Limit) *mux.Router {
+	r := mux.NewRouter()
+	ok := func(w http.ResponseWriter, r *http.Request) {}
+	r.HandleFunc("/registration", ok)
+	r.HandleFunc("/api/sessions/{id}", ok)
+	r.HandleFunc("/other", ok)
+
+	l := NewRateLimiter(NewMemoryBuckets(), limits)
+	now := time.Now()
+	l.now = func() time.Time { return now }
+	r.Use(l.Middleware)
+	return r
+}
+
+func serve(r http.Handler, target, remoteAddr string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, target, nil)
+	req.RemoteAddr = remoteAddr
+	res := httptest.NewRecorder()
+	r.ServeHTTP(res, req)
+	return res
+}
+
+func TestRateLimiter_Middleware(t *testing.T) {
+	r := newLimitedRouter(map[string]Limit{
+		"/registration":      {Rate: 1.0 / 60, Burst: 2},
+		"/api/sessions/{id}": {Rate: 1, Burst: 1},
+	})
+
+	res := serve(r, "/registration", "192.0.2.1:1000")
+	if res.Code != http.StatusOK {
+		t.Fatalf("статус %v", res.Code)
+	}
+	if res.Header().Get("RateLimit-Limit") != "2" || res.Header().Get("RateLimit-Remaining") != "1" || res.Header().Get("RateLimit-Reset") != "60" {
+		t.Errorf("заголовки RateLimit-* = %v", res.Header())
+	}
+
+	serve(r, "/registration", "192.0.2.1:1001")
+	res = serve(r, "/registration", "192.0.2.1:1002")
+	if res.Code != http.StatusTooManyRequests || res.Header().Get("Retry-After") != "60" {
+		t.Errorf("статус %v, Retry-After %q, ожидался отказ", res.Code, res.Header().Get("Retry-After"))
+	}
+
+	// У другого адреса своя корзина
+	if res = serve(r, "/registration", "198.51.100.1:1000"); res.Code != http.StatusOK {
+		t.Errorf("запрос с другого адреса отклонён: %v", res.Code)
+	}
+
+	// Маршрут с параметром делит одну корзину на все значения параметра
+	serve(r, "/api/sessions/a", "192.0.2.1:1000")
+	if res = serve(r, "/api/sessions/b", "192.0.2.1:1000"); res.Code != http.StatusTooManyRequests {
+		t.Errorf("ограничение маршрута с параметром не сработало: %v", res.Code)
+	}
+
+	// Маршрут без политики не ограничивается
+	for i := 0; i < 5; i++ {
+		if res = serve(r, "/other", "192.0.2.1:1000"); res.Code != http.StatusOK || res.Header().Get("RateLimit-Limit") != "" {
+			t.Fatalf("маршрут без политики ограничен: %v %v", res.Code, res.Header())
+		}
+	}
+}
+
+func TestRateLimiter_DefaultRoute(t *testing.T) {
+	r := newLimitedRouter(map[string]Limit{
+		"/registration": {Rate: 1, Burst: 5},
+		DefaultRoute:    {Rate: 1, Burst: 1},
+	})
+
+	serve(r, "/other", "192.0.2.1:1000")
+	if res := serve(r, "/other", "192.0.2.1:1000"); res.Code != http.StatusTooManyRequests {
+		t.Errorf("политика по умолчанию не сработала: %v", res.Code)
+	}
+	if res := serve(r, "/registration", "192.0.2.1:1000"); res.Code != http.StatusOK {
+		t.Errorf("своя политика маршрута не применена: %v", res.Code)
+	}
+}
+
+func TestTrustedProxies_ClientIP(t *testing.T) {
+	proxies, err := ParseTrustedProxies("10.0.0.0/8, 127.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = ParseTrustedProxies("10.0.0.0/33"); err == nil {
+		t.Error("неверная подсеть принята")
+	}
+
+	tests := []struct {
+		remote, xff, want string
+	}{
+		// Без доверенного прокси заголовок игнорируется
+		{"192.0.2.1:1000", "198.51.100.1", "192.0.2.1"},
+		{"127.0.0.1:1000", "", "127.0.0.1"},
+		{"127.0.0.1:1000", "198.51.100.1", "198.51.100.1"},
+		// Подставленный клиентом адрес слева не учитывается
+		{"127.0.0.1:1000", "203.0.113.9, 198.51.100.1, 10.1.2.3", "198.51.100.1"},
+		{"10.0.0.1:1000", "10.0.0.2, 10.0.0.3", "10.0.0.2"},
+		{"127.0.0.1:1000", "bogus, 198.51.100.1", "198.51.100.1"},
+		{"127.0.0.1:1000", "198.51.100.1, bogus", "127.0.0.1"},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = tt.remote
+		if tt.xff != "" {
+			req.Header.Set("X-Forwarded-For", tt.xff)
+		}
+		if got := proxies.ClientIP(req); got != tt.want {
+			t.Errorf("ClientIP(%s, %q) = %s, want %s", tt.remote, tt.xff, got, tt.want)
+		}
+	}
+
+	var got string
+	h := proxies.RealIP(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.RemoteAddr
+	}))
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = "127.0.0.1:1000"
+	req.Header.Set("X-Forwarded-For", "198.51.100.1")
+	h.ServeHTTP(httptest.NewRecorder(), req)
+	if got != "198.51.100.1:0" {
+		t.Errorf("RemoteAddr = %s", got)
+	}
+}
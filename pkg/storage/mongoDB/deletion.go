@@ -0,0 +1,90 @@
+package mongoDB
+
+import (
+	Interface "authorization/pkg/storage"
+	"context"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"time"
+)
+
+const deletionsCollection = "account_deletions" // коллекция аккаунтов, ожидающих удаления
+
+// createDeletionIndexes Создает индекс коллекции аккаунтов, ожидающих удаления.
+func (m *Storage) createDeletionIndexes(ctx context.Context) error {
+	collection := m.db.Database(databaseName).Collection(deletionsCollection)
+
+	_, err := collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "purgeAt", Value: 1}},
+	})
+	return err
+}
+
+// ScheduleDeletion Отмечает аккаунт ожидающим удаления в базе MongoDB
+func (m *Storage) ScheduleDeletion(ctx context.Context, d Interface.AccountDeletion) error {
+	collection := m.db.Database(databaseName).Collection(deletionsCollection)
+
+	_, err := collection.ReplaceOne(ctx, bson.D{{Key: "_id", Value: d.Username}}, d,
+		options.Replace().SetUpsert(true))
+	if err != nil {
+		return wrap(err)
+	}
+	return nil
+}
+
+// SearchDeletion Находит отметку об удалении аккаунта в базе MongoDB
+func (m *Storage) SearchDeletion(ctx context.Context, username string) (*Interface.AccountDeletion, error) {
+	collection := m.db.Database(databaseName).Collection(deletionsCollection)
+
+	var result Interface.AccountDeletion
+	err := collection.FindOne(ctx, bson.D{{Key: "_id", Value: username}}).Decode(&result)
+	if err != nil {
+		return nil, wrap(err)
+	}
+	return &result, nil
+}
+
+// CancelDeletion Снимает отметку об удалении аккаунта в базе MongoDB
+func (m *Storage) CancelDeletion(ctx context.Context, username string) (bool, error) {
+	collection := m.db.Database(databaseName).Collection(deletionsCollection)
+
+	result, err := collection.DeleteOne(ctx, bson.D{{Key: "_id", Value: username}})
+	if err != nil {
+		return false, wrap(err)
+	}
+	return result.DeletedCount > 0, nil
+}
+
+// DueDeletions Находит аккаунты, срок восстановления которых истёк, в базе MongoDB
+func (m *Storage) DueDeletions(ctx context.Context, now time.Time, limit int) ([]Interface.AccountDeletion, error) {
+	collection := m.db.Database(databaseName).Collection(deletionsCollection)
+
+	filter := bson.D{{Key: "purgeAt", Value: bson.D{{Key: "$lte", Value: now}}}}
+	opts := options.Find().SetSort(bson.D{{Key: "purgeAt", Value: 1}}).SetLimit(int64(limit))
+
+	cursor, err := collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, wrap(err)
+	}
+	var list []Interface.AccountDeletion
+	if err = cursor.All(ctx, &list); err != nil {
+		return nil, wrap(err)
+	}
+	return list, nil
+}
+
+// ClaimDeletion Снимает отметку об удалении аккаунта с истёкшим сроком в базе MongoDB
+func (m *Storage) ClaimDeletion(ctx context.Context, username string, now time.Time) (bool, error) {
+	collection := m.db.Database(databaseName).Collection(deletionsCollection)
+
+	filter := bson.D{
+		{Key: "_id", Value: username},
+		{Key: "purgeAt", Value: bson.D{{Key: "$lte", Value: now}}},
+	}
+	result, err := collection.DeleteOne(ctx, filter)
+	if err != nil {
+		return false, wrap(err)
+	}
+	return result.DeletedCount > 0, nil
+}
@@ -0,0 +1,136 @@
+package mongoDB
+
+import (
+	Interface "authorization/pkg/storage"
+	"context"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"time"
+)
+
+const deviceCodesCollection = "device_codes" // коллекция запросов авторизации устройств
+
+// createDeviceIndexes Создает индексы коллекции запросов авторизации устройств.
+func (m *Storage) createDeviceIndexes(ctx context.Context) error {
+	collection := m.db.Database(databaseName).Collection(deviceCodesCollection)
+
+	_, err := collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "expiresAt", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(0),
+		},
+		{
+			Keys:    bson.D{{Key: "userCode", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+	})
+	return err
+}
+
+// deviceFilter Фильтр действующего запроса: TTL-индекс удаляет истекшие с задержкой.
+func deviceFilter(key, value string) bson.D {
+	return bson.D{
+		{Key: key, Value: value},
+		{Key: "expiresAt", Value: bson.D{{Key: "$gt", Value: time.Now()}}},
+	}
+}
+
+// AddDeviceCode Добавляет запрос авторизации устройства в базу MongoDB
+func (m *Storage) AddDeviceCode(ctx context.Context, d Interface.DeviceCode) error {
+	collection := m.db.Database(databaseName).Collection(deviceCodesCollection)
+
+	// Истекший запрос ещё держит код пользователя в уникальном индексе, пока его не удалит TTL
+	_, err := collection.DeleteMany(ctx, bson.D{
+		{Key: "userCode", Value: d.UserCode},
+		{Key: "expiresAt", Value: bson.D{{Key: "$lte", Value: time.Now()}}},
+	})
+	if err != nil {
+		return wrap(err)
+	}
+
+	_, err = collection.InsertOne(ctx, d)
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return Interface.ErrUserCodeTaken
+		}
+		return wrap(err)
+	}
+	return nil
+}
+
+// searchDevice Находит действующий запрос по полю.
+func (m *Storage) searchDevice(ctx context.Context, key, value string) (*Interface.DeviceCode, error) {
+	collection := m.db.Database(databaseName).Collection(deviceCodesCollection)
+
+	var result Interface.DeviceCode
+	err := collection.FindOne(ctx, deviceFilter(key, value)).Decode(&result)
+	if err != nil {
+		return nil, wrap(err)
+	}
+	return &result, nil
+}
+
+// SearchDeviceCode Находит действующий запрос авторизации устройства в базе MongoDB
+func (m *Storage) SearchDeviceCode(ctx context.Context, id string) (*Interface.DeviceCode, error) {
+	return m.searchDevice(ctx, "_id", id)
+}
+
+// SearchUserCode Находит действующий запрос авторизации устройства по коду пользователя в базе MongoDB
+func (m *Storage) SearchUserCode(ctx context.Context, userCode string) (*Interface.DeviceCode, error) {
+	return m.searchDevice(ctx, "userCode", userCode)
+}
+
+// PollDeviceCode Запоминает время опроса устройством и возвращает предыдущее в базе MongoDB
+func (m *Storage) PollDeviceCode(ctx context.Context, id string, t time.Time) (time.Time, error) {
+	collection := m.db.Database(databaseName).Collection(deviceCodesCollection)
+
+	update := bson.D{{Key: "$set", Value: bson.D{{Key: "lastPolled", Value: t}}}}
+	opts := options.FindOneAndUpdate().
+		SetReturnDocument(options.Before).
+		SetProjection(bson.D{{Key: "lastPolled", Value: 1}})
+
+	var prev struct {
+		LastPolled time.Time `bson:"lastPolled"`
+	}
+	err := collection.FindOneAndUpdate(ctx, deviceFilter("_id", id), update, opts).Decode(&prev)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return time.Time{}, nil
+		}
+		return time.Time{}, wrap(err)
+	}
+	return prev.LastPolled, nil
+}
+
+// ApproveDeviceCode Записывает решение пользователя по запросу устройства в базе MongoDB
+func (m *Storage) ApproveDeviceCode(ctx context.Context, userCode, username string, approved bool) (bool, error) {
+	collection := m.db.Database(databaseName).Collection(deviceCodesCollection)
+
+	status := Interface.DeviceDenied
+	if approved {
+		status = Interface.DeviceApproved
+	}
+	filter := append(deviceFilter("userCode", userCode), bson.E{Key: "status", Value: Interface.DevicePending})
+	update := bson.D{{Key: "$set", Value: bson.D{
+		{Key: "status", Value: status},
+		{Key: "username", Value: username},
+	}}}
+
+	result, err := collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return false, wrap(err)
+	}
+	return result.ModifiedCount == 1, nil
+}
+
+// DelDeviceCode Удаляет запрос авторизации устройства в базе MongoDB
+func (m *Storage) DelDeviceCode(ctx context.Context, id string) (bool, error) {
+	collection := m.db.Database(databaseName).Collection(deviceCodesCollection)
+
+	result, err := collection.DeleteOne(ctx, bson.D{{Key: "_id", Value: id}})
+	if err != nil {
+		return false, wrap(err)
+	}
+	return result.DeletedCount == 1, nil
+}
@@ -0,0 +1,27 @@
+package mongoDB
+
+import (
+	Interface "authorization/pkg/storage"
+	"errors"
+	"fmt"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// wrap Переводит ошибку MongoDB в ошибки хранилища, исходная ошибка остаётся в цепочке.
+func wrap(err error) error {
+	switch {
+	case err == nil,
+		errors.Is(err, Interface.ErrNotFound),
+		errors.Is(err, Interface.ErrAlreadyExists),
+		errors.Is(err, Interface.ErrUnavailable):
+		return err
+	case errors.Is(err, mongo.ErrNoDocuments):
+		return fmt.Errorf("%w: %w", Interface.ErrNotFound, err)
+	case mongo.IsDuplicateKeyError(err):
+		return Interface.AlreadyExists(err)
+	case Interface.Interrupted(err), mongo.IsTimeout(err), mongo.IsNetworkError(err),
+		errors.Is(err, mongo.ErrClientDisconnected):
+		return Interface.Unavailable(err)
+	}
+	return err
+}
@@ -0,0 +1,46 @@
+package mongoDB
+
+import (
+	Interface "authorization/pkg/storage"
+	"context"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+const signingKeysCollection = "signing_keys" // коллекция ключей подписи
+
+// AddSigningKey Добавляет ключ подписи в базу MongoDB
+func (m *Storage) AddSigningKey(ctx context.Context, k Interface.SigningKey) error {
+	collection := m.db.Database(databaseName).Collection(signingKeysCollection)
+	_, err := collection.InsertOne(ctx, k)
+	if err != nil {
+		return wrap(err)
+	}
+	return nil
+}
+
+// ListSigningKeys Возвращает все ключи подписи из базы MongoDB
+func (m *Storage) ListSigningKeys(ctx context.Context) ([]Interface.SigningKey, error) {
+	collection := m.db.Database(databaseName).Collection(signingKeysCollection)
+
+	cursor, err := collection.Find(ctx, bson.D{})
+	if err != nil {
+		return nil, wrap(err)
+	}
+
+	var keys []Interface.SigningKey
+	if err = cursor.All(ctx, &keys); err != nil {
+		return nil, wrap(err)
+	}
+	return keys, nil
+}
+
+// DelSigningKey Удаляет ключ подписи в базе MongoDB
+func (m *Storage) DelSigningKey(ctx context.Context, id string) (bool, error) {
+	collection := m.db.Database(databaseName).Collection(signingKeysCollection)
+
+	result, err := collection.DeleteOne(ctx, bson.D{{Key: "_id", Value: id}})
+	if err != nil {
+		return false, wrap(err)
+	}
+	return result.DeletedCount > 0, nil
+}
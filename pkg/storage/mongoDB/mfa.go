@@ -0,0 +1,83 @@
+package mongoDB
+
+import (
+	Interface "authorization/pkg/storage"
+	"context"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const totpCollection = "totp" // коллекция аутентификаторов второго фактора
+
+// SetTOTP Заменяет аутентификатор пользователя в базе MongoDB
+func (m *Storage) SetTOTP(ctx context.Context, t Interface.TOTP) error {
+	collection := m.db.Database(databaseName).Collection(totpCollection)
+
+	if t.RecoveryCodes == nil {
+		// Пустой массив, а не null, чтобы к полю применялся $pull
+		t.RecoveryCodes = []string{}
+	}
+	_, err := collection.ReplaceOne(ctx, bson.D{{Key: "_id", Value: t.Username}}, t,
+		options.Replace().SetUpsert(true))
+	if err != nil {
+		return wrap(err)
+	}
+	return nil
+}
+
+// SearchTOTP Находит аутентификатор пользователя в базе MongoDB
+func (m *Storage) SearchTOTP(ctx context.Context, username string) (*Interface.TOTP, error) {
+	collection := m.db.Database(databaseName).Collection(totpCollection)
+
+	var result Interface.TOTP
+	err := collection.FindOne(ctx, bson.D{{Key: "_id", Value: username}}).Decode(&result)
+	if err != nil {
+		return nil, wrap(err)
+	}
+	return &result, nil
+}
+
+// UseTOTPStep Атомарно запоминает шаг принятого кода в базе MongoDB
+func (m *Storage) UseTOTPStep(ctx context.Context, username string, step int64) (bool, error) {
+	collection := m.db.Database(databaseName).Collection(totpCollection)
+
+	filter := bson.D{
+		{Key: "_id", Value: username},
+		{Key: "lastStep", Value: bson.D{{Key: "$lt", Value: step}}},
+	}
+	update := bson.D{{Key: "$set", Value: bson.D{{Key: "lastStep", Value: step}}}}
+
+	result, err := collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return false, wrap(err)
+	}
+	return result.ModifiedCount == 1, nil
+}
+
+// UseRecoveryCode Атомарно вычёркивает код восстановления в базе MongoDB
+func (m *Storage) UseRecoveryCode(ctx context.Context, username, hash string) (bool, error) {
+	collection := m.db.Database(databaseName).Collection(totpCollection)
+
+	filter := bson.D{
+		{Key: "_id", Value: username},
+		{Key: "recoveryCodes", Value: hash},
+	}
+	update := bson.D{{Key: "$pull", Value: bson.D{{Key: "recoveryCodes", Value: hash}}}}
+
+	result, err := collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return false, wrap(err)
+	}
+	return result.ModifiedCount == 1, nil
+}
+
+// DelTOTP Удаляет аутентификатор пользователя в базе MongoDB
+func (m *Storage) DelTOTP(ctx context.Context, username string) (bool, error) {
+	collection := m.db.Database(databaseName).Collection(totpCollection)
+
+	result, err := collection.DeleteOne(ctx, bson.D{{Key: "_id", Value: username}})
+	if err != nil {
+		return false, wrap(err)
+	}
+	return result.DeletedCount > 0, nil
+}
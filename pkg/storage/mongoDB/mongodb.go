@@ -3,7 +3,9 @@ package mongoDB
 import (
 	Interface "authorization/pkg/storage"
 	"context"
+	"errors"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 	"time"
@@ -40,79 +42,150 @@ func New(constr string) (*Storage, error) {
 	s := Storage{
 		db: client,
 	}
+
+	// Индексы вспомогательных коллекций
+	err = s.createIndexes(ctx)
+	if err != nil {
+		return nil, err
+	}
 	return &s, nil
 }
 
-// AddAccount Добавляет данные в базу MongoDB
-func (m *Storage) AddAccount(c Interface.Account) error {
+// createIndexes Создает индексы вспомогательных коллекций
+func (m *Storage) createIndexes(ctx context.Context) error {
+	indexes := []func(context.Context) error{
+		m.createAccountIndexes,
+		m.createSessionIndexes,
+		m.createTokenIndexes,
+		m.createOAuthIndexes,
+		m.createDeviceIndexes,
+		m.createCredentialIndexes,
+		m.createResetIndexes,
+		m.createOutboxIndexes,
+		m.createDeletionIndexes,
+	}
+	for _, create := range indexes {
+		if err := create(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// createAccountIndexes Создает уникальные индексы аккаунтов по логину и неизменному идентификатору.
+// Аккаунты, ещё не переведённые MigrateAccounts, идентификатора не имеют и в индекс по нему не попадают.
+// Если в коллекции уже есть аккаунты с одинаковым логином, индекс не создаётся и лишние аккаунты нужно удалить вручную.
+func (m *Storage) createAccountIndexes(ctx context.Context) error {
+	collection := m.db.Database(databaseName).Collection(collectionName)
+
+	_, err := collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "username", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys: bson.D{{Key: "userId", Value: 1}},
+			Options: options.Index().SetUnique(true).
+				SetPartialFilterExpression(bson.D{{Key: "userId", Value: bson.D{{Key: "$type", Value: "string"}}}}),
+		},
+	})
+	return err
+}
+
+// CreateAccount Добавляет аккаунт в базу MongoDB, если логин свободен.
+// Уникальный индекс по username не даёт параллельным запросам создать два аккаунта с одним логином.
+func (m *Storage) CreateAccount(ctx context.Context, c Interface.Account) error {
+	if err := c.SetDefaults(); err != nil {
+		return wrap(err)
+	}
 	login := m.db.Database(databaseName).Collection(collectionName)
-	_, err := login.InsertOne(context.Background(), c)
+	_, err := login.InsertOne(ctx, c)
 	if err != nil {
-		return err
+		return wrap(err)
 	}
 	return nil
 }
 
 // SearchAccount Находит пароль по ключу в базе MongoDB
-func (m *Storage) SearchAccount(c Interface.Account) (string, error) {
+func (m *Storage) SearchAccount(ctx context.Context, c Interface.Account) (string, error) {
 	// Получение коллекции accounts
 	collection := m.db.Database(databaseName).Collection(collectionName)
 
 	// Создание фильтра для поиска по ключу
-	filter := bson.D{{"username", c.Username}}
+	filter := bson.D{{Key: "username", Value: c.Username}}
 
 	// Поиск документа по ключу
 	var result Interface.Account
-	err := collection.FindOne(context.Background(), filter).Decode(&result)
+	err := collection.FindOne(ctx, filter).Decode(&result)
 	if err != nil {
-		if err == mongo.ErrNoDocuments {
-			// Документ не найден
-			return "", nil
-		}
 		// Возникла ошибка при выполнении запроса
-		return "", err
+		return "", wrap(err)
 	}
 	// Возврат пароля из найденного документа
 	return result.Password, nil
 }
 
 // KeysAccount Проверяет логин по ключу в базе MongoDB
-func (m *Storage) KeysAccount(c Interface.Account) (bool, error) {
+func (m *Storage) KeysAccount(ctx context.Context, c Interface.Account) (bool, error) {
 	// Получение коллекции accounts
 	collection := m.db.Database(databaseName).Collection(collectionName)
 
 	// Создание фильтра для поиска по ключу
-	filter := bson.D{{"username", c.Username}}
+	filter := bson.D{{Key: "username", Value: c.Username}}
 
 	// Поиск документа по ключу
 	var result Interface.Account
-	err := collection.FindOne(context.Background(), filter).Decode(&result)
+	err := collection.FindOne(ctx, filter).Decode(&result)
 	if err != nil {
 		if err == mongo.ErrNoDocuments {
 			// Документ не найден
 			return false, nil
 		}
 		// Возникла ошибка при выполнении запроса
-		return false, err
+		return false, wrap(err)
 	}
 
 	// Документ найден
 	return true, nil
 }
 
+// GetAccount Находит аккаунт по логину в базе MongoDB
+func (m *Storage) GetAccount(ctx context.Context, username string) (*Interface.Account, error) {
+	collection := m.db.Database(databaseName).Collection(collectionName)
+
+	var result Interface.Account
+	err := collection.FindOne(ctx, bson.D{{Key: "username", Value: username}}).Decode(&result)
+	if err != nil {
+		return nil, wrap(err)
+	}
+	return &result, nil
+}
+
+// GetAccountByID Находит аккаунт по ID в базе MongoDB
+func (m *Storage) GetAccountByID(ctx context.Context, id string) (*Interface.Account, error) {
+	collection := m.db.Database(databaseName).Collection(collectionName)
+
+	var result Interface.Account
+	err := collection.FindOne(ctx, bson.D{{Key: "userId", Value: id}}).Decode(&result)
+	if err != nil {
+		return nil, wrap(err)
+	}
+	return &result, nil
+}
+
 // DelAccount Удаляет аккаунт в базе MongoDB
-func (m *Storage) DelAccount(c Interface.Account) (bool, error) {
+func (m *Storage) DelAccount(ctx context.Context, c Interface.Account) (bool, error) {
 	// Получение коллекции accounts
 	collection := m.db.Database(databaseName).Collection(collectionName)
 
 	// Создание фильтра для поиска по ключу
-	filter := bson.D{{"username", c.Username}}
+	filter := bson.D{{Key: "username", Value: c.Username}}
 
 	// Удаление документа по фильтру
-	result, err := collection.DeleteOne(context.Background(), filter)
+	result, err := collection.DeleteOne(ctx, filter)
 	if err != nil {
 		// Возникла ошибка при выполнении запроса
-		return false, err
+		return false, wrap(err)
 	}
 
 	// Проверка, был ли удален хотя бы один документ
@@ -124,3 +197,166 @@ func (m *Storage) DelAccount(c Interface.Account) (bool, error) {
 	// Если удаленных документов нет, возвращаем false
 	return false, nil
 }
+
+// UpdatePassword Заменяет хеш пароля существующего аккаунта в базе MongoDB
+func (m *Storage) UpdatePassword(ctx context.Context, c Interface.Account) error {
+	collection := m.db.Database(databaseName).Collection(collectionName)
+
+	filter := bson.D{{Key: "username", Value: c.Username}}
+	update := bson.D{{Key: "$set", Value: bson.D{
+		{Key: "password", Value: c.Password},
+		{Key: "updatedAt", Value: time.Now().UTC()},
+	}}}
+
+	_, err := collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return wrap(err)
+	}
+	return nil
+}
+
+// ChangePassword Атомарно заменяет хеш пароля в базе MongoDB, если он не изменился
+func (m *Storage) ChangePassword(ctx context.Context, username, old, password string) (bool, error) {
+	collection := m.db.Database(databaseName).Collection(collectionName)
+
+	filter := bson.D{
+		{Key: "username", Value: username},
+		{Key: "password", Value: old},
+	}
+	update := bson.D{{Key: "$set", Value: bson.D{
+		{Key: "password", Value: password},
+		{Key: "updatedAt", Value: time.Now().UTC()},
+	}}}
+
+	result, err := collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return false, wrap(err)
+	}
+	return result.ModifiedCount == 1, nil
+}
+
+// CountLegacyAccounts Считает аккаунты с паролем в устаревшем формате SHA-256 в базе MongoDB
+func (m *Storage) CountLegacyAccounts(ctx context.Context) (int64, error) {
+	collection := m.db.Database(databaseName).Collection(collectionName)
+
+	filter := bson.D{{Key: "password", Value: primitive.Regex{Pattern: "^[0-9a-f]{64}$"}}}
+
+	return collection.CountDocuments(ctx, filter)
+}
+
+// setAccount Меняет поля существующего аккаунта в базе MongoDB
+func (m *Storage) setAccount(ctx context.Context, username string, fields bson.D) (bool, error) {
+	collection := m.db.Database(databaseName).Collection(collectionName)
+
+	result, err := collection.UpdateOne(ctx, bson.D{{Key: "username", Value: username}},
+		bson.D{{Key: "$set", Value: fields}})
+	if err != nil {
+		return false, wrap(err)
+	}
+	return result.MatchedCount > 0, nil
+}
+
+// SetDisplayName Меняет отображаемое имя пользователя в базе MongoDB
+func (m *Storage) SetDisplayName(ctx context.Context, username, displayName string) (bool, error) {
+	return m.setAccount(ctx, username, bson.D{
+		{Key: "displayName", Value: displayName},
+		{Key: "updatedAt", Value: time.Now().UTC()},
+	})
+}
+
+// SetAccountStatus Меняет статус аккаунта в базе MongoDB
+func (m *Storage) SetAccountStatus(ctx context.Context, username string, status Interface.AccountStatus) (bool, error) {
+	return m.setAccount(ctx, username, bson.D{
+		{Key: "status", Value: status},
+		{Key: "updatedAt", Value: time.Now().UTC()},
+	})
+}
+
+// SetEmailVerified Отмечает адрес пользователя подтверждённым в базе MongoDB
+func (m *Storage) SetEmailVerified(ctx context.Context, username string) (bool, error) {
+	collection := m.db.Database(databaseName).Collection(collectionName)
+
+	// Обновление конвейером меняет статус в той же операции, что и флаг
+	update := mongo.Pipeline{{{Key: "$set", Value: bson.D{
+		{Key: "emailVerified", Value: true},
+		{Key: "updatedAt", Value: time.Now().UTC()},
+		{Key: "status", Value: bson.D{{Key: "$cond", Value: bson.A{
+			bson.D{{Key: "$eq", Value: bson.A{"$status", Interface.StatusPending}}}, Interface.StatusActive, "$status",
+		}}}},
+	}}}}
+	result, err := collection.UpdateOne(ctx, bson.D{{Key: "username", Value: username}}, update)
+	if err != nil {
+		return false, wrap(err)
+	}
+	return result.MatchedCount > 0, nil
+}
+
+// SetLastLogin Запоминает время последнего входа пользователя в базе MongoDB
+func (m *Storage) SetLastLogin(ctx context.Context, username string, t time.Time) (bool, error) {
+	return m.setAccount(ctx, username, bson.D{{Key: "lastLoginAt", Value: t}})
+}
+
+// MigrateAccounts Заполняет идентификатор, статус, подтверждение адреса и время создания
+// у аккаунтов, сохранённых до появления профиля, в базе MongoDB
+func (m *Storage) MigrateAccounts(ctx context.Context) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Minute)
+	defer cancel()
+
+	collection := m.db.Database(databaseName).Collection(collectionName)
+
+	cursor, err := collection.Find(ctx, bson.D{{Key: "userId", Value: bson.D{{Key: "$exists", Value: false}}}})
+	if err != nil {
+		return 0, wrap(err)
+	}
+	defer cursor.Close(ctx)
+
+	var count int64
+	for cursor.Next(ctx) {
+		var doc struct {
+			ID       primitive.ObjectID `bson:"_id"`
+			Username string             `bson:"username"`
+		}
+		if err = cursor.Decode(&doc); err != nil {
+			return count, wrap(err)
+		}
+
+		// Без записи о подтверждении временем создания служит время из идентификатора документа
+		c := Interface.Account{CreatedAt: doc.ID.Timestamp().UTC(), EmailVerified: true}
+		v, err := m.SearchEmailVerification(ctx, doc.Username)
+		if err != nil && !errors.Is(err, Interface.ErrNotFound) {
+			return count, err
+		}
+		if err == nil {
+			c.CreatedAt, c.EmailVerified = v.CreatedAt, v.Verified
+			if !v.Verified {
+				c.Status = Interface.StatusPending
+			}
+		}
+		if err = c.SetDefaults(); err != nil {
+			return count, wrap(err)
+		}
+
+		filter := bson.D{
+			{Key: "_id", Value: doc.ID},
+			{Key: "userId", Value: bson.D{{Key: "$exists", Value: false}}},
+		}
+		update := bson.D{{Key: "$set", Value: bson.D{
+			{Key: "userId", Value: c.ID},
+			{Key: "displayName", Value: c.DisplayName},
+			{Key: "status", Value: c.Status},
+			{Key: "emailVerified", Value: c.EmailVerified},
+			{Key: "createdAt", Value: c.CreatedAt},
+			{Key: "updatedAt", Value: c.UpdatedAt},
+		}}}
+		result, err := collection.UpdateOne(ctx, filter, update)
+		if err != nil {
+			return count, wrap(err)
+		}
+		count += result.ModifiedCount
+	}
+	if err = cursor.Err(); err != nil {
+		return count, wrap(err)
+	}
+
+	return count, nil
+}
@@ -2,7 +2,13 @@ package mongoDB
 
 import (
 	"authorization/pkg/storage"
+	"context"
+	"errors"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson"
+	"sync"
 	"testing"
+	"time"
 )
 
 func TestNew(t *testing.T) {
@@ -17,7 +23,8 @@ func TestNew(t *testing.T) {
 	}
 }
 
-func TestStorage_AddAccount(t *testing.T) {
+func TestStorage_CreateAccount(t *testing.T) {
+	ctx := context.Background()
 	// Установка соединения с базой данных MongoDB
 	dataBase, err := New("mongodb://localhost:27015/")
 	if err != nil {
@@ -28,16 +35,24 @@ func TestStorage_AddAccount(t *testing.T) {
 		Username: "krex@ya.ru",
 		Password: "12345678",
 	}
-	// Вызов функции AddAccount
-	err = dataBase.AddAccount(c)
+	dataBase.DelAccount(ctx, c)
+	// Вызов функции CreateAccount
+	err = dataBase.CreateAccount(ctx, c)
 	if err != nil {
 		t.Error(err)
 	}
 
+	// Занятый логин не перезаписывается
+	err = dataBase.CreateAccount(ctx, storage.Account{Username: c.Username, Password: "87654321"})
+	if !errors.Is(err, storage.ErrAlreadyExists) {
+		t.Errorf("повторное создание аккаунта: %v", err)
+	}
+
 	t.Log("Запись создана.")
 }
 
 func TestStorage_SearchAccount(t *testing.T) {
+	ctx := context.Background()
 	// Установка соединения с базой данных MongoDB
 	dataBase, err := New("mongodb://localhost:27015/")
 	if err != nil {
@@ -50,7 +65,7 @@ func TestStorage_SearchAccount(t *testing.T) {
 	}
 
 	// Вызов функции SearchAccount
-	password, err := dataBase.SearchAccount(c)
+	password, err := dataBase.SearchAccount(ctx, c)
 	if err != nil {
 		t.Errorf("ошибка при поиске аккаунта: %v", err)
 		return
@@ -64,6 +79,7 @@ func TestStorage_SearchAccount(t *testing.T) {
 }
 
 func TestStorage_KeysAccount(t *testing.T) {
+	ctx := context.Background()
 	// Установка соединения с базой данных MongoDB
 	dataBase, err := New("mongodb://localhost:27015/")
 	if err != nil {
@@ -76,7 +92,7 @@ func TestStorage_KeysAccount(t *testing.T) {
 	}
 
 	// Вызов функции KeysAccount
-	exists, err := dataBase.KeysAccount(c)
+	exists, err := dataBase.KeysAccount(ctx, c)
 	if err != nil {
 		t.Errorf("ошибка при проверке наличия аккаунта: %v", err)
 		return
@@ -89,6 +105,7 @@ func TestStorage_KeysAccount(t *testing.T) {
 }
 
 func TestStorage_DelAccount(t *testing.T) {
+	ctx := context.Background()
 	// Установка соединения с базой данных MongoDB
 	dataBase, err := New("mongodb://localhost:27015/")
 	if err != nil {
@@ -101,7 +118,7 @@ func TestStorage_DelAccount(t *testing.T) {
 	}
 
 	// Вызов функции DelAccount
-	deleted, err := dataBase.DelAccount(c)
+	deleted, err := dataBase.DelAccount(ctx, c)
 	if err != nil {
 		t.Errorf("ошибка при удалении аккаунта: %v", err)
 		return
@@ -114,3 +131,1184 @@ func TestStorage_DelAccount(t *testing.T) {
 	}
 
 }
+
+func TestStorage_Sessions(t *testing.T) {
+	ctx := context.Background()
+	// Установка соединения с базой данных MongoDB
+	dataBase, err := New("mongodb://localhost:27015/")
+	if err != nil {
+		t.Fatalf("не удалось подключиться к базе данных: %v", err)
+	}
+
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	c := storage.Session{
+		ID:        "test-session-id",
+		Username:  "krex@ya.ru",
+		CreatedAt: now,
+		ExpiresAt: now.Add(time.Hour),
+	}
+	if err = dataBase.AddSession(ctx, c); err != nil {
+		t.Fatalf("ошибка при создании сессии: %v", err)
+	}
+
+	// Сессия находится и привязана к пользователю
+	found, err := dataBase.SearchSession(ctx, c.ID)
+	if err != nil {
+		t.Fatalf("ошибка при поиске сессии: %v", err)
+	}
+	if found == nil || found.Username != c.Username {
+		t.Fatalf("неправильная сессия. Получено: %v, Ожидается: %v", found, c)
+	}
+
+	// После удаления сессия не находится
+	deleted, err := dataBase.DelSession(ctx, c.ID)
+	if err != nil {
+		t.Fatalf("ошибка при удалении сессии: %v", err)
+	}
+	if !deleted {
+		t.Error("сессия не была удалена")
+	}
+	found, err = dataBase.SearchSession(ctx, c.ID)
+	if err != nil && !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("ошибка при поиске сессии: %v", err)
+	}
+	if found != nil {
+		t.Errorf("удалённая сессия найдена: %v", found)
+	}
+}
+
+func TestStorage_DelUserSessions(t *testing.T) {
+	ctx := context.Background()
+	// Установка соединения с базой данных MongoDB
+	dataBase, err := New("mongodb://localhost:27015/")
+	if err != nil {
+		t.Fatalf("не удалось подключиться к базе данных: %v", err)
+	}
+
+	now := time.Now().UTC()
+	ids := []string{"test-session-1", "test-session-2"}
+	for _, id := range ids {
+		err = dataBase.AddSession(ctx, storage.Session{
+			ID:        id,
+			Username:  "krex@ya.ru",
+			CreatedAt: now,
+			ExpiresAt: now.Add(time.Hour),
+		})
+		if err != nil {
+			t.Fatalf("ошибка при создании сессии: %v", err)
+		}
+	}
+
+	n, err := dataBase.DelUserSessions(ctx, "krex@ya.ru")
+	if err != nil {
+		t.Fatalf("ошибка при удалении сессий: %v", err)
+	}
+	if n != int64(len(ids)) {
+		t.Errorf("неправильное число удалённых сессий. Получено: %d, Ожидается: %d", n, len(ids))
+	}
+	for _, id := range ids {
+		found, err := dataBase.SearchSession(ctx, id)
+		if err != nil && !errors.Is(err, storage.ErrNotFound) {
+			t.Fatalf("ошибка при поиске сессии: %v", err)
+		}
+		if found != nil {
+			t.Errorf("сессия %s не удалена", id)
+		}
+	}
+}
+
+func TestStorage_ListSessions(t *testing.T) {
+	ctx := context.Background()
+	// Установка соединения с базой данных MongoDB
+	dataBase, err := New("mongodb://localhost:27015/")
+	if err != nil {
+		t.Fatalf("не удалось подключиться к базе данных: %v", err)
+	}
+
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	c := storage.Session{
+		ID:        "test-session-list",
+		Username:  "list@ya.ru",
+		CreatedAt: now,
+		LastSeen:  now,
+		ExpiresAt: now.Add(time.Hour),
+		IP:        "127.0.0.1",
+		UserAgent: "Go-http-client/1.1",
+	}
+	if err = dataBase.AddSession(ctx, c); err != nil {
+		t.Fatalf("ошибка при создании сессии: %v", err)
+	}
+	defer dataBase.DelUserSessions(ctx, c.Username)
+
+	// Обновляем время последней активности
+	seen := now.Add(time.Minute)
+	if err = dataBase.TouchSession(ctx, c.ID, seen); err != nil {
+		t.Fatalf("ошибка при обновлении сессии: %v", err)
+	}
+
+	sessions, err := dataBase.ListSessions(ctx, c.Username)
+	if err != nil {
+		t.Fatalf("ошибка при получении сессий: %v", err)
+	}
+	if len(sessions) != 1 {
+		t.Fatalf("неправильное число сессий. Получено: %d, Ожидается: %d", len(sessions), 1)
+	}
+	if sessions[0].IP != c.IP || !sessions[0].LastSeen.Equal(seen) {
+		t.Errorf("неправильная сессия. Получено: %+v", sessions[0])
+	}
+}
+
+func TestStorage_RefreshTokens(t *testing.T) {
+	ctx := context.Background()
+	// Установка соединения с базой данных MongoDB
+	dataBase, err := New("mongodb://localhost:27015/")
+	if err != nil {
+		t.Fatalf("не удалось подключиться к базе данных: %v", err)
+	}
+
+	now := time.Now().UTC()
+	c := storage.RefreshToken{
+		ID:        "test-refresh-id",
+		FamilyID:  "test-family-id",
+		Username:  "krex@ya.ru",
+		CreatedAt: now,
+		ExpiresAt: now.Add(time.Hour),
+	}
+	if err = dataBase.AddRefreshToken(ctx, c); err != nil {
+		t.Fatalf("ошибка при создании токена: %v", err)
+	}
+
+	// Первое использование успешно, второе отклоняется
+	ok, err := dataBase.UseRefreshToken(ctx, c.ID)
+	if err != nil {
+		t.Fatalf("ошибка при использовании токена: %v", err)
+	}
+	if !ok {
+		t.Error("первое использование токена отклонено")
+	}
+	ok, err = dataBase.UseRefreshToken(ctx, c.ID)
+	if err != nil {
+		t.Fatalf("ошибка при использовании токена: %v", err)
+	}
+	if ok {
+		t.Error("повторное использование токена не отклонено")
+	}
+
+	found, err := dataBase.SearchRefreshToken(ctx, c.ID)
+	if err != nil {
+		t.Fatalf("ошибка при поиске токена: %v", err)
+	}
+	if found == nil || !found.Used {
+		t.Errorf("токен не помечен использованным: %v", found)
+	}
+
+	// Отзыв семейства
+	if _, err = dataBase.DelRefreshFamily(ctx, c.FamilyID); err != nil {
+		t.Fatalf("ошибка при отзыве семейства: %v", err)
+	}
+	found, err = dataBase.SearchRefreshToken(ctx, c.ID)
+	if err != nil && !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("ошибка при поиске токена: %v", err)
+	}
+	if found != nil {
+		t.Errorf("токен отозванного семейства найден: %v", found)
+	}
+
+	// Удаление всех токенов пользователя
+	c.ID = "refresh-user-hash"
+	c.FamilyID = "refresh-user-family"
+	if err = dataBase.AddRefreshToken(ctx, c); err != nil {
+		t.Fatalf("ошибка при создании токена: %v", err)
+	}
+	n, err := dataBase.DelUserRefreshTokens(ctx, c.Username)
+	if err != nil {
+		t.Fatalf("ошибка при удалении токенов пользователя: %v", err)
+	}
+	found, err = dataBase.SearchRefreshToken(ctx, c.ID)
+	if err != nil && !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("ошибка при поиске токена: %v", err)
+	}
+	if n < 1 || found != nil {
+		t.Errorf("удалено %d, токен пользователя найден: %v", n, found)
+	}
+}
+
+func TestStorage_RevokedTokens(t *testing.T) {
+	ctx := context.Background()
+	// Установка соединения с базой данных MongoDB
+	dataBase, err := New("mongodb://localhost:27015/")
+	if err != nil {
+		t.Fatalf("не удалось подключиться к базе данных: %v", err)
+	}
+
+	revoked, err := dataBase.AccessTokenRevoked(ctx, "test-jti")
+	if err != nil {
+		t.Fatalf("ошибка при проверке токена: %v", err)
+	}
+	if revoked {
+		t.Error("неотозванный токен считается отозванным")
+	}
+
+	// Повторный отзыв того же токена не ошибка
+	for i := 0; i < 2; i++ {
+		if err = dataBase.RevokeAccessToken(ctx, "test-jti", time.Now().Add(time.Minute)); err != nil {
+			t.Fatalf("ошибка при отзыве токена: %v", err)
+		}
+	}
+	revoked, err = dataBase.AccessTokenRevoked(ctx, "test-jti")
+	if err != nil {
+		t.Fatalf("ошибка при проверке токена: %v", err)
+	}
+	if !revoked {
+		t.Error("отозванный токен не найден")
+	}
+}
+
+func TestStorage_UserAccessTokens(t *testing.T) {
+	ctx := context.Background()
+	// Установка соединения с базой данных MongoDB
+	dataBase, err := New("mongodb://localhost:27015/")
+	if err != nil {
+		t.Fatalf("не удалось подключиться к базе данных: %v", err)
+	}
+
+	const username = "access@ya.ru"
+	suffix := time.Now().Format(time.RFC3339Nano)
+	expired, first, second := "expired-"+suffix, "first-"+suffix, "second-"+suffix
+	dataBase.RevokeUserAccessTokens(ctx, username)
+
+	// Истёкший токен не отзывается, он недействителен и так
+	if err = dataBase.AddAccessToken(ctx, username, expired, time.Now().Add(-time.Minute)); err != nil {
+		t.Fatalf("ошибка при сохранении токена: %v", err)
+	}
+	for _, jti := range []string{first, second} {
+		if err = dataBase.AddAccessToken(ctx, username, jti, time.Now().Add(time.Minute)); err != nil {
+			t.Fatalf("ошибка при сохранении токена: %v", err)
+		}
+	}
+	if err = dataBase.AddAccessToken(ctx, "other@ya.ru", "other-"+suffix, time.Now().Add(time.Minute)); err != nil {
+		t.Fatalf("ошибка при сохранении токена: %v", err)
+	}
+
+	n, err := dataBase.RevokeUserAccessTokens(ctx, username)
+	if err != nil || n != 2 {
+		t.Fatalf("отозвано токенов %d, ожидается 2: %v", n, err)
+	}
+	for jti, want := range map[string]bool{first: true, second: true, expired: false, "other-" + suffix: false} {
+		revoked, err := dataBase.AccessTokenRevoked(ctx, jti)
+		if err != nil || revoked != want {
+			t.Errorf("токен %s отозван: %v, ожидается %v, %v", jti, revoked, want, err)
+		}
+	}
+
+	// Повторный отзыв ничего не находит
+	if n, err = dataBase.RevokeUserAccessTokens(ctx, username); err != nil || n != 0 {
+		t.Errorf("токены отозваны повторно: %d %v", n, err)
+	}
+	dataBase.RevokeUserAccessTokens(ctx, "other@ya.ru")
+}
+
+func TestStorage_TOTP(t *testing.T) {
+	ctx := context.Background()
+	// Установка соединения с базой данных MongoDB
+	dataBase, err := New("mongodb://localhost:27015/")
+	if err != nil {
+		t.Fatalf("не удалось подключиться к базе данных: %v", err)
+	}
+
+	c := storage.TOTP{
+		Username:      "totp@ya.ru",
+		Secret:        "JBSWY3DPEHPK3PXP",
+		Enabled:       true,
+		RecoveryCodes: []string{"hash-1", "hash-2"},
+		LastStep:      100,
+		CreatedAt:     time.Now().UTC(),
+	}
+	if err = dataBase.SetTOTP(ctx, c); err != nil {
+		t.Fatalf("ошибка при сохранении аутентификатора: %v", err)
+	}
+
+	found, err := dataBase.SearchTOTP(ctx, c.Username)
+	if err != nil {
+		t.Fatalf("ошибка при поиске аутентификатора: %v", err)
+	}
+	if found == nil || found.Secret != c.Secret || !found.Enabled || found.LastStep != c.LastStep || len(found.RecoveryCodes) != 2 {
+		t.Fatalf("аутентификатор не совпадает: %v", found)
+	}
+
+	// Шаг принимается только больше запомненного
+	for _, tt := range []struct {
+		step int64
+		want bool
+	}{{100, false}, {101, true}, {101, false}, {99, false}} {
+		ok, err := dataBase.UseTOTPStep(ctx, c.Username, tt.step)
+		if err != nil {
+			t.Fatalf("ошибка при использовании шага: %v", err)
+		}
+		if ok != tt.want {
+			t.Errorf("шаг %d: получено %v, ожидается %v", tt.step, ok, tt.want)
+		}
+	}
+
+	// Код восстановления вычёркивается один раз
+	for _, want := range []bool{true, false} {
+		ok, err := dataBase.UseRecoveryCode(ctx, c.Username, "hash-1")
+		if err != nil {
+			t.Fatalf("ошибка при использовании кода: %v", err)
+		}
+		if ok != want {
+			t.Errorf("код восстановления: получено %v, ожидается %v", ok, want)
+		}
+	}
+
+	deleted, err := dataBase.DelTOTP(ctx, c.Username)
+	if err != nil {
+		t.Fatalf("ошибка при удалении аутентификатора: %v", err)
+	}
+	found, err = dataBase.SearchTOTP(ctx, c.Username)
+	if err != nil && !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("ошибка при поиске аутентификатора: %v", err)
+	}
+	if !deleted || found != nil {
+		t.Errorf("аутентификатор не удалён: %v", found)
+	}
+}
+
+func TestStorage_WebAuthnCredentials(t *testing.T) {
+	ctx := context.Background()
+	// Установка соединения с базой данных MongoDB
+	dataBase, err := New("mongodb://localhost:27015/")
+	if err != nil {
+		t.Fatalf("не удалось подключиться к базе данных: %v", err)
+	}
+
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	c := storage.WebAuthnCredential{
+		ID:        "credential-1",
+		Username:  "passkey@ya.ru",
+		Name:      "Ноутбук",
+		PublicKey: []byte{0xa5, 0x01, 0x02},
+		Alg:       -7,
+		SignCount: 1,
+		AAGUID:    "00000000000000000000000000000000",
+		Format:    "none",
+		CreatedAt: now,
+		LastUsed:  now,
+	}
+	if _, err = dataBase.DelUserCredentials(ctx, c.Username); err != nil {
+		t.Fatalf("ошибка при удалении ключей доступа: %v", err)
+	}
+	if err = dataBase.AddCredential(ctx, c); err != nil {
+		t.Fatalf("ошибка при сохранении ключа доступа: %v", err)
+	}
+	other := c
+	other.ID = "credential-2"
+	if err = dataBase.AddCredential(ctx, other); err != nil {
+		t.Fatalf("ошибка при сохранении ключа доступа: %v", err)
+	}
+
+	found, err := dataBase.SearchCredential(ctx, c.ID)
+	if err != nil {
+		t.Fatalf("ошибка при поиске ключа доступа: %v", err)
+	}
+	if found == nil || found.Username != c.Username || string(found.PublicKey) != string(c.PublicKey) || found.SignCount != c.SignCount {
+		t.Fatalf("ключ доступа не совпадает: %v", found)
+	}
+	list, err := dataBase.ListCredentials(ctx, c.Username)
+	if err != nil {
+		t.Fatalf("ошибка при получении ключей доступа: %v", err)
+	}
+	if len(list) != 2 {
+		t.Errorf("получено %d ключей доступа, ожидается 2", len(list))
+	}
+
+	// Счётчик меняется только от ожидаемого значения
+	for _, tt := range []struct {
+		prev, next int64
+		want       bool
+	}{{1, 5, true}, {1, 6, false}, {5, 6, true}} {
+		ok, err := dataBase.UseCredential(ctx, c.ID, tt.prev, tt.next, now)
+		if err != nil {
+			t.Fatalf("ошибка при обновлении счётчика: %v", err)
+		}
+		if ok != tt.want {
+			t.Errorf("счётчик %d → %d: получено %v, ожидается %v", tt.prev, tt.next, ok, tt.want)
+		}
+	}
+	found, err = dataBase.SearchCredential(ctx, c.ID)
+	if err != nil || found == nil || found.SignCount != 6 {
+		t.Errorf("счётчик не сохранён: %v %v", found, err)
+	}
+
+	// Чужой ключ не удаляется
+	deleted, err := dataBase.DelCredential(ctx, "other@ya.ru", c.ID)
+	if err != nil || deleted {
+		t.Errorf("удалён чужой ключ доступа: %v %v", deleted, err)
+	}
+	deleted, err = dataBase.DelCredential(ctx, c.Username, c.ID)
+	if err != nil || !deleted {
+		t.Errorf("ключ доступа не удалён: %v %v", deleted, err)
+	}
+
+	n, err := dataBase.DelUserCredentials(ctx, c.Username)
+	if err != nil {
+		t.Fatalf("ошибка при удалении ключей доступа: %v", err)
+	}
+	list, err = dataBase.ListCredentials(ctx, c.Username)
+	if err != nil {
+		t.Fatalf("ошибка при получении ключей доступа: %v", err)
+	}
+	if n != 1 || len(list) != 0 {
+		t.Errorf("удалено %d, осталось %d ключей доступа", n, len(list))
+	}
+}
+
+func TestStorage_EmailVerification(t *testing.T) {
+	ctx := context.Background()
+	// Установка соединения с базой данных MongoDB
+	dataBase, err := New("mongodb://localhost:27015/")
+	if err != nil {
+		t.Fatalf("не удалось подключиться к базе данных: %v", err)
+	}
+
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	v := storage.EmailVerification{
+		Username:  "verify@ya.ru",
+		CreatedAt: now,
+	}
+	if err = dataBase.SetEmailVerification(ctx, v); err != nil {
+		t.Fatalf("ошибка при сохранении подтверждения: %v", err)
+	}
+
+	found, err := dataBase.SearchEmailVerification(ctx, v.Username)
+	if err != nil {
+		t.Fatalf("ошибка при поиске подтверждения: %v", err)
+	}
+	if found == nil || found.Verified || !found.CreatedAt.Equal(now) {
+		t.Fatalf("подтверждение не совпадает: %v", found)
+	}
+
+	v.Verified, v.VerifiedAt = true, now
+	if err = dataBase.SetEmailVerification(ctx, v); err != nil {
+		t.Fatalf("ошибка при сохранении подтверждения: %v", err)
+	}
+	found, err = dataBase.SearchEmailVerification(ctx, v.Username)
+	if err != nil || found == nil || !found.Verified {
+		t.Errorf("адрес не подтверждён: %v %v", found, err)
+	}
+
+	deleted, err := dataBase.DelEmailVerification(ctx, v.Username)
+	if err != nil {
+		t.Fatalf("ошибка при удалении подтверждения: %v", err)
+	}
+	found, err = dataBase.SearchEmailVerification(ctx, v.Username)
+	if err != nil && !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("ошибка при поиске подтверждения: %v", err)
+	}
+	if !deleted || found != nil {
+		t.Errorf("подтверждение не удалено: %v", found)
+	}
+}
+
+func TestStorage_PasswordResets(t *testing.T) {
+	ctx := context.Background()
+	// Установка соединения с базой данных MongoDB
+	dataBase, err := New("mongodb://localhost:27015/")
+	if err != nil {
+		t.Fatalf("не удалось подключиться к базе данных: %v", err)
+	}
+
+	now := time.Now().UTC()
+	c := storage.PasswordReset{
+		ID:        "reset-hash-1",
+		Username:  "reset@ya.ru",
+		CreatedAt: now,
+		ExpiresAt: now.Add(time.Hour),
+	}
+	if _, err = dataBase.DelUserPasswordResets(ctx, c.Username); err != nil {
+		t.Fatalf("ошибка при удалении токенов сброса: %v", err)
+	}
+	if err = dataBase.AddPasswordReset(ctx, c); err != nil {
+		t.Fatalf("ошибка при сохранении токена сброса: %v", err)
+	}
+
+	// Токен выдаётся один раз
+	found, err := dataBase.UsePasswordReset(ctx, c.ID)
+	if err != nil {
+		t.Fatalf("ошибка при использовании токена сброса: %v", err)
+	}
+	if found == nil || found.Username != c.Username {
+		t.Fatalf("токен сброса не совпадает: %v", found)
+	}
+	found, err = dataBase.UsePasswordReset(ctx, c.ID)
+	if found != nil || !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("токен сброса использован повторно: %v %v", found, err)
+	}
+
+	other := c
+	other.ID = "reset-hash-2"
+	if err = dataBase.AddPasswordReset(ctx, other); err != nil {
+		t.Fatalf("ошибка при сохранении токена сброса: %v", err)
+	}
+	n, err := dataBase.DelUserPasswordResets(ctx, c.Username)
+	if err != nil {
+		t.Fatalf("ошибка при удалении токенов сброса: %v", err)
+	}
+	found, err = dataBase.UsePasswordReset(ctx, other.ID)
+	if err != nil && !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("ошибка при использовании токена сброса: %v", err)
+	}
+	if n != 1 || found != nil {
+		t.Errorf("удалено %d, токен сброса остался: %v", n, found)
+	}
+}
+
+func TestStorage_ChangePassword(t *testing.T) {
+	ctx := context.Background()
+	// Установка соединения с базой данных MongoDB
+	dataBase, err := New("mongodb://localhost:27015/")
+	if err != nil {
+		t.Fatalf("не удалось подключиться к базе данных: %v", err)
+	}
+
+	c := storage.Account{
+		Username: "change@ya.ru",
+		Password: "old-hash",
+	}
+	if _, err = dataBase.DelAccount(ctx, c); err != nil {
+		t.Fatalf("ошибка при удалении аккаунта: %v", err)
+	}
+	if err = dataBase.CreateAccount(ctx, c); err != nil {
+		t.Fatalf("ошибка при добавлении аккаунта: %v", err)
+	}
+	defer dataBase.DelAccount(ctx, c)
+
+	// Пароль меняется только от ожидаемого хеша
+	for _, tt := range []struct {
+		old, password string
+		want          bool
+	}{{"old-hash", "new-hash", true}, {"old-hash", "other-hash", false}} {
+		ok, err := dataBase.ChangePassword(ctx, c.Username, tt.old, tt.password)
+		if err != nil {
+			t.Fatalf("ошибка при смене пароля: %v", err)
+		}
+		if ok != tt.want {
+			t.Errorf("смена %s → %s: получено %v, ожидается %v", tt.old, tt.password, ok, tt.want)
+		}
+	}
+
+	password, err := dataBase.SearchAccount(ctx, c)
+	if err != nil {
+		t.Fatalf("ошибка при поиске аккаунта: %v", err)
+	}
+	if password != "new-hash" {
+		t.Errorf("хеш пароля: получено %q, ожидается %q", password, "new-hash")
+	}
+
+	// Несуществующий аккаунт не создаётся
+	ok, err := dataBase.ChangePassword(ctx, "nobody@ya.ru", "", "hash")
+	if err != nil || ok {
+		t.Errorf("пароль сменён у несуществующего аккаунта: %v %v", ok, err)
+	}
+}
+
+func TestStorage_Outbox(t *testing.T) {
+	ctx := context.Background()
+	// Установка соединения с базой данных MongoDB
+	dataBase, err := New("mongodb://localhost:27015/")
+	if err != nil {
+		t.Fatalf("не удалось подключиться к базе данных: %v", err)
+	}
+
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	m := storage.OutboxMessage{
+		ID:          "outbox-test-1",
+		To:          "outbox@ya.ru",
+		Subject:     "Тема",
+		Text:        "Текст",
+		HTML:        "<p>Текст</p>",
+		NextAttempt: now.Add(-time.Minute),
+		CreatedAt:   now,
+	}
+	if _, err = dataBase.DelOutboxMessage(ctx, m.ID); err != nil {
+		t.Fatalf("ошибка при удалении письма: %v", err)
+	}
+	if err = dataBase.AddOutboxMessage(ctx, m); err != nil {
+		t.Fatalf("ошибка при добавлении письма: %v", err)
+	}
+
+	// claim Забирает письма и возвращает тестовое, если оно среди них
+	claim := func() *storage.OutboxMessage {
+		list, err := dataBase.ClaimOutboxMessages(ctx, time.Now().UTC(), time.Hour, 100)
+		if err != nil {
+			t.Fatalf("ошибка при выборе писем: %v", err)
+		}
+		for _, c := range list {
+			if c.ID == m.ID {
+				return &c
+			}
+		}
+		return nil
+	}
+
+	found := claim()
+	if found == nil || found.To != m.To || found.Subject != m.Subject || found.HTML != m.HTML {
+		t.Fatalf("письмо не совпадает: %v", found)
+	}
+	// Забранное письмо не выдаётся повторно до истечения аренды
+	if found = claim(); found != nil {
+		t.Errorf("письмо выдано повторно: %v", found)
+	}
+
+	if err = dataBase.RetryOutboxMessage(ctx, m.ID, 1, now.Add(-time.Second), "ошибка"); err != nil {
+		t.Fatalf("ошибка при сохранении попытки: %v", err)
+	}
+	found = claim()
+	if found == nil || found.Attempts != 1 || found.LastError != "ошибка" {
+		t.Errorf("попытка не сохранена: %v", found)
+	}
+
+	ok, err := dataBase.DelOutboxMessage(ctx, m.ID)
+	if err != nil || !ok {
+		t.Errorf("письмо не удалено: %v %v", ok, err)
+	}
+	ok, err = dataBase.DelOutboxMessage(ctx, m.ID)
+	if err != nil || ok {
+		t.Errorf("письмо удалено повторно: %v %v", ok, err)
+	}
+}
+
+func TestStorage_AccountDeletions(t *testing.T) {
+	ctx := context.Background()
+	// Установка соединения с базой данных MongoDB
+	dataBase, err := New("mongodb://localhost:27015/")
+	if err != nil {
+		t.Fatalf("не удалось подключиться к базе данных: %v", err)
+	}
+
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	d := storage.AccountDeletion{
+		Username:    "deletion@ya.ru",
+		RequestedAt: now,
+		PurgeAt:     now.Add(time.Hour),
+	}
+	if _, err = dataBase.CancelDeletion(ctx, d.Username); err != nil {
+		t.Fatalf("ошибка при отмене удаления: %v", err)
+	}
+	if err = dataBase.ScheduleDeletion(ctx, d); err != nil {
+		t.Fatalf("ошибка при отметке удаления: %v", err)
+	}
+
+	found, err := dataBase.SearchDeletion(ctx, d.Username)
+	if err != nil || found == nil || !found.PurgeAt.Equal(d.PurgeAt) {
+		t.Fatalf("отметка удаления не совпадает: %v %v", found, err)
+	}
+
+	// due Возвращает true, если тестовый аккаунт среди ожидающих удаления к now
+	due := func(now time.Time) bool {
+		list, err := dataBase.DueDeletions(ctx, now, 100)
+		if err != nil {
+			t.Fatalf("ошибка при выборе аккаунтов: %v", err)
+		}
+		for _, c := range list {
+			if c.Username == d.Username {
+				return true
+			}
+		}
+		return false
+	}
+	if due(now) {
+		t.Errorf("аккаунт выбран до истечения срока")
+	}
+	if !due(now.Add(2 * time.Hour)) {
+		t.Errorf("аккаунт с истёкшим сроком не выбран")
+	}
+
+	// Снять отметку для удаления можно только после истечения срока и только один раз
+	ok, err := dataBase.ClaimDeletion(ctx, d.Username, now)
+	if err != nil || ok {
+		t.Errorf("отметка снята до истечения срока: %v %v", ok, err)
+	}
+	ok, err = dataBase.ClaimDeletion(ctx, d.Username, now.Add(2*time.Hour))
+	if err != nil || !ok {
+		t.Errorf("отметка не снята: %v %v", ok, err)
+	}
+	ok, err = dataBase.ClaimDeletion(ctx, d.Username, now.Add(2*time.Hour))
+	if err != nil || ok {
+		t.Errorf("отметка снята повторно: %v %v", ok, err)
+	}
+
+	if err = dataBase.ScheduleDeletion(ctx, d); err != nil {
+		t.Fatalf("ошибка при отметке удаления: %v", err)
+	}
+	ok, err = dataBase.CancelDeletion(ctx, d.Username)
+	if err != nil || !ok {
+		t.Errorf("удаление не отменено: %v %v", ok, err)
+	}
+	found, err = dataBase.SearchDeletion(ctx, d.Username)
+	if found != nil || !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("отметка найдена после отмены: %v %v", found, err)
+	}
+}
+
+func TestStorage_AccountProfile(t *testing.T) {
+	ctx := context.Background()
+	// Установка соединения с базой данных MongoDB
+	dataBase, err := New("mongodb://localhost:27015/")
+	if err != nil {
+		t.Fatalf("не удалось подключиться к базе данных: %v", err)
+	}
+
+	const username = "profile@ya.ru"
+	if _, err = dataBase.DelAccount(ctx, storage.Account{Username: username}); err != nil {
+		t.Fatalf("ошибка при удалении аккаунта: %v", err)
+	}
+	if err = dataBase.CreateAccount(ctx, storage.Account{Username: username, Password: "hash", Status: storage.StatusPending}); err != nil {
+		t.Fatalf("ошибка при добавлении аккаунта: %v", err)
+	}
+	defer dataBase.DelAccount(ctx, storage.Account{Username: username})
+
+	// Незаданные поля заполняются при добавлении
+	c, err := dataBase.GetAccount(ctx, username)
+	if err != nil || c == nil {
+		t.Fatalf("аккаунт не найден: %v", err)
+	}
+	if c.ID == "" || c.Password != "hash" || c.Status != storage.StatusPending || c.EmailVerified ||
+		c.CreatedAt.IsZero() || !c.LastLoginAt.IsZero() {
+		t.Errorf("неверный новый аккаунт: %+v", c)
+	}
+	// Аккаунт находится и по ID
+	byID, err := dataBase.GetAccountByID(ctx, c.ID)
+	if err != nil || byID == nil || byID.Username != username || byID.Password != "hash" {
+		t.Errorf("аккаунт не найден по ID: %+v %v", byID, err)
+	}
+
+	ok, err := dataBase.SetDisplayName(ctx, username, "Иван")
+	if err != nil || !ok {
+		t.Errorf("имя не изменено: %v %v", ok, err)
+	}
+	// Подтверждение адреса делает ожидающий аккаунт активным
+	ok, err = dataBase.SetEmailVerified(ctx, username)
+	if err != nil || !ok {
+		t.Errorf("адрес не подтверждён: %v %v", ok, err)
+	}
+	login := time.Now().UTC().Truncate(time.Millisecond)
+	ok, err = dataBase.SetLastLogin(ctx, username, login)
+	if err != nil || !ok {
+		t.Errorf("время входа не сохранено: %v %v", ok, err)
+	}
+
+	found, err := dataBase.GetAccount(ctx, username)
+	if err != nil || found == nil {
+		t.Fatalf("аккаунт не найден: %v", err)
+	}
+	if found.ID != c.ID || found.DisplayName != "Иван" || found.Status != storage.StatusActive || !found.EmailVerified ||
+		!found.LastLoginAt.Equal(login) || found.UpdatedAt.Before(c.UpdatedAt) {
+		t.Errorf("неверный аккаунт после изменений: %+v", found)
+	}
+
+	// Статус, выставленный администратором, подтверждение адреса не меняет
+	ok, err = dataBase.SetAccountStatus(ctx, username, storage.StatusDisabled)
+	if err != nil || !ok {
+		t.Errorf("статус не изменён: %v %v", ok, err)
+	}
+	dataBase.SetEmailVerified(ctx, username)
+	if found, err = dataBase.GetAccount(ctx, username); err != nil || found == nil || found.Status != storage.StatusDisabled {
+		t.Errorf("неверный статус: %+v %v", found, err)
+	}
+
+	// Несуществующий аккаунт не создаётся изменением
+	ok, err = dataBase.SetDisplayName(ctx, "nobody@ya.ru", "Никто")
+	if err != nil || ok {
+		t.Errorf("изменён несуществующий аккаунт: %v %v", ok, err)
+	}
+	found, err = dataBase.GetAccount(ctx, "nobody@ya.ru")
+	if found != nil || !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("найден несуществующий аккаунт: %+v %v", found, err)
+	}
+	found, err = dataBase.GetAccountByID(ctx, "nobody")
+	if found != nil || !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("найден аккаунт с несуществующим ID: %+v %v", found, err)
+	}
+
+	// Удалённый аккаунт по ID не находится
+	if _, err = dataBase.DelAccount(ctx, storage.Account{Username: username}); err != nil {
+		t.Fatalf("ошибка при удалении аккаунта: %v", err)
+	}
+	found, err = dataBase.GetAccountByID(ctx, c.ID)
+	if found != nil || !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("найден удалённый аккаунт: %+v %v", found, err)
+	}
+}
+
+func TestStorage_MigrateAccounts(t *testing.T) {
+	ctx := context.Background()
+	// Установка соединения с базой данных MongoDB
+	dataBase, err := New("mongodb://localhost:27015/")
+	if err != nil {
+		t.Fatalf("не удалось подключиться к базе данных: %v", err)
+	}
+
+	// Аккаунт прежнего формата: только логин и хеш пароля
+	const legacy = "legacy@ya.ru"
+	dataBase.DelAccount(ctx, storage.Account{Username: legacy})
+	dataBase.DelEmailVerification(ctx, legacy)
+	collection := dataBase.db.Database(databaseName).Collection(collectionName)
+	_, err = collection.InsertOne(ctx, bson.D{{Key: "username", Value: legacy}, {Key: "password", Value: "hash"}})
+	if err != nil {
+		t.Fatalf("ошибка при добавлении аккаунта: %v", err)
+	}
+	defer dataBase.DelAccount(ctx, storage.Account{Username: legacy})
+
+	n, err := dataBase.MigrateAccounts(ctx)
+	if err != nil || n < 1 {
+		t.Fatalf("аккаунт не переведён: %v %v", n, err)
+	}
+	c, err := dataBase.GetAccount(ctx, legacy)
+	if err != nil || c == nil || c.ID == "" || c.Password != "hash" || c.Status != storage.StatusActive ||
+		!c.EmailVerified || c.CreatedAt.IsZero() {
+		t.Errorf("неверный аккаунт после перевода: %+v %v", c, err)
+	}
+
+	// Повторный запуск ничего не меняет
+	if n, err = dataBase.MigrateAccounts(ctx); err != nil || n != 0 {
+		t.Errorf("аккаунты переведены повторно: %v %v", n, err)
+	}
+}
+
+func TestStorage_Errors(t *testing.T) {
+	ctx := context.Background()
+	// Установка соединения с базой данных MongoDB
+	dataBase, err := New("mongodb://localhost:27015/")
+	if err != nil {
+		t.Fatalf("не удалось подключиться к базе данных: %v", err)
+	}
+
+	// Каждый поиск несуществующей записи возвращает ErrNotFound
+	const missing = "missing@ya.ru"
+	lookups := map[string]func() error{
+		"SearchAccount": func() error {
+			_, err := dataBase.SearchAccount(ctx, storage.Account{Username: missing})
+			return err
+		},
+		"GetAccount": func() error {
+			_, err := dataBase.GetAccount(ctx, missing)
+			return err
+		},
+		"SearchSession": func() error {
+			_, err := dataBase.SearchSession(ctx, missing)
+			return err
+		},
+		"SearchRefreshToken": func() error {
+			_, err := dataBase.SearchRefreshToken(ctx, missing)
+			return err
+		},
+		"SearchClient": func() error {
+			_, err := dataBase.SearchClient(ctx, missing)
+			return err
+		},
+		"UseAuthCode": func() error {
+			_, err := dataBase.UseAuthCode(ctx, missing)
+			return err
+		},
+		"SearchDeviceCode": func() error {
+			_, err := dataBase.SearchDeviceCode(ctx, missing)
+			return err
+		},
+		"SearchUserCode": func() error {
+			_, err := dataBase.SearchUserCode(ctx, missing)
+			return err
+		},
+		"SearchTOTP": func() error {
+			_, err := dataBase.SearchTOTP(ctx, missing)
+			return err
+		},
+		"SearchCredential": func() error {
+			_, err := dataBase.SearchCredential(ctx, missing)
+			return err
+		},
+		"SearchEmailVerification": func() error {
+			_, err := dataBase.SearchEmailVerification(ctx, missing)
+			return err
+		},
+		"UsePasswordReset": func() error {
+			_, err := dataBase.UsePasswordReset(ctx, missing)
+			return err
+		},
+		"SearchDeletion": func() error {
+			_, err := dataBase.SearchDeletion(ctx, missing)
+			return err
+		},
+	}
+	for name, lookup := range lookups {
+		if err = lookup(); !errors.Is(err, storage.ErrNotFound) {
+			t.Errorf("%s() = %v, ожидалась ErrNotFound", name, err)
+		}
+	}
+
+	// Отменённый запрос не доходит до базы
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err = dataBase.GetAccount(cancelled, missing); !errors.Is(err, storage.ErrUnavailable) {
+		t.Errorf("GetAccount() = %v, ожидалась ErrUnavailable", err)
+	}
+}
+
+func TestStorage_CreateAccountConcurrent(t *testing.T) {
+	ctx := context.Background()
+	// Установка соединения с базой данных MongoDB
+	dataBase, err := New("mongodb://localhost:27015/")
+	if err != nil {
+		t.Fatalf("не удалось подключиться к базе данных: %v", err)
+	}
+
+	const username = "race@ya.ru"
+	dataBase.DelAccount(ctx, storage.Account{Username: username})
+	defer dataBase.DelAccount(ctx, storage.Account{Username: username})
+
+	// Из одновременных попыток создать аккаунт с одним логином удаётся ровно одна
+	const n = 20
+	errs := make([]error, n)
+	var wg sync.WaitGroup
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = dataBase.CreateAccount(ctx, storage.Account{Username: username, Password: fmt.Sprint(i)})
+		}(i)
+	}
+	wg.Wait()
+
+	created := 0
+	for _, err := range errs {
+		switch {
+		case err == nil:
+			created++
+		case !errors.Is(err, storage.ErrAlreadyExists):
+			t.Errorf("ошибка при создании аккаунта: %v", err)
+		}
+	}
+	if created != 1 {
+		t.Errorf("создано аккаунтов: %d, ожидается 1", created)
+	}
+}
+
+func TestStorage_SigningKeys(t *testing.T) {
+	ctx := context.Background()
+	// Установка соединения с базой данных MongoDB
+	dataBase, err := New("mongodb://localhost:27015/")
+	if err != nil {
+		t.Fatalf("не удалось подключиться к базе данных: %v", err)
+	}
+
+	now := time.Now().UTC()
+	k := storage.SigningKey{
+		ID:         "test-kid",
+		Alg:        "ES256",
+		PrivateKey: "test-private-key",
+		CreatedAt:  now,
+		RetireAt:   now.Add(time.Hour),
+		ExpiresAt:  now.Add(2 * time.Hour),
+	}
+	if err = dataBase.AddSigningKey(ctx, k); err != nil {
+		t.Fatalf("ошибка при сохранении ключа: %v", err)
+	}
+
+	keys, err := dataBase.ListSigningKeys(ctx)
+	if err != nil {
+		t.Fatalf("ошибка при получении ключей: %v", err)
+	}
+	var found bool
+	for _, got := range keys {
+		if got.ID == k.ID {
+			found = got.Alg == k.Alg && got.PrivateKey == k.PrivateKey
+		}
+	}
+	if !found {
+		t.Errorf("ключ %s не найден среди %v", k.ID, keys)
+	}
+
+	deleted, err := dataBase.DelSigningKey(ctx, k.ID)
+	if err != nil {
+		t.Fatalf("ошибка при удалении ключа: %v", err)
+	}
+	if !deleted {
+		t.Error("ключ не удалён")
+	}
+}
+
+func TestStorage_Clients(t *testing.T) {
+	ctx := context.Background()
+	// Установка соединения с базой данных MongoDB
+	dataBase, err := New("mongodb://localhost:27015/")
+	if err != nil {
+		t.Fatalf("не удалось подключиться к базе данных: %v", err)
+	}
+
+	c := storage.Client{
+		ID:           "test-client",
+		Name:         "Тестовый клиент",
+		RedirectURIs: []string{"http://localhost:3000/callback"},
+		Scopes:       []string{"openid"},
+		GrantTypes:   []string{"authorization_code", "client_credentials"},
+		SecretHash:   "test-secret-hash",
+		CreatedAt:    time.Now().UTC(),
+	}
+	if err = dataBase.AddClient(ctx, c); err != nil {
+		t.Fatalf("ошибка при сохранении клиента: %v", err)
+	}
+	// Повторное сохранение заменяет клиента
+	c.Scopes = append(c.Scopes, "profile")
+	if err = dataBase.AddClient(ctx, c); err != nil {
+		t.Fatalf("ошибка при замене клиента: %v", err)
+	}
+
+	found, err := dataBase.SearchClient(ctx, c.ID)
+	if err != nil {
+		t.Fatalf("ошибка при поиске клиента: %v", err)
+	}
+	if found == nil || len(found.Scopes) != 2 || found.RedirectURIs[0] != c.RedirectURIs[0] ||
+		len(found.GrantTypes) != 2 || found.SecretHash != c.SecretHash {
+		t.Errorf("неправильный клиент: %v", found)
+	}
+
+	deleted, err := dataBase.DelClient(ctx, c.ID)
+	if err != nil {
+		t.Fatalf("ошибка при удалении клиента: %v", err)
+	}
+	if !deleted {
+		t.Error("клиент не удалён")
+	}
+	found, err = dataBase.SearchClient(ctx, c.ID)
+	if err != nil && !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("ошибка при поиске клиента: %v", err)
+	}
+	if found != nil {
+		t.Errorf("удалённый клиент найден: %v", found)
+	}
+}
+
+func TestStorage_AuthCodes(t *testing.T) {
+	ctx := context.Background()
+	// Установка соединения с базой данных MongoDB
+	dataBase, err := New("mongodb://localhost:27015/")
+	if err != nil {
+		t.Fatalf("не удалось подключиться к базе данных: %v", err)
+	}
+
+	now := time.Now().UTC()
+	c := storage.AuthCode{
+		ID:                  "test-code-id",
+		ClientID:            "test-client",
+		Username:            "krex@ya.ru",
+		RedirectURI:         "http://localhost:3000/callback",
+		CodeChallenge:       "test-challenge",
+		CodeChallengeMethod: "S256",
+		CreatedAt:           now,
+		ExpiresAt:           now.Add(time.Minute),
+	}
+	if err = dataBase.AddAuthCode(ctx, c); err != nil {
+		t.Fatalf("ошибка при сохранении кода: %v", err)
+	}
+
+	// Код обменивается только один раз
+	found, err := dataBase.UseAuthCode(ctx, c.ID)
+	if err != nil {
+		t.Fatalf("ошибка при использовании кода: %v", err)
+	}
+	if found == nil || found.Username != c.Username || found.CodeChallenge != c.CodeChallenge {
+		t.Errorf("неправильный код: %v", found)
+	}
+	found, err = dataBase.UseAuthCode(ctx, c.ID)
+	if err != nil && !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("ошибка при использовании кода: %v", err)
+	}
+	if found != nil {
+		t.Error("повторное использование кода не отклонено")
+	}
+}
+
+func TestStorage_DeviceCodes(t *testing.T) {
+	ctx := context.Background()
+	// Установка соединения с базой данных MongoDB
+	dataBase, err := New("mongodb://localhost:27015/")
+	if err != nil {
+		t.Fatalf("не удалось подключиться к базе данных: %v", err)
+	}
+
+	now := time.Now().UTC()
+	d := storage.DeviceCode{
+		ID:        "test-device-id",
+		UserCode:  "BCDFGHJK",
+		ClientID:  "test-cli",
+		Status:    storage.DevicePending,
+		CreatedAt: now,
+		ExpiresAt: now.Add(10 * time.Minute),
+	}
+	if err = dataBase.AddDeviceCode(ctx, d); err != nil {
+		t.Fatalf("ошибка при сохранении запроса: %v", err)
+	}
+	// Код пользователя не может принадлежать двум запросам
+	other := d
+	other.ID = "test-device-other"
+	if err = dataBase.AddDeviceCode(ctx, other); err != storage.ErrUserCodeTaken {
+		t.Errorf("ожидается ErrUserCodeTaken, получено %v", err)
+	}
+
+	// Первый опрос без предыдущего времени, второй возвращает время первого
+	prev, err := dataBase.PollDeviceCode(ctx, d.ID, now)
+	if err != nil {
+		t.Fatalf("ошибка при опросе: %v", err)
+	}
+	if !prev.IsZero() {
+		t.Errorf("при первом опросе получено время %v", prev)
+	}
+	prev, err = dataBase.PollDeviceCode(ctx, d.ID, now.Add(5*time.Second))
+	if err != nil {
+		t.Fatalf("ошибка при опросе: %v", err)
+	}
+	// Базы хранят время с разной точностью
+	if prev.Sub(now).Abs() > time.Millisecond {
+		t.Errorf("неправильное время предыдущего опроса: %v", prev)
+	}
+
+	// Решение принимается один раз
+	ok, err := dataBase.ApproveDeviceCode(ctx, d.UserCode, "krex@ya.ru", true)
+	if err != nil {
+		t.Fatalf("ошибка при подтверждении: %v", err)
+	}
+	if !ok {
+		t.Error("подтверждение отклонено")
+	}
+	ok, err = dataBase.ApproveDeviceCode(ctx, d.UserCode, "ups@mail.ru", false)
+	if err != nil {
+		t.Fatalf("ошибка при подтверждении: %v", err)
+	}
+	if ok {
+		t.Error("повторное решение не отклонено")
+	}
+
+	found, err := dataBase.SearchUserCode(ctx, d.UserCode)
+	if err != nil {
+		t.Fatalf("ошибка при поиске запроса: %v", err)
+	}
+	if found == nil || found.Status != storage.DeviceApproved || found.Username != "krex@ya.ru" {
+		t.Errorf("неправильный запрос: %v", found)
+	}
+
+	// Удаление удаётся только один раз
+	deleted, err := dataBase.DelDeviceCode(ctx, d.ID)
+	if err != nil {
+		t.Fatalf("ошибка при удалении запроса: %v", err)
+	}
+	if !deleted {
+		t.Error("запрос не удалён")
+	}
+	deleted, err = dataBase.DelDeviceCode(ctx, d.ID)
+	if err != nil {
+		t.Fatalf("ошибка при удалении запроса: %v", err)
+	}
+	if deleted {
+		t.Error("запрос удалён повторно")
+	}
+}
@@ -0,0 +1,89 @@
+package mongoDB
+
+import (
+	Interface "authorization/pkg/storage"
+	"context"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"time"
+)
+
+const (
+	clientsCollection   = "oauth_clients" // коллекция клиентов OAuth
+	authCodesCollection = "auth_codes"    // коллекция кодов авторизации
+)
+
+// createOAuthIndexes Создает индексы коллекции кодов авторизации.
+func (m *Storage) createOAuthIndexes(ctx context.Context) error {
+	collection := m.db.Database(databaseName).Collection(authCodesCollection)
+
+	_, err := collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "expiresAt", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	})
+	return err
+}
+
+// AddClient Добавляет или заменяет клиента OAuth в базе MongoDB
+func (m *Storage) AddClient(ctx context.Context, c Interface.Client) error {
+	collection := m.db.Database(databaseName).Collection(clientsCollection)
+
+	_, err := collection.ReplaceOne(ctx, bson.D{{Key: "_id", Value: c.ID}}, c,
+		options.Replace().SetUpsert(true))
+	if err != nil {
+		return wrap(err)
+	}
+	return nil
+}
+
+// SearchClient Находит клиента OAuth в базе MongoDB
+func (m *Storage) SearchClient(ctx context.Context, id string) (*Interface.Client, error) {
+	collection := m.db.Database(databaseName).Collection(clientsCollection)
+
+	var result Interface.Client
+	err := collection.FindOne(ctx, bson.D{{Key: "_id", Value: id}}).Decode(&result)
+	if err != nil {
+		return nil, wrap(err)
+	}
+	return &result, nil
+}
+
+// DelClient Удаляет клиента OAuth в базе MongoDB
+func (m *Storage) DelClient(ctx context.Context, id string) (bool, error) {
+	collection := m.db.Database(databaseName).Collection(clientsCollection)
+
+	result, err := collection.DeleteOne(ctx, bson.D{{Key: "_id", Value: id}})
+	if err != nil {
+		return false, wrap(err)
+	}
+	return result.DeletedCount > 0, nil
+}
+
+// AddAuthCode Добавляет код авторизации в базу MongoDB
+func (m *Storage) AddAuthCode(ctx context.Context, c Interface.AuthCode) error {
+	collection := m.db.Database(databaseName).Collection(authCodesCollection)
+	_, err := collection.InsertOne(ctx, c)
+	if err != nil {
+		return wrap(err)
+	}
+	return nil
+}
+
+// UseAuthCode Атомарно забирает действующий код авторизации из базы MongoDB
+func (m *Storage) UseAuthCode(ctx context.Context, id string) (*Interface.AuthCode, error) {
+	collection := m.db.Database(databaseName).Collection(authCodesCollection)
+
+	// TTL-индекс удаляет истекшие коды с задержкой, поэтому срок проверяется в фильтре
+	filter := bson.D{
+		{Key: "_id", Value: id},
+		{Key: "expiresAt", Value: bson.D{{Key: "$gt", Value: time.Now()}}},
+	}
+
+	var result Interface.AuthCode
+	err := collection.FindOneAndDelete(ctx, filter).Decode(&result)
+	if err != nil {
+		return nil, wrap(err)
+	}
+	return &result, nil
+}
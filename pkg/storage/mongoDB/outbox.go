@@ -0,0 +1,85 @@
+package mongoDB
+
+import (
+	Interface "authorization/pkg/storage"
+	"context"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"time"
+)
+
+const outboxCollection = "mail_outbox" // коллекция исходящих писем
+
+// createOutboxIndexes Создает индексы коллекции исходящих писем.
+func (m *Storage) createOutboxIndexes(ctx context.Context) error {
+	collection := m.db.Database(databaseName).Collection(outboxCollection)
+
+	_, err := collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "nextAttempt", Value: 1}},
+	})
+	return err
+}
+
+// AddOutboxMessage Ставит письмо в очередь в базе MongoDB
+func (m *Storage) AddOutboxMessage(ctx context.Context, c Interface.OutboxMessage) error {
+	collection := m.db.Database(databaseName).Collection(outboxCollection)
+	_, err := collection.InsertOne(ctx, c)
+	if err != nil {
+		return wrap(err)
+	}
+	return nil
+}
+
+// ClaimOutboxMessages Забирает письма, время отправки которых наступило, из базы MongoDB
+func (m *Storage) ClaimOutboxMessages(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]Interface.OutboxMessage, error) {
+	collection := m.db.Database(databaseName).Collection(outboxCollection)
+
+	filter := bson.D{{Key: "nextAttempt", Value: bson.D{{Key: "$lte", Value: now}}}}
+	update := bson.D{{Key: "$set", Value: bson.D{{Key: "nextAttempt", Value: now.Add(lease)}}}}
+	opts := options.FindOneAndUpdate().
+		SetSort(bson.D{{Key: "nextAttempt", Value: 1}}).
+		SetReturnDocument(options.After)
+
+	// Каждое письмо забирается отдельной атомарной операцией
+	var list []Interface.OutboxMessage
+	for len(list) < limit {
+		var result Interface.OutboxMessage
+		err := collection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&result)
+		if err != nil {
+			if err == mongo.ErrNoDocuments {
+				break
+			}
+			return list, wrap(err)
+		}
+		list = append(list, result)
+	}
+	return list, nil
+}
+
+// RetryOutboxMessage Сохраняет неудачную попытку отправки письма в базе MongoDB
+func (m *Storage) RetryOutboxMessage(ctx context.Context, id string, attempts int, next time.Time, lastError string) error {
+	collection := m.db.Database(databaseName).Collection(outboxCollection)
+
+	update := bson.D{{Key: "$set", Value: bson.D{
+		{Key: "attempts", Value: attempts},
+		{Key: "nextAttempt", Value: next},
+		{Key: "lastError", Value: lastError},
+	}}}
+	_, err := collection.UpdateOne(ctx, bson.D{{Key: "_id", Value: id}}, update)
+	if err != nil {
+		return wrap(err)
+	}
+	return nil
+}
+
+// DelOutboxMessage Удаляет письмо из очереди в базе MongoDB
+func (m *Storage) DelOutboxMessage(ctx context.Context, id string) (bool, error) {
+	collection := m.db.Database(databaseName).Collection(outboxCollection)
+
+	result, err := collection.DeleteOne(ctx, bson.D{{Key: "_id", Value: id}})
+	if err != nil {
+		return false, wrap(err)
+	}
+	return result.DeletedCount > 0, nil
+}
@@ -0,0 +1,66 @@
+package mongoDB
+
+import (
+	Interface "authorization/pkg/storage"
+	"context"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"time"
+)
+
+const resetsCollection = "password_resets" // коллекция токенов сброса пароля
+
+// createResetIndexes Создает индексы коллекции токенов сброса пароля.
+// TTL-индекс по expiresAt позволяет MongoDB самой удалять истекшие токены.
+func (m *Storage) createResetIndexes(ctx context.Context) error {
+	collection := m.db.Database(databaseName).Collection(resetsCollection)
+
+	_, err := collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "expiresAt", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(0),
+		},
+		{
+			Keys: bson.D{{Key: "username", Value: 1}},
+		},
+	})
+	return err
+}
+
+// AddPasswordReset Добавляет токен сброса пароля в базу MongoDB
+func (m *Storage) AddPasswordReset(ctx context.Context, c Interface.PasswordReset) error {
+	collection := m.db.Database(databaseName).Collection(resetsCollection)
+	_, err := collection.InsertOne(ctx, c)
+	if err != nil {
+		return wrap(err)
+	}
+	return nil
+}
+
+// UsePasswordReset Атомарно забирает действующий токен сброса пароля из базы MongoDB
+func (m *Storage) UsePasswordReset(ctx context.Context, id string) (*Interface.PasswordReset, error) {
+	collection := m.db.Database(databaseName).Collection(resetsCollection)
+
+	filter := bson.D{
+		{Key: "_id", Value: id},
+		{Key: "expiresAt", Value: bson.D{{Key: "$gt", Value: time.Now()}}},
+	}
+	var result Interface.PasswordReset
+	err := collection.FindOneAndDelete(ctx, filter).Decode(&result)
+	if err != nil {
+		return nil, wrap(err)
+	}
+	return &result, nil
+}
+
+// DelUserPasswordResets Удаляет все токены сброса пароля пользователя в базе MongoDB
+func (m *Storage) DelUserPasswordResets(ctx context.Context, username string) (int64, error) {
+	collection := m.db.Database(databaseName).Collection(resetsCollection)
+
+	result, err := collection.DeleteMany(ctx, bson.D{{Key: "username", Value: username}})
+	if err != nil {
+		return 0, wrap(err)
+	}
+	return result.DeletedCount, nil
+}
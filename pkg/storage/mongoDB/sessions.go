@@ -0,0 +1,110 @@
+package mongoDB
+
+import (
+	Interface "authorization/pkg/storage"
+	"context"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"time"
+)
+
+const sessionsCollection = "sessions" // коллекция сессий
+
+// createSessionIndexes Создает индексы коллекции сессий.
+// TTL-индекс по expiresAt позволяет MongoDB самой удалять истекшие сессии.
+func (m *Storage) createSessionIndexes(ctx context.Context) error {
+	collection := m.db.Database(databaseName).Collection(sessionsCollection)
+
+	_, err := collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "expiresAt", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(0),
+		},
+		{
+			Keys: bson.D{{Key: "username", Value: 1}},
+		},
+	})
+	return err
+}
+
+// AddSession Добавляет сессию в базу MongoDB
+func (m *Storage) AddSession(ctx context.Context, c Interface.Session) error {
+	collection := m.db.Database(databaseName).Collection(sessionsCollection)
+	_, err := collection.InsertOne(ctx, c)
+	if err != nil {
+		return wrap(err)
+	}
+	return nil
+}
+
+// SearchSession Находит действующую сессию по идентификатору в базе MongoDB
+func (m *Storage) SearchSession(ctx context.Context, id string) (*Interface.Session, error) {
+	collection := m.db.Database(databaseName).Collection(sessionsCollection)
+
+	// TTL-монитор удаляет документы с задержкой, поэтому проверяем срок и здесь
+	filter := bson.D{
+		{Key: "_id", Value: id},
+		{Key: "expiresAt", Value: bson.D{{Key: "$gt", Value: time.Now()}}},
+	}
+
+	var result Interface.Session
+	err := collection.FindOne(ctx, filter).Decode(&result)
+	if err != nil {
+		return nil, wrap(err)
+	}
+	return &result, nil
+}
+
+// DelSession Удаляет сессию в базе MongoDB
+func (m *Storage) DelSession(ctx context.Context, id string) (bool, error) {
+	collection := m.db.Database(databaseName).Collection(sessionsCollection)
+
+	result, err := collection.DeleteOne(ctx, bson.D{{Key: "_id", Value: id}})
+	if err != nil {
+		return false, wrap(err)
+	}
+	return result.DeletedCount > 0, nil
+}
+
+// DelUserSessions Удаляет все сессии пользователя в базе MongoDB
+func (m *Storage) DelUserSessions(ctx context.Context, username string) (int64, error) {
+	collection := m.db.Database(databaseName).Collection(sessionsCollection)
+
+	result, err := collection.DeleteMany(ctx, bson.D{{Key: "username", Value: username}})
+	if err != nil {
+		return 0, wrap(err)
+	}
+	return result.DeletedCount, nil
+}
+
+// ListSessions Возвращает действующие сессии пользователя в базе MongoDB
+func (m *Storage) ListSessions(ctx context.Context, username string) ([]Interface.Session, error) {
+	collection := m.db.Database(databaseName).Collection(sessionsCollection)
+
+	filter := bson.D{
+		{Key: "username", Value: username},
+		{Key: "expiresAt", Value: bson.D{{Key: "$gt", Value: time.Now()}}},
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "createdAt", Value: 1}})
+
+	cursor, err := collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, wrap(err)
+	}
+
+	var sessions []Interface.Session
+	if err = cursor.All(ctx, &sessions); err != nil {
+		return nil, wrap(err)
+	}
+	return sessions, nil
+}
+
+// TouchSession Обновляет время последней активности сессии в базе MongoDB
+func (m *Storage) TouchSession(ctx context.Context, id string, t time.Time) error {
+	collection := m.db.Database(databaseName).Collection(sessionsCollection)
+
+	update := bson.D{{Key: "$set", Value: bson.D{{Key: "lastSeen", Value: t}}}}
+	_, err := collection.UpdateByID(ctx, id, update)
+	return wrap(err)
+}
@@ -0,0 +1,191 @@
+package mongoDB
+
+import (
+	Interface "authorization/pkg/storage"
+	"context"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"time"
+)
+
+const (
+	refreshTokensCollection = "refresh_tokens" // коллекция токенов обновления
+	revokedTokensCollection = "revoked_tokens" // коллекция отозванных токенов доступа
+	accessTokensCollection  = "access_tokens"  // коллекция выданных пользователям токенов доступа
+)
+
+// createTokenIndexes Создает индексы коллекций токенов обновления и отозванных токенов.
+func (m *Storage) createTokenIndexes(ctx context.Context) error {
+	collection := m.db.Database(databaseName).Collection(refreshTokensCollection)
+
+	_, err := collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "expiresAt", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(0),
+		},
+		{
+			Keys: bson.D{{Key: "familyId", Value: 1}},
+		},
+		{
+			Keys: bson.D{{Key: "username", Value: 1}},
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	revoked := m.db.Database(databaseName).Collection(revokedTokensCollection)
+	_, err = revoked.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "expiresAt", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	})
+	if err != nil {
+		return err
+	}
+
+	access := m.db.Database(databaseName).Collection(accessTokensCollection)
+	_, err = access.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "expiresAt", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(0),
+		},
+		{
+			Keys: bson.D{{Key: "username", Value: 1}},
+		},
+	})
+	return err
+}
+
+// AddRefreshToken Добавляет токен обновления в базу MongoDB
+func (m *Storage) AddRefreshToken(ctx context.Context, c Interface.RefreshToken) error {
+	collection := m.db.Database(databaseName).Collection(refreshTokensCollection)
+	_, err := collection.InsertOne(ctx, c)
+	if err != nil {
+		return wrap(err)
+	}
+	return nil
+}
+
+// SearchRefreshToken Находит действующий токен обновления в базе MongoDB
+func (m *Storage) SearchRefreshToken(ctx context.Context, id string) (*Interface.RefreshToken, error) {
+	collection := m.db.Database(databaseName).Collection(refreshTokensCollection)
+
+	filter := bson.D{
+		{Key: "_id", Value: id},
+		{Key: "expiresAt", Value: bson.D{{Key: "$gt", Value: time.Now()}}},
+	}
+
+	var result Interface.RefreshToken
+	err := collection.FindOne(ctx, filter).Decode(&result)
+	if err != nil {
+		return nil, wrap(err)
+	}
+	return &result, nil
+}
+
+// UseRefreshToken Атомарно помечает токен обновления использованным в базе MongoDB
+func (m *Storage) UseRefreshToken(ctx context.Context, id string) (bool, error) {
+	collection := m.db.Database(databaseName).Collection(refreshTokensCollection)
+
+	filter := bson.D{
+		{Key: "_id", Value: id},
+		{Key: "used", Value: false},
+		{Key: "expiresAt", Value: bson.D{{Key: "$gt", Value: time.Now()}}},
+	}
+	update := bson.D{{Key: "$set", Value: bson.D{{Key: "used", Value: true}}}}
+
+	result, err := collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return false, wrap(err)
+	}
+	return result.ModifiedCount == 1, nil
+}
+
+// DelRefreshFamily Удаляет все токены семейства в базе MongoDB
+func (m *Storage) DelRefreshFamily(ctx context.Context, familyID string) (int64, error) {
+	collection := m.db.Database(databaseName).Collection(refreshTokensCollection)
+
+	result, err := collection.DeleteMany(ctx, bson.D{{Key: "familyId", Value: familyID}})
+	if err != nil {
+		return 0, wrap(err)
+	}
+	return result.DeletedCount, nil
+}
+
+// DelUserRefreshTokens Удаляет все токены обновления пользователя в базе MongoDB
+func (m *Storage) DelUserRefreshTokens(ctx context.Context, username string) (int64, error) {
+	collection := m.db.Database(databaseName).Collection(refreshTokensCollection)
+
+	result, err := collection.DeleteMany(ctx, bson.D{{Key: "username", Value: username}})
+	if err != nil {
+		return 0, wrap(err)
+	}
+	return result.DeletedCount, nil
+}
+
+// RevokeAccessToken Отмечает токен доступа отозванным в базе MongoDB до истечения его срока
+func (m *Storage) RevokeAccessToken(ctx context.Context, jti string, expiresAt time.Time) error {
+	collection := m.db.Database(databaseName).Collection(revokedTokensCollection)
+
+	_, err := collection.UpdateOne(ctx,
+		bson.D{{Key: "_id", Value: jti}},
+		bson.D{{Key: "$set", Value: bson.D{{Key: "expiresAt", Value: expiresAt}}}},
+		options.Update().SetUpsert(true))
+	return wrap(err)
+}
+
+// AccessTokenRevoked Проверяет отметку об отзыве токена доступа в базе MongoDB
+func (m *Storage) AccessTokenRevoked(ctx context.Context, jti string) (bool, error) {
+	collection := m.db.Database(databaseName).Collection(revokedTokensCollection)
+
+	n, err := collection.CountDocuments(ctx, bson.D{{Key: "_id", Value: jti}})
+	if err != nil {
+		return false, wrap(err)
+	}
+	return n > 0, nil
+}
+
+// accessToken Выданный пользователю токен доступа.
+type accessToken struct {
+	ID        string    `bson:"_id"`
+	Username  string    `bson:"username"`
+	ExpiresAt time.Time `bson:"expiresAt"`
+}
+
+// AddAccessToken Запоминает токен доступа пользователя в базе MongoDB до истечения его срока
+func (m *Storage) AddAccessToken(ctx context.Context, username, jti string, expiresAt time.Time) error {
+	collection := m.db.Database(databaseName).Collection(accessTokensCollection)
+	_, err := collection.InsertOne(ctx, accessToken{ID: jti, Username: username, ExpiresAt: expiresAt})
+	return wrap(err)
+}
+
+// RevokeUserAccessTokens Отмечает отозванными все действующие токены доступа пользователя в базе MongoDB
+func (m *Storage) RevokeUserAccessTokens(ctx context.Context, username string) (int64, error) {
+	collection := m.db.Database(databaseName).Collection(accessTokensCollection)
+
+	filter := bson.D{
+		{Key: "username", Value: username},
+		{Key: "expiresAt", Value: bson.D{{Key: "$gt", Value: time.Now().UTC()}}},
+	}
+	cursor, err := collection.Find(ctx, filter)
+	if err != nil {
+		return 0, wrap(err)
+	}
+	var tokens []accessToken
+	if err = cursor.All(ctx, &tokens); err != nil {
+		return 0, wrap(err)
+	}
+
+	var n int64
+	for _, t := range tokens {
+		if err = m.RevokeAccessToken(ctx, t.ID, t.ExpiresAt); err != nil {
+			return n, err
+		}
+		if _, err = collection.DeleteOne(ctx, bson.D{{Key: "_id", Value: t.ID}}); err != nil {
+			return n, wrap(err)
+		}
+		n++
+	}
+	return n, nil
+}
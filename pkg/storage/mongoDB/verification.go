@@ -0,0 +1,45 @@
+package mongoDB
+
+import (
+	Interface "authorization/pkg/storage"
+	"context"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const verificationsCollection = "email_verifications" // коллекция подтверждений адресов электронной почты
+
+// SetEmailVerification Заменяет подтверждение адреса пользователя в базе MongoDB
+func (m *Storage) SetEmailVerification(ctx context.Context, v Interface.EmailVerification) error {
+	collection := m.db.Database(databaseName).Collection(verificationsCollection)
+
+	_, err := collection.ReplaceOne(ctx, bson.D{{Key: "_id", Value: v.Username}}, v,
+		options.Replace().SetUpsert(true))
+	if err != nil {
+		return wrap(err)
+	}
+	return nil
+}
+
+// SearchEmailVerification Находит подтверждение адреса пользователя в базе MongoDB
+func (m *Storage) SearchEmailVerification(ctx context.Context, username string) (*Interface.EmailVerification, error) {
+	collection := m.db.Database(databaseName).Collection(verificationsCollection)
+
+	var result Interface.EmailVerification
+	err := collection.FindOne(ctx, bson.D{{Key: "_id", Value: username}}).Decode(&result)
+	if err != nil {
+		return nil, wrap(err)
+	}
+	return &result, nil
+}
+
+// DelEmailVerification Удаляет подтверждение адреса пользователя в базе MongoDB
+func (m *Storage) DelEmailVerification(ctx context.Context, username string) (bool, error) {
+	collection := m.db.Database(databaseName).Collection(verificationsCollection)
+
+	result, err := collection.DeleteOne(ctx, bson.D{{Key: "_id", Value: username}})
+	if err != nil {
+		return false, wrap(err)
+	}
+	return result.DeletedCount > 0, nil
+}
@@ -0,0 +1,106 @@
+package mongoDB
+
+import (
+	Interface "authorization/pkg/storage"
+	"context"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"time"
+)
+
+const credentialsCollection = "webauthn_credentials" // коллекция ключей доступа WebAuthn
+
+// createCredentialIndexes Создает индексы коллекции ключей доступа.
+func (m *Storage) createCredentialIndexes(ctx context.Context) error {
+	collection := m.db.Database(databaseName).Collection(credentialsCollection)
+
+	_, err := collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "username", Value: 1}},
+	})
+	return err
+}
+
+// AddCredential Добавляет ключ доступа в базу MongoDB
+func (m *Storage) AddCredential(ctx context.Context, c Interface.WebAuthnCredential) error {
+	collection := m.db.Database(databaseName).Collection(credentialsCollection)
+	_, err := collection.InsertOne(ctx, c)
+	if err != nil {
+		return wrap(err)
+	}
+	return nil
+}
+
+// SearchCredential Находит ключ доступа в базе MongoDB
+func (m *Storage) SearchCredential(ctx context.Context, id string) (*Interface.WebAuthnCredential, error) {
+	collection := m.db.Database(databaseName).Collection(credentialsCollection)
+
+	var result Interface.WebAuthnCredential
+	err := collection.FindOne(ctx, bson.D{{Key: "_id", Value: id}}).Decode(&result)
+	if err != nil {
+		return nil, wrap(err)
+	}
+	return &result, nil
+}
+
+// ListCredentials Возвращает ключи доступа пользователя в базе MongoDB
+func (m *Storage) ListCredentials(ctx context.Context, username string) ([]Interface.WebAuthnCredential, error) {
+	collection := m.db.Database(databaseName).Collection(credentialsCollection)
+
+	opts := options.Find().SetSort(bson.D{{Key: "createdAt", Value: 1}})
+	cursor, err := collection.Find(ctx, bson.D{{Key: "username", Value: username}}, opts)
+	if err != nil {
+		return nil, wrap(err)
+	}
+
+	var list []Interface.WebAuthnCredential
+	if err = cursor.All(ctx, &list); err != nil {
+		return nil, wrap(err)
+	}
+	return list, nil
+}
+
+// UseCredential Атомарно обновляет счётчик подписей ключа доступа в базе MongoDB
+func (m *Storage) UseCredential(ctx context.Context, id string, prev, signCount int64, t time.Time) (bool, error) {
+	collection := m.db.Database(databaseName).Collection(credentialsCollection)
+
+	filter := bson.D{
+		{Key: "_id", Value: id},
+		{Key: "signCount", Value: prev},
+	}
+	update := bson.D{{Key: "$set", Value: bson.D{
+		{Key: "signCount", Value: signCount},
+		{Key: "lastUsed", Value: t},
+	}}}
+
+	result, err := collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return false, wrap(err)
+	}
+	return result.MatchedCount == 1, nil
+}
+
+// DelCredential Удаляет ключ доступа пользователя в базе MongoDB
+func (m *Storage) DelCredential(ctx context.Context, username, id string) (bool, error) {
+	collection := m.db.Database(databaseName).Collection(credentialsCollection)
+
+	result, err := collection.DeleteOne(ctx, bson.D{
+		{Key: "_id", Value: id},
+		{Key: "username", Value: username},
+	})
+	if err != nil {
+		return false, wrap(err)
+	}
+	return result.DeletedCount > 0, nil
+}
+
+// DelUserCredentials Удаляет все ключи доступа пользователя в базе MongoDB
+func (m *Storage) DelUserCredentials(ctx context.Context, username string) (int64, error) {
+	collection := m.db.Database(databaseName).Collection(credentialsCollection)
+
+	result, err := collection.DeleteMany(ctx, bson.D{{Key: "username", Value: username}})
+	if err != nil {
+		return 0, wrap(err)
+	}
+	return result.DeletedCount, nil
+}
@@ -0,0 +1,95 @@
+package postgres
+
+import (
+	Interface "authorization/pkg/storage"
+	"context"
+	"time"
+)
+
+// ScheduleDeletion Отмечает аккаунт ожидающим удаления в базе Postgres
+func (s *Store) ScheduleDeletion(ctx context.Context, d Interface.AccountDeletion) error {
+	_, err := s.db.Exec(ctx,
+		`INSERT INTO account_deletions(username, requested_at, purge_at)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (username) DO UPDATE SET requested_at = $2, purge_at = $3;`,
+		d.Username, d.RequestedAt, d.PurgeAt)
+	if err != nil {
+		return wrap(err)
+	}
+
+	return nil
+}
+
+// SearchDeletion Находит отметку об удалении аккаунта в базе Postgres
+func (s *Store) SearchDeletion(ctx context.Context, username string) (*Interface.AccountDeletion, error) {
+	query := "SELECT username, requested_at, purge_at FROM account_deletions WHERE username = $1"
+
+	var d Interface.AccountDeletion
+	err := s.db.QueryRow(ctx, query, username).Scan(&d.Username, &d.RequestedAt, &d.PurgeAt)
+	if err != nil {
+		return nil, wrap(err)
+	}
+
+	return &d, nil
+}
+
+// CancelDeletion Снимает отметку об удалении аккаунта в базе Postgres
+func (s *Store) CancelDeletion(ctx context.Context, username string) (bool, error) {
+	tag, err := s.db.Exec(ctx, "DELETE FROM account_deletions WHERE username = $1", username)
+	if err != nil {
+		return false, wrap(err)
+	}
+
+	return tag.RowsAffected() == 1, nil
+}
+
+// DueDeletions Находит аккаунты, срок восстановления которых истёк, в базе Postgres
+func (s *Store) DueDeletions(ctx context.Context, now time.Time, limit int) ([]Interface.AccountDeletion, error) {
+	query := `SELECT username, requested_at, purge_at FROM account_deletions
+		WHERE purge_at <= $1 ORDER BY purge_at LIMIT $2`
+
+	rows, err := s.db.Query(ctx, query, now, limit)
+	if err != nil {
+		return nil, wrap(err)
+	}
+	defer rows.Close()
+
+	var list []Interface.AccountDeletion
+	for rows.Next() {
+		var d Interface.AccountDeletion
+		if err = rows.Scan(&d.Username, &d.RequestedAt, &d.PurgeAt); err != nil {
+			return nil, wrap(err)
+		}
+		list = append(list, d)
+	}
+
+	return list, wrap(rows.Err())
+}
+
+// ClaimDeletion Снимает отметку об удалении аккаунта с истёкшим сроком в базе Postgres
+func (s *Store) ClaimDeletion(ctx context.Context, username string, now time.Time) (bool, error) {
+	tag, err := s.db.Exec(ctx,
+		"DELETE FROM account_deletions WHERE username = $1 AND purge_at <= $2", username, now)
+	if err != nil {
+		return false, wrap(err)
+	}
+
+	return tag.RowsAffected() == 1, nil
+}
+
+// CreateDeletionsTable Создает таблицу account_deletions
+func (s *Store) CreateDeletionsTable() error {
+	qwery := `CREATE TABLE IF NOT EXISTS "account_deletions" (
+    username TEXT PRIMARY KEY,
+    requested_at TIMESTAMPTZ NOT NULL,
+    purge_at TIMESTAMPTZ NOT NULL
+);
+CREATE INDEX IF NOT EXISTS account_deletions_purge_at_idx ON account_deletions (purge_at);`
+
+	_, err := s.db.Exec(context.Background(), qwery)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
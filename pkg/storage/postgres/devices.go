@@ -0,0 +1,132 @@
+package postgres
+
+import (
+	Interface "authorization/pkg/storage"
+	"context"
+	"errors"
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+	"time"
+)
+
+// deviceColumns Столбцы таблицы device_codes в порядке полей Interface.DeviceCode
+const deviceColumns = "id, user_code, client_id, scope, username, status, created_at, expires_at"
+
+// scanDeviceCode Читает запрос авторизации устройства из строки результата
+func scanDeviceCode(row pgx.Row) (*Interface.DeviceCode, error) {
+	var d Interface.DeviceCode
+	err := row.Scan(&d.ID, &d.UserCode, &d.ClientID, &d.Scope, &d.Username, &d.Status, &d.CreatedAt, &d.ExpiresAt)
+	if err != nil {
+		return nil, wrap(err)
+	}
+	return &d, nil
+}
+
+// AddDeviceCode Добавляет запрос авторизации устройства в базу Postgres
+func (s *Store) AddDeviceCode(ctx context.Context, d Interface.DeviceCode) error {
+	// Попутно удаляем истекшие запросы, освобождая их коды пользователя
+	_, err := s.db.Exec(ctx, "DELETE FROM device_codes WHERE expires_at < now();")
+	if err != nil {
+		return wrap(err)
+	}
+
+	_, err = s.db.Exec(ctx,
+		`INSERT INTO device_codes(`+deviceColumns+`)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8);`,
+		d.ID, d.UserCode, d.ClientID, d.Scope, d.Username, d.Status, d.CreatedAt, d.ExpiresAt)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" && pgErr.ConstraintName == "device_codes_user_code_key" {
+			return Interface.ErrUserCodeTaken
+		}
+		return wrap(err)
+	}
+
+	return nil
+}
+
+// SearchDeviceCode Находит действующий запрос авторизации устройства в базе Postgres
+func (s *Store) SearchDeviceCode(ctx context.Context, id string) (*Interface.DeviceCode, error) {
+	query := "SELECT " + deviceColumns + " FROM device_codes WHERE id = $1 AND expires_at > now()"
+	return scanDeviceCode(s.db.QueryRow(ctx, query, id))
+}
+
+// SearchUserCode Находит действующий запрос авторизации устройства по коду пользователя в базе Postgres
+func (s *Store) SearchUserCode(ctx context.Context, userCode string) (*Interface.DeviceCode, error) {
+	query := "SELECT " + deviceColumns + " FROM device_codes WHERE user_code = $1 AND expires_at > now()"
+	return scanDeviceCode(s.db.QueryRow(ctx, query, userCode))
+}
+
+// PollDeviceCode Запоминает время опроса устройством и возвращает предыдущее в базе Postgres
+func (s *Store) PollDeviceCode(ctx context.Context, id string, t time.Time) (time.Time, error) {
+	// Строка блокируется подзапросом, поэтому прежнее значение читается без гонки
+	query := `UPDATE device_codes d SET last_polled = $2
+		FROM (SELECT id, last_polled FROM device_codes WHERE id = $1 FOR UPDATE) prev
+		WHERE d.id = prev.id
+		RETURNING prev.last_polled`
+
+	var prev *time.Time
+	err := s.db.QueryRow(ctx, query, id, t).Scan(&prev)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return time.Time{}, nil
+		}
+		return time.Time{}, wrap(err)
+	}
+	if prev == nil {
+		return time.Time{}, nil
+	}
+
+	return *prev, nil
+}
+
+// ApproveDeviceCode Записывает решение пользователя по запросу устройства в базе Postgres
+func (s *Store) ApproveDeviceCode(ctx context.Context, userCode, username string, approved bool) (bool, error) {
+	status := Interface.DeviceDenied
+	if approved {
+		status = Interface.DeviceApproved
+	}
+	update := `UPDATE device_codes SET status = $3, username = $2
+		WHERE user_code = $1 AND status = $4 AND expires_at > now()`
+
+	tag, err := s.db.Exec(ctx, update, userCode, username, status, Interface.DevicePending)
+	if err != nil {
+		return false, wrap(err)
+	}
+
+	return tag.RowsAffected() == 1, nil
+}
+
+// DelDeviceCode Удаляет запрос авторизации устройства в базе Postgres
+func (s *Store) DelDeviceCode(ctx context.Context, id string) (bool, error) {
+	delet := "DELETE FROM device_codes WHERE id = $1"
+
+	tag, err := s.db.Exec(ctx, delet, id)
+	if err != nil {
+		return false, wrap(err)
+	}
+
+	return tag.RowsAffected() == 1, nil
+}
+
+// CreateDeviceCodesTable Создает таблицу device_codes
+func (s *Store) CreateDeviceCodesTable() error {
+	qwery := `CREATE TABLE IF NOT EXISTS "device_codes" (
+    id TEXT PRIMARY KEY,
+    user_code TEXT NOT NULL UNIQUE,
+    client_id TEXT NOT NULL,
+    scope TEXT NOT NULL DEFAULT '',
+    username TEXT NOT NULL DEFAULT '',
+    status TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL,
+    last_polled TIMESTAMPTZ
+);`
+
+	_, err := s.db.Exec(context.Background(), qwery)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
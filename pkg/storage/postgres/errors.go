@@ -0,0 +1,37 @@
+package postgres
+
+import (
+	Interface "authorization/pkg/storage"
+	"errors"
+	"fmt"
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+	"net"
+	"strings"
+)
+
+// wrap Переводит ошибку Postgres в ошибки хранилища, исходная ошибка остаётся в цепочке.
+func wrap(err error) error {
+	var pgErr *pgconn.PgError
+	var netErr net.Error
+	switch {
+	case err == nil,
+		errors.Is(err, Interface.ErrNotFound),
+		errors.Is(err, Interface.ErrAlreadyExists),
+		errors.Is(err, Interface.ErrUnavailable):
+		return err
+	case errors.Is(err, pgx.ErrNoRows):
+		return fmt.Errorf("%w: %w", Interface.ErrNotFound, err)
+	case errors.As(err, &pgErr):
+		switch {
+		case pgErr.Code == "23505": // unique_violation
+			return Interface.AlreadyExists(err)
+		case strings.HasPrefix(pgErr.Code, "08"), strings.HasPrefix(pgErr.Code, "53"), strings.HasPrefix(pgErr.Code, "57"):
+			// Ошибки соединения, нехватка ресурсов и остановка сервера
+			return Interface.Unavailable(err)
+		}
+	case Interface.Interrupted(err), pgconn.Timeout(err), errors.As(err, &netErr):
+		return Interface.Unavailable(err)
+	}
+	return err
+}
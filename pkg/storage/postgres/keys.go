@@ -0,0 +1,73 @@
+package postgres
+
+import (
+	Interface "authorization/pkg/storage"
+	"context"
+)
+
+// AddSigningKey Добавляет ключ подписи в базу Postgres
+func (s *Store) AddSigningKey(ctx context.Context, k Interface.SigningKey) error {
+	_, err := s.db.Exec(ctx,
+		`INSERT INTO signing_keys(id, alg, private_key, created_at, retire_at, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6);`,
+		k.ID, k.Alg, k.PrivateKey, k.CreatedAt, k.RetireAt, k.ExpiresAt)
+	if err != nil {
+		return wrap(err)
+	}
+
+	return nil
+}
+
+// ListSigningKeys Возвращает все ключи подписи из базы Postgres
+func (s *Store) ListSigningKeys(ctx context.Context) ([]Interface.SigningKey, error) {
+	query := "SELECT id, alg, private_key, created_at, retire_at, expires_at FROM signing_keys"
+
+	rows, err := s.db.Query(ctx, query)
+	if err != nil {
+		return nil, wrap(err)
+	}
+	defer rows.Close()
+
+	var keys []Interface.SigningKey
+	for rows.Next() {
+		var k Interface.SigningKey
+		err = rows.Scan(&k.ID, &k.Alg, &k.PrivateKey, &k.CreatedAt, &k.RetireAt, &k.ExpiresAt)
+		if err != nil {
+			return nil, wrap(err)
+		}
+		keys = append(keys, k)
+	}
+
+	return keys, wrap(rows.Err())
+}
+
+// DelSigningKey Удаляет ключ подписи в базе Postgres
+func (s *Store) DelSigningKey(ctx context.Context, id string) (bool, error) {
+	delet := "DELETE FROM signing_keys WHERE id = $1"
+
+	tag, err := s.db.Exec(ctx, delet, id)
+	if err != nil {
+		return false, wrap(err)
+	}
+
+	return tag.RowsAffected() > 0, nil
+}
+
+// CreateSigningKeysTable Создает таблицу signing_keys
+func (s *Store) CreateSigningKeysTable() error {
+	qwery := `CREATE TABLE IF NOT EXISTS "signing_keys" (
+    id TEXT PRIMARY KEY,
+    alg TEXT NOT NULL,
+    private_key TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL,
+    retire_at TIMESTAMPTZ NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL
+);`
+
+	_, err := s.db.Exec(context.Background(), qwery)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,90 @@
+package postgres
+
+import (
+	Interface "authorization/pkg/storage"
+	"context"
+)
+
+// SetTOTP Заменяет аутентификатор пользователя в базе Postgres
+func (s *Store) SetTOTP(ctx context.Context, t Interface.TOTP) error {
+	_, err := s.db.Exec(ctx,
+		`INSERT INTO totp(username, secret, enabled, recovery_codes, last_step, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (username) DO UPDATE SET secret = EXCLUDED.secret, enabled = EXCLUDED.enabled,
+		recovery_codes = EXCLUDED.recovery_codes, last_step = EXCLUDED.last_step, created_at = EXCLUDED.created_at;`,
+		t.Username, t.Secret, t.Enabled, nonNil(t.RecoveryCodes), t.LastStep, t.CreatedAt)
+	if err != nil {
+		return wrap(err)
+	}
+
+	return nil
+}
+
+// SearchTOTP Находит аутентификатор пользователя в базе Postgres
+func (s *Store) SearchTOTP(ctx context.Context, username string) (*Interface.TOTP, error) {
+	query := `SELECT username, secret, enabled, recovery_codes, last_step, created_at
+		FROM totp WHERE username = $1`
+
+	var t Interface.TOTP
+	err := s.db.QueryRow(ctx, query, username).Scan(
+		&t.Username, &t.Secret, &t.Enabled, &t.RecoveryCodes, &t.LastStep, &t.CreatedAt)
+	if err != nil {
+		return nil, wrap(err)
+	}
+
+	return &t, nil
+}
+
+// UseTOTPStep Атомарно запоминает шаг принятого кода в базе Postgres
+func (s *Store) UseTOTPStep(ctx context.Context, username string, step int64) (bool, error) {
+	update := "UPDATE totp SET last_step = $2 WHERE username = $1 AND last_step < $2"
+
+	tag, err := s.db.Exec(ctx, update, username, step)
+	if err != nil {
+		return false, wrap(err)
+	}
+
+	return tag.RowsAffected() == 1, nil
+}
+
+// UseRecoveryCode Атомарно вычёркивает код восстановления в базе Postgres
+func (s *Store) UseRecoveryCode(ctx context.Context, username, hash string) (bool, error) {
+	update := `UPDATE totp SET recovery_codes = array_remove(recovery_codes, $2)
+		WHERE username = $1 AND $2 = ANY(recovery_codes)`
+
+	tag, err := s.db.Exec(ctx, update, username, hash)
+	if err != nil {
+		return false, wrap(err)
+	}
+
+	return tag.RowsAffected() == 1, nil
+}
+
+// DelTOTP Удаляет аутентификатор пользователя в базе Postgres
+func (s *Store) DelTOTP(ctx context.Context, username string) (bool, error) {
+	tag, err := s.db.Exec(ctx, "DELETE FROM totp WHERE username = $1", username)
+	if err != nil {
+		return false, wrap(err)
+	}
+
+	return tag.RowsAffected() == 1, nil
+}
+
+// CreateTOTPTable Создает таблицу totp
+func (s *Store) CreateTOTPTable() error {
+	qwery := `CREATE TABLE IF NOT EXISTS "totp" (
+    username TEXT PRIMARY KEY,
+    secret TEXT NOT NULL,
+    enabled BOOLEAN NOT NULL DEFAULT FALSE,
+    recovery_codes TEXT[] NOT NULL DEFAULT '{}',
+    last_step BIGINT NOT NULL DEFAULT 0,
+    created_at TIMESTAMPTZ NOT NULL
+);`
+
+	_, err := s.db.Exec(context.Background(), qwery)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,130 @@
+package postgres
+
+import (
+	Interface "authorization/pkg/storage"
+	"context"
+)
+
+// AddClient Добавляет или заменяет клиента OAuth в базе Postgres
+func (s *Store) AddClient(ctx context.Context, c Interface.Client) error {
+	_, err := s.db.Exec(ctx,
+		`INSERT INTO oauth_clients(id, name, redirect_uris, scopes, grant_types, secret_hash, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (id) DO UPDATE SET name = $2, redirect_uris = $3, scopes = $4, grant_types = $5, secret_hash = $6;`,
+		c.ID, c.Name, nonNil(c.RedirectURIs), nonNil(c.Scopes), nonNil(c.GrantTypes), c.SecretHash, c.CreatedAt)
+	if err != nil {
+		return wrap(err)
+	}
+
+	return nil
+}
+
+// nonNil Пустой список вместо nil, иначе pgx запишет NULL в столбец NOT NULL
+func nonNil(list []string) []string {
+	if list == nil {
+		return []string{}
+	}
+	return list
+}
+
+// SearchClient Находит клиента OAuth в базе Postgres
+func (s *Store) SearchClient(ctx context.Context, id string) (*Interface.Client, error) {
+	query := `SELECT id, name, redirect_uris, scopes, grant_types, secret_hash, created_at
+		FROM oauth_clients WHERE id = $1`
+
+	var c Interface.Client
+	err := s.db.QueryRow(ctx, query, id).Scan(
+		&c.ID, &c.Name, &c.RedirectURIs, &c.Scopes, &c.GrantTypes, &c.SecretHash, &c.CreatedAt)
+	if err != nil {
+		return nil, wrap(err)
+	}
+
+	return &c, nil
+}
+
+// DelClient Удаляет клиента OAuth в базе Postgres
+func (s *Store) DelClient(ctx context.Context, id string) (bool, error) {
+	delet := "DELETE FROM oauth_clients WHERE id = $1"
+
+	tag, err := s.db.Exec(ctx, delet, id)
+	if err != nil {
+		return false, wrap(err)
+	}
+
+	return tag.RowsAffected() > 0, nil
+}
+
+// AddAuthCode Добавляет код авторизации в базу Postgres
+func (s *Store) AddAuthCode(ctx context.Context, c Interface.AuthCode) error {
+	// Попутно удаляем истекшие коды, чтобы таблица не росла
+	_, err := s.db.Exec(ctx, "DELETE FROM auth_codes WHERE expires_at < now();")
+	if err != nil {
+		return wrap(err)
+	}
+
+	_, err = s.db.Exec(ctx,
+		`INSERT INTO auth_codes(id, client_id, username, redirect_uri, scope, code_challenge, code_challenge_method,
+		nonce, auth_time, created_at, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11);`,
+		c.ID, c.ClientID, c.Username, c.RedirectURI, c.Scope, c.CodeChallenge, c.CodeChallengeMethod,
+		c.Nonce, c.AuthTime, c.CreatedAt, c.ExpiresAt)
+	if err != nil {
+		return wrap(err)
+	}
+
+	return nil
+}
+
+// UseAuthCode Атомарно забирает действующий код авторизации из базы Postgres
+func (s *Store) UseAuthCode(ctx context.Context, id string) (*Interface.AuthCode, error) {
+	query := `DELETE FROM auth_codes WHERE id = $1 AND expires_at > now()
+		RETURNING id, client_id, username, redirect_uri, scope, code_challenge, code_challenge_method,
+		nonce, auth_time, created_at, expires_at`
+
+	var c Interface.AuthCode
+	err := s.db.QueryRow(ctx, query, id).Scan(
+		&c.ID, &c.ClientID, &c.Username, &c.RedirectURI, &c.Scope,
+		&c.CodeChallenge, &c.CodeChallengeMethod, &c.Nonce, &c.AuthTime, &c.CreatedAt, &c.ExpiresAt)
+	if err != nil {
+		return nil, wrap(err)
+	}
+
+	return &c, nil
+}
+
+// CreateOAuthTables Создает таблицы oauth_clients и auth_codes
+func (s *Store) CreateOAuthTables() error {
+	qwery := `CREATE TABLE IF NOT EXISTS "oauth_clients" (
+    id TEXT PRIMARY KEY,
+    name TEXT NOT NULL DEFAULT '',
+    redirect_uris TEXT[] NOT NULL DEFAULT '{}',
+    scopes TEXT[] NOT NULL DEFAULT '{}',
+    grant_types TEXT[] NOT NULL DEFAULT '{}',
+    secret_hash TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+ALTER TABLE oauth_clients ADD COLUMN IF NOT EXISTS grant_types TEXT[] NOT NULL DEFAULT '{}';
+ALTER TABLE oauth_clients ADD COLUMN IF NOT EXISTS secret_hash TEXT NOT NULL DEFAULT '';
+CREATE TABLE IF NOT EXISTS "auth_codes" (
+    id TEXT PRIMARY KEY,
+    client_id TEXT NOT NULL,
+    username TEXT NOT NULL,
+    redirect_uri TEXT NOT NULL,
+    scope TEXT NOT NULL DEFAULT '',
+    code_challenge TEXT NOT NULL,
+    code_challenge_method TEXT NOT NULL,
+    nonce TEXT NOT NULL DEFAULT '',
+    auth_time TIMESTAMPTZ NOT NULL DEFAULT now(),
+    created_at TIMESTAMPTZ NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL
+);
+ALTER TABLE auth_codes ADD COLUMN IF NOT EXISTS nonce TEXT NOT NULL DEFAULT '';
+ALTER TABLE auth_codes ADD COLUMN IF NOT EXISTS auth_time TIMESTAMPTZ NOT NULL DEFAULT now();`
+
+	_, err := s.db.Exec(context.Background(), qwery)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
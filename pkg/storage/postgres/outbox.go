@@ -0,0 +1,94 @@
+package postgres
+
+import (
+	Interface "authorization/pkg/storage"
+	"context"
+	"time"
+)
+
+// AddOutboxMessage Ставит письмо в очередь в базе Postgres
+func (s *Store) AddOutboxMessage(ctx context.Context, m Interface.OutboxMessage) error {
+	_, err := s.db.Exec(ctx,
+		`INSERT INTO mail_outbox(id, recipient, subject, text_body, html_body, attempts, next_attempt, last_error, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9);`,
+		m.ID, m.To, m.Subject, m.Text, m.HTML, m.Attempts, m.NextAttempt, m.LastError, m.CreatedAt)
+	if err != nil {
+		return wrap(err)
+	}
+
+	return nil
+}
+
+// ClaimOutboxMessages Забирает письма, время отправки которых наступило, из базы Postgres
+func (s *Store) ClaimOutboxMessages(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]Interface.OutboxMessage, error) {
+	// SKIP LOCKED не даёт двум копиям сервиса забрать одно письмо
+	query := `UPDATE mail_outbox SET next_attempt = $2
+		WHERE id IN (
+			SELECT id FROM mail_outbox WHERE next_attempt <= $1
+			ORDER BY next_attempt LIMIT $3 FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id, recipient, subject, text_body, html_body, attempts, next_attempt, last_error, created_at`
+
+	rows, err := s.db.Query(ctx, query, now, now.Add(lease), limit)
+	if err != nil {
+		return nil, wrap(err)
+	}
+	defer rows.Close()
+
+	var list []Interface.OutboxMessage
+	for rows.Next() {
+		var m Interface.OutboxMessage
+		err = rows.Scan(&m.ID, &m.To, &m.Subject, &m.Text, &m.HTML, &m.Attempts, &m.NextAttempt, &m.LastError, &m.CreatedAt)
+		if err != nil {
+			return nil, wrap(err)
+		}
+		list = append(list, m)
+	}
+
+	return list, wrap(rows.Err())
+}
+
+// RetryOutboxMessage Сохраняет неудачную попытку отправки письма в базе Postgres
+func (s *Store) RetryOutboxMessage(ctx context.Context, id string, attempts int, next time.Time, lastError string) error {
+	update := "UPDATE mail_outbox SET attempts = $2, next_attempt = $3, last_error = $4 WHERE id = $1"
+
+	_, err := s.db.Exec(ctx, update, id, attempts, next, lastError)
+	if err != nil {
+		return wrap(err)
+	}
+
+	return nil
+}
+
+// DelOutboxMessage Удаляет письмо из очереди в базе Postgres
+func (s *Store) DelOutboxMessage(ctx context.Context, id string) (bool, error) {
+	tag, err := s.db.Exec(ctx, "DELETE FROM mail_outbox WHERE id = $1", id)
+	if err != nil {
+		return false, wrap(err)
+	}
+
+	return tag.RowsAffected() == 1, nil
+}
+
+// CreateOutboxTable Создает таблицу mail_outbox
+func (s *Store) CreateOutboxTable() error {
+	qwery := `CREATE TABLE IF NOT EXISTS "mail_outbox" (
+    id TEXT PRIMARY KEY,
+    recipient TEXT NOT NULL,
+    subject TEXT NOT NULL,
+    text_body TEXT NOT NULL,
+    html_body TEXT NOT NULL,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    next_attempt TIMESTAMPTZ NOT NULL,
+    last_error TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL
+);
+CREATE INDEX IF NOT EXISTS mail_outbox_next_attempt_idx ON mail_outbox (next_attempt);`
+
+	_, err := s.db.Exec(context.Background(), qwery)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
@@ -3,7 +3,7 @@ package postgres
 import (
 	Interface "authorization/pkg/storage"
 	"context"
-	"github.com/jackc/pgx/v4"
+	"github.com/gofrs/uuid"
 	"github.com/jackc/pgx/v4/pgxpool"
 	"log"
 	"time"
@@ -28,66 +28,264 @@ func New(connstr string) (*Store, error) {
 	return &s, nil
 }
 
-// AddAccount Добавляет данные в базу Postgres
-func (s *Store) AddAccount(c Interface.Account) error {
-	_, err := s.db.Exec(context.Background(),
-		"INSERT INTO accounts(username, password) VALUES ($1, $2);", c.Username, c.Password)
+// CreateAccount Добавляет аккаунт в базу Postgres, если логин свободен.
+// Уникальный индекс по username не даёт параллельным запросам создать два аккаунта с одним логином.
+func (s *Store) CreateAccount(ctx context.Context, c Interface.Account) error {
+	if err := c.SetDefaults(); err != nil {
+		return wrap(err)
+	}
+	tag, err := s.db.Exec(ctx,
+		`INSERT INTO accounts(user_id, username, password, display_name, status, email_verified, created_at, updated_at, last_login_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		ON CONFLICT (username) DO NOTHING;`,
+		c.ID, c.Username, c.Password, c.DisplayName, string(c.Status), c.EmailVerified, c.CreatedAt, c.UpdatedAt, nullTime(c.LastLoginAt))
 	if err != nil {
 		log.Println(err)
-		return err
+		return wrap(err)
+	}
+	if tag.RowsAffected() == 0 {
+		return Interface.ErrAlreadyExists
 	}
 
 	return nil
 }
 
+// nullTime NULL вместо нулевого времени.
+func nullTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
 // SearchAccount Находит пароль по ключу в базе Postgres
-func (s *Store) SearchAccount(c Interface.Account) (string, error) {
+func (s *Store) SearchAccount(ctx context.Context, c Interface.Account) (string, error) {
 	query := "SELECT password FROM accounts WHERE username = $1"
 
 	var password string
-	err := s.db.QueryRow(context.Background(), query, c.Username).Scan(&password)
+	err := s.db.QueryRow(ctx, query, c.Username).Scan(&password)
 	if err != nil {
-		if err == pgx.ErrNoRows {
-			return "", nil
-		}
-		return "", err
+		return "", wrap(err)
 	}
 
 	return password, nil
 }
 
 // KeysAccount Проверяет логин по ключу в базе Postgres
-func (s *Store) KeysAccount(c Interface.Account) (bool, error) {
+func (s *Store) KeysAccount(ctx context.Context, c Interface.Account) (bool, error) {
 	query := "SELECT EXISTS(SELECT 1 FROM accounts WHERE username = $1)"
 
 	var exists bool
-	err := s.db.QueryRow(context.Background(), query, c.Username).Scan(&exists)
+	err := s.db.QueryRow(ctx, query, c.Username).Scan(&exists)
 	if err != nil {
-		return false, err
+		return false, wrap(err)
 	}
 
 	return exists, nil
 }
 
+// GetAccount Находит аккаунт по логину в базе Postgres
+func (s *Store) GetAccount(ctx context.Context, username string) (*Interface.Account, error) {
+	return s.getAccount(ctx, "username", username)
+}
+
+// GetAccountByID Находит аккаунт по ID в базе Postgres
+func (s *Store) GetAccountByID(ctx context.Context, id string) (*Interface.Account, error) {
+	// Строка не в формате UUID не может быть ID аккаунта, а в запросе вызовет ошибку приведения типа
+	if _, err := uuid.FromString(id); err != nil {
+		return nil, Interface.ErrNotFound
+	}
+	return s.getAccount(ctx, "user_id", id)
+}
+
+// getAccount Находит аккаунт по значению столбца column.
+func (s *Store) getAccount(ctx context.Context, column, value string) (*Interface.Account, error) {
+	query := `SELECT user_id::text, username, password, display_name, status, email_verified, created_at, updated_at, last_login_at
+	FROM accounts WHERE ` + column + ` = $1`
+
+	var c Interface.Account
+	var status string
+	var lastLogin *time.Time
+	err := s.db.QueryRow(ctx, query, value).Scan(
+		&c.ID, &c.Username, &c.Password, &c.DisplayName, &status, &c.EmailVerified, &c.CreatedAt, &c.UpdatedAt, &lastLogin)
+	if err != nil {
+		return nil, wrap(err)
+	}
+	c.Status = Interface.AccountStatus(status)
+	if lastLogin != nil {
+		c.LastLoginAt = *lastLogin
+	}
+
+	return &c, nil
+}
+
 // DelAccount Удаляет аккаунт в базе Postgres
-func (s *Store) DelAccount(c Interface.Account) (bool, error) {
+func (s *Store) DelAccount(ctx context.Context, c Interface.Account) (bool, error) {
 	delet := "DELETE FROM accounts WHERE username = $1"
 
-	_, err := s.db.Exec(context.Background(), delet, c.Username)
+	_, err := s.db.Exec(ctx, delet, c.Username)
 	if err != nil {
-		return false, err
+		return false, wrap(err)
 	}
 
 	return true, nil
 }
 
+// UpdatePassword Заменяет хеш пароля существующего аккаунта в базе Postgres
+func (s *Store) UpdatePassword(ctx context.Context, c Interface.Account) error {
+	update := "UPDATE accounts SET password = $2, updated_at = now() WHERE username = $1"
+
+	_, err := s.db.Exec(ctx, update, c.Username, c.Password)
+	if err != nil {
+		return wrap(err)
+	}
+
+	return nil
+}
+
+// ChangePassword Атомарно заменяет хеш пароля в базе Postgres, если он не изменился
+func (s *Store) ChangePassword(ctx context.Context, username, old, password string) (bool, error) {
+	update := "UPDATE accounts SET password = $3, updated_at = now() WHERE username = $1 AND password = $2"
+
+	tag, err := s.db.Exec(ctx, update, username, old, password)
+	if err != nil {
+		return false, wrap(err)
+	}
+
+	return tag.RowsAffected() > 0, nil
+}
+
+// SetDisplayName Меняет отображаемое имя пользователя в базе Postgres
+func (s *Store) SetDisplayName(ctx context.Context, username, displayName string) (bool, error) {
+	update := "UPDATE accounts SET display_name = $2, updated_at = now() WHERE username = $1"
+
+	tag, err := s.db.Exec(ctx, update, username, displayName)
+	if err != nil {
+		return false, wrap(err)
+	}
+
+	return tag.RowsAffected() > 0, nil
+}
+
+// SetAccountStatus Меняет статус аккаунта в базе Postgres
+func (s *Store) SetAccountStatus(ctx context.Context, username string, status Interface.AccountStatus) (bool, error) {
+	update := "UPDATE accounts SET status = $2, updated_at = now() WHERE username = $1"
+
+	tag, err := s.db.Exec(ctx, update, username, string(status))
+	if err != nil {
+		return false, wrap(err)
+	}
+
+	return tag.RowsAffected() > 0, nil
+}
+
+// SetEmailVerified Отмечает адрес пользователя подтверждённым в базе Postgres
+func (s *Store) SetEmailVerified(ctx context.Context, username string) (bool, error) {
+	update := `UPDATE accounts SET email_verified = TRUE, updated_at = now(),
+	status = CASE WHEN status = 'pending' THEN 'active' ELSE status END
+	WHERE username = $1`
+
+	tag, err := s.db.Exec(ctx, update, username)
+	if err != nil {
+		return false, wrap(err)
+	}
+
+	return tag.RowsAffected() > 0, nil
+}
+
+// SetLastLogin Запоминает время последнего входа пользователя в базе Postgres
+func (s *Store) SetLastLogin(ctx context.Context, username string, t time.Time) (bool, error) {
+	update := "UPDATE accounts SET last_login_at = $2 WHERE username = $1"
+
+	tag, err := s.db.Exec(ctx, update, username, t)
+	if err != nil {
+		return false, wrap(err)
+	}
+
+	return tag.RowsAffected() > 0, nil
+}
+
+// CountLegacyAccounts Считает аккаунты с паролем в устаревшем формате SHA-256 в базе Postgres
+func (s *Store) CountLegacyAccounts(ctx context.Context) (int64, error) {
+	query := "SELECT count(*) FROM accounts WHERE password ~ '^[0-9a-f]{64}$'"
+
+	var count int64
+	err := s.db.QueryRow(ctx, query).Scan(&count)
+	if err != nil {
+		return 0, wrap(err)
+	}
+
+	return count, nil
+}
+
+// MigrateAccounts Добавляет в таблицу accounts, созданную до появления профиля, новые столбцы
+// и заполняет их у прежних аккаунтов, затем создаёт уникальные индексы по user_id и username.
+// Таблица email_verifications уже должна быть создана. Если в таблице уже есть аккаунты с одинаковым логином,
+// индекс не создаётся и лишние аккаунты нужно удалить вручную.
+func (s *Store) MigrateAccounts(ctx context.Context) (int64, error) {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return 0, wrap(err)
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx, `ALTER TABLE accounts
+    ADD COLUMN IF NOT EXISTS user_id UUID,
+    ADD COLUMN IF NOT EXISTS display_name TEXT NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS status TEXT NOT NULL DEFAULT 'active',
+    ADD COLUMN IF NOT EXISTS email_verified BOOLEAN NOT NULL DEFAULT FALSE,
+    ADD COLUMN IF NOT EXISTS created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    ADD COLUMN IF NOT EXISTS updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    ADD COLUMN IF NOT EXISTS last_login_at TIMESTAMPTZ;`)
+	if err != nil {
+		return 0, wrap(err)
+	}
+
+	// Прежние аккаунты отличаются пустым user_id
+	tag, err := tx.Exec(ctx, `UPDATE accounts a SET
+    user_id = gen_random_uuid(),
+    email_verified = COALESCE(m.verified, TRUE),
+    status = CASE WHEN m.verified = FALSE THEN 'pending' ELSE 'active' END,
+    created_at = COALESCE(m.created_at, a.created_at),
+    updated_at = COALESCE(m.created_at, a.created_at)
+FROM (
+    SELECT p.id, v.verified, v.created_at FROM accounts p
+    LEFT JOIN email_verifications v ON v.username = p.username
+    WHERE p.user_id IS NULL
+) m
+WHERE a.id = m.id;`)
+	if err != nil {
+		return 0, wrap(err)
+	}
+
+	_, err = tx.Exec(ctx, `ALTER TABLE accounts ALTER COLUMN user_id SET NOT NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS accounts_user_id_idx ON accounts (user_id);
+CREATE UNIQUE INDEX IF NOT EXISTS accounts_username_idx ON accounts (username);`)
+	if err != nil {
+		return 0, wrap(err)
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return 0, wrap(err)
+	}
+	return tag.RowsAffected(), nil
+}
+
 // CreateAccountsTable Создает таблицу accounts
 func (s *Store) CreateAccountsTable() error {
 	qwery := `CREATE TABLE IF NOT EXISTS "accounts" (
     id SERIAL PRIMARY KEY,
+    user_id UUID NOT NULL,
     username TEXT NOT NULL,
-    password TEXT NOT NULL
-);`
+    password TEXT NOT NULL,
+    display_name TEXT NOT NULL DEFAULT '',
+    status TEXT NOT NULL DEFAULT 'active',
+    email_verified BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    last_login_at TIMESTAMPTZ
+);
+CREATE UNIQUE INDEX IF NOT EXISTS accounts_username_idx ON accounts (username);`
 
 	_, err := s.db.Exec(context.Background(), qwery)
 	if err != nil {
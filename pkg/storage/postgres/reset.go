@@ -0,0 +1,73 @@
+package postgres
+
+import (
+	Interface "authorization/pkg/storage"
+	"context"
+	"time"
+)
+
+// AddPasswordReset Добавляет токен сброса пароля в базу Postgres
+func (s *Store) AddPasswordReset(ctx context.Context, c Interface.PasswordReset) error {
+	// Попутно удаляем истекшие токены пользователя, чтобы таблица не росла
+	_, err := s.db.Exec(ctx,
+		"DELETE FROM password_resets WHERE username = $1 AND expires_at < now();", c.Username)
+	if err != nil {
+		return wrap(err)
+	}
+
+	_, err = s.db.Exec(ctx,
+		`INSERT INTO password_resets(id, username, created_at, expires_at)
+		VALUES ($1, $2, $3, $4);`,
+		c.ID, c.Username, c.CreatedAt, c.ExpiresAt)
+	if err != nil {
+		return wrap(err)
+	}
+
+	return nil
+}
+
+// UsePasswordReset Атомарно забирает действующий токен сброса пароля из базы Postgres
+func (s *Store) UsePasswordReset(ctx context.Context, id string) (*Interface.PasswordReset, error) {
+	query := `DELETE FROM password_resets WHERE id = $1
+		RETURNING id, username, created_at, expires_at`
+
+	var c Interface.PasswordReset
+	err := s.db.QueryRow(ctx, query, id).Scan(&c.ID, &c.Username, &c.CreatedAt, &c.ExpiresAt)
+	if err != nil {
+		return nil, wrap(err)
+	}
+	if !c.ExpiresAt.After(time.Now()) {
+		// Истекший токен удалён, но не действует
+		return nil, Interface.ErrNotFound
+	}
+
+	return &c, nil
+}
+
+// DelUserPasswordResets Удаляет все токены сброса пароля пользователя в базе Postgres
+func (s *Store) DelUserPasswordResets(ctx context.Context, username string) (int64, error) {
+	tag, err := s.db.Exec(ctx, "DELETE FROM password_resets WHERE username = $1", username)
+	if err != nil {
+		return 0, wrap(err)
+	}
+
+	return tag.RowsAffected(), nil
+}
+
+// CreatePasswordResetsTable Создает таблицу password_resets
+func (s *Store) CreatePasswordResetsTable() error {
+	qwery := `CREATE TABLE IF NOT EXISTS "password_resets" (
+    id TEXT PRIMARY KEY,
+    username TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL
+);
+CREATE INDEX IF NOT EXISTS password_resets_username_idx ON password_resets (username);`
+
+	_, err := s.db.Exec(context.Background(), qwery)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
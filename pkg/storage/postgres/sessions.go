@@ -0,0 +1,132 @@
+package postgres
+
+import (
+	Interface "authorization/pkg/storage"
+	"context"
+	"github.com/jackc/pgx/v4"
+	"time"
+)
+
+// sessionColumns Столбцы таблицы sessions в порядке сканирования scanSession
+const sessionColumns = "id, username, created_at, last_seen, expires_at, ip, user_agent, request_id"
+
+// scanSession Читает строку таблицы sessions
+func scanSession(row pgx.Row) (*Interface.Session, error) {
+	var c Interface.Session
+	err := row.Scan(&c.ID, &c.Username, &c.CreatedAt, &c.LastSeen, &c.ExpiresAt, &c.IP, &c.UserAgent, &c.RequestID)
+	if err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// AddSession Добавляет сессию в базу Postgres
+func (s *Store) AddSession(ctx context.Context, c Interface.Session) error {
+	// Попутно удаляем истекшие сессии пользователя, чтобы таблица не росла
+	_, err := s.db.Exec(ctx,
+		"DELETE FROM sessions WHERE username = $1 AND expires_at < now();", c.Username)
+	if err != nil {
+		return wrap(err)
+	}
+
+	_, err = s.db.Exec(ctx,
+		"INSERT INTO sessions("+sessionColumns+") VALUES ($1, $2, $3, $4, $5, $6, $7, $8);",
+		c.ID, c.Username, c.CreatedAt, c.LastSeen, c.ExpiresAt, c.IP, c.UserAgent, c.RequestID)
+	if err != nil {
+		return wrap(err)
+	}
+
+	return nil
+}
+
+// SearchSession Находит действующую сессию по идентификатору в базе Postgres
+func (s *Store) SearchSession(ctx context.Context, id string) (*Interface.Session, error) {
+	query := "SELECT " + sessionColumns + " FROM sessions WHERE id = $1 AND expires_at > now()"
+
+	c, err := scanSession(s.db.QueryRow(ctx, query, id))
+	if err != nil {
+		return nil, wrap(err)
+	}
+
+	return c, nil
+}
+
+// DelSession Удаляет сессию в базе Postgres
+func (s *Store) DelSession(ctx context.Context, id string) (bool, error) {
+	delet := "DELETE FROM sessions WHERE id = $1"
+
+	tag, err := s.db.Exec(ctx, delet, id)
+	if err != nil {
+		return false, wrap(err)
+	}
+
+	return tag.RowsAffected() > 0, nil
+}
+
+// DelUserSessions Удаляет все сессии пользователя в базе Postgres
+func (s *Store) DelUserSessions(ctx context.Context, username string) (int64, error) {
+	delet := "DELETE FROM sessions WHERE username = $1"
+
+	tag, err := s.db.Exec(ctx, delet, username)
+	if err != nil {
+		return 0, wrap(err)
+	}
+
+	return tag.RowsAffected(), nil
+}
+
+// ListSessions Возвращает действующие сессии пользователя в базе Postgres
+func (s *Store) ListSessions(ctx context.Context, username string) ([]Interface.Session, error) {
+	query := "SELECT " + sessionColumns + " FROM sessions WHERE username = $1 AND expires_at > now() ORDER BY created_at"
+
+	rows, err := s.db.Query(ctx, query, username)
+	if err != nil {
+		return nil, wrap(err)
+	}
+	defer rows.Close()
+
+	var sessions []Interface.Session
+	for rows.Next() {
+		c, err := scanSession(rows)
+		if err != nil {
+			return nil, wrap(err)
+		}
+		sessions = append(sessions, *c)
+	}
+
+	return sessions, wrap(rows.Err())
+}
+
+// TouchSession Обновляет время последней активности сессии в базе Postgres
+func (s *Store) TouchSession(ctx context.Context, id string, t time.Time) error {
+	update := "UPDATE sessions SET last_seen = $2 WHERE id = $1"
+
+	_, err := s.db.Exec(ctx, update, id, t)
+	if err != nil {
+		return wrap(err)
+	}
+
+	return nil
+}
+
+// CreateSessionsTable Создает таблицу sessions
+func (s *Store) CreateSessionsTable() error {
+	qwery := `CREATE TABLE IF NOT EXISTS "sessions" (
+    id TEXT PRIMARY KEY,
+    username TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL,
+    last_seen TIMESTAMPTZ NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL,
+    ip TEXT NOT NULL DEFAULT '',
+    user_agent TEXT NOT NULL DEFAULT '',
+    request_id TEXT NOT NULL DEFAULT ''
+);
+CREATE INDEX IF NOT EXISTS sessions_username_idx ON sessions (username);`
+
+	_, err := s.db.Exec(context.Background(), qwery)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
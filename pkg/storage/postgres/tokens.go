@@ -0,0 +1,164 @@
+package postgres
+
+import (
+	Interface "authorization/pkg/storage"
+	"context"
+	"time"
+)
+
+// AddRefreshToken Добавляет токен обновления в базу Postgres
+func (s *Store) AddRefreshToken(ctx context.Context, c Interface.RefreshToken) error {
+	// Попутно удаляем истекшие токены пользователя, чтобы таблица не росла
+	_, err := s.db.Exec(ctx,
+		"DELETE FROM refresh_tokens WHERE username = $1 AND expires_at < now();", c.Username)
+	if err != nil {
+		return wrap(err)
+	}
+
+	_, err = s.db.Exec(ctx,
+		`INSERT INTO refresh_tokens(id, family_id, username, client_id, scope, created_at, expires_at, used)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8);`,
+		c.ID, c.FamilyID, c.Username, c.ClientID, c.Scope, c.CreatedAt, c.ExpiresAt, c.Used)
+	if err != nil {
+		return wrap(err)
+	}
+
+	return nil
+}
+
+// SearchRefreshToken Находит действующий токен обновления в базе Postgres
+func (s *Store) SearchRefreshToken(ctx context.Context, id string) (*Interface.RefreshToken, error) {
+	query := `SELECT id, family_id, username, client_id, scope, created_at, expires_at, used
+		FROM refresh_tokens WHERE id = $1 AND expires_at > now()`
+
+	var c Interface.RefreshToken
+	err := s.db.QueryRow(ctx, query, id).Scan(
+		&c.ID, &c.FamilyID, &c.Username, &c.ClientID, &c.Scope, &c.CreatedAt, &c.ExpiresAt, &c.Used)
+	if err != nil {
+		return nil, wrap(err)
+	}
+
+	return &c, nil
+}
+
+// UseRefreshToken Атомарно помечает токен обновления использованным в базе Postgres
+func (s *Store) UseRefreshToken(ctx context.Context, id string) (bool, error) {
+	update := "UPDATE refresh_tokens SET used = TRUE WHERE id = $1 AND used = FALSE AND expires_at > now()"
+
+	tag, err := s.db.Exec(ctx, update, id)
+	if err != nil {
+		return false, wrap(err)
+	}
+
+	return tag.RowsAffected() == 1, nil
+}
+
+// DelRefreshFamily Удаляет все токены семейства в базе Postgres
+func (s *Store) DelRefreshFamily(ctx context.Context, familyID string) (int64, error) {
+	delet := "DELETE FROM refresh_tokens WHERE family_id = $1"
+
+	tag, err := s.db.Exec(ctx, delet, familyID)
+	if err != nil {
+		return 0, wrap(err)
+	}
+
+	return tag.RowsAffected(), nil
+}
+
+// DelUserRefreshTokens Удаляет все токены обновления пользователя в базе Postgres
+func (s *Store) DelUserRefreshTokens(ctx context.Context, username string) (int64, error) {
+	delet := "DELETE FROM refresh_tokens WHERE username = $1"
+
+	tag, err := s.db.Exec(ctx, delet, username)
+	if err != nil {
+		return 0, wrap(err)
+	}
+
+	return tag.RowsAffected(), nil
+}
+
+// RevokeAccessToken Отмечает токен доступа отозванным в базе Postgres до истечения его срока
+func (s *Store) RevokeAccessToken(ctx context.Context, jti string, expiresAt time.Time) error {
+	// Попутно удаляем отметки о токенах, которые истекли сами
+	_, err := s.db.Exec(ctx, "DELETE FROM revoked_tokens WHERE expires_at < now();")
+	if err != nil {
+		return wrap(err)
+	}
+
+	_, err = s.db.Exec(ctx,
+		"INSERT INTO revoked_tokens(id, expires_at) VALUES ($1, $2) ON CONFLICT (id) DO NOTHING;",
+		jti, expiresAt)
+	return wrap(err)
+}
+
+// AccessTokenRevoked Проверяет отметку об отзыве токена доступа в базе Postgres
+func (s *Store) AccessTokenRevoked(ctx context.Context, jti string) (bool, error) {
+	var revoked bool
+	err := s.db.QueryRow(ctx,
+		"SELECT EXISTS(SELECT 1 FROM revoked_tokens WHERE id = $1)", jti).Scan(&revoked)
+	if err != nil {
+		return false, wrap(err)
+	}
+	return revoked, nil
+}
+
+// AddAccessToken Запоминает токен доступа пользователя в базе Postgres до истечения его срока
+func (s *Store) AddAccessToken(ctx context.Context, username, jti string, expiresAt time.Time) error {
+	// Попутно удаляем токены, которые истекли сами
+	_, err := s.db.Exec(ctx, "DELETE FROM access_tokens WHERE expires_at < now();")
+	if err != nil {
+		return wrap(err)
+	}
+
+	_, err = s.db.Exec(ctx,
+		"INSERT INTO access_tokens(id, username, expires_at) VALUES ($1, $2, $3) ON CONFLICT (id) DO NOTHING;",
+		jti, username, expiresAt)
+	return wrap(err)
+}
+
+// RevokeUserAccessTokens Отмечает отозванными все действующие токены доступа пользователя в базе Postgres
+func (s *Store) RevokeUserAccessTokens(ctx context.Context, username string) (int64, error) {
+	tag, err := s.db.Exec(ctx, `WITH t AS (
+    DELETE FROM access_tokens WHERE username = $1 RETURNING id, expires_at
+)
+INSERT INTO revoked_tokens(id, expires_at)
+SELECT id, expires_at FROM t WHERE expires_at > now()
+ON CONFLICT (id) DO NOTHING;`, username)
+	if err != nil {
+		return 0, wrap(err)
+	}
+	return tag.RowsAffected(), nil
+}
+
+// CreateRefreshTokensTable Создает таблицы refresh_tokens, revoked_tokens и access_tokens
+func (s *Store) CreateRefreshTokensTable() error {
+	qwery := `CREATE TABLE IF NOT EXISTS "refresh_tokens" (
+    id TEXT PRIMARY KEY,
+    family_id TEXT NOT NULL,
+    username TEXT NOT NULL,
+    client_id TEXT NOT NULL DEFAULT '',
+    scope TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL,
+    used BOOLEAN NOT NULL DEFAULT FALSE
+);
+CREATE INDEX IF NOT EXISTS refresh_tokens_family_idx ON refresh_tokens (family_id);
+CREATE INDEX IF NOT EXISTS refresh_tokens_username_idx ON refresh_tokens (username);
+CREATE TABLE IF NOT EXISTS "revoked_tokens" (
+    id TEXT PRIMARY KEY,
+    expires_at TIMESTAMPTZ NOT NULL
+);
+CREATE TABLE IF NOT EXISTS "access_tokens" (
+    id TEXT PRIMARY KEY,
+    username TEXT NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL
+);
+CREATE INDEX IF NOT EXISTS access_tokens_username_idx ON access_tokens (username);`
+
+	_, err := s.db.Exec(context.Background(), qwery)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
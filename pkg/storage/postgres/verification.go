@@ -0,0 +1,60 @@
+package postgres
+
+import (
+	Interface "authorization/pkg/storage"
+	"context"
+)
+
+// SetEmailVerification Заменяет подтверждение адреса пользователя в базе Postgres
+func (s *Store) SetEmailVerification(ctx context.Context, v Interface.EmailVerification) error {
+	_, err := s.db.Exec(ctx,
+		`INSERT INTO email_verifications(username, verified, created_at, verified_at)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (username) DO UPDATE SET verified = $2, created_at = $3, verified_at = $4;`,
+		v.Username, v.Verified, v.CreatedAt, v.VerifiedAt)
+	if err != nil {
+		return wrap(err)
+	}
+
+	return nil
+}
+
+// SearchEmailVerification Находит подтверждение адреса пользователя в базе Postgres
+func (s *Store) SearchEmailVerification(ctx context.Context, username string) (*Interface.EmailVerification, error) {
+	query := "SELECT username, verified, created_at, verified_at FROM email_verifications WHERE username = $1"
+
+	var v Interface.EmailVerification
+	err := s.db.QueryRow(ctx, query, username).Scan(&v.Username, &v.Verified, &v.CreatedAt, &v.VerifiedAt)
+	if err != nil {
+		return nil, wrap(err)
+	}
+
+	return &v, nil
+}
+
+// DelEmailVerification Удаляет подтверждение адреса пользователя в базе Postgres
+func (s *Store) DelEmailVerification(ctx context.Context, username string) (bool, error) {
+	tag, err := s.db.Exec(ctx, "DELETE FROM email_verifications WHERE username = $1", username)
+	if err != nil {
+		return false, wrap(err)
+	}
+
+	return tag.RowsAffected() == 1, nil
+}
+
+// CreateVerificationTable Создает таблицу email_verifications
+func (s *Store) CreateVerificationTable() error {
+	qwery := `CREATE TABLE IF NOT EXISTS "email_verifications" (
+    username TEXT PRIMARY KEY,
+    verified BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMPTZ NOT NULL,
+    verified_at TIMESTAMPTZ NOT NULL
+);`
+
+	_, err := s.db.Exec(context.Background(), qwery)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,121 @@
+package postgres
+
+import (
+	Interface "authorization/pkg/storage"
+	"context"
+	"github.com/jackc/pgx/v4"
+	"time"
+)
+
+// credentialColumns Столбцы таблицы webauthn_credentials в порядке полей Interface.WebAuthnCredential
+const credentialColumns = "id, username, name, public_key, alg, sign_count, aaguid, format, created_at, last_used"
+
+// scanCredential Читает ключ доступа из строки результата
+func scanCredential(row pgx.Row) (*Interface.WebAuthnCredential, error) {
+	var c Interface.WebAuthnCredential
+	err := row.Scan(&c.ID, &c.Username, &c.Name, &c.PublicKey, &c.Alg, &c.SignCount, &c.AAGUID, &c.Format,
+		&c.CreatedAt, &c.LastUsed)
+	if err != nil {
+		return nil, wrap(err)
+	}
+	return &c, nil
+}
+
+// AddCredential Добавляет ключ доступа в базу Postgres
+func (s *Store) AddCredential(ctx context.Context, c Interface.WebAuthnCredential) error {
+	_, err := s.db.Exec(ctx,
+		`INSERT INTO webauthn_credentials(`+credentialColumns+`)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10);`,
+		c.ID, c.Username, c.Name, c.PublicKey, c.Alg, c.SignCount, c.AAGUID, c.Format, c.CreatedAt, c.LastUsed)
+	if err != nil {
+		return wrap(err)
+	}
+
+	return nil
+}
+
+// SearchCredential Находит ключ доступа в базе Postgres
+func (s *Store) SearchCredential(ctx context.Context, id string) (*Interface.WebAuthnCredential, error) {
+	query := "SELECT " + credentialColumns + " FROM webauthn_credentials WHERE id = $1"
+	return scanCredential(s.db.QueryRow(ctx, query, id))
+}
+
+// ListCredentials Возвращает ключи доступа пользователя в базе Postgres
+func (s *Store) ListCredentials(ctx context.Context, username string) ([]Interface.WebAuthnCredential, error) {
+	query := "SELECT " + credentialColumns + " FROM webauthn_credentials WHERE username = $1 ORDER BY created_at"
+
+	rows, err := s.db.Query(ctx, query, username)
+	if err != nil {
+		return nil, wrap(err)
+	}
+	defer rows.Close()
+
+	var list []Interface.WebAuthnCredential
+	for rows.Next() {
+		c, err := scanCredential(rows)
+		if err != nil {
+			return nil, wrap(err)
+		}
+		list = append(list, *c)
+	}
+
+	return list, wrap(rows.Err())
+}
+
+// UseCredential Атомарно обновляет счётчик подписей ключа доступа в базе Postgres
+func (s *Store) UseCredential(ctx context.Context, id string, prev, signCount int64, t time.Time) (bool, error) {
+	update := "UPDATE webauthn_credentials SET sign_count = $3, last_used = $4 WHERE id = $1 AND sign_count = $2"
+
+	tag, err := s.db.Exec(ctx, update, id, prev, signCount, t)
+	if err != nil {
+		return false, wrap(err)
+	}
+
+	return tag.RowsAffected() == 1, nil
+}
+
+// DelCredential Удаляет ключ доступа пользователя в базе Postgres
+func (s *Store) DelCredential(ctx context.Context, username, id string) (bool, error) {
+	delet := "DELETE FROM webauthn_credentials WHERE id = $1 AND username = $2"
+
+	tag, err := s.db.Exec(ctx, delet, id, username)
+	if err != nil {
+		return false, wrap(err)
+	}
+
+	return tag.RowsAffected() == 1, nil
+}
+
+// DelUserCredentials Удаляет все ключи доступа пользователя в базе Postgres
+func (s *Store) DelUserCredentials(ctx context.Context, username string) (int64, error) {
+	tag, err := s.db.Exec(ctx, "DELETE FROM webauthn_credentials WHERE username = $1", username)
+	if err != nil {
+		return 0, wrap(err)
+	}
+
+	return tag.RowsAffected(), nil
+}
+
+// CreateWebAuthnTable Создает таблицу webauthn_credentials
+func (s *Store) CreateWebAuthnTable() error {
+	qwery := `CREATE TABLE IF NOT EXISTS "webauthn_credentials" (
+    id TEXT PRIMARY KEY,
+    username TEXT NOT NULL,
+    name TEXT NOT NULL DEFAULT '',
+    public_key BYTEA NOT NULL,
+    alg BIGINT NOT NULL,
+    sign_count BIGINT NOT NULL DEFAULT 0,
+    aaguid TEXT NOT NULL DEFAULT '',
+    format TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL,
+    last_used TIMESTAMPTZ NOT NULL
+);
+CREATE INDEX IF NOT EXISTS webauthn_credentials_username_idx ON webauthn_credentials (username);`
+
+	_, err := s.db.Exec(context.Background(), qwery)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,66 @@
+package redisDB
+
+import (
+	"context"
+	"github.com/redis/go-redis/v9"
+	"strconv"
+	"time"
+)
+
+// attemptsKey Ключ упорядоченного множества попыток входа в базе redis.
+func attemptsKey(key string) string {
+	return "login_failures:" + key
+}
+
+// addAttempt Удаляет из множества KEYS[1] попытки раньше ARGV[2], добавляет попытку ARGV[3] со временем ARGV[1]
+// и продлевает множество на ARGV[4] мс. Возвращает число попыток до добавленной и время последней из них.
+var addAttempt = redis.NewScript(`
+redis.call('ZREMRANGEBYSCORE', KEYS[1], '-inf', '(' .. ARGV[2])
+local count = redis.call('ZCARD', KEYS[1])
+local last = redis.call('ZRANGE', KEYS[1], -1, -1, 'WITHSCORES')
+redis.call('ZADD', KEYS[1], ARGV[1], ARGV[3])
+redis.call('PEXPIRE', KEYS[1], ARGV[4])
+if count == 0 then
+	return {0, '0'}
+end
+return {count, last[2]}
+`)
+
+// AddLoginAttempt Запоминает попытку входа в базе redis и возвращает число попыток до неё и время последней.
+func (s Storage) AddLoginAttempt(ctx context.Context, key, id string, at time.Time, window time.Duration) (int, time.Time, error) {
+	ctx, cancel := context.WithTimeout(ctx, 1*time.Second)
+	defer cancel()
+
+	res, err := addAttempt.Run(ctx, s.db, []string{attemptsKey(key)},
+		at.UnixMicro(), at.Add(-window).UnixMicro(), id, window.Milliseconds()).Slice()
+	if err != nil {
+		return 0, time.Time{}, wrap(err)
+	}
+
+	count, _ := res[0].(int64)
+	if count == 0 {
+		return 0, time.Time{}, nil
+	}
+	score, _ := res[1].(string)
+	last, err := strconv.ParseFloat(score, 64)
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+	return int(count), time.UnixMicro(int64(last)).UTC(), nil
+}
+
+// DelLoginAttempt Удаляет попытку входа из базы redis.
+func (s Storage) DelLoginAttempt(ctx context.Context, key, id string) error {
+	ctx, cancel := context.WithTimeout(ctx, 1*time.Second)
+	defer cancel()
+
+	return wrap(s.db.ZRem(ctx, attemptsKey(key), id).Err())
+}
+
+// ResetLoginFailures Сбрасывает счётчик неудачных попыток входа в базе redis.
+func (s Storage) ResetLoginFailures(ctx context.Context, key string) error {
+	ctx, cancel := context.WithTimeout(ctx, 1*time.Second)
+	defer cancel()
+
+	return wrap(s.db.Del(ctx, attemptsKey(key)).Err())
+}
@@ -0,0 +1,132 @@
+package redisDB
+
+import (
+	Interface "authorization/pkg/storage"
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/redis/go-redis/v9"
+	"log"
+	"strconv"
+	"time"
+)
+
+// deletionsDueKey Ключ упорядоченного множества аккаунтов, ожидающих удаления, по сроку удаления.
+const deletionsDueKey = "account_deletions"
+
+// deletionKey Ключ отметки об удалении аккаунта в базе redis.
+func deletionKey(username string) string {
+	return "account_deletion:" + username
+}
+
+// claimDeletion Снимает отметку KEYS[1] из множества KEYS[2], если срок ARGV[2] для ARGV[1] истёк.
+var claimDeletion = redis.NewScript(`
+local score = redis.call('ZSCORE', KEYS[2], ARGV[1])
+if not score or tonumber(score) > tonumber(ARGV[2]) then
+	return 0
+end
+redis.call('ZREM', KEYS[2], ARGV[1])
+return redis.call('DEL', KEYS[1])
+`)
+
+// ScheduleDeletion Отмечает аккаунт ожидающим удаления в базе redis.
+func (s Storage) ScheduleDeletion(ctx context.Context, d Interface.AccountDeletion) error {
+	ctx, cancel := context.WithTimeout(ctx, 1*time.Second)
+	defer cancel()
+
+	data, err := json.Marshal(d)
+	if err != nil {
+		return wrap(err)
+	}
+
+	_, err = s.db.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, deletionKey(d.Username), data, 0)
+		pipe.ZAdd(ctx, deletionsDueKey, redis.Z{Score: float64(d.PurgeAt.Unix()), Member: d.Username})
+		return nil
+	})
+	if err != nil {
+		log.Printf("Не удалось отметить аккаунт для удаления %v\n", err)
+		return wrap(err)
+	}
+
+	return nil
+}
+
+// SearchDeletion Находит отметку об удалении аккаунта в базе redis.
+func (s Storage) SearchDeletion(ctx context.Context, username string) (*Interface.AccountDeletion, error) {
+	ctx, cancel := context.WithTimeout(ctx, 1*time.Second)
+	defer cancel()
+
+	data, err := s.db.Get(ctx, deletionKey(username)).Bytes()
+	if err != nil {
+		return nil, wrap(err)
+	}
+
+	var d Interface.AccountDeletion
+	if err = json.Unmarshal(data, &d); err != nil {
+		return nil, wrap(err)
+	}
+
+	return &d, nil
+}
+
+// CancelDeletion Снимает отметку об удалении аккаунта в базе redis.
+func (s Storage) CancelDeletion(ctx context.Context, username string) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, 1*time.Second)
+	defer cancel()
+
+	var del *redis.IntCmd
+	_, err := s.db.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		del = pipe.Del(ctx, deletionKey(username))
+		pipe.ZRem(ctx, deletionsDueKey, username)
+		return nil
+	})
+	if err != nil {
+		return false, wrap(err)
+	}
+
+	return del.Val() > 0, nil
+}
+
+// DueDeletions Находит аккаунты, срок восстановления которых истёк, в базе redis.
+func (s Storage) DueDeletions(ctx context.Context, now time.Time, limit int) ([]Interface.AccountDeletion, error) {
+	ctx, cancel := context.WithTimeout(ctx, 1*time.Second)
+	defer cancel()
+
+	usernames, err := s.db.ZRangeByScore(ctx, deletionsDueKey, &redis.ZRangeBy{
+		Min:   "-inf",
+		Max:   strconv.FormatInt(now.Unix(), 10),
+		Count: int64(limit),
+	}).Result()
+	if err != nil || len(usernames) == 0 {
+		return nil, wrap(err)
+	}
+
+	var list []Interface.AccountDeletion
+	for _, username := range usernames {
+		d, err := s.SearchDeletion(ctx, username)
+		if errors.Is(err, Interface.ErrNotFound) {
+			// Удаление отменено после выборки
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, *d)
+	}
+
+	return list, nil
+}
+
+// ClaimDeletion Снимает отметку об удалении аккаунта с истёкшим сроком в базе redis.
+func (s Storage) ClaimDeletion(ctx context.Context, username string, now time.Time) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, 1*time.Second)
+	defer cancel()
+
+	n, err := claimDeletion.Run(ctx, s.db, []string{deletionKey(username), deletionsDueKey}, username, now.Unix()).Int64()
+	if err != nil {
+		return false, wrap(err)
+	}
+
+	return n > 0, nil
+}
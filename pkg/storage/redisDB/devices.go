@@ -0,0 +1,199 @@
+package redisDB
+
+import (
+	Interface "authorization/pkg/storage"
+	"context"
+	"encoding/json"
+	"github.com/redis/go-redis/v9"
+	"log"
+	"time"
+)
+
+// deviceKey Ключ запроса авторизации устройства в базе redis.
+func deviceKey(id string) string {
+	return "device:" + id
+}
+
+// deviceUserKey Ключ поиска запроса по коду пользователя.
+func deviceUserKey(userCode string) string {
+	return "device_user:" + userCode
+}
+
+// deviceStatusKey Ключ решения пользователя, записывается один раз.
+func deviceStatusKey(id string) string {
+	return "device_status:" + id
+}
+
+// devicePollKey Ключ времени последнего опроса устройством.
+func devicePollKey(id string) string {
+	return "device_poll:" + id
+}
+
+// deviceDecision Решение пользователя по запросу устройства.
+type deviceDecision struct {
+	Status   string `json:"status"`
+	Username string `json:"username"`
+}
+
+// AddDeviceCode Сохраняет запрос авторизации устройства в базе redis, ключи истекают вместе с ним.
+func (s Storage) AddDeviceCode(ctx context.Context, d Interface.DeviceCode) error {
+	ctx, cancel := context.WithTimeout(ctx, 1*time.Second)
+	defer cancel()
+
+	data, err := json.Marshal(d)
+	if err != nil {
+		return wrap(err)
+	}
+
+	ttl := time.Until(d.ExpiresAt)
+	// Код пользователя короткий, поэтому занимается через NX, чтобы не перехватить чужой запрос
+	ok, err := s.db.SetNX(ctx, deviceUserKey(d.UserCode), d.ID, ttl).Result()
+	if err != nil {
+		log.Printf("Не удалось сохранить код устройства %v\n", err)
+		return wrap(err)
+	}
+	if !ok {
+		return Interface.ErrUserCodeTaken
+	}
+
+	err = s.db.Set(ctx, deviceKey(d.ID), data, ttl).Err()
+	if err != nil {
+		log.Printf("Не удалось сохранить код устройства %v\n", err)
+		return wrap(err)
+	}
+
+	return nil
+}
+
+// SearchDeviceCode Находит запрос авторизации устройства в базе redis.
+func (s Storage) SearchDeviceCode(ctx context.Context, id string) (*Interface.DeviceCode, error) {
+	ctx, cancel := context.WithTimeout(ctx, 1*time.Second)
+	defer cancel()
+
+	values, err := s.db.MGet(ctx, deviceKey(id), deviceStatusKey(id)).Result()
+	if err != nil {
+		return nil, wrap(err)
+	}
+	data, ok := values[0].(string)
+	if !ok {
+		return nil, Interface.ErrNotFound
+	}
+
+	var d Interface.DeviceCode
+	if err = json.Unmarshal([]byte(data), &d); err != nil {
+		return nil, wrap(err)
+	}
+	if time.Now().After(d.ExpiresAt) {
+		return nil, Interface.ErrNotFound
+	}
+
+	if status, ok := values[1].(string); ok {
+		var decision deviceDecision
+		if err = json.Unmarshal([]byte(status), &decision); err != nil {
+			return nil, wrap(err)
+		}
+		d.Status = decision.Status
+		d.Username = decision.Username
+	}
+
+	return &d, nil
+}
+
+// SearchUserCode Находит запрос авторизации устройства по коду пользователя в базе redis.
+func (s Storage) SearchUserCode(ctx context.Context, userCode string) (*Interface.DeviceCode, error) {
+	ctx, cancel := context.WithTimeout(ctx, 1*time.Second)
+	defer cancel()
+
+	id, err := s.db.Get(ctx, deviceUserKey(userCode)).Result()
+	if err != nil {
+		return nil, wrap(err)
+	}
+
+	return s.SearchDeviceCode(ctx, id)
+}
+
+// PollDeviceCode Запоминает время опроса устройством и возвращает предыдущее в базе redis.
+func (s Storage) PollDeviceCode(ctx context.Context, id string, t time.Time) (time.Time, error) {
+	ctx, cancel := context.WithTimeout(ctx, 1*time.Second)
+	defer cancel()
+
+	ttl, err := s.db.PTTL(ctx, deviceKey(id)).Result()
+	if err != nil {
+		return time.Time{}, wrap(err)
+	}
+	if ttl <= 0 {
+		return time.Time{}, nil
+	}
+
+	// SET ... GET возвращает прежнее значение той же командой, одновременные опросы не теряются
+	prev, err := s.db.SetArgs(ctx, devicePollKey(id), t.Format(time.RFC3339Nano), redis.SetArgs{
+		TTL: ttl,
+		Get: true,
+	}).Result()
+	if err != nil {
+		if err == redis.Nil {
+			return time.Time{}, nil
+		}
+		return time.Time{}, wrap(err)
+	}
+
+	return time.Parse(time.RFC3339Nano, prev)
+}
+
+// ApproveDeviceCode Записывает решение пользователя по запросу устройства в базе redis.
+func (s Storage) ApproveDeviceCode(ctx context.Context, userCode, username string, approved bool) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, 1*time.Second)
+	defer cancel()
+
+	id, err := s.db.Get(ctx, deviceUserKey(userCode)).Result()
+	if err != nil {
+		if err == redis.Nil {
+			return false, nil
+		}
+		return false, wrap(err)
+	}
+	ttl, err := s.db.PTTL(ctx, deviceKey(id)).Result()
+	if err != nil {
+		return false, wrap(err)
+	}
+	if ttl <= 0 {
+		return false, nil
+	}
+
+	decision := deviceDecision{Status: Interface.DeviceDenied, Username: username}
+	if approved {
+		decision.Status = Interface.DeviceApproved
+	}
+	data, err := json.Marshal(decision)
+	if err != nil {
+		return false, wrap(err)
+	}
+
+	// Решение записывается только один раз
+	return s.db.SetNX(ctx, deviceStatusKey(id), data, ttl).Result()
+}
+
+// DelDeviceCode Удаляет запрос авторизации устройства в базе redis.
+func (s Storage) DelDeviceCode(ctx context.Context, id string) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, 1*time.Second)
+	defer cancel()
+
+	data, err := s.db.GetDel(ctx, deviceKey(id)).Bytes()
+	if err != nil {
+		if err == redis.Nil {
+			return false, nil
+		}
+		return false, wrap(err)
+	}
+
+	var d Interface.DeviceCode
+	if err = json.Unmarshal(data, &d); err != nil {
+		return false, wrap(err)
+	}
+	err = s.db.Del(ctx, deviceUserKey(d.UserCode), deviceStatusKey(id), devicePollKey(id)).Err()
+	if err != nil {
+		return false, wrap(err)
+	}
+
+	return true, nil
+}
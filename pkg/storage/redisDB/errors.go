@@ -0,0 +1,26 @@
+package redisDB
+
+import (
+	Interface "authorization/pkg/storage"
+	"errors"
+	"fmt"
+	"github.com/redis/go-redis/v9"
+	"net"
+)
+
+// wrap Переводит ошибку redis в ошибки хранилища, исходная ошибка остаётся в цепочке.
+func wrap(err error) error {
+	var netErr net.Error
+	switch {
+	case err == nil,
+		errors.Is(err, Interface.ErrNotFound),
+		errors.Is(err, Interface.ErrAlreadyExists),
+		errors.Is(err, Interface.ErrUnavailable):
+		return err
+	case errors.Is(err, redis.Nil):
+		return fmt.Errorf("%w: %w", Interface.ErrNotFound, err)
+	case Interface.Interrupted(err), errors.Is(err, redis.ErrClosed), errors.As(err, &netErr):
+		return Interface.Unavailable(err)
+	}
+	return err
+}
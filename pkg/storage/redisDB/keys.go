@@ -0,0 +1,66 @@
+package redisDB
+
+import (
+	Interface "authorization/pkg/storage"
+	"context"
+	"encoding/json"
+	"log"
+	"time"
+)
+
+// signingKeysKey Хеш с ключами подписи, поле — kid.
+const signingKeysKey = "signing_keys"
+
+// AddSigningKey Сохраняет ключ подписи в базе redis.
+func (s Storage) AddSigningKey(ctx context.Context, k Interface.SigningKey) error {
+	ctx, cancel := context.WithTimeout(ctx, 1*time.Second)
+	defer cancel()
+
+	data, err := json.Marshal(k)
+	if err != nil {
+		return wrap(err)
+	}
+
+	err = s.db.HSet(ctx, signingKeysKey, k.ID, data).Err()
+	if err != nil {
+		log.Printf("Не удалось сохранить ключ подписи %v\n", err)
+		return wrap(err)
+	}
+
+	return nil
+}
+
+// ListSigningKeys Возвращает все ключи подписи из базы redis.
+func (s Storage) ListSigningKeys(ctx context.Context) ([]Interface.SigningKey, error) {
+	ctx, cancel := context.WithTimeout(ctx, 1*time.Second)
+	defer cancel()
+
+	values, err := s.db.HGetAll(ctx, signingKeysKey).Result()
+	if err != nil {
+		return nil, wrap(err)
+	}
+
+	var keys []Interface.SigningKey
+	for _, v := range values {
+		var k Interface.SigningKey
+		if err = json.Unmarshal([]byte(v), &k); err != nil {
+			return nil, wrap(err)
+		}
+		keys = append(keys, k)
+	}
+
+	return keys, nil
+}
+
+// DelSigningKey Удаляет ключ подписи в базе redis.
+func (s Storage) DelSigningKey(ctx context.Context, id string) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, 1*time.Second)
+	defer cancel()
+
+	n, err := s.db.HDel(ctx, signingKeysKey, id).Result()
+	if err != nil {
+		return false, wrap(err)
+	}
+
+	return n > 0, nil
+}
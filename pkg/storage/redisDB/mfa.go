@@ -0,0 +1,144 @@
+package redisDB
+
+import (
+	Interface "authorization/pkg/storage"
+	"context"
+	"encoding/json"
+	"github.com/redis/go-redis/v9"
+	"log"
+	"time"
+)
+
+// totpKey Ключ аутентификатора пользователя в базе redis.
+func totpKey(username string) string {
+	return "totp:" + username
+}
+
+// totpStepKey Ключ шага последнего принятого кода.
+func totpStepKey(username string) string {
+	return "totp_step:" + username
+}
+
+// totpRecoveryKey Ключ множества хешей кодов восстановления.
+func totpRecoveryKey(username string) string {
+	return "totp_recovery:" + username
+}
+
+// useStep Запоминает шаг ARGV[1] в KEYS[2], если он больше сохранённого,
+// и только для существующего аутентификатора KEYS[1].
+var useStep = redis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 0 then
+	return 0
+end
+local last = tonumber(redis.call('GET', KEYS[2]) or '-1')
+local step = tonumber(ARGV[1])
+if step <= last then
+	return 0
+end
+redis.call('SET', KEYS[2], ARGV[1])
+return 1
+`)
+
+// SetTOTP Заменяет аутентификатор пользователя в базе redis.
+func (s Storage) SetTOTP(ctx context.Context, t Interface.TOTP) error {
+	ctx, cancel := context.WithTimeout(ctx, 1*time.Second)
+	defer cancel()
+
+	// Шаг и коды восстановления хранятся отдельно, чтобы их можно было менять атомарно
+	codes := make([]interface{}, len(t.RecoveryCodes))
+	for i, c := range t.RecoveryCodes {
+		codes[i] = c
+	}
+	step := t.LastStep
+	t.RecoveryCodes, t.LastStep = nil, 0
+	data, err := json.Marshal(t)
+	if err != nil {
+		return wrap(err)
+	}
+
+	_, err = s.db.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, totpKey(t.Username), data, 0)
+		pipe.Del(ctx, totpStepKey(t.Username), totpRecoveryKey(t.Username))
+		if step > 0 {
+			pipe.Set(ctx, totpStepKey(t.Username), step, 0)
+		}
+		if len(codes) > 0 {
+			pipe.SAdd(ctx, totpRecoveryKey(t.Username), codes...)
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("Не удалось сохранить аутентификатор %v\n", err)
+		return wrap(err)
+	}
+
+	return nil
+}
+
+// SearchTOTP Находит аутентификатор пользователя в базе redis.
+func (s Storage) SearchTOTP(ctx context.Context, username string) (*Interface.TOTP, error) {
+	ctx, cancel := context.WithTimeout(ctx, 1*time.Second)
+	defer cancel()
+
+	data, err := s.db.Get(ctx, totpKey(username)).Bytes()
+	if err != nil {
+		return nil, wrap(err)
+	}
+
+	var t Interface.TOTP
+	if err = json.Unmarshal(data, &t); err != nil {
+		return nil, wrap(err)
+	}
+
+	t.RecoveryCodes, err = s.db.SMembers(ctx, totpRecoveryKey(username)).Result()
+	if err != nil {
+		return nil, wrap(err)
+	}
+	t.LastStep, err = s.db.Get(ctx, totpStepKey(username)).Int64()
+	if err != nil && err != redis.Nil {
+		return nil, wrap(err)
+	}
+
+	return &t, nil
+}
+
+// UseTOTPStep Атомарно запоминает шаг принятого кода в базе redis.
+func (s Storage) UseTOTPStep(ctx context.Context, username string, step int64) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, 1*time.Second)
+	defer cancel()
+
+	n, err := useStep.Run(ctx, s.db, []string{totpKey(username), totpStepKey(username)}, step).Int()
+	if err != nil {
+		return false, wrap(err)
+	}
+	return n == 1, nil
+}
+
+// UseRecoveryCode Атомарно вычёркивает код восстановления в базе redis.
+func (s Storage) UseRecoveryCode(ctx context.Context, username, hash string) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, 1*time.Second)
+	defer cancel()
+
+	n, err := s.db.SRem(ctx, totpRecoveryKey(username), hash).Result()
+	if err != nil {
+		return false, wrap(err)
+	}
+	return n == 1, nil
+}
+
+// DelTOTP Удаляет аутентификатор пользователя в базе redis.
+func (s Storage) DelTOTP(ctx context.Context, username string) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, 1*time.Second)
+	defer cancel()
+
+	var del *redis.IntCmd
+	_, err := s.db.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		del = pipe.Del(ctx, totpKey(username))
+		pipe.Del(ctx, totpStepKey(username), totpRecoveryKey(username))
+		return nil
+	})
+	if err != nil {
+		return false, wrap(err)
+	}
+	return del.Val() == 1, nil
+}
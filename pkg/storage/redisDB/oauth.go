@@ -0,0 +1,110 @@
+package redisDB
+
+import (
+	Interface "authorization/pkg/storage"
+	"context"
+	"encoding/json"
+	"log"
+	"time"
+)
+
+// clientKey Ключ клиента OAuth в базе redis.
+func clientKey(id string) string {
+	return "oauth_client:" + id
+}
+
+// authCodeKey Ключ кода авторизации в базе redis.
+func authCodeKey(id string) string {
+	return "auth_code:" + id
+}
+
+// AddClient Сохраняет клиента OAuth в базе redis.
+func (s Storage) AddClient(ctx context.Context, c Interface.Client) error {
+	ctx, cancel := context.WithTimeout(ctx, 1*time.Second)
+	defer cancel()
+
+	data, err := json.Marshal(c)
+	if err != nil {
+		return wrap(err)
+	}
+
+	err = s.db.Set(ctx, clientKey(c.ID), data, 0).Err()
+	if err != nil {
+		log.Printf("Не удалось сохранить клиента OAuth %v\n", err)
+		return wrap(err)
+	}
+
+	return nil
+}
+
+// SearchClient Находит клиента OAuth в базе redis.
+func (s Storage) SearchClient(ctx context.Context, id string) (*Interface.Client, error) {
+	ctx, cancel := context.WithTimeout(ctx, 1*time.Second)
+	defer cancel()
+
+	data, err := s.db.Get(ctx, clientKey(id)).Bytes()
+	if err != nil {
+		return nil, wrap(err)
+	}
+
+	var c Interface.Client
+	if err = json.Unmarshal(data, &c); err != nil {
+		return nil, wrap(err)
+	}
+
+	return &c, nil
+}
+
+// DelClient Удаляет клиента OAuth в базе redis.
+func (s Storage) DelClient(ctx context.Context, id string) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, 1*time.Second)
+	defer cancel()
+
+	n, err := s.db.Del(ctx, clientKey(id)).Result()
+	if err != nil {
+		return false, wrap(err)
+	}
+
+	return n > 0, nil
+}
+
+// AddAuthCode Сохраняет код авторизации в базе redis, ключ истекает вместе с кодом.
+func (s Storage) AddAuthCode(ctx context.Context, c Interface.AuthCode) error {
+	ctx, cancel := context.WithTimeout(ctx, 1*time.Second)
+	defer cancel()
+
+	data, err := json.Marshal(c)
+	if err != nil {
+		return wrap(err)
+	}
+
+	err = s.db.Set(ctx, authCodeKey(c.ID), data, time.Until(c.ExpiresAt)).Err()
+	if err != nil {
+		log.Printf("Не удалось сохранить код авторизации %v\n", err)
+		return wrap(err)
+	}
+
+	return nil
+}
+
+// UseAuthCode Атомарно забирает код авторизации из базы redis.
+func (s Storage) UseAuthCode(ctx context.Context, id string) (*Interface.AuthCode, error) {
+	ctx, cancel := context.WithTimeout(ctx, 1*time.Second)
+	defer cancel()
+
+	// GETDEL гарантирует, что из двух одновременных обменов код получит только один
+	data, err := s.db.GetDel(ctx, authCodeKey(id)).Bytes()
+	if err != nil {
+		return nil, wrap(err)
+	}
+
+	var c Interface.AuthCode
+	if err = json.Unmarshal(data, &c); err != nil {
+		return nil, wrap(err)
+	}
+	if time.Now().After(c.ExpiresAt) {
+		return nil, Interface.ErrNotFound
+	}
+
+	return &c, nil
+}
@@ -0,0 +1,135 @@
+package redisDB
+
+import (
+	Interface "authorization/pkg/storage"
+	"context"
+	"encoding/json"
+	"github.com/redis/go-redis/v9"
+	"log"
+	"time"
+)
+
+// outboxDueKey Ключ упорядоченного множества писем по времени следующей попытки.
+const outboxDueKey = "outbox_due"
+
+// outboxKey Ключ письма в очереди в базе redis.
+func outboxKey(id string) string {
+	return "outbox:" + id
+}
+
+// claimOutbox Забирает до ARGV[3] писем с временем попытки не позже ARGV[1]
+// и переносит их попытку на ARGV[2].
+var claimOutbox = redis.NewScript(`
+local ids = redis.call('ZRANGEBYSCORE', KEYS[1], '-inf', ARGV[1], 'LIMIT', 0, tonumber(ARGV[3]))
+for _, id in ipairs(ids) do
+	redis.call('ZADD', KEYS[1], ARGV[2], id)
+end
+return ids
+`)
+
+// AddOutboxMessage Ставит письмо в очередь в базе redis.
+func (s Storage) AddOutboxMessage(ctx context.Context, m Interface.OutboxMessage) error {
+	ctx, cancel := context.WithTimeout(ctx, 1*time.Second)
+	defer cancel()
+
+	data, err := json.Marshal(m)
+	if err != nil {
+		return wrap(err)
+	}
+
+	_, err = s.db.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, outboxKey(m.ID), data, 0)
+		pipe.ZAdd(ctx, outboxDueKey, redis.Z{Score: float64(m.NextAttempt.UnixMilli()), Member: m.ID})
+		return nil
+	})
+	if err != nil {
+		log.Printf("Не удалось поставить письмо в очередь %v\n", err)
+		return wrap(err)
+	}
+
+	return nil
+}
+
+// ClaimOutboxMessages Забирает письма, время отправки которых наступило, из базы redis.
+func (s Storage) ClaimOutboxMessages(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]Interface.OutboxMessage, error) {
+	ctx, cancel := context.WithTimeout(ctx, 1*time.Second)
+	defer cancel()
+
+	ids, err := claimOutbox.Run(ctx, s.db, []string{outboxDueKey},
+		now.UnixMilli(), now.Add(lease).UnixMilli(), limit).StringSlice()
+	if err != nil || len(ids) == 0 {
+		return nil, wrap(err)
+	}
+
+	keys := make([]string, len(ids))
+	for i, id := range ids {
+		keys[i] = outboxKey(id)
+	}
+	values, err := s.db.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, wrap(err)
+	}
+
+	var list []Interface.OutboxMessage
+	for _, v := range values {
+		data, ok := v.(string)
+		if !ok {
+			// Письмо удалено после выбора
+			continue
+		}
+		var m Interface.OutboxMessage
+		if err = json.Unmarshal([]byte(data), &m); err != nil {
+			return nil, wrap(err)
+		}
+		list = append(list, m)
+	}
+
+	return list, nil
+}
+
+// RetryOutboxMessage Сохраняет неудачную попытку отправки письма в базе redis.
+func (s Storage) RetryOutboxMessage(ctx context.Context, id string, attempts int, next time.Time, lastError string) error {
+	ctx, cancel := context.WithTimeout(ctx, 1*time.Second)
+	defer cancel()
+
+	data, err := s.db.Get(ctx, outboxKey(id)).Bytes()
+	if err != nil {
+		if err == redis.Nil {
+			return nil
+		}
+		return wrap(err)
+	}
+	var m Interface.OutboxMessage
+	if err = json.Unmarshal(data, &m); err != nil {
+		return wrap(err)
+	}
+	m.Attempts, m.NextAttempt, m.LastError = attempts, next, lastError
+	if data, err = json.Marshal(m); err != nil {
+		return wrap(err)
+	}
+
+	_, err = s.db.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.SetXX(ctx, outboxKey(id), data, 0)
+		pipe.ZAddXX(ctx, outboxDueKey, redis.Z{Score: float64(next.UnixMilli()), Member: id})
+		return nil
+	})
+	return wrap(err)
+}
+
+// DelOutboxMessage Удаляет письмо из очереди в базе redis.
+func (s Storage) DelOutboxMessage(ctx context.Context, id string) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, 1*time.Second)
+	defer cancel()
+
+	var del *redis.IntCmd
+	_, err := s.db.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		del = pipe.Del(ctx, outboxKey(id))
+		pipe.ZRem(ctx, outboxDueKey, id)
+		return nil
+	})
+	if err != nil {
+		return false, wrap(err)
+	}
+
+	return del.Val() > 0, nil
+}
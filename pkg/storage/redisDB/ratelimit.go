@@ -0,0 +1,56 @@
+package redisDB
+
+import (
+	"context"
+	"github.com/redis/go-redis/v9"
+	"strconv"
+	"time"
+)
+
+// takeToken Пополняет корзину KEYS[1] со скоростью ARGV[1] токенов в секунду до ARGV[2]
+// на момент ARGV[3] (миллисекунды) и забирает один токен, если он есть.
+// Корзина удаляется, когда снова наполнится.
+var takeToken = redis.NewScript(`
+local rate = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+local b = redis.call('HMGET', KEYS[1], 'tokens', 'ts')
+local tokens = tonumber(b[1])
+local ts = tonumber(b[2])
+if tokens == nil or ts == nil then
+	tokens = burst
+	ts = now
+end
+tokens = math.min(burst, tokens + math.max(0, now - ts) * rate / 1000)
+local allowed = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+end
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'ts', tostring(now))
+redis.call('PEXPIRE', KEYS[1], math.ceil((burst - tokens) * 1000 / rate) + 1000)
+return {allowed, tostring(tokens)}
+`)
+
+// TakeToken Забирает токен из корзины в базе redis.
+func (s Storage) TakeToken(ctx context.Context, key string, rate float64, burst int, now time.Time) (bool, float64, error) {
+	ctx, cancel := context.WithTimeout(ctx, 1*time.Second)
+	defer cancel()
+
+	res, err := takeToken.Run(ctx, s.db, []string{"ratelimit:" + key},
+		strconv.FormatFloat(rate, 'f', -1, 64), burst, now.UnixMilli()).Slice()
+	if err != nil {
+		return false, 0, wrap(err)
+	}
+	if len(res) != 2 {
+		return false, 0, redis.Nil
+	}
+
+	allowed, _ := res[0].(int64)
+	text, _ := res[1].(string)
+	tokens, err := strconv.ParseFloat(text, 64)
+	if err != nil {
+		return false, 0, wrap(err)
+	}
+	return allowed == 1, tokens, nil
+}
@@ -1,10 +1,13 @@
 package redisDB
 
 import (
+	"authorization/pkg/check"
 	Interface "authorization/pkg/storage"
 	"context"
+	"errors"
 	"github.com/redis/go-redis/v9"
 	"log"
+	"strings"
 	"time"
 )
 
@@ -13,6 +16,24 @@ type Storage struct {
 	db *redis.Client
 }
 
+// delIndexed Атомарно удаляет ключи, перечисленные во множестве-индексе KEYS[1], и сам индекс.
+// Ключи строятся как ARGV[i] .. член множества, возвращается число удалённых ключей ARGV[1].
+// Атомарность не даёт записи, добавленной во время удаления, остаться действующей.
+var delIndexed = redis.NewScript(`
+local ids = redis.call('SMEMBERS', KEYS[1])
+local n = 0
+for _, id in ipairs(ids) do
+	for i = 1, #ARGV do
+		local d = redis.call('DEL', ARGV[i] .. id)
+		if i == 1 then
+			n = n + d
+		end
+	end
+end
+redis.call('DEL', KEYS[1])
+return n
+`)
+
 // New Конструктор
 func New(constr string) (*Storage, error) {
 	client, err := redis.ParseURL(constr)
@@ -25,59 +46,209 @@ func New(constr string) (*Storage, error) {
 	return s, nil
 }
 
-// AddAccount Добавляет данные в базу redis.
-func (s *Storage) AddAccount(c Interface.Account) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+// accountKey Ключ хеша аккаунта в базе redis.
+func accountKey(username string) string {
+	return "account:" + username
+}
+
+// accountIDKey Ключ логина аккаунта по его ID в базе redis.
+func accountIDKey(id string) string {
+	return "account_id:" + id
+}
+
+// accountFields Поля хеша аккаунта.
+func accountFields(c Interface.Account) []interface{} {
+	return append([]interface{}{"password", c.Password}, profileFields(c)...)
+}
+
+// profileFields Поля хеша аккаунта, кроме пароля. Время хранится в RFC 3339, пустая строка — нулевое время.
+func profileFields(c Interface.Account) []interface{} {
+	return []interface{}{
+		"userId", c.ID,
+		"displayName", c.DisplayName,
+		"status", string(c.Status),
+		"emailVerified", formatBool(c.EmailVerified),
+		"createdAt", formatTime(c.CreatedAt),
+		"updatedAt", formatTime(c.UpdatedAt),
+		"lastLoginAt", formatTime(c.LastLoginAt),
+	}
+}
+
+// parseAccount Собирает аккаунт из полей хеша.
+func parseAccount(username string, m map[string]string) (*Interface.Account, error) {
+	c := Interface.Account{
+		ID:            m["userId"],
+		Username:      username,
+		Password:      m["password"],
+		DisplayName:   m["displayName"],
+		Status:        Interface.AccountStatus(m["status"]),
+		EmailVerified: m["emailVerified"] == "1",
+	}
+	var err error
+	if c.CreatedAt, err = parseTime(m["createdAt"]); err != nil {
+		return nil, err
+	}
+	if c.UpdatedAt, err = parseTime(m["updatedAt"]); err != nil {
+		return nil, err
+	}
+	if c.LastLoginAt, err = parseTime(m["lastLoginAt"]); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+func formatBool(b bool) string {
+	if b {
+		return "1"
+	}
+	return "0"
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339Nano)
+}
+
+func parseTime(v string) (time.Time, error) {
+	if v == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.RFC3339Nano, v)
+}
+
+// setAccount Записывает поля ARGV (пары имя, значение) в хеш KEYS[1], только если он есть.
+var setAccount = redis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 0 then
+	return 0
+end
+redis.call('HSET', KEYS[1], unpack(ARGV))
+return 1
+`)
+
+// updateAccount Меняет поля существующего аккаунта и время его изменения.
+func (s Storage) updateAccount(ctx context.Context, username string, fields ...interface{}) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, 1*time.Second)
+	defer cancel()
+
+	fields = append(fields, "updatedAt", formatTime(time.Now()))
+	n, err := setAccount.Run(ctx, s.db, []string{accountKey(username)}, fields...).Int()
+	if err != nil {
+		return false, wrap(err)
+	}
+	return n == 1, nil
+}
+
+// createAccount Записывает поля ARGV, начиная со второго (пары имя, значение), в хеш KEYS[1], только если его ещё нет,
+// и сохраняет логин ARGV[1] под ключом ID KEYS[2].
+var createAccount = redis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 1 then
+	return 0
+end
+redis.call('HSET', KEYS[1], unpack(ARGV, 2))
+redis.call('SET', KEYS[2], ARGV[1])
+return 1
+`)
+
+// CreateAccount Добавляет аккаунт в базу redis, если логин свободен.
+// Проверка и запись выполняются одним скриптом, параллельные запросы не создадут аккаунт дважды.
+func (s *Storage) CreateAccount(ctx context.Context, c Interface.Account) error {
+	ctx, cancel := context.WithTimeout(ctx, 1*time.Second)
 	defer cancel()
 
-	err := s.db.Set(ctx, c.Username, c.Password, 0).Err()
+	if err := c.SetDefaults(); err != nil {
+		return wrap(err)
+	}
+	keys := []string{accountKey(c.Username), accountIDKey(c.ID)}
+	n, err := createAccount.Run(ctx, s.db, keys, append([]interface{}{c.Username}, accountFields(c)...)...).Int()
 	if err != nil {
 		log.Printf("Не удалось сделать запись %v\n", err)
-		return nil
+		return wrap(err)
+	}
+	if n == 0 {
+		return Interface.ErrAlreadyExists
 	}
 
 	return nil
 }
 
 // SearchAccount Находит пароль по ключу в базе redis
-func (s Storage) SearchAccount(c Interface.Account) (result string, err error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+func (s Storage) SearchAccount(ctx context.Context, c Interface.Account) (result string, err error) {
+	ctx, cancel := context.WithTimeout(ctx, 1*time.Second)
 	defer cancel()
 
-	result, err = s.db.Get(ctx, c.Username).Result()
+	result, err = s.db.HGet(ctx, accountKey(c.Username), "password").Result()
 	if err != nil {
 		log.Printf("Нет такой записи %v\n", err)
-		return "", err
+		return "", wrap(err)
 	}
-	return result, err
+	return result, wrap(err)
 }
 
 // KeysAccount Проверяет логин по ключу в базе redis
-func (s Storage) KeysAccount(c Interface.Account) (bool, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+func (s Storage) KeysAccount(ctx context.Context, c Interface.Account) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, 1*time.Second)
 	defer cancel()
 
-	key, err := s.db.Keys(ctx, c.Username).Result()
+	n, err := s.db.Exists(ctx, accountKey(c.Username)).Result()
 	if err != nil {
 		log.Printf("Ошибка при поиске ключей: %v\n", err)
-		return false, err
+		return false, wrap(err)
 	}
+	return n > 0, nil
+}
 
-	// Обработка найденных ключей
-	for _, k := range key {
-		if c.Username == k {
-			return true, nil
-		}
+// GetAccount Находит аккаунт по логину в базе redis
+func (s Storage) GetAccount(ctx context.Context, username string) (*Interface.Account, error) {
+	ctx, cancel := context.WithTimeout(ctx, 1*time.Second)
+	defer cancel()
+
+	m, err := s.db.HGetAll(ctx, accountKey(username)).Result()
+	if err != nil {
+		return nil, wrap(err)
+	}
+	if len(m) == 0 {
+		return nil, Interface.ErrNotFound
+	}
+	return parseAccount(username, m)
+}
+
+// GetAccountByID Находит аккаунт по ID в базе redis
+func (s Storage) GetAccountByID(ctx context.Context, id string) (*Interface.Account, error) {
+	ctx, cancel := context.WithTimeout(ctx, 1*time.Second)
+	defer cancel()
+
+	username, err := s.db.Get(ctx, accountIDKey(id)).Result()
+	if err != nil {
+		return nil, wrap(err)
+	}
+	m, err := s.db.HGetAll(ctx, accountKey(username)).Result()
+	if err != nil {
+		return nil, wrap(err)
 	}
-	return false, nil
+	// Логин мог освободиться и достаться новому аккаунту с другим ID
+	if m["userId"] != id {
+		return nil, Interface.ErrNotFound
+	}
+	return parseAccount(username, m)
 }
 
+// delAccount Удаляет хеш аккаунта KEYS[1] и ключ его ID с префиксом ARGV[1].
+var delAccount = redis.NewScript(`
+local id = redis.call('HGET', KEYS[1], 'userId')
+if id then
+	redis.call('DEL', ARGV[1] .. id)
+end
+return redis.call('DEL', KEYS[1])
+`)
+
 // DelAccount Удаляет аккаунт в базе Redis
-func (s Storage) DelAccount(c Interface.Account) (bool, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+func (s Storage) DelAccount(ctx context.Context, c Interface.Account) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, 1*time.Second)
 	defer cancel()
 
-	err := s.db.Del(ctx, c.Username).Err()
+	err := delAccount.Run(ctx, s.db, []string{accountKey(c.Username)}, accountIDKey("")).Err()
 	if err != nil {
 		log.Printf("Не удалось удвлить аккаунт %v\n", err)
 		return false, nil
@@ -85,3 +256,190 @@ func (s Storage) DelAccount(c Interface.Account) (bool, error) {
 
 	return true, nil
 }
+
+// UpdatePassword Заменяет хеш пароля существующего аккаунта в базе Redis
+func (s Storage) UpdatePassword(ctx context.Context, c Interface.Account) error {
+	// Пароль меняется, только если аккаунт есть: удалённый во время входа аккаунт не воссоздаётся
+	_, err := s.updateAccount(ctx, c.Username, "password", c.Password)
+	if err != nil {
+		log.Printf("Не удалось обновить пароль %v\n", err)
+		return wrap(err)
+	}
+
+	return nil
+}
+
+// changePassword Заменяет пароль в хеше KEYS[1] на ARGV[2], только если он равен ARGV[1].
+var changePassword = redis.NewScript(`
+if redis.call('HGET', KEYS[1], 'password') ~= ARGV[1] then
+	return 0
+end
+redis.call('HSET', KEYS[1], 'password', ARGV[2], 'updatedAt', ARGV[3])
+return 1
+`)
+
+// ChangePassword Атомарно заменяет хеш пароля в базе Redis, если он не изменился
+func (s Storage) ChangePassword(ctx context.Context, username, old, password string) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, 1*time.Second)
+	defer cancel()
+
+	n, err := changePassword.Run(ctx, s.db, []string{accountKey(username)}, old, password, formatTime(time.Now())).Int()
+	if err != nil {
+		log.Printf("Не удалось сменить пароль %v\n", err)
+		return false, wrap(err)
+	}
+
+	return n == 1, nil
+}
+
+// SetDisplayName Меняет отображаемое имя пользователя в базе redis
+func (s Storage) SetDisplayName(ctx context.Context, username, displayName string) (bool, error) {
+	return s.updateAccount(ctx, username, "displayName", displayName)
+}
+
+// SetAccountStatus Меняет статус аккаунта в базе redis
+func (s Storage) SetAccountStatus(ctx context.Context, username string, status Interface.AccountStatus) (bool, error) {
+	return s.updateAccount(ctx, username, "status", string(status))
+}
+
+// verifyAccount Отмечает адрес подтверждённым, аккаунт в статусе pending становится активным.
+var verifyAccount = redis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 0 then
+	return 0
+end
+redis.call('HSET', KEYS[1], 'emailVerified', '1', 'updatedAt', ARGV[1])
+if redis.call('HGET', KEYS[1], 'status') == 'pending' then
+	redis.call('HSET', KEYS[1], 'status', 'active')
+end
+return 1
+`)
+
+// SetEmailVerified Отмечает адрес пользователя подтверждённым в базе redis
+func (s Storage) SetEmailVerified(ctx context.Context, username string) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, 1*time.Second)
+	defer cancel()
+
+	n, err := verifyAccount.Run(ctx, s.db, []string{accountKey(username)}, formatTime(time.Now())).Int()
+	if err != nil {
+		return false, wrap(err)
+	}
+	return n == 1, nil
+}
+
+// SetLastLogin Запоминает время последнего входа пользователя в базе redis
+func (s Storage) SetLastLogin(ctx context.Context, username string, t time.Time) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, 1*time.Second)
+	defer cancel()
+
+	n, err := setAccount.Run(ctx, s.db, []string{accountKey(username)}, "lastLoginAt", formatTime(t)).Int()
+	if err != nil {
+		return false, wrap(err)
+	}
+	return n == 1, nil
+}
+
+// CountLegacyAccounts Считает аккаунты с паролем в устаревшем формате SHA-256 в базе Redis
+func (s Storage) CountLegacyAccounts(ctx context.Context) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	var count int64
+	iter := s.db.Scan(ctx, 0, accountKey("*"), 1000).Iterator()
+	for iter.Next(ctx) {
+		value, err := s.db.HGet(ctx, iter.Val(), "password").Result()
+		if err != nil {
+			// Аккаунт уже удалён
+			continue
+		}
+		if check.IsLegacyHash(value) {
+			count++
+		}
+	}
+	if err := iter.Err(); err != nil {
+		return 0, wrap(err)
+	}
+
+	return count, nil
+}
+
+// migrateAccount Переносит пароль из строки KEYS[1] прежнего формата в хеш аккаунта KEYS[2]
+// с полями ARGV (пары имя, значение) и сохраняет логин под ключом ID KEYS[3].
+// Если хеш уже есть, прежняя запись просто удаляется.
+var migrateAccount = redis.NewScript(`
+if redis.call('TYPE', KEYS[1]).ok ~= 'string' then
+	return 0
+end
+local password = redis.call('GET', KEYS[1])
+redis.call('DEL', KEYS[1])
+if redis.call('EXISTS', KEYS[2]) == 1 then
+	return 0
+end
+redis.call('HSET', KEYS[2], 'password', password, unpack(ARGV))
+redis.call('SET', KEYS[3], KEYS[1])
+return 1
+`)
+
+// MigrateAccounts Переводит аккаунты, хранившиеся строкой с хешем пароля под ключом-логином, в хеши account:
+// и добавляет недостающие ключи account_id: для поиска аккаунта по ID.
+func (s Storage) MigrateAccounts(ctx context.Context) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Minute)
+	defer cancel()
+
+	var count int64
+	iter := s.db.Scan(ctx, 0, "*", 1000).Iterator()
+	for iter.Next(ctx) {
+		username := iter.Val()
+		// Служебные ключи содержат ":" или не содержат "@", логином служит адрес почты
+		if strings.Contains(username, ":") || !strings.Contains(username, "@") {
+			continue
+		}
+
+		c := Interface.Account{Username: username, EmailVerified: true}
+		v, err := s.SearchEmailVerification(ctx, username)
+		if err != nil && !errors.Is(err, Interface.ErrNotFound) {
+			return count, err
+		}
+		if err == nil {
+			c.CreatedAt, c.EmailVerified = v.CreatedAt, v.Verified
+			if !v.Verified {
+				c.Status = Interface.StatusPending
+			}
+		}
+		if err = c.SetDefaults(); err != nil {
+			return count, wrap(err)
+		}
+
+		// Пароль переносит скрипт, чтобы не затереть смену пароля во время переноса
+		keys := []string{username, accountKey(username), accountIDKey(c.ID)}
+		n, err := migrateAccount.Run(ctx, s.db, keys, profileFields(c)...).Int()
+		if err != nil {
+			return count, wrap(err)
+		}
+		count += int64(n)
+	}
+	if err := iter.Err(); err != nil {
+		return count, wrap(err)
+	}
+
+	// Аккаунтам, созданным до появления поиска по ID, добавляется ключ ID
+	iter = s.db.Scan(ctx, 0, accountKey("*"), 1000).Iterator()
+	for iter.Next(ctx) {
+		id, err := s.db.HGet(ctx, iter.Val(), "userId").Result()
+		if errors.Is(err, redis.Nil) {
+			// Аккаунт уже удалён
+			continue
+		}
+		if err != nil {
+			return count, wrap(err)
+		}
+		username := strings.TrimPrefix(iter.Val(), accountKey(""))
+		if err = s.db.SetNX(ctx, accountIDKey(id), username, 0).Err(); err != nil {
+			return count, wrap(err)
+		}
+	}
+	if err := iter.Err(); err != nil {
+		return count, wrap(err)
+	}
+
+	return count, nil
+}
@@ -0,0 +1,81 @@
+package redisDB
+
+import (
+	Interface "authorization/pkg/storage"
+	"context"
+	"encoding/json"
+	"github.com/redis/go-redis/v9"
+	"log"
+	"time"
+)
+
+// resetKey Ключ токена сброса пароля в базе redis.
+func resetKey(id string) string {
+	return "password_reset:" + id
+}
+
+// userResetsKey Ключ множества токенов сброса пароля пользователя.
+func userResetsKey(username string) string {
+	return "password_reset_user:" + username
+}
+
+// AddPasswordReset Сохраняет токен сброса пароля в базе redis.
+func (s Storage) AddPasswordReset(ctx context.Context, c Interface.PasswordReset) error {
+	ctx, cancel := context.WithTimeout(ctx, 1*time.Second)
+	defer cancel()
+
+	data, err := json.Marshal(c)
+	if err != nil {
+		return wrap(err)
+	}
+
+	ttl := time.Until(c.ExpiresAt)
+	_, err = s.db.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, resetKey(c.ID), data, ttl)
+		pipe.SAdd(ctx, userResetsKey(c.Username), c.ID)
+		pipe.Expire(ctx, userResetsKey(c.Username), ttl)
+		return nil
+	})
+	if err != nil {
+		log.Printf("Не удалось сохранить токен сброса пароля %v\n", err)
+		return wrap(err)
+	}
+
+	return nil
+}
+
+// UsePasswordReset Атомарно забирает токен сброса пароля из базы redis.
+func (s Storage) UsePasswordReset(ctx context.Context, id string) (*Interface.PasswordReset, error) {
+	ctx, cancel := context.WithTimeout(ctx, 1*time.Second)
+	defer cancel()
+
+	// GETDEL отдаёт токен только одному из одновременных запросов
+	data, err := s.db.GetDel(ctx, resetKey(id)).Bytes()
+	if err != nil {
+		return nil, wrap(err)
+	}
+
+	var c Interface.PasswordReset
+	if err = json.Unmarshal(data, &c); err != nil {
+		return nil, wrap(err)
+	}
+	if err = s.db.SRem(ctx, userResetsKey(c.Username), id).Err(); err != nil {
+		log.Println(err)
+	}
+
+	return &c, nil
+}
+
+// DelUserPasswordResets Удаляет все токены сброса пароля пользователя в базе redis.
+func (s Storage) DelUserPasswordResets(ctx context.Context, username string) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, 1*time.Second)
+	defer cancel()
+
+	n, err := delIndexed.Run(ctx, s.db, []string{userResetsKey(username)}, resetKey("")).Int64()
+	if err != nil {
+		log.Printf("Не удалось удалить токены сброса пароля %v\n", err)
+		return 0, wrap(err)
+	}
+
+	return n, nil
+}
@@ -0,0 +1,162 @@
+package redisDB
+
+import (
+	Interface "authorization/pkg/storage"
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/redis/go-redis/v9"
+	"log"
+	"time"
+)
+
+// sessionKey Ключ сессии в базе redis.
+func sessionKey(id string) string {
+	return "session:" + id
+}
+
+// userSessionsKey Ключ множества идентификаторов сессий пользователя.
+func userSessionsKey(username string) string {
+	return "sessions:" + username
+}
+
+// AddSession Сохраняет сессию в базе redis, ключ истекает вместе с сессией.
+func (s Storage) AddSession(ctx context.Context, c Interface.Session) error {
+	ctx, cancel := context.WithTimeout(ctx, 1*time.Second)
+	defer cancel()
+
+	data, err := json.Marshal(c)
+	if err != nil {
+		return wrap(err)
+	}
+
+	ttl := time.Until(c.ExpiresAt)
+	_, err = s.db.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, sessionKey(c.ID), data, ttl)
+		// Индекс сессий пользователя живёт не меньше самой новой сессии
+		pipe.SAdd(ctx, userSessionsKey(c.Username), c.ID)
+		pipe.Expire(ctx, userSessionsKey(c.Username), ttl)
+		return nil
+	})
+	if err != nil {
+		log.Printf("Не удалось сохранить сессию %v\n", err)
+		return wrap(err)
+	}
+
+	return nil
+}
+
+// SearchSession Находит сессию по идентификатору в базе redis.
+func (s Storage) SearchSession(ctx context.Context, id string) (*Interface.Session, error) {
+	ctx, cancel := context.WithTimeout(ctx, 1*time.Second)
+	defer cancel()
+
+	data, err := s.db.Get(ctx, sessionKey(id)).Bytes()
+	if err != nil {
+		return nil, wrap(err)
+	}
+
+	var c Interface.Session
+	if err = json.Unmarshal(data, &c); err != nil {
+		return nil, wrap(err)
+	}
+	if time.Now().After(c.ExpiresAt) {
+		return nil, Interface.ErrNotFound
+	}
+
+	return &c, nil
+}
+
+// DelSession Удаляет сессию в базе redis.
+func (s Storage) DelSession(ctx context.Context, id string) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, 1*time.Second)
+	defer cancel()
+
+	n, err := s.db.Del(ctx, sessionKey(id)).Result()
+	if err != nil {
+		log.Printf("Не удалось удалить сессию %v\n", err)
+		return false, wrap(err)
+	}
+
+	return n > 0, nil
+}
+
+// DelUserSessions Удаляет все сессии пользователя в базе redis.
+func (s Storage) DelUserSessions(ctx context.Context, username string) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, 1*time.Second)
+	defer cancel()
+
+	n, err := delIndexed.Run(ctx, s.db, []string{userSessionsKey(username)}, sessionKey("")).Int64()
+	if err != nil {
+		log.Printf("Не удалось удалить сессии пользователя %v\n", err)
+		return 0, wrap(err)
+	}
+
+	return n, nil
+}
+
+// ListSessions Возвращает действующие сессии пользователя в базе redis.
+func (s Storage) ListSessions(ctx context.Context, username string) ([]Interface.Session, error) {
+	ctx, cancel := context.WithTimeout(ctx, 1*time.Second)
+	defer cancel()
+
+	ids, err := s.db.SMembers(ctx, userSessionsKey(username)).Result()
+	if err != nil {
+		return nil, wrap(err)
+	}
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	keys := make([]string, len(ids))
+	for i, id := range ids {
+		keys[i] = sessionKey(id)
+	}
+	values, err := s.db.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, wrap(err)
+	}
+
+	var sessions []Interface.Session
+	var stale []interface{}
+	for i, v := range values {
+		data, ok := v.(string)
+		if !ok {
+			// Сессия истекла или удалена, убираем её из индекса
+			stale = append(stale, ids[i])
+			continue
+		}
+		var c Interface.Session
+		if err = json.Unmarshal([]byte(data), &c); err != nil {
+			return nil, wrap(err)
+		}
+		sessions = append(sessions, c)
+	}
+	if len(stale) > 0 {
+		s.db.SRem(ctx, userSessionsKey(username), stale...)
+	}
+
+	return sessions, nil
+}
+
+// TouchSession Обновляет время последней активности сессии в базе redis.
+func (s Storage) TouchSession(ctx context.Context, id string, t time.Time) error {
+	ctx, cancel := context.WithTimeout(ctx, 1*time.Second)
+	defer cancel()
+
+	c, err := s.SearchSession(ctx, id)
+	if errors.Is(err, Interface.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	c.LastSeen = t
+
+	data, err := json.Marshal(c)
+	if err != nil {
+		return wrap(err)
+	}
+	// XX не даёт воскресить сессию, удалённую между чтением и записью
+	return wrap(s.db.SetArgs(ctx, sessionKey(id), data, redis.SetArgs{Mode: "XX", KeepTTL: true}).Err())
+}
@@ -0,0 +1,217 @@
+package redisDB
+
+import (
+	Interface "authorization/pkg/storage"
+	"context"
+	"encoding/json"
+	"github.com/redis/go-redis/v9"
+	"log"
+	"strconv"
+	"time"
+)
+
+// refreshKey Ключ токена обновления в базе redis.
+func refreshKey(id string) string {
+	return "refresh:" + id
+}
+
+// refreshUsedKey Ключ-отметка об использовании токена обновления.
+func refreshUsedKey(id string) string {
+	return "refresh_used:" + id
+}
+
+// refreshFamilyKey Ключ множества токенов одного семейства.
+func refreshFamilyKey(familyID string) string {
+	return "refresh_family:" + familyID
+}
+
+// refreshUserKey Ключ множества токенов обновления пользователя.
+func refreshUserKey(username string) string {
+	return "refresh_user:" + username
+}
+
+// accessUserKey Ключ упорядоченного по сроку множества токенов доступа пользователя.
+func accessUserKey(username string) string {
+	return "access_user:" + username
+}
+
+// revokedKey Ключ-отметка об отзыве токена доступа.
+func revokedKey(jti string) string {
+	return "revoked:" + jti
+}
+
+// AddRefreshToken Сохраняет токен обновления в базе redis.
+func (s Storage) AddRefreshToken(ctx context.Context, c Interface.RefreshToken) error {
+	ctx, cancel := context.WithTimeout(ctx, 1*time.Second)
+	defer cancel()
+
+	data, err := json.Marshal(c)
+	if err != nil {
+		return wrap(err)
+	}
+
+	ttl := time.Until(c.ExpiresAt)
+	_, err = s.db.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, refreshKey(c.ID), data, ttl)
+		// Новый токен семейства живёт дольше предыдущих, индекс продлевается вместе с ним
+		pipe.SAdd(ctx, refreshFamilyKey(c.FamilyID), c.ID)
+		pipe.Expire(ctx, refreshFamilyKey(c.FamilyID), ttl)
+		pipe.SAdd(ctx, refreshUserKey(c.Username), c.ID)
+		pipe.Expire(ctx, refreshUserKey(c.Username), ttl)
+		return nil
+	})
+	if err != nil {
+		log.Printf("Не удалось сохранить токен обновления %v\n", err)
+		return wrap(err)
+	}
+
+	return nil
+}
+
+// SearchRefreshToken Находит токен обновления в базе redis.
+func (s Storage) SearchRefreshToken(ctx context.Context, id string) (*Interface.RefreshToken, error) {
+	ctx, cancel := context.WithTimeout(ctx, 1*time.Second)
+	defer cancel()
+
+	data, err := s.db.Get(ctx, refreshKey(id)).Bytes()
+	if err != nil {
+		return nil, wrap(err)
+	}
+
+	var c Interface.RefreshToken
+	if err = json.Unmarshal(data, &c); err != nil {
+		return nil, wrap(err)
+	}
+	if time.Now().After(c.ExpiresAt) {
+		return nil, Interface.ErrNotFound
+	}
+
+	used, err := s.db.Exists(ctx, refreshUsedKey(id)).Result()
+	if err != nil {
+		return nil, wrap(err)
+	}
+	c.Used = used > 0
+
+	return &c, nil
+}
+
+// UseRefreshToken Атомарно помечает токен обновления использованным в базе redis.
+func (s Storage) UseRefreshToken(ctx context.Context, id string) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, 1*time.Second)
+	defer cancel()
+
+	ttl, err := s.db.PTTL(ctx, refreshKey(id)).Result()
+	if err != nil {
+		return false, wrap(err)
+	}
+	if ttl <= 0 {
+		// Токен истёк или удалён вместе с семейством
+		return false, nil
+	}
+
+	// Отметка живёт столько же, сколько токен, чтобы повторное использование было видно до конца срока
+	return s.db.SetNX(ctx, refreshUsedKey(id), 1, ttl).Result()
+}
+
+// DelRefreshFamily Удаляет все токены семейства в базе redis.
+func (s Storage) DelRefreshFamily(ctx context.Context, familyID string) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, 1*time.Second)
+	defer cancel()
+
+	n, err := delIndexed.Run(ctx, s.db, []string{refreshFamilyKey(familyID)}, refreshKey(""), refreshUsedKey("")).Int64()
+	if err != nil {
+		log.Printf("Не удалось удалить семейство токенов %v\n", err)
+		return 0, wrap(err)
+	}
+
+	return n, nil
+}
+
+// DelUserRefreshTokens Удаляет все токены обновления пользователя в базе redis.
+func (s Storage) DelUserRefreshTokens(ctx context.Context, username string) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, 1*time.Second)
+	defer cancel()
+
+	n, err := delIndexed.Run(ctx, s.db, []string{refreshUserKey(username)}, refreshKey(""), refreshUsedKey("")).Int64()
+	if err != nil {
+		log.Printf("Не удалось удалить токены обновления пользователя %v\n", err)
+		return 0, wrap(err)
+	}
+
+	return n, nil
+}
+
+// RevokeAccessToken Отмечает токен доступа отозванным в базе redis до истечения его срока.
+func (s Storage) RevokeAccessToken(ctx context.Context, jti string, expiresAt time.Time) error {
+	ctx, cancel := context.WithTimeout(ctx, 1*time.Second)
+	defer cancel()
+
+	ttl := time.Until(expiresAt)
+	if ttl <= 0 {
+		return nil
+	}
+	return wrap(s.db.Set(ctx, revokedKey(jti), 1, ttl).Err())
+}
+
+// AccessTokenRevoked Проверяет отметку об отзыве токена доступа в базе redis.
+func (s Storage) AccessTokenRevoked(ctx context.Context, jti string) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, 1*time.Second)
+	defer cancel()
+
+	n, err := s.db.Exists(ctx, revokedKey(jti)).Result()
+	if err != nil {
+		return false, wrap(err)
+	}
+	return n > 0, nil
+}
+
+// AddAccessToken Запоминает токен доступа пользователя в базе redis до истечения его срока.
+func (s Storage) AddAccessToken(ctx context.Context, username, jti string, expiresAt time.Time) error {
+	ctx, cancel := context.WithTimeout(ctx, 1*time.Second)
+	defer cancel()
+
+	_, err := s.db.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.ZRemRangeByScore(ctx, accessUserKey(username), "-inf", strconv.FormatInt(time.Now().Unix(), 10))
+		pipe.ZAdd(ctx, accessUserKey(username), redis.Z{Score: float64(expiresAt.Unix()), Member: jti})
+		// Срок у всех токенов доступа одинаковый, новый истекает последним
+		pipe.ExpireAt(ctx, accessUserKey(username), expiresAt)
+		return nil
+	})
+	return wrap(err)
+}
+
+// RevokeUserAccessTokens Отмечает отозванными все действующие токены доступа пользователя в базе redis.
+func (s Storage) RevokeUserAccessTokens(ctx context.Context, username string) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, 1*time.Second)
+	defer cancel()
+
+	now := time.Now()
+	tokens, err := s.db.ZRangeByScoreWithScores(ctx, accessUserKey(username), &redis.ZRangeBy{
+		Min: strconv.FormatInt(now.Unix(), 10),
+		Max: "+inf",
+	}).Result()
+	if err != nil {
+		return 0, wrap(err)
+	}
+	if len(tokens) == 0 {
+		return 0, nil
+	}
+
+	// Удаляются только прочитанные токены: выданный за это время останется в множестве
+	_, err = s.db.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		members := make([]interface{}, 0, len(tokens))
+		for _, t := range tokens {
+			jti, _ := t.Member.(string)
+			if ttl := time.Unix(int64(t.Score), 0).Sub(now); ttl > 0 {
+				pipe.Set(ctx, revokedKey(jti), 1, ttl)
+			}
+			members = append(members, jti)
+		}
+		pipe.ZRem(ctx, accessUserKey(username), members...)
+		return nil
+	})
+	if err != nil {
+		return 0, wrap(err)
+	}
+	return int64(len(tokens)), nil
+}
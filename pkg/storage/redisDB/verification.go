@@ -0,0 +1,62 @@
+package redisDB
+
+import (
+	Interface "authorization/pkg/storage"
+	"context"
+	"encoding/json"
+	"log"
+	"time"
+)
+
+// verificationKey Ключ подтверждения адреса электронной почты в базе redis.
+func verificationKey(username string) string {
+	return "email_verification:" + username
+}
+
+// SetEmailVerification Заменяет подтверждение адреса пользователя в базе redis.
+func (s Storage) SetEmailVerification(ctx context.Context, v Interface.EmailVerification) error {
+	ctx, cancel := context.WithTimeout(ctx, 1*time.Second)
+	defer cancel()
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		return wrap(err)
+	}
+	if err = s.db.Set(ctx, verificationKey(v.Username), data, 0).Err(); err != nil {
+		log.Printf("Не удалось сохранить подтверждение адреса %v\n", err)
+		return wrap(err)
+	}
+
+	return nil
+}
+
+// SearchEmailVerification Находит подтверждение адреса пользователя в базе redis.
+func (s Storage) SearchEmailVerification(ctx context.Context, username string) (*Interface.EmailVerification, error) {
+	ctx, cancel := context.WithTimeout(ctx, 1*time.Second)
+	defer cancel()
+
+	data, err := s.db.Get(ctx, verificationKey(username)).Bytes()
+	if err != nil {
+		return nil, wrap(err)
+	}
+
+	var v Interface.EmailVerification
+	if err = json.Unmarshal(data, &v); err != nil {
+		return nil, wrap(err)
+	}
+
+	return &v, nil
+}
+
+// DelEmailVerification Удаляет подтверждение адреса пользователя в базе redis.
+func (s Storage) DelEmailVerification(ctx context.Context, username string) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, 1*time.Second)
+	defer cancel()
+
+	n, err := s.db.Del(ctx, verificationKey(username)).Result()
+	if err != nil {
+		return false, wrap(err)
+	}
+
+	return n > 0, nil
+}
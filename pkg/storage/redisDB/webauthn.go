@@ -0,0 +1,174 @@
+package redisDB
+
+import (
+	Interface "authorization/pkg/storage"
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/redis/go-redis/v9"
+	"log"
+	"time"
+)
+
+// credentialKey Ключ ключа доступа в базе redis.
+func credentialKey(id string) string {
+	return "webauthn:" + id
+}
+
+// credentialCountKey Ключ счётчика подписей и времени последнего входа ключом доступа.
+func credentialCountKey(id string) string {
+	return "webauthn_count:" + id
+}
+
+// userCredentialsKey Ключ множества ключей доступа пользователя.
+func userCredentialsKey(username string) string {
+	return "webauthn_user:" + username
+}
+
+// credentialUsage Изменяемая часть ключа доступа, хранится отдельно от неизменной.
+type credentialUsage struct {
+	SignCount int64     `json:"signCount"`
+	LastUsed  time.Time `json:"lastUsed"`
+}
+
+// useCredential Заменяет запись об использовании KEYS[1] на ARGV[2],
+// только если счётчик подписей в ней равен ARGV[1].
+var useCredential = redis.NewScript(`
+local cur = redis.call('GET', KEYS[1])
+if not cur then
+	return 0
+end
+if cjson.decode(cur)['signCount'] ~= tonumber(ARGV[1]) then
+	return 0
+end
+redis.call('SET', KEYS[1], ARGV[2])
+return 1
+`)
+
+// AddCredential Сохраняет ключ доступа в базе redis.
+func (s Storage) AddCredential(ctx context.Context, c Interface.WebAuthnCredential) error {
+	ctx, cancel := context.WithTimeout(ctx, 1*time.Second)
+	defer cancel()
+
+	usage, err := json.Marshal(credentialUsage{SignCount: c.SignCount, LastUsed: c.LastUsed})
+	if err != nil {
+		return wrap(err)
+	}
+	data, err := json.Marshal(c)
+	if err != nil {
+		return wrap(err)
+	}
+
+	_, err = s.db.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, credentialKey(c.ID), data, 0)
+		pipe.Set(ctx, credentialCountKey(c.ID), usage, 0)
+		pipe.SAdd(ctx, userCredentialsKey(c.Username), c.ID)
+		return nil
+	})
+	if err != nil {
+		log.Printf("Не удалось сохранить ключ доступа %v\n", err)
+		return wrap(err)
+	}
+
+	return nil
+}
+
+// SearchCredential Находит ключ доступа в базе redis.
+func (s Storage) SearchCredential(ctx context.Context, id string) (*Interface.WebAuthnCredential, error) {
+	ctx, cancel := context.WithTimeout(ctx, 1*time.Second)
+	defer cancel()
+
+	values, err := s.db.MGet(ctx, credentialKey(id), credentialCountKey(id)).Result()
+	if err != nil {
+		return nil, wrap(err)
+	}
+	data, ok := values[0].(string)
+	if !ok {
+		return nil, Interface.ErrNotFound
+	}
+
+	var c Interface.WebAuthnCredential
+	if err = json.Unmarshal([]byte(data), &c); err != nil {
+		return nil, wrap(err)
+	}
+	if usage, ok := values[1].(string); ok {
+		var u credentialUsage
+		if err = json.Unmarshal([]byte(usage), &u); err != nil {
+			return nil, wrap(err)
+		}
+		c.SignCount, c.LastUsed = u.SignCount, u.LastUsed
+	}
+
+	return &c, nil
+}
+
+// ListCredentials Возвращает ключи доступа пользователя в базе redis.
+func (s Storage) ListCredentials(ctx context.Context, username string) ([]Interface.WebAuthnCredential, error) {
+	ctx, cancel := context.WithTimeout(ctx, 1*time.Second)
+	defer cancel()
+
+	ids, err := s.db.SMembers(ctx, userCredentialsKey(username)).Result()
+	if err != nil {
+		return nil, wrap(err)
+	}
+
+	var list []Interface.WebAuthnCredential
+	for _, id := range ids {
+		c, err := s.SearchCredential(ctx, id)
+		if errors.Is(err, Interface.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, *c)
+	}
+
+	return list, nil
+}
+
+// UseCredential Атомарно обновляет счётчик подписей ключа доступа в базе redis.
+func (s Storage) UseCredential(ctx context.Context, id string, prev, signCount int64, t time.Time) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, 1*time.Second)
+	defer cancel()
+
+	usage, err := json.Marshal(credentialUsage{SignCount: signCount, LastUsed: t})
+	if err != nil {
+		return false, wrap(err)
+	}
+	n, err := useCredential.Run(ctx, s.db, []string{credentialCountKey(id)}, prev, usage).Int()
+	if err != nil {
+		return false, wrap(err)
+	}
+	return n == 1, nil
+}
+
+// DelCredential Удаляет ключ доступа пользователя в базе redis.
+func (s Storage) DelCredential(ctx context.Context, username, id string) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, 1*time.Second)
+	defer cancel()
+
+	// Ключ из чужого множества не удаляется
+	n, err := s.db.SRem(ctx, userCredentialsKey(username), id).Result()
+	if err != nil || n == 0 {
+		return false, wrap(err)
+	}
+	if err = s.db.Del(ctx, credentialKey(id), credentialCountKey(id)).Err(); err != nil {
+		return false, wrap(err)
+	}
+	return true, nil
+}
+
+// DelUserCredentials Удаляет все ключи доступа пользователя в базе redis.
+func (s Storage) DelUserCredentials(ctx context.Context, username string) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, 1*time.Second)
+	defer cancel()
+
+	n, err := delIndexed.Run(ctx, s.db, []string{userCredentialsKey(username)}, credentialKey(""), credentialCountKey("")).Int64()
+	if err != nil {
+		log.Printf("Не удалось удалить ключи доступа пользователя %v\n", err)
+		return 0, wrap(err)
+	}
+
+	return n, nil
+}
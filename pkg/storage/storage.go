@@ -1,13 +1,92 @@
 package storage
 
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/gofrs/uuid"
+	"time"
+)
+
+// Ошибки хранилищ. Базы возвращают их обёрнутыми вместе с исходной ошибкой драйвера,
+// поэтому проверять их нужно через errors.Is.
+var (
+	// ErrNotFound Запись не найдена, истекла или уже использована.
+	ErrNotFound = errors.New("запись не найдена")
+	// ErrAlreadyExists Запись с таким ключом уже есть.
+	ErrAlreadyExists = errors.New("запись уже существует")
+	// ErrUnavailable База недоступна или не ответила вовремя, запрос можно повторить позже.
+	ErrUnavailable = errors.New("база данных недоступна")
+)
+
+// ErrUserCodeTaken Код пользователя уже занят другим запросом авторизации устройства.
+var ErrUserCodeTaken = fmt.Errorf("код пользователя уже занят: %w", ErrAlreadyExists)
+
+// Unavailable Помечает ошибку драйвера как недоступность базы.
+func Unavailable(err error) error {
+	return fmt.Errorf("%w: %w", ErrUnavailable, err)
+}
+
+// AlreadyExists Помечает ошибку драйвера как нарушение уникальности ключа.
+func AlreadyExists(err error) error {
+	return fmt.Errorf("%w: %w", ErrAlreadyExists, err)
+}
+
+// Interrupted Проверяет, что запрос прерван отменой или истечением контекста.
+func Interrupted(err error) bool {
+	return errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+}
+
+// AccountStatus Состояние аккаунта.
+type AccountStatus string
+
+const (
+	StatusActive   AccountStatus = "active"   // Вход разрешён
+	StatusDisabled AccountStatus = "disabled" // Аккаунт отключён администратором, вход запрещён
+	StatusLocked   AccountStatus = "locked"   // Аккаунт заблокирован из соображений безопасности, вход запрещён
+	StatusPending  AccountStatus = "pending"  // Адрес электронной почты ещё не подтверждён
+)
+
+// Account Аккаунт пользователя.
+// ID не меняется за всё время жизни аккаунта, в отличие от логина.
+// Нулевое LastLoginAt значит, что пользователь ещё не входил.
 type Account struct {
-	Username string `json:"username"`
-	Password string `json:"password"`
+	ID            string        `json:"id" bson:"userId"`
+	Username      string        `json:"username" bson:"username"`
+	Password      string        `json:"password" bson:"password"`
+	DisplayName   string        `json:"displayName" bson:"displayName"`
+	Status        AccountStatus `json:"status" bson:"status"`
+	EmailVerified bool          `json:"emailVerified" bson:"emailVerified"`
+	CreatedAt     time.Time     `json:"createdAt" bson:"createdAt"`
+	UpdatedAt     time.Time     `json:"updatedAt" bson:"updatedAt"`
+	LastLoginAt   time.Time     `json:"lastLoginAt" bson:"lastLoginAt"`
+}
+
+// SetDefaults Заполняет незаданные поля нового аккаунта: идентификатор, статус и время создания.
+func (c *Account) SetDefaults() error {
+	if c.ID == "" {
+		id, err := uuid.NewV4()
+		if err != nil {
+			return err
+		}
+		c.ID = id.String()
+	}
+	if c.Status == "" {
+		c.Status = StatusActive
+	}
+	if c.CreatedAt.IsZero() {
+		c.CreatedAt = time.Now().UTC()
+	}
+	if c.UpdatedAt.IsZero() {
+		c.UpdatedAt = c.CreatedAt
+	}
+	return nil
 }
 
 type FormAccount struct {
-	Username string `json:"username"`
-	Password string `json:"password"`
+	Username    string `json:"username"`
+	Password    string `json:"password"`
+	DisplayName string `json:"displayName"`
 }
 
 type Response struct {
@@ -16,9 +95,363 @@ type Response struct {
 	ErrorMessages []string `json:"errorMessages"`
 }
 
+// Session Сессия пользователя на сервере.
+// ID хранит SHA-256 от случайного токена из cookie, сам токен на сервере не сохраняется.
+type Session struct {
+	ID        string    `json:"id" bson:"_id"`
+	Username  string    `json:"username" bson:"username"`
+	CreatedAt time.Time `json:"createdAt" bson:"createdAt"`
+	LastSeen  time.Time `json:"lastSeen" bson:"lastSeen"`
+	ExpiresAt time.Time `json:"expiresAt" bson:"expiresAt"`
+	IP        string    `json:"ip" bson:"ip"`               // Адрес клиента при входе
+	UserAgent string    `json:"userAgent" bson:"userAgent"` // Браузер или приложение клиента
+	RequestID string    `json:"requestId" bson:"requestId"` // Идентификатор запроса входа из журнала
+}
+
+// SessionStore Хранилище сессий.
+// SearchSession возвращает ErrNotFound, если сессия не найдена или истекла.
+type SessionStore interface {
+	AddSession(ctx context.Context, s Session) error
+	SearchSession(ctx context.Context, id string) (*Session, error)
+	DelSession(ctx context.Context, id string) (bool, error)
+	DelUserSessions(ctx context.Context, username string) (int64, error)
+	ListSessions(ctx context.Context, username string) ([]Session, error)
+	TouchSession(ctx context.Context, id string, t time.Time) error
+}
+
+// RefreshToken Долгоживущий токен обновления.
+// ID хранит SHA-256 токена. Все токены, полученные ротацией из одного входа,
+// составляют семейство FamilyID и отзываются вместе.
+type RefreshToken struct {
+	ID        string    `json:"id" bson:"_id"`
+	FamilyID  string    `json:"familyId" bson:"familyId"`
+	Username  string    `json:"username" bson:"username"`
+	ClientID  string    `json:"clientId" bson:"clientId"`
+	Scope     string    `json:"scope" bson:"scope"`
+	CreatedAt time.Time `json:"createdAt" bson:"createdAt"`
+	ExpiresAt time.Time `json:"expiresAt" bson:"expiresAt"`
+	Used      bool      `json:"used" bson:"used"` // Токен уже обменян на новый
+}
+
+// TokenStore Хранилище токенов обновления и отозванных токенов доступа.
+// SearchRefreshToken возвращает ErrNotFound, если токен не найден или истёк.
+// UseRefreshToken атомарно помечает токен использованным и возвращает false,
+// если он уже был использован.
+// Отозванный токен доступа хранится по jti до истечения его срока, дальше он недействителен и так.
+// Токены доступа пользователя запоминаются по jti до истечения срока,
+// RevokeUserAccessTokens отзывает их все и возвращает число отозванных.
+type TokenStore interface {
+	AddRefreshToken(ctx context.Context, t RefreshToken) error
+	SearchRefreshToken(ctx context.Context, id string) (*RefreshToken, error)
+	UseRefreshToken(ctx context.Context, id string) (bool, error)
+	DelRefreshFamily(ctx context.Context, familyID string) (int64, error)
+	DelUserRefreshTokens(ctx context.Context, username string) (int64, error)
+	RevokeAccessToken(ctx context.Context, jti string, expiresAt time.Time) error
+	AccessTokenRevoked(ctx context.Context, jti string) (bool, error)
+	AddAccessToken(ctx context.Context, username, jti string, expiresAt time.Time) error
+	RevokeUserAccessTokens(ctx context.Context, username string) (int64, error)
+}
+
+// SigningKey Ключ подписи токенов, общий для всех копий сервиса.
+// Ключ публикуется с CreatedAt, подписывает токены с опозданием на время кеширования JWKS и до RetireAt,
+// затем до ExpiresAt публикуется только для проверки.
+type SigningKey struct {
+	ID         string    `json:"id" bson:"_id"` // kid
+	Alg        string    `json:"alg" bson:"alg"`
+	PrivateKey string    `json:"privateKey" bson:"privateKey"` // PKCS #8 в формате PEM
+	CreatedAt  time.Time `json:"createdAt" bson:"createdAt"`
+	RetireAt   time.Time `json:"retireAt" bson:"retireAt"`
+	ExpiresAt  time.Time `json:"expiresAt" bson:"expiresAt"`
+}
+
+// KeyStore Хранилище ключей подписи.
+type KeyStore interface {
+	AddSigningKey(ctx context.Context, k SigningKey) error
+	ListSigningKeys(ctx context.Context) ([]SigningKey, error)
+	DelSigningKey(ctx context.Context, id string) (bool, error)
+}
+
+// Client Зарегистрированный клиент OAuth 2.0: SPA, мобильное приложение или сервис.
+// Код авторизации отправляется только на один из RedirectURIs при точном совпадении адреса.
+// Клиент с SecretHash конфиденциальный и предъявляет секрет при каждом обращении за токенами.
+type Client struct {
+	ID           string    `json:"id" bson:"_id"`
+	Name         string    `json:"name" bson:"name"`
+	RedirectURIs []string  `json:"redirectUris" bson:"redirectUris"`
+	Scopes       []string  `json:"scopes" bson:"scopes"`         // Разрешённые клиенту области доступа
+	GrantTypes   []string  `json:"grantTypes" bson:"grantTypes"` // Пусто — authorization_code и refresh_token
+	SecretHash   string    `json:"secretHash" bson:"secretHash"` // SHA-256 секрета клиента
+	CreatedAt    time.Time `json:"createdAt" bson:"createdAt"`
+}
+
+// ClientStore Хранилище клиентов OAuth.
+// AddClient заменяет клиента с тем же ID.
+// SearchClient возвращает ErrNotFound, если клиент не найден.
+type ClientStore interface {
+	AddClient(ctx context.Context, c Client) error
+	SearchClient(ctx context.Context, id string) (*Client, error)
+	DelClient(ctx context.Context, id string) (bool, error)
+}
+
+// AuthCode Одноразовый код авторизации OAuth 2.0.
+// ID хранит SHA-256 кода, CodeChallenge — преобразованный секрет PKCE,
+// который клиент предъявит при обмене кода на токены.
+type AuthCode struct {
+	ID                  string    `json:"id" bson:"_id"`
+	ClientID            string    `json:"clientId" bson:"clientId"`
+	Username            string    `json:"username" bson:"username"`
+	RedirectURI         string    `json:"redirectUri" bson:"redirectUri"`
+	Scope               string    `json:"scope" bson:"scope"`
+	CodeChallenge       string    `json:"codeChallenge" bson:"codeChallenge"`
+	CodeChallengeMethod string    `json:"codeChallengeMethod" bson:"codeChallengeMethod"`
+	Nonce               string    `json:"nonce" bson:"nonce"`       // Значение клиента для id_token OpenID Connect
+	AuthTime            time.Time `json:"authTime" bson:"authTime"` // Когда пользователь вводил пароль
+	CreatedAt           time.Time `json:"createdAt" bson:"createdAt"`
+	ExpiresAt           time.Time `json:"expiresAt" bson:"expiresAt"`
+}
+
+// CodeStore Хранилище кодов авторизации.
+// UseAuthCode атомарно удаляет код и возвращает его,
+// ErrNotFound — если код не найден, истёк или уже обменян.
+type CodeStore interface {
+	AddAuthCode(ctx context.Context, c AuthCode) error
+	UseAuthCode(ctx context.Context, id string) (*AuthCode, error)
+}
+
+// Состояния запроса авторизации устройства.
+const (
+	DevicePending  = "pending"  // Пользователь ещё не ввёл код
+	DeviceApproved = "approved" // Пользователь разрешил доступ
+	DeviceDenied   = "denied"   // Пользователь отказал
+)
+
+// DeviceCode Запрос авторизации устройства по RFC 8628.
+// ID хранит SHA-256 кода устройства, UserCode — код, который пользователь вводит на странице /device.
+type DeviceCode struct {
+	ID        string    `json:"id" bson:"_id"`
+	UserCode  string    `json:"userCode" bson:"userCode"`
+	ClientID  string    `json:"clientId" bson:"clientId"`
+	Scope     string    `json:"scope" bson:"scope"`
+	Username  string    `json:"username" bson:"username"` // Кто подтвердил запрос
+	Status    string    `json:"status" bson:"status"`
+	CreatedAt time.Time `json:"createdAt" bson:"createdAt"`
+	ExpiresAt time.Time `json:"expiresAt" bson:"expiresAt"`
+}
+
+// DeviceStore Хранилище запросов авторизации устройств.
+// SearchDeviceCode и SearchUserCode возвращают ErrNotFound, если запрос не найден или истёк.
+// PollDeviceCode запоминает время опроса и возвращает предыдущее, нулевое при первом опросе.
+// ApproveDeviceCode атомарно переводит ожидающий запрос в DeviceApproved или DeviceDenied
+// и возвращает false, если запрос уже решён или истёк.
+// DelDeviceCode возвращает true только одному из одновременных вызовов.
+type DeviceStore interface {
+	AddDeviceCode(ctx context.Context, d DeviceCode) error
+	SearchDeviceCode(ctx context.Context, id string) (*DeviceCode, error)
+	SearchUserCode(ctx context.Context, userCode string) (*DeviceCode, error)
+	PollDeviceCode(ctx context.Context, id string, t time.Time) (time.Time, error)
+	ApproveDeviceCode(ctx context.Context, userCode, username string, approved bool) (bool, error)
+	DelDeviceCode(ctx context.Context, id string) (bool, error)
+}
+
+// TOTP Второй фактор пользователя по RFC 6238.
+// Пока Enabled не установлен, аутентификатор ждёт подтверждения первым кодом и при входе не спрашивается.
+// Секрет нужен для проверки кодов и хранится как есть, коды восстановления — только как SHA-256.
+type TOTP struct {
+	Username      string    `json:"username" bson:"_id"`
+	Secret        string    `json:"secret" bson:"secret"` // Base32
+	Enabled       bool      `json:"enabled" bson:"enabled"`
+	RecoveryCodes []string  `json:"recoveryCodes" bson:"recoveryCodes"` // Хеши неиспользованных кодов восстановления
+	LastStep      int64     `json:"lastStep" bson:"lastStep"`           // Шаг времени последнего принятого кода
+	CreatedAt     time.Time `json:"createdAt" bson:"createdAt"`
+}
+
+// MFAStore Хранилище вторых факторов.
+// SetTOTP заменяет аутентификатор пользователя вместе с кодами восстановления.
+// SearchTOTP возвращает ErrNotFound, если аутентификатора нет.
+// UseTOTPStep атомарно запоминает шаг принятого кода и возвращает false, если этот
+// или более поздний шаг уже использован: перехваченный код нельзя предъявить повторно.
+// UseRecoveryCode атомарно вычёркивает код восстановления и возвращает false, если его нет.
+type MFAStore interface {
+	SetTOTP(ctx context.Context, t TOTP) error
+	SearchTOTP(ctx context.Context, username string) (*TOTP, error)
+	UseTOTPStep(ctx context.Context, username string, step int64) (bool, error)
+	UseRecoveryCode(ctx context.Context, username, hash string) (bool, error)
+	DelTOTP(ctx context.Context, username string) (bool, error)
+}
+
+// WebAuthnCredential Ключ доступа WebAuthn пользователя.
+// ID — идентификатор ключа от аутентификатора в base64url, PublicKey — открытый ключ в формате COSE.
+type WebAuthnCredential struct {
+	ID        string    `json:"id" bson:"_id"`
+	Username  string    `json:"username" bson:"username"`
+	Name      string    `json:"name" bson:"name"` // Название, которое дал пользователь
+	PublicKey []byte    `json:"publicKey" bson:"publicKey"`
+	Alg       int64     `json:"alg" bson:"alg"`
+	SignCount int64     `json:"signCount" bson:"signCount"`
+	AAGUID    string    `json:"aaguid" bson:"aaguid"` // Модель аутентификатора в hex
+	Format    string    `json:"format" bson:"format"` // Формат аттестации при регистрации
+	CreatedAt time.Time `json:"createdAt" bson:"createdAt"`
+	LastUsed  time.Time `json:"lastUsed" bson:"lastUsed"`
+}
+
+// CredentialStore Хранилище ключей доступа WebAuthn.
+// SearchCredential возвращает ErrNotFound, если ключ не найден.
+// UseCredential атомарно заменяет счётчик подписей prev на signCount и возвращает false,
+// если счётчик уже изменился: два входа с одним значением счётчика означают копию ключа.
+// DelCredential удаляет ключ, только если он принадлежит пользователю.
+type CredentialStore interface {
+	AddCredential(ctx context.Context, c WebAuthnCredential) error
+	SearchCredential(ctx context.Context, id string) (*WebAuthnCredential, error)
+	ListCredentials(ctx context.Context, username string) ([]WebAuthnCredential, error)
+	UseCredential(ctx context.Context, id string, prev, signCount int64, t time.Time) (bool, error)
+	DelCredential(ctx context.Context, username, id string) (bool, error)
+	DelUserCredentials(ctx context.Context, username string) (int64, error)
+}
+
+// EmailVerification Подтверждение адреса электронной почты аккаунта.
+// Запись создаётся при регистрации, по её CreatedAt отбрасываются ссылки, выданные до повторной регистрации.
+// Подтверждён ли адрес, решает Account.EmailVerified, Verified и VerifiedAt только сохраняют историю.
+type EmailVerification struct {
+	Username   string    `json:"username" bson:"_id"`
+	Verified   bool      `json:"verified" bson:"verified"`
+	CreatedAt  time.Time `json:"createdAt" bson:"createdAt"`   // Время регистрации, ссылки выданы не раньше
+	VerifiedAt time.Time `json:"verifiedAt" bson:"verifiedAt"` // Нулевое, пока адрес не подтверждён
+}
+
+// VerificationStore Хранилище подтверждений адресов электронной почты.
+// SetEmailVerification заменяет запись пользователя.
+// SearchEmailVerification возвращает ErrNotFound, если записи нет.
+type VerificationStore interface {
+	SetEmailVerification(ctx context.Context, v EmailVerification) error
+	SearchEmailVerification(ctx context.Context, username string) (*EmailVerification, error)
+	DelEmailVerification(ctx context.Context, username string) (bool, error)
+}
+
+// PasswordReset Токен сброса забытого пароля.
+// ID хранит SHA-256 токена из письма, сам токен на сервере не сохраняется.
+type PasswordReset struct {
+	ID        string    `json:"id" bson:"_id"`
+	Username  string    `json:"username" bson:"username"`
+	CreatedAt time.Time `json:"createdAt" bson:"createdAt"`
+	ExpiresAt time.Time `json:"expiresAt" bson:"expiresAt"`
+}
+
+// ResetStore Хранилище токенов сброса пароля.
+// UsePasswordReset атомарно удаляет действующий токен и возвращает его,
+// ErrNotFound — если токена нет, он истёк или уже использован.
+type ResetStore interface {
+	AddPasswordReset(ctx context.Context, r PasswordReset) error
+	UsePasswordReset(ctx context.Context, id string) (*PasswordReset, error)
+	DelUserPasswordResets(ctx context.Context, username string) (int64, error)
+}
+
+// OutboxMessage Письмо в очереди на отправку.
+// Письмо хранится в базе до успешной отправки, чтобы не потеряться при сбое почтового сервера или перезапуске.
+type OutboxMessage struct {
+	ID          string    `json:"id" bson:"_id"`
+	To          string    `json:"to" bson:"to"`
+	Subject     string    `json:"subject" bson:"subject"`
+	Text        string    `json:"text" bson:"text"`
+	HTML        string    `json:"html" bson:"html"`
+	Attempts    int       `json:"attempts" bson:"attempts"`       // Число неудачных попыток отправки
+	NextAttempt time.Time `json:"nextAttempt" bson:"nextAttempt"` // Не отправлять раньше этого времени
+	LastError   string    `json:"lastError" bson:"lastError"`
+	CreatedAt   time.Time `json:"createdAt" bson:"createdAt"`
+}
+
+// OutboxStore Очередь исходящих писем.
+// ClaimOutboxMessages атомарно забирает до limit писем, время отправки которых наступило,
+// и откладывает их на lease: другая копия сервиса не отправит то же письмо одновременно.
+// RetryOutboxMessage сохраняет неудачную попытку и время следующей.
+type OutboxStore interface {
+	AddOutboxMessage(ctx context.Context, m OutboxMessage) error
+	ClaimOutboxMessages(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]OutboxMessage, error)
+	RetryOutboxMessage(ctx context.Context, id string, attempts int, next time.Time, lastError string) error
+	DelOutboxMessage(ctx context.Context, id string) (bool, error)
+}
+
+// AccountDeletion Отметка об удалении аккаунта. До PurgeAt аккаунт можно восстановить, войдя в него,
+// после — он удаляется окончательно вместе со всеми данными пользователя.
+type AccountDeletion struct {
+	Username    string    `json:"username" bson:"_id"`
+	RequestedAt time.Time `json:"requestedAt" bson:"requestedAt"`
+	PurgeAt     time.Time `json:"purgeAt" bson:"purgeAt"`
+}
+
+// DeletionStore Хранилище отметок об удалении аккаунтов.
+// ScheduleDeletion заменяет отметку пользователя.
+// SearchDeletion возвращает ErrNotFound, если аккаунт не ожидает удаления.
+// DueDeletions возвращает до limit отметок, срок восстановления которых истёк к now.
+// ClaimDeletion атомарно снимает отметку, только если её срок истёк к now, и возвращает false,
+// если аккаунт уже восстановлен: восстановление и окончательное удаление не выполнятся оба.
+type DeletionStore interface {
+	ScheduleDeletion(ctx context.Context, d AccountDeletion) error
+	SearchDeletion(ctx context.Context, username string) (*AccountDeletion, error)
+	CancelDeletion(ctx context.Context, username string) (bool, error)
+	DueDeletions(ctx context.Context, now time.Time, limit int) ([]AccountDeletion, error)
+	ClaimDeletion(ctx context.Context, username string, now time.Time) (bool, error)
+}
+
+// AttemptStore Счётчики попыток входа в скользящем окне.
+// Есть только в Redis, чтобы счётчики были общими для всех копий сервиса;
+// с остальными базами счётчики хранятся в памяти процесса.
+// AddLoginAttempt атомарно удаляет попытки старше window, запоминает попытку id во время at
+// и возвращает число попыток до неё и время последней из них, поэтому параллельные попытки видят друг друга.
+// DelLoginAttempt удаляет попытку, которая не оказалась неудачной.
+type AttemptStore interface {
+	AddLoginAttempt(ctx context.Context, key, id string, at time.Time, window time.Duration) (int, time.Time, error)
+	DelLoginAttempt(ctx context.Context, key, id string) error
+	ResetLoginFailures(ctx context.Context, key string) error
+}
+
+// BucketStore Корзины токенов для ограничения частоты запросов.
+// Есть только в Redis, чтобы ограничения были общими для всех копий сервиса.
+// TakeToken пополняет корзину key со скоростью rate токенов в секунду, но не больше burst,
+// забирает один токен, если он есть, и возвращает, удалось ли его забрать, и сколько токенов осталось.
+type BucketStore interface {
+	TakeToken(ctx context.Context, key string, rate float64, burst int, now time.Time) (bool, float64, error)
+}
+
+// AccountMigrator Переводит аккаунты, сохранённые до появления идентификаторов, статусов и профиля, в текущий формат.
+// Аккаунт получает новый ID, время создания и подтверждение адреса берутся из записи о подтверждении;
+// аккаунты без такой записи созданы раньше подтверждения и считаются подтверждёнными.
+// MigrateAccounts можно вызывать при каждом запуске, он возвращает число переведённых аккаунтов.
+type AccountMigrator interface {
+	MigrateAccounts(ctx context.Context) (int64, error)
+}
+
 type Interface interface {
-	AddAccount(c Account) error
-	SearchAccount(c Account) (string, error)
-	KeysAccount(c Account) (bool, error)
-	DelAccount(c Account) (bool, error)
+	// CreateAccount атомарно добавляет аккаунт, если логин свободен, иначе возвращает ErrAlreadyExists.
+	CreateAccount(ctx context.Context, c Account) error
+	SearchAccount(ctx context.Context, c Account) (string, error)
+	KeysAccount(ctx context.Context, c Account) (bool, error)
+	DelAccount(ctx context.Context, c Account) (bool, error)
+	UpdatePassword(ctx context.Context, c Account) error
+	// ChangePassword заменяет хеш пароля, только если текущий хеш равен old,
+	// и возвращает false, если пароль уже изменён другим запросом или аккаунта нет.
+	ChangePassword(ctx context.Context, username, old, password string) (bool, error)
+	CountLegacyAccounts(ctx context.Context) (int64, error)
+	// SearchAccount, GetAccount и GetAccountByID возвращают ErrNotFound, если аккаунта нет.
+	GetAccount(ctx context.Context, username string) (*Account, error)
+	// GetAccountByID находит аккаунт по неизменному ID, которым пользователь обозначается в токенах.
+	GetAccountByID(ctx context.Context, id string) (*Account, error)
+	// Методы Set* меняют поле существующего аккаунта и возвращают false, если аккаунта нет.
+	// Все они, кроме SetLastLogin, обновляют UpdatedAt.
+	SetDisplayName(ctx context.Context, username, displayName string) (bool, error)
+	SetAccountStatus(ctx context.Context, username string, status AccountStatus) (bool, error)
+	// SetEmailVerified отмечает адрес подтверждённым, аккаунт в статусе pending становится активным.
+	SetEmailVerified(ctx context.Context, username string) (bool, error)
+	SetLastLogin(ctx context.Context, username string, t time.Time) (bool, error)
+	SessionStore
+	TokenStore
+	KeyStore
+	ClientStore
+	CodeStore
+	DeviceStore
+	MFAStore
+	CredentialStore
+	VerificationStore
+	ResetStore
+	OutboxStore
+	DeletionStore
 }
@@ -0,0 +1,106 @@
+package throttle
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// sweepEvery Через сколько записей попыток удаляются счётчики, окно которых прошло.
+const sweepEvery = 1000
+
+// attempt Одна попытка входа.
+type attempt struct {
+	id string
+	at time.Time
+}
+
+// attempts Попытки по одному ключу.
+type attempts struct {
+	list   []attempt
+	window time.Duration
+}
+
+// MemoryStore Счётчики попыток в памяти процесса. Используется, когда база данных
+// не хранит счётчики: у каждой копии сервиса свои счётчики, и они обнуляются при перезапуске.
+type MemoryStore struct {
+	mu    sync.Mutex
+	keys  map[string]*attempts
+	added int
+}
+
+// NewMemoryStore Конструктор.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{keys: make(map[string]*attempts)}
+}
+
+// AddLoginAttempt Удаляет попытки старше window, запоминает попытку id
+// и возвращает число попыток до неё и время последней.
+func (s *MemoryStore) AddLoginAttempt(_ context.Context, key, id string, at time.Time, window time.Duration) (int, time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	a, ok := s.keys[key]
+	if !ok {
+		a = &attempts{}
+		s.keys[key] = a
+	}
+	a.window = window
+	a.list = prune(a.list, at.Add(-window))
+
+	count, last := len(a.list), time.Time{}
+	for _, p := range a.list {
+		if p.at.After(last) {
+			last = p.at
+		}
+	}
+	a.list = append(a.list, attempt{id: id, at: at})
+
+	s.added++
+	if s.added%sweepEvery == 0 {
+		for k, a := range s.keys {
+			if a.list = prune(a.list, at.Add(-a.window)); len(a.list) == 0 {
+				delete(s.keys, k)
+			}
+		}
+	}
+	return count, last, nil
+}
+
+// DelLoginAttempt Удаляет попытку id.
+func (s *MemoryStore) DelLoginAttempt(_ context.Context, key, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	a, ok := s.keys[key]
+	if !ok {
+		return nil
+	}
+	for i, p := range a.list {
+		if p.id == id {
+			a.list = append(a.list[:i], a.list[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+// ResetLoginFailures Сбрасывает счётчик.
+func (s *MemoryStore) ResetLoginFailures(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.keys, key)
+	return nil
+}
+
+// prune Оставляет попытки не раньше since. Попытки хранятся в порядке добавления.
+func prune(list []attempt, since time.Time) []attempt {
+	kept := list[:0]
+	for _, p := range list {
+		if !p.at.Before(since) {
+			kept = append(kept, p)
+		}
+	}
+	return kept
+}
@@ -0,0 +1,149 @@
+// Package throttle Защита входа от перебора паролей: счётчики неудачных попыток
+// по аккаунту и по адресу клиента в скользящем окне, растущая пауза между попытками
+// и временная блокировка.
+package throttle
+
+import (
+	"authorization/pkg/storage"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"strings"
+	"time"
+)
+
+// Policy Правила для одного счётчика неудачных попыток.
+type Policy struct {
+	Window    time.Duration // За какой период считаются неудачные попытки
+	Free      int           // Сколько неудачных попыток допускается без паузы
+	Delay     time.Duration // Пауза после первой попытки сверх Free, дальше удваивается
+	LockAfter int           // После стольких неудачных попыток вход блокируется на Lockout
+	Lockout   time.Duration
+}
+
+var (
+	// AccountPolicy Правила для попыток входа в один аккаунт.
+	AccountPolicy = Policy{Window: 15 * time.Minute, Free: 3, Delay: time.Second, LockAfter: 10, Lockout: 15 * time.Minute}
+	// AddressPolicy Правила для попыток входа с одного адреса. За одним адресом
+	// может быть много пользователей, поэтому допускается больше ошибок.
+	AddressPolicy = Policy{Window: 15 * time.Minute, Free: 20, Delay: time.Second, LockAfter: 100, Lockout: 15 * time.Minute}
+)
+
+// wait Сколько ещё ждать после count неудачных попыток, последняя из которых была в last.
+func (p Policy) wait(count int, last, now time.Time) time.Duration {
+	if count <= p.Free {
+		return 0
+	}
+
+	d := p.Lockout
+	if count < p.LockAfter {
+		d = p.Delay
+		for i := p.Free + 1; i < count && d < p.Lockout; i++ {
+			d *= 2
+		}
+		if d > p.Lockout {
+			d = p.Lockout
+		}
+	}
+
+	if wait := last.Add(d).Sub(now); wait > 0 {
+		return wait
+	}
+	return 0
+}
+
+// Limiter Считает попытки входа по аккаунту и по адресу клиента.
+type Limiter struct {
+	store   storage.AttemptStore
+	account Policy
+	address Policy
+	now     func() time.Time
+}
+
+// New Конструктор, счётчики хранятся в store.
+func New(store storage.AttemptStore) *Limiter {
+	return &Limiter{
+		store:   store,
+		account: AccountPolicy,
+		address: AddressPolicy,
+		now:     time.Now,
+	}
+}
+
+// accountKey Ключ счётчика аккаунта. Регистр не учитывается, чтобы его смена не обнуляла счётчик.
+func accountKey(username string) string {
+	return "user:" + strings.ToLower(username)
+}
+
+// addressKey Ключ счётчика адреса клиента.
+func addressKey(ip string) string {
+	return "ip:" + ip
+}
+
+// Attempt Попытка входа, учтённая до проверки пароля.
+type Attempt struct {
+	id   string
+	keys []string
+}
+
+// Reserve Учитывает попытку входа в аккаунт username с адреса ip до проверки пароля
+// и возвращает, сколько ещё ждать, если попытка не разрешена. Хранилище учитывает попытку
+// и возвращает предыдущие одним действием, поэтому параллельные попытки не проходят все разом.
+// Неразрешённая попытка не учитывается, разрешённая считается неудачной, пока её не отменит Cancel
+// или не сбросит Success. Пустой username или ip не учитывается.
+func (l *Limiter) Reserve(ctx context.Context, username, ip string) (*Attempt, time.Duration, error) {
+	now := l.now().UTC()
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return nil, 0, err
+	}
+	a := &Attempt{id: hex.EncodeToString(b)}
+
+	var wait time.Duration
+	reserve := func(key string, p Policy) error {
+		count, last, err := l.store.AddLoginAttempt(ctx, key, a.id, now, p.Window)
+		if err != nil {
+			return err
+		}
+		a.keys = append(a.keys, key)
+		if d := p.wait(count, last, now); d > wait {
+			wait = d
+		}
+		return nil
+	}
+
+	var err error
+	if username != "" {
+		err = reserve(accountKey(username), l.account)
+	}
+	if err == nil && ip != "" {
+		err = reserve(addressKey(ip), l.address)
+	}
+	if err == nil && wait == 0 {
+		return a, 0, nil
+	}
+	// Пауза, найденная до сбоя хранилища, всё равно действует
+	if cerr := l.Cancel(ctx, a); err == nil {
+		err = cerr
+	}
+	return nil, wait, err
+}
+
+// Cancel Отменяет учёт попытки, которая не оказалась неудачной: пароль верный или это не подбор.
+func (l *Limiter) Cancel(ctx context.Context, a *Attempt) error {
+	if a == nil {
+		return nil
+	}
+	for _, key := range a.keys {
+		if err := l.store.DelLoginAttempt(ctx, key, a.id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Success Сбрасывает счётчик аккаунта после успешного входа. Счётчик адреса не сбрасывается:
+// иначе перебор с одного адреса можно было бы прерывать входом в свой аккаунт.
+func (l *Limiter) Success(ctx context.Context, username string) error {
+	return l.store.ResetLoginFailures(ctx, accountKey(username))
+}
@@ -0,0 +1,190 @@
+package throttle
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newTestLimiter Счётчики в памяти и часы, которые двигает тест.
+func newTestLimiter() (*Limiter, *time.Time) {
+	now := time.Date(2023, 7, 1, 12, 0, 0, 0, time.UTC)
+	l := New(NewMemoryStore())
+	l.now = func() time.Time { return now }
+	return l, &now
+}
+
+func TestPolicy_Wait(t *testing.T) {
+	p := Policy{Window: time.Hour, Free: 3, Delay: time.Second, LockAfter: 6, Lockout: 10 * time.Minute}
+	now := time.Now()
+
+	tests := []struct {
+		count int
+		want  time.Duration
+	}{
+		{0, 0},
+		{3, 0},
+		{4, time.Second},
+		{5, 2 * time.Second},
+		{6, 10 * time.Minute},
+		{50, 10 * time.Minute},
+	}
+	for _, tt := range tests {
+		if got := p.wait(tt.count, now, now); got != tt.want {
+			t.Errorf("wait(%d) = %v, want %v", tt.count, got, tt.want)
+		}
+	}
+
+	// Пауза отсчитывается от последней попытки
+	if got := p.wait(5, now.Add(-time.Second), now); got != time.Second {
+		t.Errorf("wait() через секунду = %v", got)
+	}
+	if got := p.wait(5, now.Add(-time.Minute), now); got != 0 {
+		t.Errorf("wait() после паузы = %v", got)
+	}
+}
+
+// fail Учитывает разрешённую попытку, которая оказалась неудачной.
+func fail(t *testing.T, l *Limiter, username, ip string) {
+	t.Helper()
+	if _, wait, err := l.Reserve(context.Background(), username, ip); err != nil || wait != 0 {
+		t.Fatalf("Reserve() = %v, %v, попытка не разрешена", wait, err)
+	}
+}
+
+// check Возвращает паузу до следующей попытки, не учитывая саму проверку.
+func check(t *testing.T, l *Limiter, username, ip string) time.Duration {
+	t.Helper()
+	a, wait, err := l.Reserve(context.Background(), username, ip)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = l.Cancel(context.Background(), a); err != nil {
+		t.Fatal(err)
+	}
+	return wait
+}
+
+func TestLimiter_Account(t *testing.T) {
+	ctx := context.Background()
+	l, now := newTestLimiter()
+
+	for i := 0; i < AccountPolicy.Free; i++ {
+		fail(t, l, "user@ya.ru", "192.0.2.1")
+	}
+	if wait := check(t, l, "user@ya.ru", "192.0.2.1"); wait != 0 {
+		t.Fatalf("Reserve() = %v, пауза раньше времени", wait)
+	}
+
+	fail(t, l, "user@ya.ru", "192.0.2.1")
+	if wait := check(t, l, "USER@ya.ru", "198.51.100.1"); wait != AccountPolicy.Delay {
+		t.Fatalf("Reserve() = %v, ожидалась пауза %v для аккаунта с другого адреса", wait, AccountPolicy.Delay)
+	}
+	if wait := check(t, l, "other@ya.ru", "198.51.100.1"); wait != 0 {
+		t.Errorf("пауза %v для другого аккаунта", wait)
+	}
+
+	// Отклонённые попытки не учитываются и не продлевают паузу
+	for i := 0; i < AccountPolicy.LockAfter; i++ {
+		if wait := check(t, l, "user@ya.ru", "192.0.2.1"); wait != AccountPolicy.Delay {
+			t.Fatalf("Reserve() = %v, пауза изменилась после отклонённой попытки", wait)
+		}
+	}
+
+	// Блокировка после LockAfter попыток, каждая после своей паузы
+	for i := AccountPolicy.Free + 1; i < AccountPolicy.LockAfter; i++ {
+		*now = now.Add(check(t, l, "user@ya.ru", ""))
+		fail(t, l, "user@ya.ru", "192.0.2.1")
+	}
+	if wait := check(t, l, "user@ya.ru", ""); wait != AccountPolicy.Lockout {
+		t.Errorf("Reserve() = %v, ожидалась блокировка на %v", wait, AccountPolicy.Lockout)
+	}
+
+	*now = now.Add(AccountPolicy.Lockout)
+	if wait := check(t, l, "user@ya.ru", ""); wait != 0 {
+		t.Errorf("блокировка %v не снята после Lockout", wait)
+	}
+
+	// Успешный вход сбрасывает счётчик аккаунта
+	fail(t, l, "user@ya.ru", "192.0.2.1")
+	if err := l.Success(ctx, "user@ya.ru"); err != nil {
+		t.Fatal(err)
+	}
+	if wait := check(t, l, "user@ya.ru", ""); wait != 0 {
+		t.Errorf("пауза %v после успешного входа", wait)
+	}
+}
+
+func TestLimiter_Address(t *testing.T) {
+	ctx := context.Background()
+	l, now := newTestLimiter()
+
+	// Перебор по разным аккаунтам с одного адреса
+	for i := 0; i <= AddressPolicy.Free; i++ {
+		fail(t, l, "user"+string(rune('a'+i%26))+"@ya.ru", "192.0.2.1")
+	}
+	if wait := check(t, l, "new@ya.ru", "192.0.2.1"); wait != AddressPolicy.Delay {
+		t.Errorf("Reserve() = %v, ожидалась пауза %v для адреса", wait, AddressPolicy.Delay)
+	}
+	if wait := check(t, l, "new@ya.ru", "198.51.100.1"); wait != 0 {
+		t.Errorf("пауза %v для другого адреса", wait)
+	}
+
+	// Успешный вход не сбрасывает счётчик адреса
+	l.Success(ctx, "new@ya.ru")
+	if wait := check(t, l, "new@ya.ru", "192.0.2.1"); wait == 0 {
+		t.Error("счётчик адреса сброшен входом")
+	}
+
+	// Попытки старше окна не учитываются
+	*now = now.Add(AddressPolicy.Window + time.Second)
+	if wait := check(t, l, "new@ya.ru", "192.0.2.1"); wait != 0 {
+		t.Errorf("пауза %v после окна", wait)
+	}
+}
+
+func TestLimiter_Cancel(t *testing.T) {
+	ctx := context.Background()
+	l, _ := newTestLimiter()
+
+	// Отменённые попытки, например с верным паролем, не считаются неудачными
+	for i := 0; i < AccountPolicy.LockAfter; i++ {
+		a, wait, err := l.Reserve(ctx, "user@ya.ru", "192.0.2.1")
+		if err != nil || wait != 0 {
+			t.Fatalf("Reserve() = %v, %v", wait, err)
+		}
+		if err = l.Cancel(ctx, a); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if wait := check(t, l, "user@ya.ru", "192.0.2.1"); wait != 0 {
+		t.Errorf("пауза %v после отменённых попыток", wait)
+	}
+}
+
+func TestLimiter_Concurrent(t *testing.T) {
+	ctx := context.Background()
+	l, _ := newTestLimiter()
+
+	// Параллельные попытки видят друг друга: без паузы проходит столько же, сколько подряд
+	const n = 50
+	var allowed int32
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, wait, err := l.Reserve(ctx, "user@ya.ru", "192.0.2.1")
+			if err == nil && wait == 0 {
+				atomic.AddInt32(&allowed, 1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if allowed != int32(AccountPolicy.Free+1) {
+		t.Errorf("разрешено попыток: %d, ожидается %d", allowed, AccountPolicy.Free+1)
+	}
+}
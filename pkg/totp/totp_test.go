@@ -0,0 +1,81 @@
+package totp
+
+import (
+	"encoding/base32"
+	"net/url"
+	"testing"
+	"time"
+)
+
+// rfcSecret Секрет из тестовых векторов RFC 6238 для SHA-1.
+var rfcSecret = base32.StdEncoding.EncodeToString([]byte("12345678901234567890"))
+
+func TestCode_RFC6238(t *testing.T) {
+	// Последние шесть цифр восьмизначных кодов из приложения B RFC 6238
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+	for _, tt := range tests {
+		got, err := Code(rfcSecret, time.Unix(tt.unix, 0))
+		if err != nil {
+			t.Fatalf("ошибка вычисления кода: %v", err)
+		}
+		if got != tt.want {
+			t.Errorf("код для %d: получено %s, ожидается %s", tt.unix, got, tt.want)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	secret, err := GenerateSecret()
+	if err != nil {
+		t.Fatalf("ошибка создания секрета: %v", err)
+	}
+	now := time.Now()
+
+	code, _ := Code(secret, now)
+	step, ok := Validate(secret, code, now)
+	if !ok || step != Step(now) {
+		t.Errorf("текущий код не принят: шаг %d, %v", step, ok)
+	}
+
+	// Код предыдущего шага ещё действует, двумя шагами раньше — уже нет
+	prev, _ := Code(secret, now.Add(-Period))
+	if _, ok = Validate(secret, prev, now); !ok {
+		t.Error("код предыдущего шага не принят")
+	}
+	old, _ := Code(secret, now.Add(-3*Period))
+	if _, ok = Validate(secret, old, now); ok && old != code && old != prev {
+		t.Error("устаревший код принят")
+	}
+
+	for _, bad := range []string{"", "12345", "1234567", "abcdef"} {
+		if _, ok = Validate(secret, bad, now); ok {
+			t.Errorf("принят некорректный код %q", bad)
+		}
+	}
+	if _, ok = Validate("не base32", code, now); ok {
+		t.Error("принят код для некорректного секрета")
+	}
+}
+
+func TestURI(t *testing.T) {
+	u, err := url.Parse(URI("Authorization", "ups@mail.ru", "JBSWY3DPEHPK3PXP"))
+	if err != nil {
+		t.Fatalf("адрес не разбирается: %v", err)
+	}
+	if u.Scheme != "otpauth" || u.Host != "totp" || u.Path != "/Authorization:ups@mail.ru" {
+		t.Errorf("неверный адрес: %s", u)
+	}
+	if q := u.Query(); q.Get("secret") != "JBSWY3DPEHPK3PXP" || q.Get("issuer") != "Authorization" {
+		t.Errorf("неверные параметры: %s", u.RawQuery)
+	}
+}
@@ -0,0 +1,168 @@
+package webauthn
+
+import (
+	"errors"
+	"math"
+)
+
+// errCBOR Данные не разбираются как CBOR (RFC 8949).
+var errCBOR = errors.New("webauthn: некорректный CBOR")
+
+// cborMaxDepth Предельная вложенность: в данных аутентификатора её больше трёх не бывает.
+const cborMaxDepth = 16
+
+// cborReader Разбирает подмножество CBOR, которое используют WebAuthn и COSE:
+// целые числа, строки байтов и текста, массивы, словари, теги и простые значения.
+// Словари возвращаются как map[interface{}]interface{} с ключами int64 или string.
+type cborReader struct {
+	b   []byte
+	pos int
+}
+
+// decodeCBOR Разбирает одно значение в начале b и возвращает число прочитанных байтов.
+func decodeCBOR(b []byte) (interface{}, int, error) {
+	r := &cborReader{b: b}
+	v, err := r.value(0)
+	if err != nil {
+		return nil, 0, err
+	}
+	return v, r.pos, nil
+}
+
+// next Возвращает следующие n байтов.
+func (r *cborReader) next(n uint64) ([]byte, error) {
+	if n > uint64(len(r.b)-r.pos) {
+		return nil, errCBOR
+	}
+	v := r.b[r.pos : r.pos+int(n)]
+	r.pos += int(n)
+	return v, nil
+}
+
+// head Читает заголовок значения: основной тип и аргумент.
+func (r *cborReader) head() (byte, uint64, error) {
+	b, err := r.next(1)
+	if err != nil {
+		return 0, 0, err
+	}
+	major, info := b[0]>>5, b[0]&0x1f
+
+	var size uint64
+	switch {
+	case info < 24:
+		return major, uint64(info), nil
+	case info == 24:
+		size = 1
+	case info == 25:
+		size = 2
+	case info == 26:
+		size = 4
+	case info == 27:
+		size = 8
+	default:
+		// Значения неопределённой длины в WebAuthn не используются
+		return 0, 0, errCBOR
+	}
+
+	arg, err := r.next(size)
+	if err != nil {
+		return 0, 0, err
+	}
+	var v uint64
+	for _, c := range arg {
+		v = v<<8 | uint64(c)
+	}
+	return major, v, nil
+}
+
+// value Читает значение с учётом вложенности.
+func (r *cborReader) value(depth int) (interface{}, error) {
+	if depth > cborMaxDepth {
+		return nil, errCBOR
+	}
+	major, arg, err := r.head()
+	if err != nil {
+		return nil, err
+	}
+
+	switch major {
+	case 0:
+		if arg > math.MaxInt64 {
+			return nil, errCBOR
+		}
+		return int64(arg), nil
+	case 1:
+		if arg > math.MaxInt64 {
+			return nil, errCBOR
+		}
+		return -1 - int64(arg), nil
+	case 2:
+		b, err := r.next(arg)
+		if err != nil {
+			return nil, err
+		}
+		return append([]byte(nil), b...), nil
+	case 3:
+		b, err := r.next(arg)
+		if err != nil {
+			return nil, err
+		}
+		return string(b), nil
+	case 4:
+		// Каждый элемент занимает хотя бы байт, это отсекает огромные длины до выделения памяти
+		if arg > uint64(len(r.b)-r.pos) {
+			return nil, errCBOR
+		}
+		list := make([]interface{}, 0, arg)
+		for i := uint64(0); i < arg; i++ {
+			v, err := r.value(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, v)
+		}
+		return list, nil
+	case 5:
+		if arg > uint64(len(r.b)-r.pos) {
+			return nil, errCBOR
+		}
+		m := make(map[interface{}]interface{}, arg)
+		for i := uint64(0); i < arg; i++ {
+			k, err := r.value(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			switch k.(type) {
+			case int64, string:
+			default:
+				return nil, errCBOR
+			}
+			v, err := r.value(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			m[k] = v
+		}
+		return m, nil
+	case 6:
+		// Тег не меняет смысла значения для наших целей
+		return r.value(depth + 1)
+	default:
+		switch arg {
+		case 20:
+			return false, nil
+		case 21:
+			return true, nil
+		case 22, 23:
+			return nil, nil
+		}
+		// Числа с плавающей точкой и прочие простые значения в полях WebAuthn не встречаются
+		return nil, nil
+	}
+}
+
+// cborMap Значение как словарь CBOR.
+func cborMap(v interface{}) (map[interface{}]interface{}, bool) {
+	m, ok := v.(map[interface{}]interface{})
+	return m, ok
+}
@@ -0,0 +1,123 @@
+package webauthn
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"errors"
+	"math/big"
+)
+
+// Алгоритмы подписи COSE (RFC 9053), которые принимает сервис.
+const (
+	AlgES256 int64 = -7   // ECDSA P-256 с SHA-256
+	AlgEdDSA int64 = -8   // Ed25519
+	AlgRS256 int64 = -257 // RSASSA-PKCS1-v1_5 с SHA-256
+)
+
+// Параметры ключа COSE (RFC 9052).
+const (
+	coseKty    int64 = 1
+	coseAlg    int64 = 3
+	coseCrv    int64 = -1 // Для RSA — модуль n
+	coseX      int64 = -2 // Для RSA — экспонента e
+	coseY      int64 = -3
+	ktyOKP     int64 = 1
+	ktyEC2     int64 = 2
+	ktyRSA     int64 = 3
+	crvP256    int64 = 1
+	crvEd25519 int64 = 6
+)
+
+// ErrUnsupportedKey Ключ аутентификатора другого типа или с неподдерживаемым алгоритмом.
+var ErrUnsupportedKey = errors.New("webauthn: неподдерживаемый ключ")
+
+// coseBytes Поле словаря COSE как строка байтов.
+func coseBytes(m map[interface{}]interface{}, k int64) []byte {
+	b, _ := m[k].([]byte)
+	return b
+}
+
+// coseInt Поле словаря COSE как целое.
+func coseInt(m map[interface{}]interface{}, k int64) (int64, bool) {
+	v, ok := m[k].(int64)
+	return v, ok
+}
+
+// ParsePublicKey Разбирает открытый ключ COSE и возвращает его вместе с алгоритмом подписи.
+func ParsePublicKey(cose []byte) (crypto.PublicKey, int64, error) {
+	v, n, err := decodeCBOR(cose)
+	if err != nil {
+		return nil, 0, err
+	}
+	m, ok := cborMap(v)
+	if !ok || n != len(cose) {
+		return nil, 0, ErrUnsupportedKey
+	}
+	return publicKey(m)
+}
+
+// publicKey Открытый ключ из разобранного словаря COSE.
+func publicKey(m map[interface{}]interface{}) (crypto.PublicKey, int64, error) {
+	kty, _ := coseInt(m, coseKty)
+	alg, _ := coseInt(m, coseAlg)
+
+	switch {
+	case kty == ktyEC2 && alg == AlgES256:
+		if crv, _ := coseInt(m, coseCrv); crv != crvP256 {
+			return nil, 0, ErrUnsupportedKey
+		}
+		x, y := coseBytes(m, coseX), coseBytes(m, coseY)
+		if len(x) != 32 || len(y) != 32 {
+			return nil, 0, ErrUnsupportedKey
+		}
+		pub := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !pub.Curve.IsOnCurve(pub.X, pub.Y) {
+			return nil, 0, ErrUnsupportedKey
+		}
+		return pub, alg, nil
+
+	case kty == ktyOKP && alg == AlgEdDSA:
+		if crv, _ := coseInt(m, coseCrv); crv != crvEd25519 {
+			return nil, 0, ErrUnsupportedKey
+		}
+		x := coseBytes(m, coseX)
+		if len(x) != ed25519.PublicKeySize {
+			return nil, 0, ErrUnsupportedKey
+		}
+		return ed25519.PublicKey(x), alg, nil
+
+	case kty == ktyRSA && alg == AlgRS256:
+		n, e := coseBytes(m, coseCrv), coseBytes(m, coseX)
+		if len(n) < 256 || len(e) == 0 || len(e) > 4 {
+			return nil, 0, ErrUnsupportedKey
+		}
+		exp := new(big.Int).SetBytes(e)
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exp.Int64())}, alg, nil
+	}
+	return nil, 0, ErrUnsupportedKey
+}
+
+// verifySignature Проверяет подпись data ключом pub по алгоритму COSE.
+func verifySignature(pub crypto.PublicKey, alg int64, data, sig []byte) error {
+	digest := sha256.Sum256(data)
+
+	switch key := pub.(type) {
+	case *ecdsa.PublicKey:
+		if alg == AlgES256 && ecdsa.VerifyASN1(key, digest[:], sig) {
+			return nil
+		}
+	case ed25519.PublicKey:
+		if alg == AlgEdDSA && ed25519.Verify(key, data, sig) {
+			return nil
+		}
+	case *rsa.PublicKey:
+		if alg == AlgRS256 && rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], sig) == nil {
+			return nil
+		}
+	}
+	return ErrSignature
+}
@@ -0,0 +1,415 @@
+// Package webauthn Регистрация и проверка ключей доступа по WebAuthn Level 2 (W3C).
+// Поддерживаются аттестации none и packed, ключи ES256, EdDSA и RS256.
+// Доверие к производителю аутентификатора по сертификату не проверяется:
+// аттестация packed лишь подтверждает, что ключ создан тем же устройством.
+package webauthn
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+var (
+	// ErrMalformed Ответ аутентификатора не разбирается.
+	ErrMalformed = errors.New("webauthn: некорректный ответ аутентификатора")
+	// ErrClientData Данные клиента не относятся к этой церемонии: тип, вызов или источник не совпадают.
+	ErrClientData = errors.New("webauthn: данные клиента не совпадают с церемонией")
+	// ErrRelyingParty Аутентификатор подписал ответ для другого сайта.
+	ErrRelyingParty = errors.New("webauthn: ответ выдан для другого сайта")
+	// ErrUserPresence Пользователь не подтвердил присутствие или личность на аутентификаторе.
+	ErrUserPresence = errors.New("webauthn: пользователь не подтвердил действие")
+	// ErrAttestation Аттестация не прошла проверку или её формат не поддерживается.
+	ErrAttestation = errors.New("webauthn: аттестация не прошла проверку")
+	// ErrSignature Подпись не прошла проверку.
+	ErrSignature = errors.New("webauthn: неверная подпись")
+	// ErrSignCount Счётчик подписей не вырос: ключ, возможно, скопирован.
+	ErrSignCount = errors.New("webauthn: счётчик подписей не вырос")
+)
+
+// Флаги данных аутентификатора.
+const (
+	flagUserPresent  = 0x01
+	flagUserVerified = 0x04
+	flagAttested     = 0x40
+)
+
+// Timeout Сколько браузер ждёт действия пользователя.
+const Timeout = 2 * time.Minute
+
+// challengeSize Длина случайного вызова в байтах.
+const challengeSize = 32
+
+// oidAAGUID Расширение сертификата аттестации с AAGUID модели аутентификатора.
+var oidAAGUID = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 45724, 1, 1, 4}
+
+// Bytes Двоичные данные, в JSON — строка base64url без выравнивания.
+type Bytes []byte
+
+// MarshalJSON Кодирует данные в base64url.
+func (b Bytes) MarshalJSON() ([]byte, error) {
+	return json.Marshal(base64.RawURLEncoding.EncodeToString(b))
+}
+
+// UnmarshalJSON Раскодирует данные из base64url, с выравниванием или без.
+func (b *Bytes) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	v, err := base64.RawURLEncoding.DecodeString(string(bytes.TrimRight([]byte(s), "=")))
+	if err != nil {
+		return err
+	}
+	*b = v
+	return nil
+}
+
+// RelyingParty Сайт, для которого создаются ключи доступа.
+// ID — домен без схемы и порта, Origin — точный источник страниц входа.
+type RelyingParty struct {
+	ID     string
+	Name   string
+	Origin string
+}
+
+// Credential Зарегистрированный ключ доступа.
+type Credential struct {
+	ID        []byte
+	PublicKey []byte // Ключ в формате COSE
+	Alg       int64
+	SignCount uint32
+	AAGUID    []byte // Модель аутентификатора, нули — если не сообщается
+	Format    string // Формат аттестации при регистрации
+}
+
+// RPEntity Сайт в параметрах церемонии.
+type RPEntity struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// UserEntity Пользователь в параметрах регистрации.
+type UserEntity struct {
+	ID          Bytes  `json:"id"`
+	Name        string `json:"name"`
+	DisplayName string `json:"displayName"`
+}
+
+// CredentialParameter Допустимый тип ключа.
+type CredentialParameter struct {
+	Type string `json:"type"`
+	Alg  int64  `json:"alg"`
+}
+
+// CredentialDescriptor Ссылка на существующий ключ.
+type CredentialDescriptor struct {
+	Type string `json:"type"`
+	ID   Bytes  `json:"id"`
+}
+
+// AuthenticatorSelection Требования к аутентификатору.
+type AuthenticatorSelection struct {
+	ResidentKey      string `json:"residentKey"`
+	UserVerification string `json:"userVerification"`
+}
+
+// CreationOptions Параметры navigator.credentials.create() (PublicKeyCredentialCreationOptions).
+type CreationOptions struct {
+	Challenge              Bytes                  `json:"challenge"`
+	RP                     RPEntity               `json:"rp"`
+	User                   UserEntity             `json:"user"`
+	PubKeyCredParams       []CredentialParameter  `json:"pubKeyCredParams"`
+	Timeout                int64                  `json:"timeout"`
+	Attestation            string                 `json:"attestation"`
+	ExcludeCredentials     []CredentialDescriptor `json:"excludeCredentials"`
+	AuthenticatorSelection AuthenticatorSelection `json:"authenticatorSelection"`
+}
+
+// RequestOptions Параметры navigator.credentials.get() (PublicKeyCredentialRequestOptions).
+type RequestOptions struct {
+	Challenge        Bytes                  `json:"challenge"`
+	RPID             string                 `json:"rpId"`
+	AllowCredentials []CredentialDescriptor `json:"allowCredentials"`
+	Timeout          int64                  `json:"timeout"`
+	UserVerification string                 `json:"userVerification"`
+}
+
+// clientData Данные клиента, которые браузер передаёт аутентификатору на подпись.
+type clientData struct {
+	Type      string `json:"type"`
+	Challenge string `json:"challenge"`
+	Origin    string `json:"origin"`
+}
+
+// authenticatorData Разобранные данные аутентификатора.
+type authenticatorData struct {
+	RPIDHash     []byte
+	Flags        byte
+	SignCount    uint32
+	AAGUID       []byte
+	CredentialID []byte
+	PublicKey    []byte
+}
+
+// NewChallenge Случайный вызов для новой церемонии.
+func NewChallenge() (Bytes, error) {
+	b := make([]byte, challengeSize)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// descriptors Ссылки на ключи по их идентификаторам.
+func descriptors(ids [][]byte) []CredentialDescriptor {
+	list := make([]CredentialDescriptor, 0, len(ids))
+	for _, id := range ids {
+		list = append(list, CredentialDescriptor{Type: "public-key", ID: id})
+	}
+	return list
+}
+
+// CreationOptions Параметры регистрации нового ключа пользователя.
+// Уже зарегистрированные ключи exclude браузер не даст создать повторно.
+func (rp RelyingParty) CreationOptions(challenge, userID []byte, name string, exclude [][]byte) CreationOptions {
+	return CreationOptions{
+		Challenge: challenge,
+		RP:        RPEntity{ID: rp.ID, Name: rp.Name},
+		User:      UserEntity{ID: userID, Name: name, DisplayName: name},
+		PubKeyCredParams: []CredentialParameter{
+			{Type: "public-key", Alg: AlgES256},
+			{Type: "public-key", Alg: AlgEdDSA},
+			{Type: "public-key", Alg: AlgRS256},
+		},
+		Timeout:            Timeout.Milliseconds(),
+		Attestation:        "direct",
+		ExcludeCredentials: descriptors(exclude),
+		AuthenticatorSelection: AuthenticatorSelection{
+			ResidentKey:      "preferred",
+			UserVerification: "required",
+		},
+	}
+}
+
+// RequestOptions Параметры входа. Пустой allow позволяет выбрать любой ключ доступа этого сайта.
+func (rp RelyingParty) RequestOptions(challenge []byte, allow [][]byte) RequestOptions {
+	return RequestOptions{
+		Challenge:        challenge,
+		RPID:             rp.ID,
+		AllowCredentials: descriptors(allow),
+		Timeout:          Timeout.Milliseconds(),
+		UserVerification: "required",
+	}
+}
+
+// checkClientData Проверяет тип церемонии, вызов и источник в данных клиента.
+func (rp RelyingParty) checkClientData(raw []byte, typ string, challenge []byte) error {
+	var c clientData
+	if err := json.Unmarshal(raw, &c); err != nil {
+		return ErrMalformed
+	}
+	got, err := base64.RawURLEncoding.DecodeString(c.Challenge)
+	if err != nil || c.Type != typ || c.Origin != rp.Origin ||
+		subtle.ConstantTimeCompare(got, challenge) != 1 {
+		return ErrClientData
+	}
+	return nil
+}
+
+// parseAuthenticatorData Разбирает данные аутентификатора.
+func parseAuthenticatorData(b []byte) (*authenticatorData, error) {
+	if len(b) < 37 {
+		return nil, ErrMalformed
+	}
+	d := &authenticatorData{
+		RPIDHash:  b[:32],
+		Flags:     b[32],
+		SignCount: binary.BigEndian.Uint32(b[33:37]),
+	}
+	if d.Flags&flagAttested == 0 {
+		return d, nil
+	}
+
+	rest := b[37:]
+	if len(rest) < 18 {
+		return nil, ErrMalformed
+	}
+	d.AAGUID = rest[:16]
+	n := int(binary.BigEndian.Uint16(rest[16:18]))
+	rest = rest[18:]
+	if n == 0 || n > 1023 || len(rest) < n {
+		return nil, ErrMalformed
+	}
+	d.CredentialID = rest[:n]
+
+	// За ключом COSE могут идти расширения, длину ключа знает только разбор CBOR
+	_, size, err := decodeCBOR(rest[n:])
+	if err != nil {
+		return nil, ErrMalformed
+	}
+	d.PublicKey = rest[n : n+size]
+	return d, nil
+}
+
+// checkAuthenticatorData Проверяет сайт и действие пользователя.
+func (rp RelyingParty) checkAuthenticatorData(d *authenticatorData, requireUV bool) error {
+	hash := sha256.Sum256([]byte(rp.ID))
+	if subtle.ConstantTimeCompare(d.RPIDHash, hash[:]) != 1 {
+		return ErrRelyingParty
+	}
+	if d.Flags&flagUserPresent == 0 || requireUV && d.Flags&flagUserVerified == 0 {
+		return ErrUserPresence
+	}
+	return nil
+}
+
+// VerifyRegistration Проверяет ответ navigator.credentials.create() на вызов challenge
+// и возвращает новый ключ. С requireUV аутентификатор должен был проверить личность пользователя.
+func (rp RelyingParty) VerifyRegistration(challenge, clientDataJSON, attestationObject []byte, requireUV bool) (*Credential, error) {
+	if err := rp.checkClientData(clientDataJSON, "webauthn.create", challenge); err != nil {
+		return nil, err
+	}
+
+	v, _, err := decodeCBOR(attestationObject)
+	if err != nil {
+		return nil, ErrMalformed
+	}
+	att, ok := cborMap(v)
+	if !ok {
+		return nil, ErrMalformed
+	}
+	format, _ := att["fmt"].(string)
+	rawAuthData, _ := att["authData"].([]byte)
+	stmt, ok := cborMap(att["attStmt"])
+	if !ok {
+		return nil, ErrMalformed
+	}
+
+	d, err := parseAuthenticatorData(rawAuthData)
+	if err != nil {
+		return nil, err
+	}
+	if err = rp.checkAuthenticatorData(d, requireUV); err != nil {
+		return nil, err
+	}
+	if d.CredentialID == nil {
+		return nil, ErrMalformed
+	}
+	pub, alg, err := ParsePublicKey(d.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	switch format {
+	case "none":
+		if len(stmt) != 0 {
+			return nil, ErrAttestation
+		}
+	case "packed":
+		clientHash := sha256.Sum256(clientDataJSON)
+		signed := append(append([]byte(nil), rawAuthData...), clientHash[:]...)
+		if err = verifyPacked(stmt, signed, d.AAGUID, pub, alg); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, ErrAttestation
+	}
+
+	return &Credential{
+		ID:        d.CredentialID,
+		PublicKey: d.PublicKey,
+		Alg:       alg,
+		SignCount: d.SignCount,
+		AAGUID:    d.AAGUID,
+		Format:    format,
+	}, nil
+}
+
+// verifyPacked Проверяет аттестацию packed: подпись сертификатом аутентификатора
+// или, без сертификата, самим новым ключом (самоаттестация).
+func verifyPacked(stmt map[interface{}]interface{}, signed, aaguid []byte, credKey interface{}, credAlg int64) error {
+	alg, ok := stmt["alg"].(int64)
+	sig, _ := stmt["sig"].([]byte)
+	if !ok || len(sig) == 0 {
+		return ErrAttestation
+	}
+
+	x5c, ok := stmt["x5c"].([]interface{})
+	if !ok {
+		if alg != credAlg {
+			return ErrAttestation
+		}
+		if verifySignature(credKey, alg, signed, sig) != nil {
+			return ErrAttestation
+		}
+		return nil
+	}
+
+	if len(x5c) == 0 {
+		return ErrAttestation
+	}
+	der, _ := x5c[0].([]byte)
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return ErrAttestation
+	}
+	// Требования к сертификату аттестации из раздела 8.2.1 спецификации
+	if cert.Version != 3 || cert.IsCA || len(cert.Subject.OrganizationalUnit) != 1 ||
+		cert.Subject.OrganizationalUnit[0] != "Authenticator Attestation" {
+		return ErrAttestation
+	}
+	for _, ext := range cert.Extensions {
+		if !ext.Id.Equal(oidAAGUID) {
+			continue
+		}
+		var value []byte
+		if _, err = asn1.Unmarshal(ext.Value, &value); err != nil || !bytes.Equal(value, aaguid) {
+			return ErrAttestation
+		}
+	}
+	if verifySignature(cert.PublicKey, alg, signed, sig) != nil {
+		return ErrAttestation
+	}
+	return nil
+}
+
+// VerifyAssertion Проверяет ответ navigator.credentials.get() ключом cred на вызов challenge
+// и возвращает новое значение счётчика подписей для сохранения.
+// Если аутентификатор ведёт счётчик, он обязан расти с каждым входом.
+func (rp RelyingParty) VerifyAssertion(cred Credential, challenge, clientDataJSON, rawAuthData, signature []byte, requireUV bool) (uint32, error) {
+	if err := rp.checkClientData(clientDataJSON, "webauthn.get", challenge); err != nil {
+		return 0, err
+	}
+
+	d, err := parseAuthenticatorData(rawAuthData)
+	if err != nil {
+		return 0, err
+	}
+	if err = rp.checkAuthenticatorData(d, requireUV); err != nil {
+		return 0, err
+	}
+
+	pub, alg, err := ParsePublicKey(cred.PublicKey)
+	if err != nil {
+		return 0, err
+	}
+	clientHash := sha256.Sum256(clientDataJSON)
+	signed := append(append([]byte(nil), rawAuthData...), clientHash[:]...)
+	if err = verifySignature(pub, alg, signed, signature); err != nil {
+		return 0, err
+	}
+
+	if (d.SignCount != 0 || cred.SignCount != 0) && d.SignCount <= cred.SignCount {
+		return 0, ErrSignCount
+	}
+	return d.SignCount, nil
+}
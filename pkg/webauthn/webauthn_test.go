@@ -0,0 +1,143 @@
+package webauthn_test
+
+import (
+	"authorization/pkg/webauthn"
+	"authorization/pkg/webauthn/webauthntest"
+	"errors"
+	"testing"
+)
+
+var rp = webauthn.RelyingParty{ID: "localhost", Name: "Authorization", Origin: "http://localhost:5000"}
+
+// register Регистрирует новый ключ программного аутентификатора.
+func register(t *testing.T, a *webauthntest.Authenticator, format string) *webauthn.Credential {
+	t.Helper()
+
+	challenge, err := webauthn.NewChallenge()
+	if err != nil {
+		t.Fatalf("ошибка создания вызова: %v", err)
+	}
+	resp, err := a.Create(challenge, format)
+	if err != nil {
+		t.Fatalf("ошибка аутентификатора: %v", err)
+	}
+	cred, err := rp.VerifyRegistration(challenge, resp.ClientDataJSON, resp.AttestationObject, true)
+	if err != nil {
+		t.Fatalf("регистрация %s не прошла: %v", format, err)
+	}
+	return cred
+}
+
+// assert Выполняет вход ключом и возвращает ошибку проверки.
+func assert(t *testing.T, a *webauthntest.Authenticator, cred *webauthn.Credential) (uint32, error) {
+	t.Helper()
+
+	challenge, err := webauthn.NewChallenge()
+	if err != nil {
+		t.Fatalf("ошибка создания вызова: %v", err)
+	}
+	resp, err := a.Get(cred.ID, challenge)
+	if err != nil {
+		t.Fatalf("ошибка аутентификатора: %v", err)
+	}
+	return rp.VerifyAssertion(*cred, challenge, resp.ClientDataJSON, resp.AuthenticatorData, resp.Signature, true)
+}
+
+func TestRegistrationAndAssertion(t *testing.T) {
+	for _, format := range []string{webauthntest.FormatNone, webauthntest.FormatPacked, webauthntest.FormatPackedX5C} {
+		t.Run(format, func(t *testing.T) {
+			a := webauthntest.New(rp.ID, rp.Origin)
+			cred := register(t, a, format)
+			if cred.Alg != webauthn.AlgES256 || string(cred.AAGUID) != string(webauthntest.AAGUID) {
+				t.Errorf("неверный ключ: %+v", cred)
+			}
+
+			count, err := assert(t, a, cred)
+			if err != nil {
+				t.Fatalf("вход не прошёл: %v", err)
+			}
+			if count <= cred.SignCount {
+				t.Errorf("счётчик не вырос: %d", count)
+			}
+		})
+	}
+}
+
+func TestVerifyAssertion_SignCount(t *testing.T) {
+	a := webauthntest.New(rp.ID, rp.Origin)
+	cred := register(t, a, webauthntest.FormatNone)
+
+	count, err := assert(t, a, cred)
+	if err != nil {
+		t.Fatalf("вход не прошёл: %v", err)
+	}
+	cred.SignCount = count
+
+	// Копия ключа с отставшим счётчиком
+	a.Counter = 0
+	if _, err = assert(t, a, cred); !errors.Is(err, webauthn.ErrSignCount) {
+		t.Errorf("скопированный ключ не обнаружен: %v", err)
+	}
+}
+
+func TestVerifyRegistration_Rejects(t *testing.T) {
+	challenge, _ := webauthn.NewChallenge()
+
+	tests := []struct {
+		name string
+		a    *webauthntest.Authenticator
+		want error
+	}{
+		{"чужой источник", webauthntest.New(rp.ID, "https://evil.example"), webauthn.ErrClientData},
+		{"чужой сайт", webauthntest.New("evil.example", rp.Origin), webauthn.ErrRelyingParty},
+		{"без проверки пользователя", func() *webauthntest.Authenticator {
+			a := webauthntest.New(rp.ID, rp.Origin)
+			a.UserVerified = false
+			return a
+		}(), webauthn.ErrUserPresence},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := tt.a.Create(challenge, webauthntest.FormatPacked)
+			if err != nil {
+				t.Fatalf("ошибка аутентификатора: %v", err)
+			}
+			_, err = rp.VerifyRegistration(challenge, resp.ClientDataJSON, resp.AttestationObject, true)
+			if !errors.Is(err, tt.want) {
+				t.Errorf("получено %v, ожидается %v", err, tt.want)
+			}
+		})
+	}
+
+	// Ответ на другой вызов
+	a := webauthntest.New(rp.ID, rp.Origin)
+	resp, _ := a.Create(challenge, webauthntest.FormatNone)
+	other, _ := webauthn.NewChallenge()
+	if _, err := rp.VerifyRegistration(other, resp.ClientDataJSON, resp.AttestationObject, true); !errors.Is(err, webauthn.ErrClientData) {
+		t.Errorf("принят ответ на другой вызов: %v", err)
+	}
+
+	// Испорченные данные аттестации не должны ронять разбор
+	for i := range resp.AttestationObject {
+		broken := append([]byte(nil), resp.AttestationObject[:i]...)
+		if _, err := rp.VerifyRegistration(challenge, resp.ClientDataJSON, broken, true); err == nil {
+			t.Fatalf("принята обрезанная аттестация длины %d", i)
+		}
+	}
+}
+
+func TestVerifyAssertion_WrongKey(t *testing.T) {
+	a := webauthntest.New(rp.ID, rp.Origin)
+	cred := register(t, a, webauthntest.FormatNone)
+	other := register(t, a, webauthntest.FormatNone)
+
+	challenge, _ := webauthn.NewChallenge()
+	resp, err := a.Get(other.ID, challenge)
+	if err != nil {
+		t.Fatalf("ошибка аутентификатора: %v", err)
+	}
+	_, err = rp.VerifyAssertion(*cred, challenge, resp.ClientDataJSON, resp.AuthenticatorData, resp.Signature, true)
+	if !errors.Is(err, webauthn.ErrSignature) {
+		t.Errorf("принята подпись другим ключом: %v", err)
+	}
+}
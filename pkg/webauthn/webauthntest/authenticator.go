@@ -0,0 +1,241 @@
+// Package webauthntest Программный аутентификатор WebAuthn для тестов.
+// Создаёт ключи ES256 и отвечает на церемонии так же, как браузер с аппаратным ключом.
+package webauthntest
+
+import (
+	"authorization/pkg/webauthn"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"time"
+)
+
+// Форматы аттестации при регистрации.
+const (
+	FormatNone      = "none"       // Без аттестации
+	FormatPacked    = "packed"     // Самоаттестация: подпись новым ключом
+	FormatPackedX5C = "packed-x5c" // Подпись сертификатом аттестации аутентификатора
+)
+
+// Флаги данных аутентификатора.
+const (
+	flagUserPresent  = 0x01
+	flagUserVerified = 0x04
+	flagAttested     = 0x40
+)
+
+// ErrUnknownCredential Ключа с таким идентификатором у аутентификатора нет.
+var ErrUnknownCredential = errors.New("webauthntest: неизвестный ключ")
+
+// AAGUID Модель программного аутентификатора.
+var AAGUID = []byte("webauthntest-001")
+
+// Authenticator Программный аутентификатор для одного сайта.
+type Authenticator struct {
+	RPID   string
+	Origin string
+
+	// UserVerified Отмечать проверку личности пользователя (PIN или биометрия).
+	UserVerified bool
+	// Counter Счётчик подписей, растёт с каждой церемонией.
+	// Если обнулить его, аутентификатор ведёт себя как скопированный.
+	Counter uint32
+
+	keys       map[string]*ecdsa.PrivateKey
+	attestKey  *ecdsa.PrivateKey
+	attestCert []byte
+}
+
+// Response Ответ аутентификатора, как его отправляет JS страницы входа.
+type Response struct {
+	ID                webauthn.Bytes `json:"id"`
+	ClientDataJSON    webauthn.Bytes `json:"clientDataJSON"`
+	AttestationObject webauthn.Bytes `json:"attestationObject,omitempty"`
+	AuthenticatorData webauthn.Bytes `json:"authenticatorData,omitempty"`
+	Signature         webauthn.Bytes `json:"signature,omitempty"`
+}
+
+// New Аутентификатор для сайта rpID со страницами на origin.
+func New(rpID, origin string) *Authenticator {
+	return &Authenticator{
+		RPID:         rpID,
+		Origin:       origin,
+		UserVerified: true,
+		keys:         make(map[string]*ecdsa.PrivateKey),
+	}
+}
+
+// clientData Данные клиента, как их формирует браузер.
+func (a *Authenticator) clientData(typ string, challenge []byte) ([]byte, error) {
+	return json.Marshal(map[string]interface{}{
+		"type":        typ,
+		"challenge":   base64.RawURLEncoding.EncodeToString(challenge),
+		"origin":      a.Origin,
+		"crossOrigin": false,
+	})
+}
+
+// authData Данные аутентификатора; attested добавляет идентификатор и открытый ключ.
+func (a *Authenticator) authData(attested []byte) []byte {
+	rpHash := sha256.Sum256([]byte(a.RPID))
+	flags := byte(flagUserPresent)
+	if a.UserVerified {
+		flags |= flagUserVerified
+	}
+	if attested != nil {
+		flags |= flagAttested
+	}
+	a.Counter++
+
+	b := append(rpHash[:], flags)
+	b = binary.BigEndian.AppendUint32(b, a.Counter)
+	return append(b, attested...)
+}
+
+// sign Подпись ES256 данных аутентификатора вместе с хешем данных клиента.
+func sign(key *ecdsa.PrivateKey, authData, clientDataJSON []byte) ([]byte, error) {
+	clientHash := sha256.Sum256(clientDataJSON)
+	digest := sha256.Sum256(append(append([]byte(nil), authData...), clientHash[:]...))
+	return ecdsa.SignASN1(rand.Reader, key, digest[:])
+}
+
+// coseKey Открытый ключ ES256 в формате COSE.
+func coseKey(pub *ecdsa.PublicKey) []byte {
+	x := make([]byte, 32)
+	y := make([]byte, 32)
+	pub.X.FillBytes(x)
+	pub.Y.FillBytes(y)
+	return encode(cborMap{
+		{int64(1), int64(2)}, // kty: EC2
+		{int64(3), webauthn.AlgES256},
+		{int64(-1), int64(1)}, // crv: P-256
+		{int64(-2), x},
+		{int64(-3), y},
+	})
+}
+
+// attestation Ключ и сертификат аттестации, создаются при первой регистрации с FormatPackedX5C.
+func (a *Authenticator) attestation() (*ecdsa.PrivateKey, []byte, error) {
+	if a.attestKey != nil {
+		return a.attestKey, a.attestCert, nil
+	}
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	aaguid, err := asn1.Marshal(AAGUID)
+	if err != nil {
+		return nil, nil, err
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject: pkix.Name{
+			Country:            []string{"RU"},
+			Organization:       []string{"webauthntest"},
+			OrganizationalUnit: []string{"Authenticator Attestation"},
+			CommonName:         "webauthntest attestation",
+		},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		BasicConstraintsValid: true,
+		ExtraExtensions:       []pkix.Extension{{Id: []int{1, 3, 6, 1, 4, 1, 45724, 1, 1, 4}, Value: aaguid}},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	a.attestKey, a.attestCert = key, der
+	return key, der, nil
+}
+
+// Create Отвечает на navigator.credentials.create() с вызовом challenge.
+func (a *Authenticator) Create(challenge []byte, format string) (*Response, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	id := make([]byte, 16)
+	if _, err = rand.Read(id); err != nil {
+		return nil, err
+	}
+	a.keys[string(id)] = key
+
+	clientDataJSON, err := a.clientData("webauthn.create", challenge)
+	if err != nil {
+		return nil, err
+	}
+	attested := append([]byte(nil), AAGUID...)
+	attested = binary.BigEndian.AppendUint16(attested, uint16(len(id)))
+	attested = append(attested, id...)
+	attested = append(attested, coseKey(&key.PublicKey)...)
+	authData := a.authData(attested)
+
+	stmt := cborMap{}
+	fmtName := format
+	switch format {
+	case FormatNone:
+	case FormatPacked:
+		sig, err := sign(key, authData, clientDataJSON)
+		if err != nil {
+			return nil, err
+		}
+		stmt = cborMap{{"alg", webauthn.AlgES256}, {"sig", sig}}
+	case FormatPackedX5C:
+		attestKey, cert, err := a.attestation()
+		if err != nil {
+			return nil, err
+		}
+		sig, err := sign(attestKey, authData, clientDataJSON)
+		if err != nil {
+			return nil, err
+		}
+		stmt = cborMap{{"alg", webauthn.AlgES256}, {"sig", sig}, {"x5c", []interface{}{cert}}}
+		fmtName = FormatPacked
+	default:
+		return nil, errors.New("webauthntest: неизвестный формат аттестации " + format)
+	}
+
+	return &Response{
+		ID:             id,
+		ClientDataJSON: clientDataJSON,
+		AttestationObject: encode(cborMap{
+			{"fmt", fmtName},
+			{"attStmt", stmt},
+			{"authData", authData},
+		}),
+	}, nil
+}
+
+// Get Отвечает на navigator.credentials.get() ключом id с вызовом challenge.
+func (a *Authenticator) Get(id, challenge []byte) (*Response, error) {
+	key, ok := a.keys[string(id)]
+	if !ok {
+		return nil, ErrUnknownCredential
+	}
+
+	clientDataJSON, err := a.clientData("webauthn.get", challenge)
+	if err != nil {
+		return nil, err
+	}
+	authData := a.authData(nil)
+	sig, err := sign(key, authData, clientDataJSON)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Response{
+		ID:                id,
+		ClientDataJSON:    clientDataJSON,
+		AuthenticatorData: authData,
+		Signature:         sig,
+	}, nil
+}
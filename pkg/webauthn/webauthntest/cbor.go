@@ -0,0 +1,55 @@
+package webauthntest
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// cborMap Словарь CBOR с ключами в заданном порядке.
+type cborMap []struct {
+	k, v interface{}
+}
+
+// head Заголовок значения CBOR с основным типом major и аргументом n.
+func head(major byte, n uint64) []byte {
+	switch {
+	case n < 24:
+		return []byte{major<<5 | byte(n)}
+	case n <= 0xff:
+		return []byte{major<<5 | 24, byte(n)}
+	case n <= 0xffff:
+		return binary.BigEndian.AppendUint16([]byte{major<<5 | 25}, uint16(n))
+	case n <= 0xffffffff:
+		return binary.BigEndian.AppendUint32([]byte{major<<5 | 26}, uint32(n))
+	}
+	return binary.BigEndian.AppendUint64([]byte{major<<5 | 27}, n)
+}
+
+// encode Кодирует значение в CBOR. Поддерживаются только типы, нужные WebAuthn.
+func encode(v interface{}) []byte {
+	switch v := v.(type) {
+	case int64:
+		if v < 0 {
+			return head(1, uint64(-1-v))
+		}
+		return head(0, uint64(v))
+	case []byte:
+		return append(head(2, uint64(len(v))), v...)
+	case string:
+		return append(head(3, uint64(len(v))), v...)
+	case []interface{}:
+		b := head(4, uint64(len(v)))
+		for _, e := range v {
+			b = append(b, encode(e)...)
+		}
+		return b
+	case cborMap:
+		b := head(5, uint64(len(v)))
+		for _, e := range v {
+			b = append(b, encode(e.k)...)
+			b = append(b, encode(e.v)...)
+		}
+		return b
+	}
+	panic(fmt.Sprintf("webauthntest: тип %T не кодируется в CBOR", v))
+}
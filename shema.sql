@@ -1,7 +1,170 @@
+DROP TABLE IF EXISTS "account_deletions";
+DROP TABLE IF EXISTS "mail_outbox";
+DROP TABLE IF EXISTS "password_resets";
+DROP TABLE IF EXISTS "email_verifications";
+DROP TABLE IF EXISTS "webauthn_credentials";
+DROP TABLE IF EXISTS "totp";
+DROP TABLE IF EXISTS "access_tokens";
+DROP TABLE IF EXISTS "revoked_tokens";
+DROP TABLE IF EXISTS "device_codes";
+DROP TABLE IF EXISTS "auth_codes";
+DROP TABLE IF EXISTS "oauth_clients";
+DROP TABLE IF EXISTS "signing_keys";
+DROP TABLE IF EXISTS "refresh_tokens";
+DROP TABLE IF EXISTS "sessions";
 DROP TABLE IF EXISTS "accounts";
 
 CREATE TABLE IF NOT EXISTS "accounts" (
     id SERIAL PRIMARY KEY,
+    user_id UUID NOT NULL,
     username TEXT NOT NULL,
-    password TEXT NOT NULL
-);
\ No newline at end of file
+    password TEXT NOT NULL,
+    display_name TEXT NOT NULL DEFAULT '',
+    status TEXT NOT NULL DEFAULT 'active',
+    email_verified BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    last_login_at TIMESTAMPTZ
+);
+CREATE UNIQUE INDEX IF NOT EXISTS accounts_user_id_idx ON accounts (user_id);
+CREATE UNIQUE INDEX IF NOT EXISTS accounts_username_idx ON accounts (username);
+
+CREATE TABLE IF NOT EXISTS "sessions" (
+    id TEXT PRIMARY KEY,
+    username TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL,
+    last_seen TIMESTAMPTZ NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL,
+    ip TEXT NOT NULL DEFAULT '',
+    user_agent TEXT NOT NULL DEFAULT '',
+    request_id TEXT NOT NULL DEFAULT ''
+);
+CREATE INDEX IF NOT EXISTS sessions_username_idx ON sessions (username);
+
+CREATE TABLE IF NOT EXISTS "refresh_tokens" (
+    id TEXT PRIMARY KEY,
+    family_id TEXT NOT NULL,
+    username TEXT NOT NULL,
+    client_id TEXT NOT NULL DEFAULT '',
+    scope TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL,
+    used BOOLEAN NOT NULL DEFAULT FALSE
+);
+CREATE INDEX IF NOT EXISTS refresh_tokens_family_idx ON refresh_tokens (family_id);
+CREATE INDEX IF NOT EXISTS refresh_tokens_username_idx ON refresh_tokens (username);
+
+CREATE TABLE IF NOT EXISTS "revoked_tokens" (
+    id TEXT PRIMARY KEY,
+    expires_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS "access_tokens" (
+    id TEXT PRIMARY KEY,
+    username TEXT NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL
+);
+CREATE INDEX IF NOT EXISTS access_tokens_username_idx ON access_tokens (username);
+
+CREATE TABLE IF NOT EXISTS "signing_keys" (
+    id TEXT PRIMARY KEY,
+    alg TEXT NOT NULL,
+    private_key TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL,
+    retire_at TIMESTAMPTZ NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS "oauth_clients" (
+    id TEXT PRIMARY KEY,
+    name TEXT NOT NULL DEFAULT '',
+    redirect_uris TEXT[] NOT NULL DEFAULT '{}',
+    scopes TEXT[] NOT NULL DEFAULT '{}',
+    grant_types TEXT[] NOT NULL DEFAULT '{}',
+    secret_hash TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS "auth_codes" (
+    id TEXT PRIMARY KEY,
+    client_id TEXT NOT NULL,
+    username TEXT NOT NULL,
+    redirect_uri TEXT NOT NULL,
+    scope TEXT NOT NULL DEFAULT '',
+    code_challenge TEXT NOT NULL,
+    code_challenge_method TEXT NOT NULL,
+    nonce TEXT NOT NULL DEFAULT '',
+    auth_time TIMESTAMPTZ NOT NULL DEFAULT now(),
+    created_at TIMESTAMPTZ NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS "device_codes" (
+    id TEXT PRIMARY KEY,
+    user_code TEXT NOT NULL UNIQUE,
+    client_id TEXT NOT NULL,
+    scope TEXT NOT NULL DEFAULT '',
+    username TEXT NOT NULL DEFAULT '',
+    status TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL,
+    last_polled TIMESTAMPTZ
+);
+
+CREATE TABLE IF NOT EXISTS "totp" (
+    username TEXT PRIMARY KEY,
+    secret TEXT NOT NULL,
+    enabled BOOLEAN NOT NULL DEFAULT FALSE,
+    recovery_codes TEXT[] NOT NULL DEFAULT '{}',
+    last_step BIGINT NOT NULL DEFAULT 0,
+    created_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS "webauthn_credentials" (
+    id TEXT PRIMARY KEY,
+    username TEXT NOT NULL,
+    name TEXT NOT NULL DEFAULT '',
+    public_key BYTEA NOT NULL,
+    alg BIGINT NOT NULL,
+    sign_count BIGINT NOT NULL DEFAULT 0,
+    aaguid TEXT NOT NULL DEFAULT '',
+    format TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL,
+    last_used TIMESTAMPTZ NOT NULL
+);
+CREATE INDEX IF NOT EXISTS webauthn_credentials_username_idx ON webauthn_credentials (username);
+
+CREATE TABLE IF NOT EXISTS "email_verifications" (
+    username TEXT PRIMARY KEY,
+    verified BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMPTZ NOT NULL,
+    verified_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS "password_resets" (
+    id TEXT PRIMARY KEY,
+    username TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL
+);
+CREATE INDEX IF NOT EXISTS password_resets_username_idx ON password_resets (username);
+
+CREATE TABLE IF NOT EXISTS "mail_outbox" (
+    id TEXT PRIMARY KEY,
+    recipient TEXT NOT NULL,
+    subject TEXT NOT NULL,
+    text_body TEXT NOT NULL,
+    html_body TEXT NOT NULL,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    next_attempt TIMESTAMPTZ NOT NULL,
+    last_error TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL
+);
+CREATE INDEX IF NOT EXISTS mail_outbox_next_attempt_idx ON mail_outbox (next_attempt);
+
+CREATE TABLE IF NOT EXISTS "account_deletions" (
+    username TEXT PRIMARY KEY,
+    requested_at TIMESTAMPTZ NOT NULL,
+    purge_at TIMESTAMPTZ NOT NULL
+);
+CREATE INDEX IF NOT EXISTS account_deletions_purge_at_idx ON account_deletions (purge_at);